@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+// coverageReport summarises how many exported columns are anonymised.
+type coverageReport struct {
+	Tables            []tableCoverage `json:"tables"`
+	TotalColumns      int             `json:"total_columns"`
+	AnonymisedColumns int             `json:"anonymised_columns"`
+	Coverage          float64         `json:"coverage_percent"`
+}
+
+// tableCoverage is the anonymisation coverage of a single table.
+// Truncated tables export no data and are left out of the overall figures.
+type tableCoverage struct {
+	Table             string  `json:"table"`
+	TotalColumns      int     `json:"total_columns"`
+	AnonymisedColumns int     `json:"anonymised_columns"`
+	Coverage          float64 `json:"coverage_percent"`
+	Truncated         bool    `json:"truncated,omitempty"`
+}
+
+// buildCoverageReport counts, per table, the columns that have an
+// anonymisation rule. Rules for columns that do not exist are ignored.
+func buildCoverageReport(anon *anonymiser.Anonymiser, tables []schema.TableInfo) coverageReport {
+	report := coverageReport{Tables: make([]tableCoverage, 0, len(tables))}
+
+	for _, table := range tables {
+		exists := make(map[string]bool, len(table.Columns))
+		for _, col := range table.Columns {
+			exists[col.Name] = true
+		}
+
+		anonymised := 0
+		for _, col := range anon.GetAnonymisedColumns(table.Name) {
+			if exists[col] {
+				anonymised++
+			}
+		}
+
+		tc := tableCoverage{
+			Table:             table.Name,
+			TotalColumns:      len(table.Columns),
+			AnonymisedColumns: anonymised,
+			Coverage:          percentage(anonymised, len(table.Columns)),
+			Truncated:         anon.ShouldTruncate(table.Name),
+		}
+		report.Tables = append(report.Tables, tc)
+
+		if !tc.Truncated {
+			report.TotalColumns += tc.TotalColumns
+			report.AnonymisedColumns += tc.AnonymisedColumns
+		}
+	}
+
+	report.Coverage = percentage(report.AnonymisedColumns, report.TotalColumns)
+	return report
+}
+
+// percentage returns n as a percentage of total, or 0 if total is 0.
+func percentage(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// printCoverageReport writes the coverage report as a table.
+func printCoverageReport(w io.Writer, report coverageReport) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "=== Anonymisation Coverage ===")
+	for _, tc := range report.Tables {
+		if tc.Truncated {
+			fmt.Fprintf(w, "  %-30s %s\n", tc.Table, "truncated (no data)")
+			continue
+		}
+		fmt.Fprintf(w, "  %-30s %3d/%-3d columns  %5.1f%%\n", tc.Table, tc.AnonymisedColumns, tc.TotalColumns, tc.Coverage)
+	}
+	fmt.Fprintf(w, "Overall:           %d/%d columns (%.1f%%)\n", report.AnonymisedColumns, report.TotalColumns, report.Coverage)
+}
+
+// writeCoverageJSON writes the coverage report to path as JSON.
+func writeCoverageJSON(path string, report coverageReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal coverage report: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write coverage report: %w", err)
+	}
+	return nil
+}
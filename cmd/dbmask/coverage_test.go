@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+func columns(names ...string) []database.ColumnInfo {
+	cols := make([]database.ColumnInfo, len(names))
+	for i, name := range names {
+		cols[i] = database.ColumnInfo{Name: name}
+	}
+	return cols
+}
+
+func sampleCoverage() coverageReport {
+	anon := anonymiser.New(&config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"email":   config.Rule("{{faker.email}}"),
+				"name":    config.Rule("{{faker.name}}"),
+				"missing": config.Rule("{{faker.name}}"), // Not a real column, ignored
+			}},
+			"orders":   {Columns: config.ColumnRuleMap{"notes": config.Rule("REDACTED")}},
+			"sessions": {Truncate: true},
+		},
+	})
+
+	return buildCoverageReport(anon, []schema.TableInfo{
+		{Name: "users", Columns: columns("id", "email", "name", "created_at")},
+		{Name: "orders", Columns: columns("id", "user_id", "total", "notes")},
+		{Name: "products", Columns: columns("id", "title")},
+		{Name: "sessions", Columns: columns("id", "token", "payload")},
+	})
+}
+
+func TestBuildCoverageReport(t *testing.T) {
+	report := sampleCoverage()
+
+	want := []tableCoverage{
+		{Table: "users", TotalColumns: 4, AnonymisedColumns: 2, Coverage: 50},
+		{Table: "orders", TotalColumns: 4, AnonymisedColumns: 1, Coverage: 25},
+		{Table: "products", TotalColumns: 2, AnonymisedColumns: 0, Coverage: 0},
+		{Table: "sessions", TotalColumns: 3, AnonymisedColumns: 0, Coverage: 0, Truncated: true},
+	}
+	if len(report.Tables) != len(want) {
+		t.Fatalf("Tables = %+v, want %+v", report.Tables, want)
+	}
+	for i := range want {
+		if report.Tables[i] != want[i] {
+			t.Errorf("Tables[%d] = %+v, want %+v", i, report.Tables[i], want[i])
+		}
+	}
+
+	// Truncated tables are left out of the overall figures: 3 of 10 columns
+	if report.TotalColumns != 10 || report.AnonymisedColumns != 3 {
+		t.Errorf("overall = %d/%d, want 3/10", report.AnonymisedColumns, report.TotalColumns)
+	}
+	if math.Abs(report.Coverage-30) > 1e-9 {
+		t.Errorf("Coverage = %v, want 30", report.Coverage)
+	}
+}
+
+func TestBuildCoverageReport_NoColumns(t *testing.T) {
+	report := buildCoverageReport(anonymiser.New(&config.Config{}), nil)
+	if report.Coverage != 0 || report.TotalColumns != 0 {
+		t.Errorf("empty report = %+v", report)
+	}
+}
+
+func TestPrintCoverageReport(t *testing.T) {
+	var buf bytes.Buffer
+	printCoverageReport(&buf, sampleCoverage())
+
+	output := buf.String()
+	for _, want := range []string{
+		"=== Anonymisation Coverage ===",
+		"2/4   columns   50.0%",
+		"truncated (no data)",
+		"Overall:           3/10 columns (30.0%)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestWriteCoverageJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	if err := writeCoverageJSON(path, sampleCoverage()); err != nil {
+		t.Fatalf("writeCoverageJSON() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+
+	var report coverageReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Coverage != 30 || len(report.Tables) != 4 {
+		t.Errorf("report = %+v", report)
+	}
+	if !strings.Contains(string(data), `"coverage_percent": 30`) {
+		t.Errorf("JSON missing coverage_percent, got:\n%s", data)
+	}
+}
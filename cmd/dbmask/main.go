@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/fktracker"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+	"github.com/elliotjreed/database-anonymiser-minimiser/pkg/dbmask"
 )
 
 var (
@@ -21,10 +29,63 @@ var (
 	version = "dev"
 
 	configPath   string
-	outputPath   string
+	outputs      []string
+	formatList   string
 	verbose      bool
 	dryRun       bool
 	syncTruncate bool
+	syncPrune    bool
+	syncSuggest  bool
+	profile      bool
+
+	allowUnsafeWhere bool
+	reuseBuffers     bool
+	lenient          bool
+	skipAutoInc      bool
+	materialise      bool
+	resumeOnError    bool
+	keyset           bool
+	verifyFK         bool
+	quoteMode        string
+	maxErrors        int
+	rowsLimitTotal   int64
+	continueOnError  bool
+	mysqldumpCompat  bool
+	strictRules      bool
+	schemaOnly       bool
+	refresh          bool
+	dumpSequences    bool
+	coverageJSON     string
+	fromDate         string
+	connectionFile   string
+	parallelBatches  int
+	sortTables       string
+	fkManifest       string
+	readThreads      int
+	writeThreads     int
+	writeFKManifest  string
+	safeMode         bool
+	allowHosts       []string
+	denyHosts        []string
+	dumpCharset      string
+	preview          int
+	quoteDecimals    bool
+	consistencyStore string
+	checkpointPath   string
+	sinceFile        string
+	schemaOnlyTables []string
+	lineEndings      string
+	insertStyle      string
+	statsJSON        string
+	noFKChecks       bool
+	schemaFile       string
+	dataFile         string
+	onlyAnonymised   bool
+	maxRowSize       int
+	maxInsertSize    int
+	oversizedRows    string
+	failIfEmpty      bool
+	configProfile    string
 )
 
 func main() {
@@ -39,10 +100,61 @@ Supports MySQL, PostgreSQL, and SQLite databases.`,
 	}
 
 	rootCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to config file (required)")
-	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path (default: stdout)")
+	rootCmd.Flags().StringArrayVarP(&outputs, "output", "o", nil, "Output file path or s3://bucket/key, one for each --format, repeated for several (default: stdout)")
+	rootCmd.Flags().StringVar(&formatList, "format", string(exporter.FormatSQL), "Output formats, comma-separated: sql, ndjson, params (e.g. sql,ndjson with two --output paths)")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without executing")
+	rootCmd.Flags().IntVar(&preview, "preview", 0, "Print N rows of each anonymised table before and after anonymisation, without exporting")
+	rootCmd.Flags().StringVar(&fromDate, "from-date", "", "Override the after_date of every date-based retain (e.g. 2024-01-01)")
+	rootCmd.Flags().BoolVar(&schemaOnly, "schema-only", false, "Export table structure only, without rows (alias: --no-data)")
+	rootCmd.Flags().BoolVar(&refresh, "refresh", false, "Empty existing tables with TRUNCATE TABLE instead of DROP and CREATE")
+	rootCmd.Flags().BoolVar(&dumpSequences, "dump-sequences", true, "Export Postgres standalone sequences before the tables")
+	rootCmd.Flags().BoolVar(&strictRules, "strict", false, "Treat anonymisation rule warnings as errors")
+	rootCmd.Flags().BoolVar(&lenient, "lenient", false, "Ignore unknown keys in the config file")
+	rootCmd.Flags().StringVar(&connectionFile, "connection-file", "", "YAML/JSON file with the connection block, overriding the config's connection")
+	rootCmd.Flags().StringVar(&configProfile, "config-profile", "", "Profile in the config whose connection and table values override the rest, e.g. ci")
+	rootCmd.Flags().BoolVar(&profile, "profile", false, "Print per-phase timing to stderr")
+	rootCmd.Flags().BoolVar(&reuseBuffers, "reuse-buffers", false, "Stream rows through reusable buffers to reduce allocations")
+	rootCmd.Flags().IntVar(&parallelBatches, "parallel-batches", 0, "Number of batches to read ahead while writing (0 = read and write serially)")
+	rootCmd.Flags().IntVar(&readThreads, "threads-read", 1, "Batches in flight while reading; N-1 are read ahead of the writer (1 = serial)")
+	rootCmd.Flags().IntVar(&writeThreads, "threads-write", 1, "Goroutines formatting INSERT statements for the writer (1 = serial)")
+	rootCmd.Flags().BoolVar(&skipAutoInc, "skip-autoincrement", false, "Omit auto-increment columns from INSERT statements")
+	rootCmd.Flags().BoolVar(&materialise, "materialise-generated", false, "Insert generated column values and create them as plain columns")
+	rootCmd.Flags().BoolVar(&resumeOnError, "resume-on-error", false, "Resume a table stream by primary key after a lost connection or deadlock")
+	rootCmd.Flags().BoolVar(&keyset, "keyset", false, "Page through tables by primary key instead of one large query")
+	rootCmd.Flags().StringVar(&coverageJSON, "coverage-json", "", "Write the anonymisation coverage report to this file as JSON")
+	rootCmd.Flags().StringVar(&statsJSON, "stats-json", "", "Write the export statistics to this file as JSON (- for stdout)")
+	rootCmd.Flags().BoolVar(&verifyFK, "verify-fk", false, "Report foreign key values in the dump that reference missing rows")
+	rootCmd.Flags().StringVar(&fkManifest, "fk-manifest", "", "Drop child rows whose parent is in neither this prior dump manifest nor the dump")
+	rootCmd.Flags().StringVar(&writeFKManifest, "write-fk-manifest", "", "Write the parent keys in the dump to this manifest file")
+	rootCmd.Flags().IntVar(&maxErrors, "max-errors", 0, "Number of tables that may fail before the export is aborted")
+	rootCmd.Flags().Int64Var(&rowsLimitTotal, "rows-limit-total", 0, "Abort the export rather than write more than this many rows in total (0 = no limit)")
+	rootCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Skip every table that fails to export instead of aborting")
+	rootCmd.Flags().BoolVar(&mysqldumpCompat, "mysqldump-compat", false, "Format MySQL dumps like mysqldump's default output")
+	rootCmd.Flags().StringVar(&lineEndings, "line-endings", string(exporter.LineEndingLF), "Line endings of the SQL dump: lf, or crlf")
+	rootCmd.Flags().StringVar(&insertStyle, "insert-style", string(exporter.InsertMultiline), "INSERT layout: multiline (one row per line), or compact (one line per statement)")
+	rootCmd.Flags().IntVar(&maxRowSize, "max-row-size", 0, "Warn about rows whose values take more than this many bytes in the dump, naming their primary key (0 = no limit)")
+	rootCmd.Flags().IntVar(&maxInsertSize, "max-insert-size", exporter.DefaultMaxInsertSize, "Start another INSERT statement before one takes more than this many bytes")
+	rootCmd.Flags().StringVar(&oversizedRows, "oversized-rows", string(exporter.OversizedWarn), "What to do with rows over --max-row-size: warn (write them), or skip (leave them out)")
+	rootCmd.Flags().BoolVar(&quoteDecimals, "quote-decimals", false, "Write DECIMAL and NUMERIC values as quoted strings instead of numeric literals")
+	rootCmd.Flags().StringVar(&consistencyStore, "consistency-store", "", "Keep the fakes given to original values in this SQLite file, reusing them between exports")
+	rootCmd.Flags().StringVar(&schemaFile, "schema-file", "", "Write the schema of the SQL dump to this file, and its rows to --data-file")
+	rootCmd.Flags().StringVar(&dataFile, "data-file", "", "Write the rows of the SQL dump to this file, and its schema to --schema-file")
+	rootCmd.Flags().StringVar(&checkpointPath, "checkpoint", "", "Save progress to this file, and resume from it when an earlier export was interrupted")
+	rootCmd.Flags().StringVar(&sinceFile, "since-file", "", "Export only rows changed since the export recorded in this file (tables with an updated_column), then record this one")
+	rootCmd.Flags().StringVar(&dumpCharset, "dump-charset", "", "Character set MySQL data is read and dumped in, overriding the connection's charset (default utf8mb4)")
+	rootCmd.Flags().BoolVar(&failIfEmpty, "fail-if-empty", false, "Fail if no rows are exported from any table, e.g. because of a wrong database or filter")
+	rootCmd.Flags().BoolVar(&onlyAnonymised, "only-anonymised", false, "Export only the tables with anonymisation rules, and the tables they reference")
+	rootCmd.Flags().StringSliceVar(&schemaOnlyTables, "schema-only-tables", nil, "Table glob patterns to export as schema only, e.g. \"audit_*,log_*\", overriding the config")
+	rootCmd.Flags().BoolVar(&noFKChecks, "no-foreign-key-checks", true, "Turn foreign key checks off while the dump is restored (=false leaves them on)")
+	rootCmd.Flags().StringVar(&sortTables, "sort-tables", string(schema.SortDependency), "Table order: dependency, alpha, or none (discovery order)")
+	rootCmd.Flags().StringVar(&quoteMode, "quote", string(database.QuoteAlways), "Identifier quoting: always, or minimal (reserved words and special characters only)")
+	rootCmd.Flags().BoolVar(&allowUnsafeWhere, "allow-unsafe-where", false, "Skip the safety check on where: filters")
+	rootCmd.Flags().BoolVar(&safeMode, "safe-mode", false, "Refuse to connect to hosts matching the deny list (default *prod*)")
+	rootCmd.Flags().StringSliceVar(&allowHosts, "allow-hosts", nil, "Host glob patterns allowed in safe mode, added to the config's allow_hosts")
+	rootCmd.Flags().StringSliceVar(&denyHosts, "deny-hosts", nil, "Host glob patterns refused in safe mode, added to the config's deny_hosts")
 
+	rootCmd.Flags().SetNormalizeFunc(flagAliases(map[string]string{"no-data": "schema-only"}))
 	rootCmd.MarkFlagRequired("config")
 
 	versionCmd := &cobra.Command{
@@ -68,15 +180,85 @@ Use --truncate to add new tables with truncate: true instead.`,
 	syncCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to config file (required)")
 	syncCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
 	syncCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be added without modifying the file")
-	syncCmd.Flags().BoolVar(&syncTruncate, "truncate", false, "Add new tables with truncate: true")
+	syncCmd.Flags().BoolVar(&syncTruncate, "truncate", false, "Add new tables with truncate: true (alias: --no-data)")
+	syncCmd.Flags().BoolVar(&syncPrune, "prune", false, "Remove configured tables that are no longer in the database")
+	syncCmd.Flags().BoolVar(&syncSuggest, "suggest-rules", false, "Pre-fill column rules for new tables from their column names")
+	syncCmd.Flags().BoolVar(&lenient, "lenient", false, "Ignore unknown keys in the config file")
+	syncCmd.Flags().StringVar(&connectionFile, "connection-file", "", "YAML/JSON file with the connection block, overriding the config's connection")
+	syncCmd.Flags().SetNormalizeFunc(flagAliases(map[string]string{"no-data": "truncate"}))
 	syncCmd.MarkFlagRequired("config")
 	rootCmd.AddCommand(syncCmd)
 
+	listTablesCmd := &cobra.Command{
+		Use:   "list-tables",
+		Short: "List database tables with row counts and config status",
+		Long: `Connects to the database and lists each table with its row count,
+whether it is present in the configuration file, and the action that
+an export would take (truncate, retain, full, anonymised).
+
+This command is read-only and never modifies the configuration file.`,
+		RunE: runListTables,
+	}
+	listTablesCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to config file (required)")
+	listTablesCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
+	listTablesCmd.Flags().BoolVar(&lenient, "lenient", false, "Ignore unknown keys in the config file")
+	listTablesCmd.Flags().StringVar(&connectionFile, "connection-file", "", "YAML/JSON file with the connection block, overriding the config's connection")
+	listTablesCmd.Flags().StringVar(&configProfile, "config-profile", "", "Profile in the config whose connection and table values override the rest, e.g. ci")
+	listTablesCmd.MarkFlagRequired("config")
+	rootCmd.AddCommand(listTablesCmd)
+
+	checkFKCmd := &cobra.Command{
+		Use:   "check-fk",
+		Short: "Report foreign keys broken by rows in the source database",
+		Long: `Connects to the database and, for each foreign key, counts the rows
+whose value references a row missing from the referenced table.
+
+Use it before relying on foreign key filtering (--verify-fk, --fk-manifest)
+to find inconsistencies that are already in the source. Exits non-zero if
+any are found. This command is read-only.`,
+		RunE: runCheckFK,
+	}
+	checkFKCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to config file (required)")
+	checkFKCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
+	checkFKCmd.Flags().BoolVar(&lenient, "lenient", false, "Ignore unknown keys in the config file")
+	checkFKCmd.Flags().StringVar(&connectionFile, "connection-file", "", "YAML/JSON file with the connection block, overriding the config's connection")
+	checkFKCmd.Flags().StringVar(&configProfile, "config-profile", "", "Profile in the config whose connection and table values override the rest, e.g. ci")
+	checkFKCmd.MarkFlagRequired("config")
+	rootCmd.AddCommand(checkFKCmd)
+
+	testConnectionCmd := &cobra.Command{
+		Use:   "test-connection",
+		Short: "Check that the database in the config file can be reached",
+		Long: `Loads the configuration file, connects to the database and closes
+the connection again, reporting whether it succeeded and how long it took.
+
+No tables are listed or exported.`,
+		RunE: runTestConnection,
+	}
+	testConnectionCmd.Flags().StringVarP(&configPath, "config", "c", "", "Path to config file (required)")
+	testConnectionCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
+	testConnectionCmd.Flags().BoolVar(&lenient, "lenient", false, "Ignore unknown keys in the config file")
+	testConnectionCmd.Flags().StringVar(&connectionFile, "connection-file", "", "YAML/JSON file with the connection block, overriding the config's connection")
+	testConnectionCmd.Flags().StringVar(&configProfile, "config-profile", "", "Profile in the config whose connection and table values override the rest, e.g. ci")
+	testConnectionCmd.MarkFlagRequired("config")
+	rootCmd.AddCommand(testConnectionCmd)
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// flagAliases returns a flag normalization function that maps each alias to
+// its flag name, so that e.g. --no-data behaves exactly like --schema-only.
+func flagAliases(aliases map[string]string) func(*pflag.FlagSet, string) pflag.NormalizedName {
+	return func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if target, ok := aliases[name]; ok {
+			name = target
+		}
+		return pflag.NormalizedName(name)
+	}
+}
+
 func runExport(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
 
@@ -89,95 +271,308 @@ func runExport(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Loading configuration from: %s\n", configPath)
 	}
 
-	cfg, err := config.Load(configPath)
+	cfg, err := config.LoadWithOptions(configPath, config.LoadOptions{Lenient: lenient, ConnectionFile: connectionFile, Profile: configProfile})
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	if refresh && schemaOnly {
+		return fmt.Errorf("--refresh cannot be used with --schema-only")
+	}
+
+	var fromTime time.Time
+	if fromDate != "" {
+		fromTime, err = config.ParseDate(fromDate)
+		if err != nil {
+			return fmt.Errorf("invalid --from-date %q: %w", fromDate, err)
+		}
+	}
+
+	// Reject where: filters that look like injected statements
+	if !allowUnsafeWhere {
+		if err := cfg.ValidateWhereClauses(); err != nil {
+			return fmt.Errorf("unsafe where filter (use --allow-unsafe-where to override): %w", err)
+		}
+	}
+
 	// Create anonymiser and validate rules
 	anon := anonymiser.New(cfg)
 	if errors := anon.ValidateRules(); len(errors) > 0 {
 		for _, e := range errors {
 			fmt.Fprintf(os.Stderr, "Warning: %s\n", e)
 		}
+		if strictRules {
+			return fmt.Errorf("%d anonymisation rule warnings (--strict)", len(errors))
+		}
 	}
 
-	// Create database driver
-	if verbose {
-		fmt.Printf("Connecting to %s database...\n", cfg.Connection.Type)
+	readThreads = clampThreads("threads-read", readThreads)
+	writeThreads = clampThreads("threads-write", writeThreads)
+	if (parallelBatches > 0 || readThreads > 1 || writeThreads > 1) && reuseBuffers {
+		fmt.Fprintln(os.Stderr, "Warning: --parallel-batches and --threads-* have no effect with --reuse-buffers")
 	}
 
-	driver, err := database.NewDriver(cfg.Connection.Type)
+	if mysqldumpCompat && cfg.Connection.Type != "mysql" {
+		fmt.Fprintf(os.Stderr, "Warning: --mysqldump-compat has no effect for %s databases\n", cfg.Connection.Type)
+	}
+
+	if dumpCharset != "" {
+		if cfg.Connection.Type != "mysql" {
+			fmt.Fprintf(os.Stderr, "Warning: --dump-charset has no effect for %s databases\n", cfg.Connection.Type)
+		} else {
+			cfg.Connection.Charset = dumpCharset
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("invalid --dump-charset: %w", err)
+			}
+		}
+	}
+
+	mode, err := database.ParseQuoteMode(quoteMode)
 	if err != nil {
 		return err
 	}
 
-	if err := driver.Connect(&cfg.Connection); err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+	lineEnding, err := exporter.ParseLineEnding(lineEndings)
+	if err != nil {
+		return err
 	}
-	defer driver.Close()
-
-	// Analyze schema
-	if verbose {
-		fmt.Println("Analyzing database schema...")
+	style, err := exporter.ParseInsertStyle(insertStyle)
+	if err != nil {
+		return err
+	}
+	if style == exporter.InsertCompact && mysqldumpCompat {
+		fmt.Fprintln(os.Stderr, "Warning: --insert-style has no effect with --mysqldump-compat, whose INSERTs are always compact")
 	}
 
-	analyzer := schema.NewAnalyser(driver)
-	tables, err := analyzer.GetAllTables()
+	oversized, err := exporter.ParseOversizedRowAction(oversizedRows)
 	if err != nil {
-		return fmt.Errorf("failed to analyze schema: %w", err)
+		return err
 	}
 
-	// Sort tables by dependencies
-	if verbose {
-		fmt.Println("Sorting tables by foreign key dependencies...")
+	formats, err := exporter.ParseFormats(formatList)
+	if err != nil {
+		return err
+	}
+	paths, err := schemaDataPaths(formats, outputs, schemaFile, dataFile)
+	if err != nil {
+		return err
+	}
+	if dataFile != "" && checkpointPath != "" {
+		return fmt.Errorf("--checkpoint cannot be used with --schema-file and --data-file")
+	}
+	if err := checkStatsJSONPath(statsJSON, paths); err != nil {
+		return err
 	}
 
-	sortedTables, err := analyzer.SortTablesByDependency(tables)
+	sortOrder, err := schema.ParseSortOrder(sortTables)
 	if err != nil {
-		return fmt.Errorf("failed to sort tables: %w", err)
+		return err
+	}
+	if sortOrder != schema.SortDependency {
+		// These rely on each table being exported after the tables it references
+		for _, dep := range []struct {
+			flag string
+			set  bool
+		}{{"--fk-manifest", fkManifest != ""}, {"--verify-fk", verifyFK}, {"--refresh", refresh}} {
+			if dep.set {
+				return fmt.Errorf("%s requires --sort-tables %s, not %s", dep.flag, schema.SortDependency, sortOrder)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Warning: tables are exported in %s order, restoring the dump may fail where foreign keys are enforced\n", sortOrder)
+	}
+	if !noFKChecks && refresh {
+		fmt.Fprintln(os.Stderr, "Warning: with --no-foreign-key-checks=false, restoring a --refresh dump fails to empty tables that other tables reference")
+	}
+
+	cfg.SafeMode = cfg.SafeMode || safeMode
+	if err := addHostPatterns(cfg, allowHosts, denyHosts); err != nil {
+		return err
+	}
+
+	if len(schemaOnlyTables) > 0 {
+		cfg.SchemaOnlyTables = append(cfg.SchemaOnlyTables, schemaOnlyTables...)
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid --schema-only-tables: %w", err)
+		}
+	}
+
+	// Export only the rows changed since the previous incremental export
+	var since time.Time
+	if sinceFile != "" {
+		since, err = readSinceFile(sinceFile)
+		if err != nil {
+			return err
+		}
+		if !hasUpdatedColumn(cfg) {
+			fmt.Fprintln(os.Stderr, "Warning: no table has an updated_column, --since-file exports every row")
+		} else if verbose && !since.IsZero() {
+			fmt.Printf("Exporting rows changed since: %s\n", since.Format(time.RFC3339))
+		}
+	}
+
+	// Progress and policy table warnings go to stdout, unless the dump does
+	var log io.Writer = os.Stdout
+	if slices.Contains(paths, "") {
+		log = os.Stderr
+	}
+
+	opts := dbmask.Options{
+		SortOrder: sortOrder,
+		QuoteMode: mode,
+		DryRun:    dryRun,
+		Export: exporter.Options{
+			Verbose:              verbose,
+			Log:                  log,
+			BatchSize:            1000,
+			ReuseBuffers:         reuseBuffers,
+			ParallelBatches:      parallelBatches,
+			ReadThreads:          readThreads,
+			WriteThreads:         writeThreads,
+			SkipAutoIncrement:    skipAutoInc,
+			MaterialiseGenerated: materialise,
+			ResumeOnError:        resumeOnError,
+			Keyset:               keyset,
+			VerifyFK:             verifyFK,
+			FKManifest:           fkManifest,
+			WriteFKManifest:      writeFKManifest,
+			MaxErrors:            maxErrors,
+			RowsLimitTotal:       rowsLimitTotal,
+			ContinueOnError:      continueOnError,
+			MysqldumpCompat:      mysqldumpCompat,
+			SchemaOnly:           schemaOnly,
+			Refresh:              refresh,
+			DumpSequences:        dumpSequences,
+			FromDate:             fromTime,
+			QuoteDecimals:        quoteDecimals,
+			Since:                since,
+			KeepForeignKeyChecks: !noFKChecks,
+			LineEnding:           lineEnding,
+			InsertStyle:          style,
+			MaxRowSize:           maxRowSize,
+			MaxInsertSize:        maxInsertSize,
+			OversizedRows:        oversized,
+			FailIfEmpty:          failIfEmpty,
+		},
+		OnlyAnonymised: onlyAnonymised,
+		Strict:         strictRules,
+	}
+
+	// Preview mode
+	if preview > 0 {
+		return runPreview(os.Stdout, cfg, anon, preview)
 	}
 
 	// Dry run mode
 	if dryRun {
-		return printDryRun(sortedTables, anon)
+		stats, err := dbmask.Export(context.Background(), cfg, io.Discard, opts)
+		if err != nil {
+			return err
+		}
+		return printDryRun(os.Stdout, stats.Tables, anonymiser.New(stats.Config), fromTime)
 	}
 
-	// Determine output
-	var output *os.File
-	if outputPath != "" {
-		output, err = os.Create(outputPath)
+	// Resume an interrupted export where its checkpoint left off
+	var resume *exporter.Checkpoint
+	if checkpointPath != "" {
+		if err := checkpointOutputs(paths); err != nil {
+			return err
+		}
+		resume, err = exporter.LoadCheckpoint(checkpointPath)
 		if err != nil {
-			return fmt.Errorf("failed to create output file: %w", err)
+			return err
+		}
+		if resume != nil && consistencyStore == "" {
+			fmt.Fprintln(os.Stderr, "Warning: resuming without --consistency-store, fakes may differ from those already exported")
 		}
-		defer output.Close()
+		opts.Export.Checkpoint = checkpointPath
+	}
 
-		if verbose {
-			fmt.Printf("Writing output to: %s\n", outputPath)
+	// Keep fakes in a file, shared with earlier and later exports
+	var store dbmask.FileStore
+	if consistencyStore != "" {
+		store, err = dbmask.NewSQLiteStore(consistencyStore)
+		if err != nil {
+			return err
 		}
-	} else {
-		output = os.Stdout
+		opts.ConsistencyStore = store
 	}
 
-	// Export
-	if verbose {
-		fmt.Printf("Exporting %d tables...\n", len(sortedTables))
+	// Open an output for each format, read from the same pass over the data
+	var sqlOutput io.Writer = io.Discard
+	opened := make([]*exportOutput, 0, len(formats))
+	for i, format := range formats {
+		var output *exportOutput
+		switch {
+		case resume == nil:
+			output, err = openOutput(paths[i])
+		case format == exporter.FormatNDJSON:
+			output, err = resumeOutput(paths[i], resume.NDJSONOffset)
+		case format == exporter.FormatParams:
+			output, err = resumeOutput(paths[i], resume.ParamsOffset)
+		default:
+			output, err = resumeOutput(paths[i], resume.SQLOffset)
+		}
+		if err != nil {
+			for _, o := range opened {
+				o.finish(err)
+			}
+			if store != nil {
+				store.Close()
+			}
+			return err
+		}
+		opened = append(opened, output)
+
+		switch format {
+		case exporter.FormatSQL:
+			sqlOutput = output
+		case exporter.FormatNDJSON:
+			opts.Export.NDJSON = output
+		case exporter.FormatParams:
+			opts.Export.Params = output
+		}
 	}
 
-	exp := exporter.New(driver, anon, output, exporter.Options{
-		Verbose:   verbose,
-		BatchSize: 1000,
-	})
+	// Write the rows of the SQL dump to their own file
+	if dataFile != "" {
+		output, err := openOutput(dataFile)
+		if err != nil {
+			for _, o := range opened {
+				o.finish(err)
+			}
+			if store != nil {
+				store.Close()
+			}
+			return err
+		}
+		opened = append(opened, output)
+		opts.Export.Data = output
+	}
 
-	if err := exp.Export(sortedTables); err != nil {
-		return fmt.Errorf("export failed: %w", err)
+	stats, err := dbmask.Export(context.Background(), cfg, sqlOutput, opts)
+
+	// Complete the uploads before reporting success
+	for _, output := range opened {
+		if finishErr := output.finish(err); err == nil {
+			err = finishErr
+		}
+	}
+	if store != nil {
+		if closeErr := store.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
 	}
 
+	// Report on the rules merged from the policy table too
+	anon = anonymiser.New(stats.Config)
+
 	// Collect final statistics
 	elapsed := time.Since(startTime)
 	var memStatsAfter runtime.MemStats
 	runtime.ReadMemStats(&memStatsAfter)
-	stats := exp.GetStats()
 
 	// Print statistics
 	fmt.Fprintln(os.Stderr)
@@ -185,11 +580,58 @@ func runExport(cmd *cobra.Command, args []string) error {
 	fmt.Fprintf(os.Stderr, "Tables exported:   %d\n", stats.TablesExported)
 	fmt.Fprintf(os.Stderr, "Tables truncated:  %d\n", stats.TablesTruncated)
 	fmt.Fprintf(os.Stderr, "Rows exported:     %d\n", stats.RowsExported)
+	if fkManifest != "" || stats.RowsFiltered > 0 {
+		fmt.Fprintf(os.Stderr, "Rows filtered:     %d\n", stats.RowsFiltered)
+	}
+	if stats.RowsOversized > 0 {
+		fmt.Fprintf(os.Stderr, "Rows oversized:    %d (%d skipped)\n", stats.RowsOversized, stats.RowsSkipped)
+	}
 	fmt.Fprintf(os.Stderr, "Run time:          %s\n", elapsed.Round(time.Millisecond))
 	fmt.Fprintf(os.Stderr, "Memory used:       %s\n", formatBytes(memStatsAfter.TotalAlloc-memStatsBefore.TotalAlloc))
 	fmt.Fprintf(os.Stderr, "Peak memory:       %s\n", formatBytes(memStatsAfter.HeapAlloc))
 	fmt.Fprintf(os.Stderr, "CPU cores used:    %d\n", runtime.NumCPU())
 
+	if statsJSON != "" {
+		if err := writeStatsJSON(statsJSON, buildStatsReport(stats.Stats, elapsed, memStatsAfter.HeapAlloc)); err != nil {
+			return err
+		}
+	}
+
+	if profile {
+		printProfile(stats.AnalysisDuration, stats.SortDuration, stats.Tables, stats.Stats)
+	}
+
+	coverage := buildCoverageReport(anon, stats.Tables)
+	printCoverageReport(os.Stderr, coverage)
+	if coverageJSON != "" {
+		if err := writeCoverageJSON(coverageJSON, coverage); err != nil {
+			return err
+		}
+	}
+
+	charset := cfg.Connection.Charset
+	if charset == "" {
+		charset = exporter.DefaultDumpCharset
+	}
+	printCharsetMismatches(os.Stderr, stats.CharsetMismatches, charset)
+
+	// Report both orphans and failed tables before failing on either
+	var orphanErr error
+	if verifyFK {
+		orphanErr = reportOrphans(stats.Orphans)
+	}
+	if err := errors.Join(orphanErr, reportTableErrors(stats.TableErrors)); err != nil {
+		return err
+	}
+
+	// Record this export for the next incremental one, from the time it
+	// started so that rows changed while it ran are not missed
+	if sinceFile != "" {
+		if err := writeSinceFile(sinceFile, startTime); err != nil {
+			return err
+		}
+	}
+
 	if verbose {
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintln(os.Stderr, "Export completed successfully!")
@@ -198,30 +640,126 @@ func runExport(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func printDryRun(tables []schema.TableInfo, anon *anonymiser.Anonymiser) error {
-	fmt.Println("=== DRY RUN MODE ===")
-	fmt.Printf("Found %d tables\n\n", len(tables))
+// hasUpdatedColumn reports whether any table has an updated_column for
+// incremental exports to filter on.
+func hasUpdatedColumn(cfg *config.Config) bool {
+	for _, tableCfg := range cfg.Configuration {
+		if tableCfg != nil && tableCfg.UpdatedColumn != "" {
+			return true
+		}
+	}
+	return false
+}
 
+// printProfile prints the time spent in each phase of the export to stderr.
+func printProfile(analysis, sorting time.Duration, tables []schema.TableInfo, stats exporter.Stats) {
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "=== Profile ===")
+	fmt.Fprintf(os.Stderr, "Schema analysis:   %s\n", analysis.Round(time.Millisecond))
+	fmt.Fprintf(os.Stderr, "Dependency sort:   %s\n", sorting.Round(time.Millisecond))
+	fmt.Fprintln(os.Stderr, "Table export:")
 	for _, table := range tables {
-		fmt.Printf("Table: %s\n", table.Name)
-		fmt.Printf("  Rows: %d\n", table.RowCount)
+		if d, ok := stats.TableDurations[table.Name]; ok {
+			fmt.Fprintf(os.Stderr, "  %-30s %s\n", table.Name, d.Round(time.Millisecond))
+		}
+	}
+}
+
+// reportTableErrors prints the tables that failed to export to stderr and
+// returns an error if there are any.
+func reportTableErrors(tableErrors []exporter.TableError) error {
+	if len(tableErrors) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "=== Failed Tables ===")
+	for _, te := range tableErrors {
+		fmt.Fprintf(os.Stderr, "  %-30s %v\n", te.Table, te.Err)
+	}
+
+	return fmt.Errorf("%d tables failed to export", len(tableErrors))
+}
+
+// clampThreads limits a --threads-* flag value to the exporter's bounds,
+// warning when it is changed.
+func clampThreads(flag string, n int) int {
+	clamped := exporter.ClampThreads(n)
+	if clamped != n {
+		fmt.Fprintf(os.Stderr, "Warning: --%s %d is out of range, using %d\n", flag, n, clamped)
+	}
+	return clamped
+}
+
+// printCharsetMismatches warns about MySQL columns whose character set
+// differs from the dump's charset, suggesting the SET NAMES their table's
+// rows could be restored under instead.
+func printCharsetMismatches(w io.Writer, mismatches []exporter.CharsetMismatch, charset string) {
+	if len(mismatches) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "=== Character Set Check ===")
+	for _, m := range mismatches {
+		fmt.Fprintf(w, "  %-30s %-10s (consider SET NAMES %s around this table's rows)\n", m.Table+"."+m.Column, m.Charset, m.Charset)
+	}
+	fmt.Fprintf(w, "Warning: %d columns use a character set other than the dump's (%s); their values are converted on restore and may not round-trip\n", len(mismatches), charset)
+}
+
+// reportOrphans prints dangling foreign key references to stderr and returns
+// an error if there are any.
+func reportOrphans(orphans []fktracker.Orphan) error {
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "=== Foreign Key Verification ===")
+	if len(orphans) == 0 {
+		fmt.Fprintln(os.Stderr, "No orphaned foreign key references found")
+		return nil
+	}
+
+	for _, orphan := range orphans {
+		fmt.Fprintf(os.Stderr, "  %s\n", orphan)
+	}
+
+	return fmt.Errorf("found %d orphaned foreign key references", len(orphans))
+}
+
+// printDryRun writes the tables an export would write to w, with the
+// action and anonymised columns of each.
+func printDryRun(w io.Writer, tables []schema.TableInfo, anon *anonymiser.Anonymiser, fromDate time.Time) error {
+	fmt.Fprintln(w, "=== DRY RUN MODE ===")
+	fmt.Fprintf(w, "Found %d tables\n\n", len(tables))
+
+	for _, table := range tables {
+		fmt.Fprintf(w, "Table: %s\n", table.Name)
+		fmt.Fprintf(w, "  Rows: %d\n", table.RowCount)
 
 		if anon.ShouldTruncate(table.Name) {
-			fmt.Println("  Action: TRUNCATE (no data will be exported)")
+			fmt.Fprintln(w, "  Action: TRUNCATE (no data will be exported)")
 		} else if retainCfg := anon.GetRetainConfig(table.Name); retainCfg.IsDateBased() {
-			fmt.Printf("  Action: RETAIN rows where %s > %s\n",
-				retainCfg.ColumnName, retainCfg.AfterDate.Format("2006-01-02"))
+			afterDate := retainCfg.AfterDate
+			if !fromDate.IsZero() {
+				afterDate = fromDate
+			}
+			fmt.Fprintf(w, "  Action: RETAIN rows where %s > %s\n",
+				retainCfg.ColumnName, afterDate.Format("2006-01-02"))
 		} else if retainCfg.IsCountBased() {
-			fmt.Printf("  Action: RETAIN %d rows\n", retainCfg.Count)
+			fmt.Fprintf(w, "  Action: RETAIN %d rows\n", retainCfg.Count)
+		} else if retainCfg.IsFollow() {
+			fmt.Fprintf(w, "  Action: RETAIN rows referencing exported %s rows\n", retainCfg.Follow)
 		} else {
-			fmt.Println("  Action: FULL EXPORT")
+			fmt.Fprintln(w, "  Action: FULL EXPORT")
+		}
+
+		if where := anon.GetWhere(table.Name); where != "" {
+			fmt.Fprintf(w, "  Filter: WHERE %s\n", where)
 		}
 
 		if cols := anon.GetAnonymisedColumns(table.Name); len(cols) > 0 {
-			fmt.Printf("  Anonymised columns: %v\n", cols)
+			fmt.Fprintf(w, "  Anonymised columns: %v\n", cols)
 		}
 
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	return nil
@@ -233,14 +771,18 @@ func runSync(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Loading configuration from: %s\n", configPath)
 	}
 
-	cfg, err := config.Load(configPath)
+	cfg, err := config.LoadWithOptions(configPath, config.LoadOptions{Lenient: lenient, ConnectionFile: connectionFile})
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Create database driver
 	if verbose {
-		fmt.Printf("Connecting to %s database...\n", cfg.Connection.Type)
+		fmt.Printf("Connecting to %s...\n", cfg.Connection.SafeString())
+	}
+
+	if err := cfg.CheckHost(); err != nil {
+		return err
 	}
 
 	driver, err := database.NewDriver(cfg.Connection.Type)
@@ -249,7 +791,7 @@ func runSync(cmd *cobra.Command, args []string) error {
 	}
 
 	if err := driver.Connect(&cfg.Connection); err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err
 	}
 	defer driver.Close()
 
@@ -263,26 +805,53 @@ func runSync(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get tables: %w", err)
 	}
 
-	// Find tables not in config
-	var newTables []string
-	for _, table := range dbTables {
-		if !cfg.HasTable(table) {
-			newTables = append(newTables, table)
-		}
-	}
+	// Compare config tables with database tables
+	newTables, removedTables := cfg.DiffTables(dbTables)
 
-	if len(newTables) == 0 {
+	if len(newTables) == 0 && len(removedTables) == 0 {
 		fmt.Println("All database tables are already in the configuration.")
 		return nil
 	}
 
+	// Suggest column rules for new tables; truncated tables export no rows
+	var suggested map[string]map[string]string
+	if syncSuggest && !syncTruncate && len(newTables) > 0 {
+		suggested, err = suggestRules(cfg, driver, newTables)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Report what will be added
-	fmt.Printf("Found %d new table(s) not in configuration:\n", len(newTables))
-	for _, table := range newTables {
-		if syncTruncate {
-			fmt.Printf("  + %s (truncate: true)\n", table)
-		} else {
-			fmt.Printf("  + %s (full export)\n", table)
+	if len(newTables) > 0 {
+		fmt.Printf("Found %d new table(s) not in configuration:\n", len(newTables))
+		for _, table := range newTables {
+			if syncTruncate {
+				fmt.Printf("  + %s (truncate: true)\n", table)
+			} else {
+				fmt.Printf("  + %s (full export)\n", table)
+			}
+			rules := suggested[table]
+			columns := make([]string, 0, len(rules))
+			for column := range rules {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+			for _, column := range columns {
+				fmt.Printf("      %s: %s (suggested)\n", column, rules[column])
+			}
+		}
+	}
+
+	// Report removals whether or not they will be pruned
+	if len(removedTables) > 0 {
+		fmt.Printf("Found %d configured table(s) no longer in the database:\n", len(removedTables))
+		for _, table := range removedTables {
+			if syncPrune {
+				fmt.Printf("  - %s (pruned)\n", table)
+			} else {
+				fmt.Printf("  - %s (use --prune to remove)\n", table)
+			}
 		}
 	}
 
@@ -292,28 +861,273 @@ func runSync(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	// Add new tables to config
+	if !syncPrune {
+		removedTables = nil
+	}
+	if len(newTables) == 0 && len(removedTables) == 0 {
+		return nil
+	}
+
+	applySync(cfg, newTables, removedTables, syncTruncate, suggested)
+
+	// Save the updated config
+	if err := cfg.Save(configPath); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("\nConfiguration updated: %s\n", configPath)
+	fmt.Printf("Added %d table(s).\n", len(newTables))
+	if len(removedTables) > 0 {
+		fmt.Printf("Removed %d table(s).\n", len(removedTables))
+	}
+
+	return nil
+}
+
+// addHostPatterns adds the --allow-hosts and --deny-hosts patterns to those
+// of the config, and validates the merged lists.
+func addHostPatterns(cfg *config.Config, allow, deny []string) error {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+
+	cfg.AllowHosts = append(cfg.AllowHosts, allow...)
+	cfg.DenyHosts = append(cfg.DenyHosts, deny...)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid --allow-hosts or --deny-hosts: %w", err)
+	}
+	return nil
+}
+
+// suggestRules reads the columns of each table and returns the column
+// rules suggested by their names, keyed by table.
+func suggestRules(cfg *config.Config, driver database.Driver, tables []string) (map[string]map[string]string, error) {
+	suggested := make(map[string]map[string]string, len(tables))
+	for _, table := range tables {
+		columns, err := driver.GetColumns(table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get columns for table %s: %w", table, err)
+		}
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = column.Name
+		}
+		if rules := cfg.SuggestRules(names); len(rules) > 0 {
+			suggested[table] = rules
+		}
+	}
+	return suggested, nil
+}
+
+// applySync adds the new tables to the config, with truncate: true if
+// truncate is set and any suggested column rules, and removes the removed
+// ones.
+func applySync(cfg *config.Config, newTables, removedTables []string, truncate bool, suggested map[string]map[string]string) {
 	for _, table := range newTables {
 		var tableConfig *config.TableConfig
-		if syncTruncate {
+		if truncate {
 			tableConfig = &config.TableConfig{Truncate: true}
 		} else {
 			tableConfig = &config.TableConfig{}
+			for col, rule := range suggested[table] {
+				if tableConfig.Columns == nil {
+					tableConfig.Columns = make(config.ColumnRuleMap, len(suggested[table]))
+				}
+				tableConfig.Columns[col] = config.Rule(rule)
+			}
 		}
 		cfg.AddTable(table, tableConfig)
 	}
 
-	// Save the updated config
-	if err := cfg.Save(configPath); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+	for _, table := range removedTables {
+		cfg.RemoveTable(table)
 	}
+}
 
-	fmt.Printf("\nConfiguration updated: %s\n", configPath)
-	fmt.Printf("Added %d table(s).\n", len(newTables))
+func runListTables(cmd *cobra.Command, args []string) error {
+	// Load configuration
+	if verbose {
+		fmt.Printf("Loading configuration from: %s\n", configPath)
+	}
+
+	cfg, err := config.LoadWithOptions(configPath, config.LoadOptions{Lenient: lenient, ConnectionFile: connectionFile, Profile: configProfile})
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Create database driver
+	if verbose {
+		fmt.Printf("Connecting to %s...\n", cfg.Connection.SafeString())
+	}
+
+	if err := cfg.CheckHost(); err != nil {
+		return err
+	}
+
+	driver, err := database.NewDriver(cfg.Connection.Type)
+	if err != nil {
+		return err
+	}
+
+	if err := driver.Connect(&cfg.Connection); err != nil {
+		return err
+	}
+	defer driver.Close()
+
+	tables, err := driver.GetTables()
+	if err != nil {
+		return fmt.Errorf("failed to get tables: %w", err)
+	}
+
+	anon := anonymiser.New(cfg)
+
+	fmt.Printf("%-40s %12s  %-9s  %s\n", "TABLE", "ROWS", "IN CONFIG", "ACTION")
+	for _, table := range tables {
+		rowCount, err := driver.GetRowCount(table)
+		if err != nil {
+			return fmt.Errorf("failed to get row count for %s: %w", table, err)
+		}
+		fmt.Println(formatTableListRow(table, rowCount, cfg.HasTable(table), describeTableAction(anon, table)))
+	}
+
+	return nil
+}
+
+func runCheckFK(cmd *cobra.Command, args []string) error {
+	// Load configuration
+	if verbose {
+		fmt.Printf("Loading configuration from: %s\n", configPath)
+	}
+
+	cfg, err := config.LoadWithOptions(configPath, config.LoadOptions{Lenient: lenient, ConnectionFile: connectionFile, Profile: configProfile})
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Create database driver
+	if verbose {
+		fmt.Printf("Connecting to %s...\n", cfg.Connection.SafeString())
+	}
+
+	if err := cfg.CheckHost(); err != nil {
+		return err
+	}
+
+	driver, err := database.NewDriver(cfg.Connection.Type)
+	if err != nil {
+		return err
+	}
+
+	if err := driver.Connect(&cfg.Connection); err != nil {
+		return err
+	}
+	defer driver.Close()
+
+	orphaned, err := schema.NewAnalyser(driver).FindOrphanedForeignKeys()
+	if err != nil {
+		return err
+	}
+
+	return reportSourceOrphans(os.Stdout, orphaned)
+}
+
+// reportSourceOrphans prints the foreign keys broken by rows in the source
+// database and returns an error if there are any.
+func reportSourceOrphans(w io.Writer, orphaned []schema.OrphanedForeignKey) error {
+	if len(orphaned) == 0 {
+		fmt.Fprintln(w, "No orphaned foreign key references found")
+		return nil
+	}
+
+	for _, fk := range orphaned {
+		fmt.Fprintf(w, "  %s.%s -> %s.%s: %d orphaned rows\n",
+			fk.Table, fk.Column, fk.ReferencedTable, fk.ReferencedColumn, fk.Rows)
+	}
+
+	return fmt.Errorf("found %d foreign keys with orphaned rows", len(orphaned))
+}
 
+func runTestConnection(cmd *cobra.Command, args []string) error {
+	// Load configuration
+	if verbose {
+		fmt.Printf("Loading configuration from: %s\n", configPath)
+	}
+
+	cfg, err := config.LoadWithOptions(configPath, config.LoadOptions{Lenient: lenient, ConnectionFile: connectionFile, Profile: configProfile})
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	fmt.Printf("Connecting to %s...\n", cfg.Connection.SafeString())
+
+	if err := cfg.CheckHost(); err != nil {
+		return err
+	}
+
+	elapsed, err := testConnection(&cfg.Connection)
+	if err != nil {
+		fmt.Printf("Connection failed after %v\n", elapsed.Round(time.Millisecond))
+		return err
+	}
+
+	fmt.Printf("Connection succeeded in %v\n", elapsed.Round(time.Millisecond))
 	return nil
 }
 
+// testConnection connects to the database and closes the connection again,
+// returning how long it took.
+func testConnection(conn *config.Connection) (time.Duration, error) {
+	startTime := time.Now()
+
+	driver, err := database.NewDriver(conn.Type)
+	if err != nil {
+		return time.Since(startTime), err
+	}
+
+	if err := driver.Connect(conn); err != nil {
+		return time.Since(startTime), err
+	}
+
+	if err := driver.Close(); err != nil {
+		return time.Since(startTime), fmt.Errorf("failed to close connection: %w", err)
+	}
+
+	return time.Since(startTime), nil
+}
+
+// formatTableListRow formats a single line of the list-tables output.
+func formatTableListRow(table string, rowCount int64, inConfig bool, action string) string {
+	configured := "no"
+	if inConfig {
+		configured = "yes"
+	}
+	return fmt.Sprintf("%-40s %12d  %-9s  %s", table, rowCount, configured, action)
+}
+
+// describeTableAction returns a short description of what an export would do with a table.
+func describeTableAction(anon *anonymiser.Anonymiser, table string) string {
+	if anon.ShouldTruncate(table) {
+		return "truncate"
+	}
+
+	var action string
+	if retainCfg := anon.GetRetainConfig(table); retainCfg.IsDateBased() {
+		action = fmt.Sprintf("retain %s > %s", retainCfg.ColumnName, retainCfg.AfterDate.Format("2006-01-02"))
+	} else if retainCfg.IsCountBased() {
+		action = fmt.Sprintf("retain %d", retainCfg.Count)
+	} else if retainCfg.IsFollow() {
+		action = fmt.Sprintf("retain follow %s", retainCfg.Follow)
+	} else {
+		action = "full"
+	}
+
+	if cols := anon.GetAnonymisedColumns(table); len(cols) > 0 {
+		action += fmt.Sprintf(", anonymised (%d columns)", len(cols))
+	}
+
+	return action
+}
+
 // formatBytes formats bytes into a human-readable string.
 func formatBytes(bytes uint64) string {
 	const (
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+	"github.com/elliotjreed/database-anonymiser-minimiser/pkg/dbmask"
+	"github.com/spf13/pflag"
+)
+
+func TestFormatTableListRow(t *testing.T) {
+	t.Run("configured table", func(t *testing.T) {
+		row := formatTableListRow("users", 1234, true, "full")
+		fields := strings.Fields(row)
+		want := []string{"users", "1234", "yes", "full"}
+		if len(fields) != len(want) {
+			t.Fatalf("formatTableListRow() = %q, want fields %v", row, want)
+		}
+		for i := range want {
+			if fields[i] != want[i] {
+				t.Errorf("field %d = %q, want %q", i, fields[i], want[i])
+			}
+		}
+	})
+
+	t.Run("unconfigured table", func(t *testing.T) {
+		row := formatTableListRow("sessions", 0, false, "full")
+		if !strings.Contains(row, " no ") {
+			t.Errorf("formatTableListRow() = %q, want config status 'no'", row)
+		}
+	})
+
+	t.Run("columns are aligned", func(t *testing.T) {
+		a := formatTableListRow("a", 1, true, "full")
+		b := formatTableListRow("much_longer_table_name", 1000000, false, "truncate")
+		if strings.Index(a, "full") != strings.Index(b, "truncate") {
+			t.Errorf("action column not aligned:\n%s\n%s", a, b)
+		}
+	})
+}
+
+func TestDescribeTableAction(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"sessions": {Truncate: true},
+			"logs":     {Retain: config.RetainConfig{Count: 100}},
+			"orders": {Retain: config.RetainConfig{
+				ColumnName: "created_at",
+				AfterDate:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			}},
+			"order_items": {Retain: config.RetainConfig{Follow: "orders"}},
+			"users":       {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}"), "name": config.Rule("{{faker.name}}")}},
+		},
+	}
+	anon := anonymiser.New(cfg)
+
+	tests := []struct {
+		table string
+		want  string
+	}{
+		{"sessions", "truncate"},
+		{"logs", "retain 100"},
+		{"orders", "retain created_at > 2024-01-01"},
+		{"order_items", "retain follow orders"},
+		{"users", "full, anonymised (2 columns)"},
+		{"products", "full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			if got := describeTableAction(anon, tt.table); got != tt.want {
+				t.Errorf("describeTableAction(%q) = %q, want %q", tt.table, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"flag", []string{"--schema-only"}},
+		{"alias", []string{"--no-data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enabled bool
+			flags := pflag.NewFlagSet("dbmask", pflag.ContinueOnError)
+			flags.BoolVar(&enabled, "schema-only", false, "")
+			flags.SetNormalizeFunc(flagAliases(map[string]string{"no-data": "schema-only"}))
+
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse(%v) error = %v", tt.args, err)
+			}
+			if !enabled {
+				t.Errorf("Parse(%v) did not set schema-only", tt.args)
+			}
+		})
+	}
+}
+
+func TestThreadFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantRead  int
+		wantWrite int
+	}{
+		{"defaults are serial", nil, 1, 1},
+		{"within bounds", []string{"--threads-read", "4", "--threads-write", "2"}, 4, 2},
+		{"below minimum", []string{"--threads-read", "0", "--threads-write", "-2"}, 1, 1},
+		{"above maximum", []string{"--threads-read", "1000", "--threads-write", "65"}, exporter.MaxThreads, exporter.MaxThreads},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var read, write int
+			flags := pflag.NewFlagSet("dbmask", pflag.ContinueOnError)
+			flags.IntVar(&read, "threads-read", 1, "")
+			flags.IntVar(&write, "threads-write", 1, "")
+
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatalf("Parse(%v) error = %v", tt.args, err)
+			}
+			if got := clampThreads("threads-read", read); got != tt.wantRead {
+				t.Errorf("threads-read = %d, want %d", got, tt.wantRead)
+			}
+			if got := clampThreads("threads-write", write); got != tt.wantWrite {
+				t.Errorf("threads-write = %d, want %d", got, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestApplySync(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users":      {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+				"old_tokens": {Truncate: true},
+			},
+		}
+	}
+
+	t.Run("adds new tables", func(t *testing.T) {
+		cfg := newConfig()
+		applySync(cfg, []string{"orders"}, nil, false, nil)
+
+		if tc := cfg.GetTableConfig("orders"); tc == nil || tc.Truncate {
+			t.Errorf("orders = %+v, want full export", tc)
+		}
+		if !cfg.HasTable("old_tokens") {
+			t.Error("old_tokens should be kept without prune")
+		}
+	})
+
+	t.Run("adds new tables truncated", func(t *testing.T) {
+		cfg := newConfig()
+		applySync(cfg, []string{"orders"}, nil, true, nil)
+
+		if tc := cfg.GetTableConfig("orders"); tc == nil || !tc.Truncate {
+			t.Errorf("orders = %+v, want truncate: true", tc)
+		}
+	})
+
+	t.Run("prunes removed tables", func(t *testing.T) {
+		cfg := newConfig()
+		applySync(cfg, nil, []string{"old_tokens"}, false, nil)
+
+		if cfg.HasTable("old_tokens") {
+			t.Error("old_tokens should have been pruned")
+		}
+		if !cfg.GetTableConfig("users").Columns["email"].Is("{{faker.email}}") {
+			t.Error("users rules should be untouched")
+		}
+	})
+
+	t.Run("adds suggested column rules", func(t *testing.T) {
+		cfg := newConfig()
+		suggested := map[string]map[string]string{"orders": {"email": "{{faker.email}}"}}
+		applySync(cfg, []string{"orders"}, nil, false, suggested)
+
+		if got := cfg.GetTableConfig("orders").Columns["email"]; !got.Is("{{faker.email}}") {
+			t.Errorf("orders.email = %q, want {{faker.email}}", got)
+		}
+	})
+}
+
+func TestAddHostPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"valid patterns", []string{"staging-*"}, []string{"*.prod.internal"}, false},
+		{"invalid allow pattern", []string{"db[1"}, nil, true},
+		{"invalid deny pattern", nil, []string{"prod[-"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Connection: config.Connection{Type: "sqlite", File: "test.db"},
+				AllowHosts: []string{"localhost"},
+			}
+
+			err := addHostPatterns(cfg, tt.allow, tt.deny)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addHostPatterns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if want := append([]string{"localhost"}, tt.allow...); !tt.wantErr && !slices.Equal(cfg.AllowHosts, want) {
+				t.Errorf("AllowHosts = %v, want %v", cfg.AllowHosts, want)
+			}
+		})
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	t.Run("working connection", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "test.db")
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", file, err)
+		}
+		conn := &config.Connection{Type: "sqlite", File: file}
+
+		elapsed, err := testConnection(conn)
+		if err != nil {
+			t.Fatalf("testConnection() error = %v", err)
+		}
+		if elapsed <= 0 {
+			t.Errorf("testConnection() elapsed = %v, want > 0", elapsed)
+		}
+	})
+
+	t.Run("broken connection", func(t *testing.T) {
+		conn := &config.Connection{Type: "sqlite", File: filepath.Join(t.TempDir(), "missing", "test.db")}
+
+		if _, err := testConnection(conn); !errors.Is(err, database.ErrConnectionFailed) {
+			t.Errorf("testConnection() error = %v, want ErrConnectionFailed", err)
+		}
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		conn := &config.Connection{Type: "oracle"}
+
+		if _, err := testConnection(conn); !errors.Is(err, database.ErrUnsupportedDriver) {
+			t.Errorf("testConnection() error = %v, want ErrUnsupportedDriver", err)
+		}
+	})
+}
+
+func TestReportSourceOrphans(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", file, err)
+	}
+	defer db.Close()
+
+	// Foreign keys are not enforced by default, so orphaned rows can be inserted
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id))",
+		"CREATE TABLE reviews (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id))",
+		"INSERT INTO users (id) VALUES (1), (2)",
+		"INSERT INTO orders (user_id) VALUES (1), (2), (3), (4), (NULL)",
+		"INSERT INTO reviews (user_id) VALUES (1)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	driver, err := database.NewDriver("sqlite")
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	if err := driver.Connect(&config.Connection{Type: "sqlite", File: file}); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer driver.Close()
+
+	orphaned, err := schema.NewAnalyser(driver).FindOrphanedForeignKeys()
+	if err != nil {
+		t.Fatalf("FindOrphanedForeignKeys() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := reportSourceOrphans(&buf, orphaned); err == nil {
+		t.Error("reportSourceOrphans() expected error for orphaned rows")
+	}
+	if want := "orders.user_id -> users.id: 2 orphaned rows"; !strings.Contains(buf.String(), want) {
+		t.Errorf("report = %q, want it to contain %q", buf.String(), want)
+	}
+	if strings.Contains(buf.String(), "reviews") {
+		t.Errorf("report = %q, reviews has no orphaned rows", buf.String())
+	}
+
+	buf.Reset()
+	if err := reportSourceOrphans(&buf, nil); err != nil {
+		t.Errorf("reportSourceOrphans(nil) error = %v", err)
+	}
+}
+
+func TestPolicyTableReports(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", file, err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, name TEXT)",
+		"CREATE TABLE dbmask_policy (table_name TEXT, column_name TEXT, rule TEXT)",
+		"INSERT INTO dbmask_policy VALUES ('users', 'email', '{{faker.email}}')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	cfg := &config.Config{
+		Connection:  config.Connection{Type: "sqlite", File: file},
+		PolicyTable: "dbmask_policy",
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"name": config.Rule("{{faker.name}}")}},
+		},
+	}
+	stats, err := dbmask.Export(context.Background(), cfg, io.Discard, dbmask.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	anon := anonymiser.New(stats.Config)
+
+	var buf bytes.Buffer
+	if err := printDryRun(&buf, stats.Tables, anon, time.Time{}); err != nil {
+		t.Fatalf("printDryRun() error = %v", err)
+	}
+	if !slices.ContainsFunc(strings.Split(buf.String(), "\n"), func(line string) bool {
+		return strings.Contains(line, "Anonymised columns:") && strings.Contains(line, "email")
+	}) {
+		t.Errorf("dry run = %q, want the policy table's email column anonymised", buf.String())
+	}
+
+	for _, tc := range buildCoverageReport(anon, stats.Tables).Tables {
+		if tc.Table == "users" && tc.AnonymisedColumns != 2 {
+			t.Errorf("users anonymised columns = %d, want 2 with the policy table's email rule", tc.AnonymisedColumns)
+		}
+	}
+}
+
+func TestPrintCharsetMismatches(t *testing.T) {
+	var buf bytes.Buffer
+	printCharsetMismatches(&buf, nil, "utf8mb4")
+	if buf.Len() != 0 {
+		t.Errorf("printCharsetMismatches(nil) = %q, want no output", buf.String())
+	}
+
+	printCharsetMismatches(&buf, []exporter.CharsetMismatch{{Table: "users", Column: "name", Charset: "latin1"}}, "utf8mb4")
+	for _, want := range []string{"users.name", "SET NAMES latin1", "1 columns", "(utf8mb4)"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output = %q, want it to contain %q", buf.String(), want)
+		}
+	}
+}
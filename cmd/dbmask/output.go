@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/storage"
+)
+
+// exportOutput is where one format of an export is written: a file, an S3
+// upload, or stdout.
+type exportOutput struct {
+	io.Writer
+	file     *os.File
+	s3Writer *storage.S3Writer
+}
+
+// outputPaths pairs each format with its --output path, in the order both
+// were given. A single format without an --output path is written to stdout,
+// shown as an empty path.
+func outputPaths(formats []exporter.Format, paths []string) ([]string, error) {
+	if len(paths) == 0 && len(formats) == 1 {
+		return []string{""}, nil
+	}
+	if len(paths) != len(formats) {
+		return nil, fmt.Errorf("--format %s needs one --output path for each format, got %d", joinFormats(formats), len(paths))
+	}
+	return paths, nil
+}
+
+// schemaDataPaths is outputPaths for an export that may split its SQL dump
+// with --schema-file and --data-file. Those replace the --output of an SQL
+// dump, and the schema file is returned as its path.
+func schemaDataPaths(formats []exporter.Format, paths []string, schemaFile, dataFile string) ([]string, error) {
+	if schemaFile == "" && dataFile == "" {
+		return outputPaths(formats, paths)
+	}
+	if schemaFile == "" || dataFile == "" {
+		return nil, fmt.Errorf("--schema-file and --data-file must be given together")
+	}
+	if len(formats) != 1 || formats[0] != exporter.FormatSQL {
+		return nil, fmt.Errorf("--schema-file and --data-file split an SQL dump, and cannot be used with --format %s", joinFormats(formats))
+	}
+	if len(paths) > 0 {
+		return nil, fmt.Errorf("--schema-file and --data-file replace --output")
+	}
+	return []string{schemaFile}, nil
+}
+
+// joinFormats joins formats as they are written in --format.
+func joinFormats(formats []exporter.Format) string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	return strings.Join(names, ",")
+}
+
+// openOutput opens an output file or S3 upload, or stdout if path is empty.
+func openOutput(path string) (*exportOutput, error) {
+	s3Location, isS3, err := storage.ParseS3URL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isS3 {
+		uploader, err := storage.NewMinioUploaderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		s3Writer := storage.NewS3Writer(context.Background(), uploader, s3Location)
+
+		if verbose {
+			fmt.Printf("Uploading output to: %s\n", path)
+		}
+		return &exportOutput{Writer: s3Writer, s3Writer: s3Writer}, nil
+	}
+
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+
+		if verbose {
+			fmt.Printf("Writing output to: %s\n", path)
+		}
+		return &exportOutput{Writer: file, file: file}, nil
+	}
+
+	return &exportOutput{Writer: os.Stdout}, nil
+}
+
+// checkpointOutputs checks that every output is a local file, which is cut
+// back to the checkpoint when an export is resumed.
+func checkpointOutputs(paths []string) error {
+	for _, path := range paths {
+		if path == "" || strings.HasPrefix(path, "s3://") {
+			return fmt.Errorf("--checkpoint needs every --output to be a local file")
+		}
+	}
+	return nil
+}
+
+// resumeOutput reopens an output file of an interrupted export, cutting off
+// anything written after the checkpoint at offset so rows are appended after
+// the last ones the checkpoint records.
+func resumeOutput(path string, offset int64) (*exportOutput, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resume output: %w", err)
+	}
+	if info.Size() < offset {
+		return nil, fmt.Errorf("cannot resume %s: it is %d bytes, shorter than the %d bytes the checkpoint records", path, info.Size(), offset)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate output file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek output file: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("Resuming output at byte %d: %s\n", offset, path)
+	}
+	return &exportOutput{Writer: file, file: file}, nil
+}
+
+// finish completes an S3 upload, or aborts it if the export failed with
+// exportErr, and closes an output file.
+func (o *exportOutput) finish(exportErr error) error {
+	if o.s3Writer != nil {
+		if exportErr != nil {
+			o.s3Writer.Abort(exportErr)
+			return nil
+		}
+		return o.s3Writer.Close()
+	}
+	if o.file != nil {
+		return o.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+)
+
+func TestOutputPaths(t *testing.T) {
+	both := []exporter.Format{exporter.FormatSQL, exporter.FormatNDJSON}
+
+	tests := []struct {
+		name    string
+		formats []exporter.Format
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{"single format to stdout", []exporter.Format{exporter.FormatSQL}, nil, []string{""}, false},
+		{"single format to file", []exporter.Format{exporter.FormatNDJSON}, []string{"rows.ndjson"}, []string{"rows.ndjson"}, false},
+		{"path for each format", both, []string{"dump.sql", "s3://bucket/rows.ndjson"}, []string{"dump.sql", "s3://bucket/rows.ndjson"}, false},
+		{"several formats to stdout", both, nil, nil, true},
+		{"too few paths", both, []string{"dump.sql"}, nil, true},
+		{"too many paths", []exporter.Format{exporter.FormatSQL}, []string{"a.sql", "b.sql"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputPaths(tt.formats, tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaDataPaths(t *testing.T) {
+	sql := []exporter.Format{exporter.FormatSQL}
+
+	tests := []struct {
+		name       string
+		formats    []exporter.Format
+		paths      []string
+		schemaFile string
+		dataFile   string
+		want       []string
+		wantErr    bool
+	}{
+		{"no split", sql, []string{"dump.sql"}, "", "", []string{"dump.sql"}, false},
+		{"split", sql, nil, "schema.sql", "data.sql", []string{"schema.sql"}, false},
+		{"split to s3", sql, nil, "s3://bucket/schema.sql", "s3://bucket/data.sql", []string{"s3://bucket/schema.sql"}, false},
+		{"schema file alone", sql, nil, "schema.sql", "", nil, true},
+		{"data file alone", sql, nil, "", "data.sql", nil, true},
+		{"with --output", sql, []string{"dump.sql"}, "schema.sql", "data.sql", nil, true},
+		{"with another format", []exporter.Format{exporter.FormatSQL, exporter.FormatNDJSON}, nil, "schema.sql", "data.sql", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schemaDataPaths(tt.formats, tt.paths, tt.schemaFile, tt.dataFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("schemaDataPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("schemaDataPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointOutputs(t *testing.T) {
+	if err := checkpointOutputs([]string{"dump.sql", "rows.ndjson"}); err != nil {
+		t.Errorf("checkpointOutputs() of files error = %v", err)
+	}
+	for _, paths := range [][]string{{""}, {"dump.sql", "s3://bucket/rows.ndjson"}} {
+		if err := checkpointOutputs(paths); err == nil {
+			t.Errorf("checkpointOutputs(%q) expected error", paths)
+		}
+	}
+}
+
+func TestResumeOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	os.WriteFile(path, []byte("CREATE TABLE t;\nINSERT INTO t VALU"), 0644)
+
+	output, err := resumeOutput(path, int64(len("CREATE TABLE t;\n")))
+	if err != nil {
+		t.Fatalf("resumeOutput() error = %v", err)
+	}
+	output.Write([]byte("INSERT INTO t VALUES (1);\n"))
+	if err := output.finish(nil); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	if want := "CREATE TABLE t;\nINSERT INTO t VALUES (1);\n"; string(got) != want {
+		t.Errorf("resumed file = %q, want %q", got, want)
+	}
+
+	if _, err := resumeOutput(path, 1000); err == nil {
+		t.Error("resumeOutput() past the end of the file expected error")
+	}
+	if _, err := resumeOutput(filepath.Join(t.TempDir(), "missing.sql"), 0); err == nil {
+		t.Error("resumeOutput() of a missing file expected error")
+	}
+}
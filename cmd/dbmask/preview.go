@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+// previewValueWidth is how many characters of a value --preview shows.
+const previewValueWidth = 40
+
+// runPreview connects to the database and writes to w up to n rows of each
+// anonymised table before and after anonymisation, without exporting. The
+// rules of the config's policy table, if it has one, are previewed too.
+func runPreview(w io.Writer, cfg *config.Config, anon *anonymiser.Anonymiser, n int) error {
+	if err := cfg.CheckHost(); err != nil {
+		return err
+	}
+
+	driver, err := database.NewDriver(cfg.Connection.Type)
+	if err != nil {
+		return err
+	}
+
+	if err := driver.Connect(&cfg.Connection); err != nil {
+		return err
+	}
+	defer driver.Close()
+
+	// Preview the rules kept in the database itself, as an export merges them
+	if cfg.PolicyTable != "" {
+		rules, err := database.ReadPolicy(driver, cfg.PolicyTable)
+		if err != nil {
+			return err
+		}
+		merged, err := cfg.MergePolicy(rules)
+		if err != nil {
+			return err
+		}
+		anon = anonymiser.New(merged)
+	}
+
+	fmt.Fprintln(w, "=== PREVIEW MODE ===")
+	return writePreview(w, driver, anon, n)
+}
+
+// writePreview prints up to n rows of each table with anonymisation rules,
+// showing the original and anonymised value of each anonymised column side
+// by side. Truncated tables are skipped, and rows are filtered by the
+// table's where: filter but not its retain.
+func writePreview(w io.Writer, driver database.Driver, anon *anonymiser.Anonymiser, n int) error {
+	tables, err := driver.GetTables()
+	if err != nil {
+		return fmt.Errorf("failed to get tables: %w", err)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		if !anon.HasAnonymisation(table) || anon.ShouldTruncate(table) {
+			continue
+		}
+
+		if anon.UsesPrimaryKey(table) {
+			pk, err := driver.GetPrimaryKey(table)
+			if err != nil {
+				return fmt.Errorf("failed to get primary key for %s: %w", table, err)
+			}
+			anon.SetPrimaryKey(table, pk)
+		}
+
+		columns := anon.GetAnonymisedColumns(table)
+		sort.Strings(columns)
+
+		var rows []map[string]any
+		opts := database.StreamOptions{Limit: n, Where: anon.GetWhere(table)}
+		err := driver.StreamRows(table, opts, n, func(batch []map[string]any) error {
+			rows = append(rows, batch...)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to preview table %s: %w", table, err)
+		}
+
+		fmt.Fprintf(w, "\n=== %s (%d rows) ===\n", table, len(rows))
+		for i, row := range rows {
+			anonymised := anon.AnonymiseRow(table, row)
+			fmt.Fprintf(w, "Row %d:\n", i+1)
+			for _, col := range columns {
+				if _, ok := row[col]; !ok {
+					continue
+				}
+				fmt.Fprintf(w, "  %-20s %-*s -> %s\n", col, previewValueWidth, formatPreviewValue(row[col]), formatPreviewValue(anonymised[col]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatPreviewValue formats a value for --preview, cut to previewValueWidth
+// characters.
+func formatPreviewValue(v any) string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		s = string(val)
+	default:
+		s = fmt.Sprint(val)
+	}
+
+	if utf8.RuneCountInString(s) > previewValueWidth {
+		s = string([]rune(s)[:previewValueWidth-3]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+func TestWritePreview(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", file, err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, name TEXT, bio TEXT)",
+		"CREATE TABLE sessions (id INTEGER PRIMARY KEY, token TEXT)",
+		"CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users (email, name, bio) VALUES ('alice@real.example', 'Alice', NULL), ('bob@real.example', 'Bob', NULL), ('carol@real.example', 'Carol', NULL)",
+		"INSERT INTO sessions (token) VALUES ('secret')",
+		"INSERT INTO products (name) VALUES ('Widget')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	driver, err := database.NewDriver("sqlite")
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	if err := driver.Connect(&config.Connection{Type: "sqlite", File: file}); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer driver.Close()
+
+	anon := anonymiser.New(&config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users":    {Columns: config.ColumnRuleMap{"email": config.Rule("user_{{pk}}@example.com"), "bio": config.Rule("REDACTED")}},
+			"sessions": {Truncate: true, Columns: config.ColumnRuleMap{"token": config.Rule("{{faker.uuid}}")}},
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := writePreview(&buf, driver, anon, 2); err != nil {
+		t.Fatalf("writePreview() error = %v", err)
+	}
+	output := buf.String()
+
+	for _, want := range []string{
+		"=== users (2 rows) ===",
+		"alice@real.example",
+		"-> user_1@example.com",
+		"-> user_2@example.com",
+		"NULL",
+		"-> REDACTED",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	for _, unwanted := range []string{"carol", "Alice", "sessions", "products"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q, got:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestRunPreview_PolicyTable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", file, err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)",
+		"CREATE TABLE dbmask_policy (table_name TEXT, column_name TEXT, rule TEXT)",
+		"INSERT INTO users (email) VALUES ('alice@real.example')",
+		"INSERT INTO dbmask_policy VALUES ('users', 'email', 'REDACTED')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	cfg := &config.Config{Connection: config.Connection{Type: "sqlite", File: file}, PolicyTable: "dbmask_policy"}
+
+	var buf bytes.Buffer
+	if err := runPreview(&buf, cfg, anonymiser.New(cfg), 1); err != nil {
+		t.Fatalf("runPreview() error = %v", err)
+	}
+	if want := "-> REDACTED"; !strings.Contains(buf.String(), want) {
+		t.Errorf("output should contain the policy table's rule %q, got:\n%s", want, buf.String())
+	}
+}
+
+func TestFormatPreviewValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"null", nil, "NULL"},
+		{"bytes", []byte("abc"), "abc"},
+		{"number", int64(42), "42"},
+		{"long", strings.Repeat("x", 50), strings.Repeat("x", previewValueWidth-3) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatPreviewValue(tt.v); got != tt.want {
+				t.Errorf("formatPreviewValue(%v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// readSinceFile returns the time the previous export recorded in a
+// --since-file started, or the zero time if there is no file yet.
+func readSinceFile(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read since file: %w", err)
+	}
+
+	since, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp in since file %s: %w", path, err)
+	}
+	return since, nil
+}
+
+// writeSinceFile records the time an export started, in UTC like the dates
+// in the config. The next export keeps rows changed after it, compared to the
+// second, so the second before the start is recorded: rows changed while the
+// export ran, even in its first second, are exported again by the next one
+// rather than missed.
+func writeSinceFile(path string, started time.Time) error {
+	data := started.UTC().Truncate(time.Second).Add(-time.Second).Format(time.RFC3339) + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to write since file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+func TestSinceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-export")
+
+	since, err := readSinceFile(path)
+	if err != nil || !since.IsZero() {
+		t.Fatalf("readSinceFile() before the first export = %v, %v, want zero time", since, err)
+	}
+
+	started := time.Date(2024, 3, 15, 11, 30, 45, 900_000_000, time.FixedZone("BST", 3600))
+	if err := writeSinceFile(path, started); err != nil {
+		t.Fatalf("writeSinceFile() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if want := "2024-03-15T10:30:44Z\n"; string(data) != want {
+		t.Errorf("since file = %q, want %q", data, want)
+	}
+
+	since, err = readSinceFile(path)
+	if err != nil {
+		t.Fatalf("readSinceFile() error = %v", err)
+	}
+	if want := time.Date(2024, 3, 15, 10, 30, 44, 0, time.UTC); !since.Equal(want) {
+		t.Errorf("readSinceFile() = %v, want %v", since, want)
+	}
+
+	os.WriteFile(path, []byte("yesterday\n"), 0644)
+	if _, err := readSinceFile(path); err == nil {
+		t.Error("readSinceFile() of an invalid timestamp expected error")
+	}
+}
+
+func TestSinceFile_StartSecond(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", file, err)
+	}
+	defer db.Close()
+
+	// Rows changed before the export, and within the second it started
+	for _, q := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, updated_at TEXT)",
+		"INSERT INTO users (id, updated_at) VALUES (1, '2024-03-15 10:30:43'), (2, '2024-03-15 10:30:45')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "last-export")
+	if err := writeSinceFile(path, time.Date(2024, 3, 15, 10, 30, 45, 100_000_000, time.UTC)); err != nil {
+		t.Fatalf("writeSinceFile() error = %v", err)
+	}
+	since, err := readSinceFile(path)
+	if err != nil {
+		t.Fatalf("readSinceFile() error = %v", err)
+	}
+
+	driver, err := database.NewDriver("sqlite")
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	if err := driver.Connect(&config.Connection{Type: "sqlite", File: file}); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer driver.Close()
+
+	var ids []any
+	err = driver.StreamRows("users", database.StreamOptions{ColumnName: "updated_at", AfterDate: since}, 10, func(rows []map[string]any) error {
+		for _, row := range rows {
+			ids = append(ids, row["id"])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamRows() error = %v", err)
+	}
+	if len(ids) != 1 || ids[0] != int64(2) {
+		t.Errorf("next export reads ids %v, want only 2, changed in the start second", ids)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+)
+
+// statsReport is the end-of-run summary as it is written by --stats-json.
+type statsReport struct {
+	TablesExported  int    `json:"tables_exported"`
+	TablesTruncated int    `json:"tables_truncated"`
+	RowsExported    int64  `json:"rows_exported"`
+	RunTimeMS       int64  `json:"run_time_ms"`
+	PeakMemoryBytes uint64 `json:"peak_memory_bytes"`
+}
+
+// buildStatsReport builds the summary of an export that took elapsed and
+// left peakMemory bytes of heap allocated.
+func buildStatsReport(stats exporter.Stats, elapsed time.Duration, peakMemory uint64) statsReport {
+	return statsReport{
+		TablesExported:  stats.TablesExported,
+		TablesTruncated: stats.TablesTruncated,
+		RowsExported:    stats.RowsExported,
+		RunTimeMS:       elapsed.Milliseconds(),
+		PeakMemoryBytes: peakMemory,
+	}
+}
+
+// checkStatsJSONPath checks that stats written to stdout would not be mixed
+// into a dump also written to stdout.
+func checkStatsJSONPath(path string, outputPaths []string) error {
+	if path != "-" {
+		return nil
+	}
+	for _, output := range outputPaths {
+		if output == "" {
+			return fmt.Errorf("--stats-json - needs --output, as the dump is written to stdout")
+		}
+	}
+	return nil
+}
+
+// writeStatsJSON writes the summary to path as JSON, or to stdout if path is "-".
+func writeStatsJSON(path string, report statsReport) error {
+	if path == "-" {
+		return encodeStatsJSON(os.Stdout, report)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	if err := encodeStatsJSON(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	return nil
+}
+
+// encodeStatsJSON writes the summary to w as indented JSON.
+func encodeStatsJSON(w io.Writer, report statsReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+)
+
+func TestWriteStatsJSON(t *testing.T) {
+	stats := exporter.Stats{TablesExported: 4, TablesTruncated: 1, RowsExported: 1500, RowsFiltered: 3}
+	report := buildStatsReport(stats, 2500*time.Millisecond+400*time.Microsecond, 64<<20)
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := writeStatsJSON(path, report); err != nil {
+		t.Fatalf("writeStatsJSON() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]any{
+		"tables_exported":   float64(4),
+		"tables_truncated":  float64(1),
+		"rows_exported":     float64(1500),
+		"run_time_ms":       float64(2500),
+		"peak_memory_bytes": float64(64 << 20),
+	}
+	if len(got) != len(want) {
+		t.Errorf("stats = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestEncodeStatsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeStatsJSON(&buf, statsReport{TablesExported: 2, RowsExported: 10}); err != nil {
+		t.Fatalf("encodeStatsJSON() error = %v", err)
+	}
+
+	var report statsReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.TablesExported != 2 || report.RowsExported != 10 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestCheckStatsJSONPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		outputs []string
+		wantErr bool
+	}{
+		{"file with dump to stdout", "stats.json", []string{""}, false},
+		{"stdout with dump to a file", "-", []string{"dump.sql"}, false},
+		{"stdout with dump to stdout", "-", []string{""}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkStatsJSONPath(tt.path, tt.outputs); (err != nil) != tt.wantErr {
+				t.Errorf("checkStatsJSONPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,39 +1,301 @@
 package anonymiser
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"os"
 	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 )
 
 var (
-	// fakerPattern matches {{faker.funcName}} templates.
-	fakerPattern = regexp.MustCompile(`\{\{faker\.(\w+)\}\}`)
+	// fakerPattern matches {{faker.funcName}} templates, optionally with the
+	// :seeded modifier, e.g. {{faker.email:seeded}}.
+	fakerPattern = regexp.MustCompile(`\{\{faker\.(\w+)(:seeded)?\}\}`)
+
+	// refPattern matches {{ref:table.column}} templates.
+	refPattern = regexp.MustCompile(`\{\{ref:(\w+)\.(\w+)\}\}`)
+
+	// shiftPattern matches {{shift.days(entity_column)}} templates.
+	shiftPattern = regexp.MustCompile(`\{\{shift\.days\((\w+)\)\}\}`)
+
+	// shiftLayouts are the string date formats that {{shift.days(...)}} can shift.
+	shiftLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
 )
 
+// MaxShiftDays bounds the random per-entity offset of {{shift.days(...)}} rules.
+const MaxShiftDays = 365
+
+// pkPlaceholder is replaced with the row's primary key value in column rules.
+// Composite keys are joined with "_".
+const pkPlaceholder = "{{pk}}"
+
+// usesPK reports whether a rule step uses the {{pk}} placeholder.
+func usesPK(step string) bool {
+	return strings.Contains(step, pkPlaceholder)
+}
+
 // Anonymiser handles data anonymisation based on configuration.
 type Anonymiser struct {
 	config *config.Config
 
-	// consistencyMap maintains value mappings for referential integrity.
-	// Key format: "column:originalValue" -> anonymised value
-	consistencyMap map[string]string
-	mu             sync.RWMutex
+	// rules maps table name to its column rules, including those resolved
+	// from column classifications.
+	rules map[string]config.ColumnRuleMap
+
+	// conditions maps table name to its anonymise_where: condition. Rows
+	// that do not match are exported unchanged.
+	conditions map[string]*config.Condition
+
+	// variantConditions holds the parsed when: conditions of conditional
+	// rules, keyed by the condition as written.
+	variantConditions map[string]*config.Condition
+
+	// caseInsensitive maps table name to its case_insensitive_consistency
+	// columns, whose original values are lowercased for consistency mapping.
+	caseInsensitive map[string]map[string]bool
+
+	// skipConsistency maps table name to its skip_consistency columns, which
+	// are given a fresh fake every row and never stored.
+	skipConsistency map[string]map[string]bool
+
+	// entityColumns maps table name to its entity_column, whose value picks
+	// the fake identity the table's faker rules are expanded from.
+	entityColumns map[string]string
+
+	// templates holds the parsed steps of gotemplate: rules, keyed by the
+	// step. Steps that do not parse are left out and reported by ValidateRules.
+	templates map[string]*template.Template
+
+	// store maintains value mappings for referential integrity.
+	// Key format: "table.column:originalValue" -> anonymised value
+	store ConsistencyStore
+	mu    sync.RWMutex
+
+	// primaryKeys maps table name to its primary key columns for {{pk}} rules.
+	primaryKeys map[string][]string
+
+	// shiftOffsets maps an entity id to its {{shift.days(...)}} offset in days.
+	shiftOffsets map[string]int
+
+	// unshiftable holds the "table.column" of each shift column a value that
+	// is not a recognisable date has been found in, so that it is warned
+	// about once.
+	unshiftable map[string]bool
+
+	// arrayColumns maps table name to its array columns, whose elements are faked individually.
+	arrayColumns map[string]map[string]bool
+
+	// columnLengths maps table name to the declared length of its character
+	// columns, which faker values are truncated to.
+	columnLengths map[string]map[string]int
+
+	// distinctLimits maps "table.column" to the number of distinct fakes the
+	// column may be given, and distinctFakes to those generated so far.
+	// distinctMu serialises the generation of capped fakes.
+	distinctLimits map[string]int
+	distinctFakes  map[string]*fakePool
+	distinctMu     sync.Mutex
+
+	// shuffled maps "table.column" to the shuffled values of a {{shuffle}}
+	// column, guarded by shuffleMu.
+	shuffled  map[string]*shufflePool
+	shuffleMu sync.Mutex
 }
 
+// fakePool holds the distinct fakes generated for a preserve_distinct column.
+type fakePool struct {
+	values []string
+	seen   map[string]bool
+}
+
+// maxDistinctAttempts bounds how many times a fake is regenerated when it
+// repeats one already in a preserve_distinct column's pool.
+const maxDistinctAttempts = 10
+
 // New creates a new Anonymiser instance.
 func New(cfg *config.Config) *Anonymiser {
+	rules := make(map[string]config.ColumnRuleMap, len(cfg.Configuration))
+	conditions := make(map[string]*config.Condition)
+	caseInsensitive := make(map[string]map[string]bool)
+	skipConsistency := make(map[string]map[string]bool)
+	templates := make(map[string]*template.Template)
+	variantConditions := make(map[string]*config.Condition)
+	entityColumns := make(map[string]string)
+	for tableName, tableConfig := range cfg.Configuration {
+		rules[tableName] = cfg.ColumnRules(tableName)
+
+		for _, rule := range rules[tableName] {
+			for _, v := range rule.Variants {
+				if v.When != "" {
+					if cond, err := config.ParseCondition(v.When); err == nil {
+						variantConditions[v.When] = cond
+					}
+				}
+			}
+
+			for _, step := range rule.AllSteps() {
+				if isGoTemplate(step) {
+					if tmpl, err := parseGoTemplate(step); err == nil {
+						templates[step] = tmpl
+					}
+				}
+			}
+		}
+
+		if tableConfig != nil && len(tableConfig.CaseInsensitiveConsistency) > 0 {
+			caseInsensitive[tableName] = make(map[string]bool, len(tableConfig.CaseInsensitiveConsistency))
+			for _, col := range tableConfig.CaseInsensitiveConsistency {
+				caseInsensitive[tableName][col] = true
+			}
+		}
+
+		if tableConfig != nil && len(tableConfig.SkipConsistency) > 0 {
+			skipConsistency[tableName] = make(map[string]bool, len(tableConfig.SkipConsistency))
+			for _, col := range tableConfig.SkipConsistency {
+				skipConsistency[tableName][col] = true
+			}
+		}
+
+		if tableConfig != nil && tableConfig.EntityColumn != "" {
+			entityColumns[tableName] = tableConfig.EntityColumn
+		}
+
+		// Invalid conditions are rejected by Config.Validate; anonymise
+		// every row rather than none if one gets this far
+		if tableConfig != nil && tableConfig.AnonymiseWhere != "" {
+			if cond, err := config.ParseCondition(tableConfig.AnonymiseWhere); err == nil {
+				conditions[tableName] = cond
+			}
+		}
+	}
+
 	return &Anonymiser{
-		config:         cfg,
-		consistencyMap: make(map[string]string),
+		config:          cfg,
+		rules:           rules,
+		conditions:      conditions,
+		caseInsensitive: caseInsensitive,
+		skipConsistency: skipConsistency,
+		entityColumns:   entityColumns,
+		templates:       templates,
+		store:           NewMemoryStore(),
+		primaryKeys:     make(map[string][]string),
+		shiftOffsets:    make(map[string]int),
+		unshiftable:     make(map[string]bool),
+		arrayColumns:    make(map[string]map[string]bool),
+		columnLengths:   make(map[string]map[string]int),
+		distinctLimits:  make(map[string]int),
+		distinctFakes:   make(map[string]*fakePool),
+
+		variantConditions: variantConditions,
+		shuffled:          make(map[string]*shufflePool),
+	}
+}
+
+// SetPrimaryKey records the primary key columns of a table so that rules
+// using the {{pk}} placeholder can be expanded.
+func (a *Anonymiser) SetPrimaryKey(tableName string, columns []string) {
+	a.mu.Lock()
+	a.primaryKeys[tableName] = columns
+	a.mu.Unlock()
+}
+
+// SetArrayColumns records the array columns of a table so that faker rules
+// are applied to each element of their values.
+func (a *Anonymiser) SetArrayColumns(tableName string, columns []string) {
+	set := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		set[col] = true
+	}
+	a.mu.Lock()
+	a.arrayColumns[tableName] = set
+	a.mu.Unlock()
+}
+
+// SetColumnLengths records the declared length of a table's character
+// columns so that faker values are truncated to fit them.
+func (a *Anonymiser) SetColumnLengths(tableName string, lengths map[string]int) {
+	a.mu.Lock()
+	a.columnLengths[tableName] = lengths
+	a.mu.Unlock()
+}
+
+// PreserveDistinctColumns returns the table's preserve_distinct columns.
+func (a *Anonymiser) PreserveDistinctColumns(tableName string) []string {
+	tableConfig := a.config.GetTableConfig(tableName)
+	if tableConfig == nil {
+		return nil
+	}
+	return tableConfig.PreserveDistinct
+}
+
+// SetDistinctLimit caps the number of distinct fakes generated for
+// tableName.col at limit, the number of distinct values in the source.
+// Once the cap is reached, new original values reuse an existing fake.
+func (a *Anonymiser) SetDistinctLimit(tableName, col string, limit int) {
+	a.distinctMu.Lock()
+	a.distinctLimits[tableName+"."+col] = limit
+	a.distinctMu.Unlock()
+}
+
+// columnLength returns the declared length of tableName.col, or 0 if it is unlimited or unknown.
+func (a *Anonymiser) columnLength(tableName, col string) int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.columnLengths[tableName][col]
+}
+
+// isArrayColumn returns true if tableName.col was recorded as an array column.
+func (a *Anonymiser) isArrayColumn(tableName, col string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.arrayColumns[tableName][col]
+}
+
+// UsesPrimaryKey returns true if any column rule for the table uses the {{pk}} placeholder.
+func (a *Anonymiser) UsesPrimaryKey(tableName string) bool {
+	for _, rule := range a.rules[tableName] {
+		if rule.Any(usesPK) {
+			return true
+		}
 	}
+	return false
+}
+
+// primaryKeyValue builds the {{pk}} substitution for a row, joining composite
+// key values with "_". value looks up a column's value in the row.
+func (a *Anonymiser) primaryKeyValue(tableName string, value func(col string) any) string {
+	a.mu.RLock()
+	pkCols := a.primaryKeys[tableName]
+	a.mu.RUnlock()
+
+	parts := make([]string, len(pkCols))
+	for i, col := range pkCols {
+		if v := value(col); v != nil {
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, "_")
 }
 
 // AnonymiseRow applies anonymisation rules to a row of data.
 func (a *Anonymiser) AnonymiseRow(tableName string, row map[string]any) map[string]any {
-	tableConfig := a.config.GetTableConfig(tableName)
-	if tableConfig == nil || tableConfig.Columns == nil {
+	rules := a.rules[tableName]
+	if rules == nil {
+		return row
+	}
+
+	// Pass rows not matching anonymise_where: through unchanged
+	if cond := a.conditions[tableName]; cond != nil && !cond.Match(func(c string) any { return row[c] }) {
 		return row
 	}
 
@@ -42,66 +304,520 @@ func (a *Anonymiser) AnonymiseRow(tableName string, row map[string]any) map[stri
 		result[col] = val
 	}
 
-	for col, rule := range tableConfig.Columns {
+	var pk string
+	pkLoaded := false
+	pkValue := func() string {
+		if !pkLoaded {
+			pk = a.primaryKeyValue(tableName, func(c string) any { return row[c] })
+			pkLoaded = true
+		}
+		return pk
+	}
+
+	for col, rule := range rules {
 		if _, exists := result[col]; !exists {
 			continue
 		}
 
-		// Handle null rule (set to NULL)
-		if rule == "null" || rule == "" {
-			result[col] = nil
+		result[col] = a.applyRule(tableName, col, rule, result[col], func() map[string]any { return row }, pkValue)
+	}
+
+	return result
+}
+
+// AnonymiseValues applies anonymisation rules to a row held as a slice of
+// values, in place. columns gives the column name for each position in values.
+// This avoids allocating a map per row when streaming in columnar mode.
+func (a *Anonymiser) AnonymiseValues(tableName string, columns []string, values []any) {
+	rules := a.rules[tableName]
+	if rules == nil {
+		return
+	}
+
+	valueOf := func(c string) any {
+		for j, name := range columns {
+			if name == c {
+				return values[j]
+			}
+		}
+		return nil
+	}
+
+	// Leave rows not matching anonymise_where: unchanged
+	if cond := a.conditions[tableName]; cond != nil && !cond.Match(valueOf) {
+		return
+	}
+
+	// Resolve the primary key and the original values rules read before any
+	// value is replaced in place: the whole row for gotemplate: and
+	// conditional rules, or just the shift and identity entities
+	var pk string
+	if a.UsesPrimaryKey(tableName) {
+		pk = a.primaryKeyValue(tableName, valueOf)
+	}
+	var original map[string]any
+	if a.usesGoTemplate(tableName) || a.usesConditionalRule(tableName) {
+		original = make(map[string]any, len(columns))
+		for j, name := range columns {
+			original[name] = values[j]
+		}
+	} else {
+		for _, rule := range rules {
+			for _, step := range rule.Steps {
+				for _, matches := range shiftPattern.FindAllStringSubmatch(step, -1) {
+					if original == nil {
+						original = make(map[string]any)
+					}
+					original[matches[1]] = valueOf(matches[1])
+				}
+			}
+		}
+		if entity := a.entityColumns[tableName]; entity != "" {
+			if original == nil {
+				original = make(map[string]any)
+			}
+			original[entity] = valueOf(entity)
+		}
+	}
+
+	for i, col := range columns {
+		rule, ok := rules[col]
+		if !ok {
 			continue
 		}
 
-		// Get original value for consistency mapping
-		originalVal := result[col]
-		var originalStr string
-		if originalVal != nil {
-			switch v := originalVal.(type) {
-			case string:
-				originalStr = v
-			default:
-				// For non-string types, convert to string for mapping
-				originalStr = ""
+		values[i] = a.applyRule(tableName, col, rule, values[i], func() map[string]any { return original }, func() string { return pk })
+	}
+}
+
+// applyRule applies a column rule for tableName.col to a value. The steps of
+// a rule written as a list are applied in order, each to the output of the
+// previous one. original returns the row's original values, holding at
+// least the {{shift.days(...)}} and entity_column columns and, if the table has
+// gotemplate: or conditional rules, every column. pk returns the row's {{pk}}
+// substitution.
+func (a *Anonymiser) applyRule(tableName, col string, rule config.ColumnRule, val any, original func() map[string]any, pk func() string) any {
+	// Apply the first variant of a conditional rule the row matches, e.g.
+	// when: country = 'US', leaving the value as it is if none does
+	steps := rule.Steps
+	if rule.IsConditional() {
+		variant, ok := a.matchVariant(rule.Variants, original())
+		if !ok {
+			return val
+		}
+		steps = []string{variant.Rule}
+	}
+
+	for step, stepRule := range steps {
+		// Evaluate Go templates against the row, e.g. gotemplate:{{.first_name}}.{{.id}}
+		if isGoTemplate(stepRule) {
+			val = a.executeTemplate(stepRule, original())
+			continue
+		}
+
+		// Shift dates by the entity's offset, e.g. {{shift.days(user_id)}}
+		if matches := shiftPattern.FindStringSubmatch(stepRule); matches != nil {
+			shifted, ok := shiftDate(val, a.shiftOffset(original()[matches[1]]))
+			if !ok {
+				a.warnUnshiftable(tableName, col)
 			}
+			val = shifted
+			continue
 		}
 
-		// Check for faker template
-		if matches := fakerPattern.FindStringSubmatch(rule); matches != nil {
-			funcName := matches[1]
+		// Replace fields of PHP serialized data, e.g.
+		// {{phpserialize.replace:email:{{faker.email}}}}
+		if matches := phpSerializePattern.FindStringSubmatch(stepRule); matches != nil {
+			val = a.replacePHPSerialized(tableName, col, matches[1], matches[2], step, val)
+			continue
+		}
 
-			// Check consistency map first
-			a.mu.RLock()
-			key := col + ":" + originalStr
-			if cached, ok := a.consistencyMap[key]; ok {
-				a.mu.RUnlock()
-				result[col] = cached
+		// Expand faker rules from the fake identity of the row's entity,
+		// e.g. entity_column: user_id. Rows without one are faked as usual.
+		if entity := a.entityColumns[tableName]; entity != "" && fakerPattern.MatchString(stepRule) && !a.isArrayColumn(tableName, col) {
+			if id := original()[entity]; id != nil {
+				val = substitutePK(a.entityFakeValue(tableName, col, stepRule, id), stepRule, pk)
 				continue
 			}
-			a.mu.RUnlock()
+		}
 
-			// Generate new value
-			newVal := GenerateFakeValue(funcName)
+		// Deal out the column's own values in a random order
+		if stepRule == shuffleRule {
+			val = a.nextShuffled(tableName, col)
+			continue
+		}
 
-			// Store in consistency map
-			if originalStr != "" {
-				a.mu.Lock()
-				a.consistencyMap[key] = newVal
-				a.mu.Unlock()
-			}
+		// Substitute the row's primary key, e.g. user_{{pk}}@example.com,
+		// after expanding any faker tokens, e.g. {{faker.firstName}}_{{pk}}
+		if usesPK(stepRule) && !fakerPattern.MatchString(stepRule) {
+			val = strings.ReplaceAll(stepRule, pkPlaceholder, pk())
+			continue
+		}
+
+		val = substitutePK(a.anonymiseValue(tableName, col, stepRule, step, val), stepRule, pk)
+	}
+	return val
+}
 
-			result[col] = newVal
+// substitutePK replaces the {{pk}} placeholders a faker rule step leaves in
+// its fake with the row's primary key. The placeholder is kept through faker
+// expansion so that the consistency mapping holds one fake per original
+// value, not one per row.
+func substitutePK(val any, stepRule string, pk func() string) any {
+	if s, ok := val.(string); ok && usesPK(stepRule) {
+		return strings.ReplaceAll(s, pkPlaceholder, pk())
+	}
+	return val
+}
+
+// shiftOffset returns the day offset for an entity, choosing a random non-zero
+// offset within MaxShiftDays the first time the entity is seen. Rows without
+// an entity id get a fresh offset.
+func (a *Anonymiser) shiftOffset(entity any) int {
+	var key string
+	if entity != nil {
+		if b, ok := entity.([]byte); ok {
+			key = string(b)
 		} else {
-			// Static replacement value
-			result[col] = rule
+			key = fmt.Sprint(entity)
+		}
+
+		a.mu.RLock()
+		offset, ok := a.shiftOffsets[key]
+		a.mu.RUnlock()
+		if ok {
+			return offset
 		}
 	}
 
-	return result
+	offset := rand.IntN(MaxShiftDays) + 1
+	if rand.IntN(2) == 0 {
+		offset = -offset
+	}
+
+	if entity != nil {
+		a.mu.Lock()
+		// Another goroutine may have chosen an offset for this entity first
+		if existing, ok := a.shiftOffsets[key]; ok {
+			offset = existing
+		} else {
+			a.shiftOffsets[key] = offset
+		}
+		a.mu.Unlock()
+	}
+
+	return offset
+}
+
+// shiftDate moves a date value by days, keeping its type and string format.
+// NULLs are kept; values that are not recognisable dates are set to NULL,
+// and reported by ok being false.
+func shiftDate(val any, days int) (shifted any, ok bool) {
+	switch v := val.(type) {
+	case nil:
+		return nil, true
+	case time.Time:
+		return v.AddDate(0, 0, days), true
+	case []byte:
+		return shiftDate(string(v), days)
+	case string:
+		for _, layout := range shiftLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.AddDate(0, 0, days).Format(layout), true
+			}
+		}
+	}
+	return nil, false
 }
 
-// ShouldTruncate returns true if the table should be truncated (schema only).
+// warnUnshiftable warns, once per column, that a shift column holds values
+// that are not recognisable dates, which are written as NULL.
+func (a *Anonymiser) warnUnshiftable(tableName, col string) {
+	key := tableName + "." + col
+	a.mu.Lock()
+	warned := a.unshiftable[key]
+	a.unshiftable[key] = true
+	a.mu.Unlock()
+	if !warned {
+		fmt.Fprintf(os.Stderr, "Warning: %s holds values that are not recognisable dates, which {{shift.days(...)}} writes as NULL\n", key)
+	}
+}
+
+// anonymiseValue applies a single column rule for tableName.col to a value.
+// step is the rule's position in a rule pipeline, which keeps the consistency
+// mapping of each step apart.
+func (a *Anonymiser) anonymiseValue(tableName, col, rule string, step int, originalVal any) any {
+	// Handle null rule (set to NULL)
+	if rule == "null" || rule == "" {
+		return nil
+	}
+
+	// Reuse the value generated for another table's column, e.g. {{ref:users.email}}
+	if matches := refPattern.FindStringSubmatch(rule); matches != nil {
+		return a.anonymiseRef(matches[1], matches[2], originalVal)
+	}
+
+	// Get original value for consistency mapping
+	var originalStr string
+	if originalVal != nil {
+		switch v := originalVal.(type) {
+		case string:
+			originalStr = v
+		case []byte:
+			originalStr = string(v)
+		default:
+			// For non-string types, convert to string for mapping
+			originalStr = ""
+		}
+	}
+
+	// Originals differing only by case, e.g. emails, share a fake
+	if a.caseInsensitive[tableName][col] {
+		originalStr = strings.ToLower(originalStr)
+	}
+
+	// Check for faker template, e.g. {{faker.name}} or TEST-{{faker.name}}
+	if fakerPattern.MatchString(rule) {
+		// Fake each element of array values, e.g. {a@example.com,b@example.com}
+		if a.isArrayColumn(tableName, col) {
+			if elements, ok := parseArrayLiteral(originalStr); ok {
+				for i, elem := range elements {
+					if s, ok := elem.(string); ok {
+						elements[i] = a.fakeValue(tableName, col, rule, step, s, s)
+					}
+				}
+				return formatArrayLiteral(elements)
+			}
+		}
+
+		// Seed :seeded rules from non-string values by their text
+		seedKey := originalStr
+		if seedKey == "" && originalVal != nil {
+			seedKey = fmt.Sprint(originalVal)
+		}
+
+		return a.fakeValue(tableName, col, rule, step, originalStr, seedKey)
+	}
+
+	// Static replacement value
+	return rule
+}
+
+// fakeValue expands a faker rule for tableName.col, returning the same fake
+// value each time the same original value is seen. seedKey is the original
+// value that :seeded tokens are derived from.
+func (a *Anonymiser) fakeValue(tableName, col, rule string, step int, originalStr, seedKey string) string {
+	a.distinctMu.Lock()
+	limit := a.distinctLimits[tableName+"."+col]
+	a.distinctMu.Unlock()
+	if limit > 0 && step == 0 {
+		return a.distinctFakeValue(tableName, col, rule, seedKey, limit)
+	}
+
+	// High-cardinality columns, e.g. free-text notes, are not worth remembering
+	if a.skipConsistency[tableName][col] {
+		return a.generateFake(tableName, col, rule, seedKey)
+	}
+
+	// Check consistency store first
+	store := a.consistencyStore()
+	key := consistencyKey(tableName, col, rule, step, originalStr)
+	if cached, ok := store.Get(key); ok {
+		return cached
+	}
+
+	newVal := a.generateFake(tableName, col, rule, seedKey)
+
+	// Save in consistency store
+	if originalStr != "" {
+		store.Set(key, newVal)
+	}
+
+	return newVal
+}
+
+// consistencyKey returns the consistency store key of an original value of
+// tableName.col faked by rule. The key holds a hash of the rule, so that a
+// store kept between exports does not give back the fakes of a rule since
+// changed. Steps after the first of a rule pipeline map the output of the
+// previous step, so they are keyed apart from the column's originals.
+func consistencyKey(tableName, col, rule string, step int, original string) string {
+	sum := sha256.Sum256([]byte(rule))
+	if step > 0 {
+		return fmt.Sprintf("%s.%s#%d@%x:%s", tableName, col, step, sum[:4], original)
+	}
+	return fmt.Sprintf("%s.%s@%x:%s", tableName, col, sum[:4], original)
+}
+
+// distinctFakeValue is fakeValue for a column capped at limit distinct fakes.
+// Each original value, including non-string ones, is given its own fake until
+// limit fakes exist; after that it reuses the fake chosen by a hash of the
+// original, so the mapping stays consistent.
+func (a *Anonymiser) distinctFakeValue(tableName, col, rule, original string, limit int) string {
+	a.distinctMu.Lock()
+	defer a.distinctMu.Unlock()
+
+	store := a.consistencyStore()
+	key := consistencyKey(tableName, col, rule, 0, original)
+	if cached, ok := store.Get(key); ok {
+		return cached
+	}
+
+	pool := a.distinctFakes[tableName+"."+col]
+	if pool == nil {
+		pool = &fakePool{seen: make(map[string]bool)}
+		a.distinctFakes[tableName+"."+col] = pool
+	}
+
+	var newVal string
+	if len(pool.values) < limit {
+		// Regenerate fakes that repeat one in the pool, which would leave
+		// the column with fewer distinct values than the source
+		newVal = a.generateFake(tableName, col, rule, original)
+		for attempt := 1; attempt < maxDistinctAttempts && pool.seen[newVal]; attempt++ {
+			newVal = a.generateFake(tableName, col, rule, original)
+		}
+		if !pool.seen[newVal] {
+			pool.values = append(pool.values, newVal)
+			pool.seen[newVal] = true
+		}
+	} else {
+		newVal = pool.values[uint64(seedFor(a.config.FakerSalt, original))%uint64(len(pool.values))]
+	}
+
+	store.Set(key, newVal)
+
+	return newVal
+}
+
+// generateFake expands a faker rule for tableName.col, wrapped in the
+// configured prefix and suffix and cut to the column's length so that it can
+// be restored. seedKey is the original value that :seeded tokens are derived from.
+func (a *Anonymiser) generateFake(tableName, col, rule, seedKey string) string {
+	return a.wrapFake(tableName, col, rule, expandFakerTemplate(rule, seedFor(a.config.FakerSalt, seedKey)))
+}
+
+// wrapFake wraps an expanded faker rule for tableName.col in the configured
+// prefix and suffix and cuts it to the column's length. The fakes of email
+// rules are cut in their local part, so that they stay valid addresses.
+func (a *Anonymiser) wrapFake(tableName, col, rule, fake string) string {
+	prefix, suffix := a.fakeAffixes(tableName)
+	if isEmailRule(rule) {
+		return truncateEmail(prefix+fake+suffix, a.columnLength(tableName, col))
+	}
+	return truncateRunes(prefix+fake+suffix, a.columnLength(tableName, col))
+}
+
+// isEmailRule reports whether a faker rule generates an email address.
+func isEmailRule(rule string) bool {
+	for _, matches := range fakerPattern.FindAllStringSubmatch(rule, -1) {
+		if matches[1] == "email" {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateEmail cuts an email address to at most n characters by shortening
+// its local part, keeping the @ and domain. Addresses whose domain alone
+// does not leave room for a local part are cut like any other value.
+func truncateEmail(s string, n int) string {
+	at := strings.LastIndex(s, "@")
+	if n <= 0 || utf8.RuneCountInString(s) <= n || at < 0 {
+		return truncateRunes(s, n)
+	}
+	domain := s[at:]
+	local := n - utf8.RuneCountInString(domain)
+	if local < 1 {
+		return truncateRunes(s, n)
+	}
+	return truncateRunes(s[:at], local) + domain
+}
+
+// truncateRunes cuts s to at most n characters. n <= 0 means no limit.
+func truncateRunes(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// expandFakerTemplate replaces every {{faker.funcName}} token in rule with a
+// generated value, keeping any surrounding text. {{faker.funcName:seeded}}
+// tokens are generated from seed.
+func expandFakerTemplate(rule string, seed int64) string {
+	return fakerPattern.ReplaceAllStringFunc(rule, func(token string) string {
+		matches := fakerPattern.FindStringSubmatch(token)
+		if matches[2] != "" {
+			return GenerateSeededFakeValue(matches[1], seed)
+		}
+		return GenerateFakeValue(matches[1])
+	})
+}
+
+// seedFor derives the seed of :seeded faker tokens from a hash of the
+// original value and salt, so each original always maps to the same fake.
+func seedFor(salt, original string) int64 {
+	sum := sha256.Sum256([]byte(original + salt))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// fakeAffixes returns the prefix and suffix to wrap faker values for a table
+// in. Table settings override the global ones.
+func (a *Anonymiser) fakeAffixes(tableName string) (string, string) {
+	prefix, suffix := a.config.FakePrefix, a.config.FakeSuffix
+	if tableConfig := a.config.GetTableConfig(tableName); tableConfig != nil {
+		if tableConfig.FakePrefix != "" {
+			prefix = tableConfig.FakePrefix
+		}
+		if tableConfig.FakeSuffix != "" {
+			suffix = tableConfig.FakeSuffix
+		}
+	}
+	return prefix, suffix
+}
+
+// anonymiseRef applies the rule of the referenced table.column to a value, so
+// that it shares the referenced column's consistency mapping. Values are set
+// to NULL if the reference cannot be resolved.
+func (a *Anonymiser) anonymiseRef(refTable, refCol string, originalVal any) any {
+	rule, ok := a.refRule(refTable, refCol)
+	if !ok {
+		return nil
+	}
+
+	val := originalVal
+	for step, stepRule := range rule.Steps {
+		val = a.anonymiseValue(refTable, refCol, stepRule, step, val)
+	}
+	return val
+}
+
+// refRule returns the rule of a {{ref:table.column}} target. References to
+// unconfigured columns, or to rules that are themselves references or depend
+// on other columns of the row ({{pk}}, {{shift.days(...)}}, gotemplate:),
+// cannot be resolved, nor can conditional rules or skip_consistency columns,
+// whose fakes are not kept to be shared.
+func (a *Anonymiser) refRule(refTable, refCol string) (config.ColumnRule, bool) {
+	rule, ok := a.rules[refTable][refCol]
+	if !ok || a.skipConsistency[refTable][refCol] || rule.IsConditional() || rule.Any(func(step string) bool {
+		return refPattern.MatchString(step) || shiftPattern.MatchString(step) || usesPK(step) || isGoTemplate(step) || strings.Contains(step, phpSerializePrefix) || isShuffle(step)
+	}) {
+		return config.ColumnRule{}, false
+	}
+	return rule, true
+}
+
+// ShouldTruncate returns true if the table should be truncated (schema only),
+// either by its table config or by matching a schema-only table pattern.
 func (a *Anonymiser) ShouldTruncate(tableName string) bool {
+	if a.config.IsSchemaOnlyTable(tableName) {
+		return true
+	}
 	tableConfig := a.config.GetTableConfig(tableName)
 	if tableConfig == nil {
 		return false
@@ -118,13 +834,48 @@ func (a *Anonymiser) GetRetainConfig(tableName string) config.RetainConfig {
 	return tableConfig.Retain
 }
 
-// HasAnonymisation returns true if the table has any anonymisation rules.
-func (a *Anonymiser) HasAnonymisation(tableName string) bool {
+// GetWhere returns the raw where: predicate for a table, or empty string if none is set.
+func (a *Anonymiser) GetWhere(tableName string) string {
 	tableConfig := a.config.GetTableConfig(tableName)
 	if tableConfig == nil {
-		return false
+		return ""
 	}
-	return len(tableConfig.Columns) > 0
+	return tableConfig.Where
+}
+
+// GetUpdatedColumn returns the update-timestamp column of a table, or empty
+// string if none is set.
+func (a *Anonymiser) GetUpdatedColumn(tableName string) string {
+	tableConfig := a.config.GetTableConfig(tableName)
+	if tableConfig == nil {
+		return ""
+	}
+	return tableConfig.UpdatedColumn
+}
+
+// GetPostSQL returns the statements written after a table's rows, or nil if
+// none are set.
+func (a *Anonymiser) GetPostSQL(tableName string) []string {
+	tableConfig := a.config.GetTableConfig(tableName)
+	if tableConfig == nil {
+		return nil
+	}
+	return tableConfig.PostSQL
+}
+
+// GetOutputTypes returns the output types a table's columns are written as,
+// by column, or nil if none are set.
+func (a *Anonymiser) GetOutputTypes(tableName string) map[string]string {
+	tableConfig := a.config.GetTableConfig(tableName)
+	if tableConfig == nil {
+		return nil
+	}
+	return tableConfig.As
+}
+
+// HasAnonymisation returns true if the table has any anonymisation rules.
+func (a *Anonymiser) HasAnonymisation(tableName string) bool {
+	return len(a.rules[tableName]) > 0
 }
 
 // ParseFakerTemplate extracts the faker function name from a template.
@@ -144,23 +895,46 @@ func IsFakerTemplate(s string) bool {
 
 // GetAnonymisedColumns returns the list of columns that will be anonymised for a table.
 func (a *Anonymiser) GetAnonymisedColumns(tableName string) []string {
-	tableConfig := a.config.GetTableConfig(tableName)
-	if tableConfig == nil || tableConfig.Columns == nil {
+	rules := a.rules[tableName]
+	if rules == nil {
 		return nil
 	}
 
-	columns := make([]string, 0, len(tableConfig.Columns))
-	for col := range tableConfig.Columns {
+	columns := make([]string, 0, len(rules))
+	for col := range rules {
 		columns = append(columns, col)
 	}
 	return columns
 }
 
-// ClearConsistencyMap clears the consistency map (useful for testing).
+// SetConsistencyStore replaces the store of value mappings, e.g. with one
+// that persists them between exports. It must be called before any rows are
+// anonymised.
+func (a *Anonymiser) SetConsistencyStore(store ConsistencyStore) {
+	a.mu.Lock()
+	a.store = store
+	a.mu.Unlock()
+}
+
+// consistencyStore returns the store of value mappings.
+func (a *Anonymiser) consistencyStore() ConsistencyStore {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.store
+}
+
+// ClearConsistencyMap replaces the consistency store with an empty
+// MemoryStore (useful for testing).
 func (a *Anonymiser) ClearConsistencyMap() {
 	a.mu.Lock()
-	a.consistencyMap = make(map[string]string)
+	a.store = NewMemoryStore()
+	a.shiftOffsets = make(map[string]int)
+	a.unshiftable = make(map[string]bool)
 	a.mu.Unlock()
+
+	a.distinctMu.Lock()
+	a.distinctFakes = make(map[string]*fakePool)
+	a.distinctMu.Unlock()
 }
 
 // ValidateRules validates anonymisation rules for known faker functions.
@@ -172,14 +946,89 @@ func (a *Anonymiser) ValidateRules() []string {
 	}
 
 	for tableName, tableConfig := range a.config.Configuration {
-		if tableConfig == nil || tableConfig.Columns == nil {
+		if tableConfig == nil {
+			continue
+		}
+
+		// Classified columns are left as they are if the policy has no rule
+		for col, class := range tableConfig.Classification {
+			if _, ok := a.config.Policy[class]; !ok && !strings.EqualFold(class, config.ClassNone) {
+				errors = append(errors, "no policy rule for classification '"+class+"' of "+tableName+"."+col)
+			}
+		}
+
+		// Truncated tables are exported as schema only, so their rows are
+		// neither anonymised nor retained
+		if tableConfig.Truncate {
+			if len(tableConfig.Columns) > 0 {
+				errors = append(errors, "truncated table "+tableName+" has column rules, which have no effect")
+			}
+			if !tableConfig.Retain.IsEmpty() {
+				errors = append(errors, "truncated table "+tableName+" has a retain setting, which has no effect")
+			}
+		}
+
+		rules := a.rules[tableName]
+		if rules == nil {
 			continue
 		}
 
-		for col, rule := range tableConfig.Columns {
-			if funcName, isFaker := ParseFakerTemplate(rule); isFaker {
-				if GetFakerFunc(funcName) == nil {
-					errors = append(errors, "unknown faker function '"+funcName+"' for "+tableName+"."+col)
+		// Rows are retained by the original value, but the exported value is
+		// replaced, so the dump may not look like it honours the retention
+		if retainCol := tableConfig.Retain.ColumnName; retainCol != "" {
+			if _, ok := rules[retainCol]; ok {
+				errors = append(errors, "retain column '"+retainCol+"' for "+tableName+" is also anonymised; exported values may fall outside the retention window")
+			}
+		}
+
+		for _, col := range tableConfig.PreserveDistinct {
+			if !rules[col].Any(fakerPattern.MatchString) {
+				errors = append(errors, "preserve_distinct column '"+col+"' for "+tableName+" has no faker rule")
+			}
+		}
+
+		for _, col := range tableConfig.CaseInsensitiveConsistency {
+			if !rules[col].Any(fakerPattern.MatchString) {
+				errors = append(errors, "case_insensitive_consistency column '"+col+"' for "+tableName+" has no faker rule")
+			}
+		}
+
+		for _, col := range tableConfig.SkipConsistency {
+			if !rules[col].Any(fakerPattern.MatchString) {
+				errors = append(errors, "skip_consistency column '"+col+"' for "+tableName+" has no faker rule")
+			}
+			if slices.Contains(tableConfig.PreserveDistinct, col) {
+				errors = append(errors, "skip_consistency column '"+col+"' for "+tableName+" is also in preserve_distinct, which keeps its fakes consistent")
+			}
+		}
+
+		for col, rule := range rules {
+			// Values are dealt out to every row the table exports in turn
+			if rule.Any(isShuffle) && !rule.Is(shuffleRule) {
+				errors = append(errors, "{{shuffle}} must be the whole rule for "+tableName+"."+col)
+			} else if rule.Is(shuffleRule) && tableConfig.AnonymiseWhere != "" {
+				errors = append(errors, "{{shuffle}} column "+tableName+"."+col+" also deals out the values of rows anonymise_where leaves unchanged")
+			} else if rule.Is(shuffleRule) && tableConfig.Retain.IsFollow() {
+				errors = append(errors, "{{shuffle}} column "+tableName+"."+col+" also deals out the values of rows retain follow leaves out")
+			}
+			for _, step := range rule.AllSteps() {
+				if strings.HasPrefix(step, phpSerializePrefix) && !phpSerializePattern.MatchString(step) {
+					errors = append(errors, "invalid phpserialize rule for "+tableName+"."+col+": want {{phpserialize.replace:key:rule}}")
+				}
+				if isGoTemplate(step) {
+					if _, err := parseGoTemplate(step); err != nil {
+						errors = append(errors, "invalid gotemplate rule for "+tableName+"."+col+": "+err.Error())
+					}
+				}
+				for _, matches := range fakerPattern.FindAllStringSubmatch(step, -1) {
+					if GetFakerFunc(matches[1]) == nil {
+						errors = append(errors, "unknown faker function '"+matches[1]+"' for "+tableName+"."+col)
+					}
+				}
+				for _, matches := range refPattern.FindAllStringSubmatch(step, -1) {
+					if _, ok := a.refRule(matches[1], matches[2]); !ok {
+						errors = append(errors, "unresolvable reference '"+matches[1]+"."+matches[2]+"' for "+tableName+"."+col)
+					}
 				}
 			}
 		}
@@ -1,8 +1,13 @@
 package anonymiser
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 )
@@ -17,8 +22,8 @@ func TestNew(t *testing.T) {
 	if anon.config != cfg {
 		t.Error("New() did not store config correctly")
 	}
-	if anon.consistencyMap == nil {
-		t.Error("New() did not initialize consistencyMap")
+	if anon.store == nil {
+		t.Error("New() did not initialize the consistency store")
 	}
 }
 
@@ -47,8 +52,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email": "{{faker.email}}",
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.email}}"),
 					},
 				},
 			},
@@ -77,8 +82,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"role": "user",
+					Columns: config.ColumnRuleMap{
+						"role": config.Rule("user"),
 					},
 				},
 			},
@@ -101,8 +106,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"phone": "null",
+					Columns: config.ColumnRuleMap{
+						"phone": config.Rule("null"),
 					},
 				},
 			},
@@ -125,8 +130,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"phone": "",
+					Columns: config.ColumnRuleMap{
+						"phone": config.Rule(""),
 					},
 				},
 			},
@@ -148,8 +153,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"nonexistent": "{{faker.email}}",
+					Columns: config.ColumnRuleMap{
+						"nonexistent": config.Rule("{{faker.email}}"),
 					},
 				},
 			},
@@ -175,8 +180,8 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email": "{{faker.email}}",
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.email}}"),
 					},
 				},
 			},
@@ -207,10 +212,10 @@ func TestAnonymiseRow(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email":    "{{faker.email}}",
-						"password": "redacted",
-						"phone":    "null",
+					Columns: config.ColumnRuleMap{
+						"email":    config.Rule("{{faker.email}}"),
+						"password": config.Rule("redacted"),
+						"phone":    config.Rule("null"),
 					},
 				},
 			},
@@ -241,12 +246,209 @@ func TestAnonymiseRow(t *testing.T) {
 	})
 }
 
+func TestAnonymiseValues(t *testing.T) {
+	t.Run("no config for table", func(t *testing.T) {
+		anon := New(&config.Config{})
+
+		values := []any{int64(1), "john@example.com"}
+		anon.AnonymiseValues("users", []string{"id", "email"}, values)
+
+		if values[1] != "john@example.com" {
+			t.Errorf("email should be unchanged, got %v", values[1])
+		}
+	})
+
+	t.Run("applies rules in place by column position", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.email}}"),
+						"role":  config.Rule("user"),
+						"phone": config.Rule("null"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+
+		values := []any{int64(1), "john@example.com", "admin", "123-456-7890"}
+		anon.AnonymiseValues("users", []string{"id", "email", "role", "phone"}, values)
+
+		if values[0] != int64(1) {
+			t.Errorf("id should be unchanged, got %v", values[0])
+		}
+		if values[1] == "john@example.com" {
+			t.Error("email should have been anonymised")
+		}
+		if values[2] != "user" {
+			t.Errorf("role = %v, want 'user'", values[2])
+		}
+		if values[3] != nil {
+			t.Errorf("phone = %v, want nil", values[3])
+		}
+	})
+
+	t.Run("shares consistency map with AnonymiseRow", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.email}}"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+
+		row := anon.AnonymiseRow("users", map[string]any{"email": "same@example.com"})
+		values := []any{"same@example.com"}
+		anon.AnonymiseValues("users", []string{"email"}, values)
+
+		if row["email"] != values[0] {
+			t.Errorf("AnonymiseValues() = %v, want %v", values[0], row["email"])
+		}
+	})
+}
+
+func TestAnonymiseRow_PrimaryKeyPlaceholder(t *testing.T) {
+	t.Run("single primary key", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("user_{{pk}}@example.com"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+		anon.SetPrimaryKey("users", []string{"id"})
+
+		result := anon.AnonymiseRow("users", map[string]any{"id": int64(42), "email": "john@example.com"})
+
+		if result["email"] != "user_42@example.com" {
+			t.Errorf("email = %v, want user_42@example.com", result["email"])
+		}
+	})
+
+	t.Run("with faker tokens", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{
+						"username": config.Rule("{{faker.firstName}}_{{pk}}"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+		anon.SetPrimaryKey("users", []string{"id"})
+
+		first := anon.AnonymiseRow("users", map[string]any{"id": int64(42), "username": "john"})
+		second := anon.AnonymiseRow("users", map[string]any{"id": int64(43), "username": "john"})
+
+		name, ok := strings.CutSuffix(first["username"].(string), "_42")
+		if !ok || name == "" || strings.Contains(name, "{{") {
+			t.Fatalf("username = %v, want a fake first name followed by _42", first["username"])
+		}
+		if second["username"] != name+"_43" {
+			t.Errorf("username = %v, want the same fake name followed by _43", second["username"])
+		}
+	})
+
+	t.Run("composite primary key", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"memberships": {
+					Columns: config.ColumnRuleMap{
+						"label": config.Rule("member-{{pk}}"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+		anon.SetPrimaryKey("memberships", []string{"org_id", "user_id"})
+
+		result := anon.AnonymiseRow("memberships", map[string]any{
+			"org_id":  int64(7),
+			"user_id": "abc",
+			"label":   "Alice @ Acme",
+		})
+
+		if result["label"] != "member-7_abc" {
+			t.Errorf("label = %v, want member-7_abc", result["label"])
+		}
+	})
+
+	t.Run("primary key column itself anonymised", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{
+						"id":    config.Rule("0"),
+						"email": config.Rule("user_{{pk}}@example.com"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+		anon.SetPrimaryKey("users", []string{"id"})
+
+		values := []any{int64(5), "john@example.com"}
+		anon.AnonymiseValues("users", []string{"id", "email"}, values)
+
+		if values[1] != "user_5@example.com" {
+			t.Errorf("email = %v, want user_5@example.com", values[1])
+		}
+	})
+
+	t.Run("no primary key registered", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"logs": {
+					Columns: config.ColumnRuleMap{
+						"ref": config.Rule("log-{{pk}}"),
+					},
+				},
+			},
+		}
+		anon := New(cfg)
+
+		result := anon.AnonymiseRow("logs", map[string]any{"ref": "abc"})
+
+		if result["ref"] != "log-" {
+			t.Errorf("ref = %v, want log-", result["ref"])
+		}
+	})
+}
+
+func TestUsesPrimaryKey(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users":  {Columns: config.ColumnRuleMap{"email": config.Rule("user_{{pk}}@example.com")}},
+			"orders": {Columns: config.ColumnRuleMap{"notes": config.Rule("{{faker.text}}")}},
+		},
+	}
+	anon := New(cfg)
+
+	if !anon.UsesPrimaryKey("users") {
+		t.Error("UsesPrimaryKey(users) = false, want true")
+	}
+	if anon.UsesPrimaryKey("orders") {
+		t.Error("UsesPrimaryKey(orders) = true, want false")
+	}
+	if anon.UsesPrimaryKey("missing") {
+		t.Error("UsesPrimaryKey(missing) = true, want false")
+	}
+}
+
 func TestAnonymiseRow_Concurrent(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
 			"users": {
-				Columns: map[string]string{
-					"email": "{{faker.email}}",
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email}}"),
 				},
 			},
 		},
@@ -299,6 +501,38 @@ func TestShouldTruncate(t *testing.T) {
 	}
 }
 
+func TestShouldTruncate_SchemaOnlyTables(t *testing.T) {
+	cfg := &config.Config{
+		SchemaOnlyTables: []string{"audit_*", "log_*"},
+		Configuration: map[string]*config.TableConfig{
+			"audit_events": {Columns: config.ColumnRuleMap{"ip": config.Rule("{{faker.ipv4}}")}},
+			"log_requests": {Truncate: false, Retain: config.RetainConfig{Count: 10}},
+			"logs":         {Truncate: true},
+			"users":        {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+		},
+	}
+	anon := New(cfg)
+
+	tests := []struct {
+		table string
+		want  bool
+	}{
+		{"audit_events", true}, // pattern wins over column rules
+		{"log_requests", true}, // pattern wins over truncate: false
+		{"audit_unconfigured", true},
+		{"logs", true}, // config truncate still applies
+		{"users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			if got := anon.ShouldTruncate(tt.table); got != tt.want {
+				t.Errorf("ShouldTruncate(%q) = %v, want %v", tt.table, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetRetainConfig(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
@@ -333,12 +567,12 @@ func TestHasAnonymisation(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
 			"users": {
-				Columns: map[string]string{
-					"email": "{{faker.email}}",
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email}}"),
 				},
 			},
 			"orders":  {},
-			"logs":    {Columns: map[string]string{}},
+			"logs":    {Columns: config.ColumnRuleMap{}},
 			"archive": {Columns: nil},
 		},
 	}
@@ -424,9 +658,9 @@ func TestGetAnonymisedColumns(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
 			"users": {
-				Columns: map[string]string{
-					"email": "{{faker.email}}",
-					"phone": "null",
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email}}"),
+					"phone": config.Rule("null"),
 				},
 			},
 			"orders": {},
@@ -474,8 +708,8 @@ func TestClearConsistencyMap(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
 			"users": {
-				Columns: map[string]string{
-					"email": "{{faker.email}}",
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email}}"),
 				},
 			},
 		},
@@ -504,11 +738,11 @@ func TestValidateRules(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email": "{{faker.email}}",
-						"name":  "{{faker.name}}",
-						"role":  "user",
-						"phone": "null",
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.email}}"),
+						"name":  config.Rule("{{faker.name}}"),
+						"role":  config.Rule("user"),
+						"phone": config.Rule("null"),
 					},
 				},
 			},
@@ -525,8 +759,8 @@ func TestValidateRules(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email": "{{faker.invalidFunc}}",
+					Columns: config.ColumnRuleMap{
+						"email": config.Rule("{{faker.invalidFunc}}"),
 					},
 				},
 			},
@@ -543,14 +777,14 @@ func TestValidateRules(t *testing.T) {
 		cfg := &config.Config{
 			Configuration: map[string]*config.TableConfig{
 				"users": {
-					Columns: map[string]string{
-						"email":   "{{faker.email}}",
-						"invalid": "{{faker.unknownFunc}}",
+					Columns: config.ColumnRuleMap{
+						"email":   config.Rule("{{faker.email}}"),
+						"invalid": config.Rule("{{faker.unknownFunc}}"),
 					},
 				},
 				"orders": {
-					Columns: map[string]string{
-						"bad": "{{faker.anotherBadFunc}}",
+					Columns: config.ColumnRuleMap{
+						"bad": config.Rule("{{faker.anotherBadFunc}}"),
 					},
 				},
 			},
@@ -587,3 +821,942 @@ func TestValidateRules(t *testing.T) {
 		}
 	})
 }
+
+func TestAnonymiseRow_Ref(t *testing.T) {
+	newAnonymiser := func() *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")},
+				},
+				"orders": {
+					Columns: config.ColumnRuleMap{"customer_email": config.Rule("{{ref:users.email}}")},
+				},
+				"invoices": {
+					Columns: config.ColumnRuleMap{"billing_email": config.Rule("{{ref:users.email}}")},
+				},
+			},
+		})
+	}
+
+	t.Run("denormalised copy matches source", func(t *testing.T) {
+		anon := newAnonymiser()
+		user := anon.AnonymiseRow("users", map[string]any{"email": "john@example.com"})
+		order := anon.AnonymiseRow("orders", map[string]any{"customer_email": "john@example.com"})
+
+		if user["email"] == "john@example.com" {
+			t.Fatal("source value should be anonymised")
+		}
+		if order["customer_email"] != user["email"] {
+			t.Errorf("customer_email = %v, want %v", order["customer_email"], user["email"])
+		}
+	})
+
+	t.Run("copy exported before source", func(t *testing.T) {
+		anon := newAnonymiser()
+		values := []any{[]byte("jane@example.com")}
+		anon.AnonymiseValues("invoices", []string{"billing_email"}, values)
+		user := anon.AnonymiseRow("users", map[string]any{"email": "jane@example.com"})
+		order := anon.AnonymiseRow("orders", map[string]any{"customer_email": "jane@example.com"})
+
+		if values[0] != user["email"] || order["customer_email"] != user["email"] {
+			t.Errorf("copies %v, %v should match users.email %v", values[0], order["customer_email"], user["email"])
+		}
+	})
+
+	t.Run("different originals get different values", func(t *testing.T) {
+		anon := newAnonymiser()
+		a := anon.AnonymiseRow("orders", map[string]any{"customer_email": "a@example.com"})
+		b := anon.AnonymiseRow("orders", map[string]any{"customer_email": "b@example.com"})
+		if a["customer_email"] == b["customer_email"] {
+			t.Errorf("different originals mapped to the same value %v", a["customer_email"])
+		}
+	})
+
+	t.Run("keyed by table and column", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users":    {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+				"contacts": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+			},
+		})
+		anon.AnonymiseRow("users", map[string]any{"email": "x@example.com"})
+		if _, ok := anon.store.Get(consistencyKey("users", "email", "{{faker.email}}", 0, "x@example.com")); !ok {
+			t.Error("consistency map should be keyed by table.column")
+		}
+	})
+
+	t.Run("unresolvable reference is nulled", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"orders": {Columns: config.ColumnRuleMap{"customer_email": config.Rule("{{ref:users.email}}")}},
+			},
+		})
+		result := anon.AnonymiseRow("orders", map[string]any{"customer_email": "john@example.com"})
+		if result["customer_email"] != nil {
+			t.Errorf("customer_email = %v, want nil", result["customer_email"])
+		}
+	})
+}
+
+func TestValidateRules_Ref(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email}}"),
+					"label": config.Rule("user_{{pk}}"),
+				},
+			},
+			"orders": {
+				Columns: config.ColumnRuleMap{
+					"customer_email": config.Rule("{{ref:users.email}}"),
+					"customer_phone": config.Rule("{{ref:users.phone}}"),
+					"customer_label": config.Rule("{{ref:users.label}}"),
+				},
+			},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	if len(errors) != 2 {
+		t.Errorf("ValidateRules() = %v, want 2 errors", errors)
+	}
+}
+
+func TestAnonymiseRow_FakeAffixes(t *testing.T) {
+	t.Run("inline prefix and suffix", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"name": config.Rule("TEST-{{faker.name}}-END")}},
+			},
+		})
+		result := anon.AnonymiseRow("users", map[string]any{"name": "John Smith"})
+
+		name := result["name"].(string)
+		if !strings.HasPrefix(name, "TEST-") || !strings.HasSuffix(name, "-END") || len(name) <= len("TEST--END") {
+			t.Errorf("name = %q, want TEST-<name>-END", name)
+		}
+	})
+
+	t.Run("multiple tokens", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"name": config.Rule("{{faker.firstName}} {{faker.lastName}}")}},
+			},
+		})
+		result := anon.AnonymiseRow("users", map[string]any{"name": "John Smith"})
+
+		if parts := strings.Split(result["name"].(string), " "); len(parts) < 2 || strings.Contains(result["name"].(string), "{{") {
+			t.Errorf("name = %q, want two expanded tokens", result["name"])
+		}
+	})
+
+	t.Run("global and table affixes", func(t *testing.T) {
+		anon := New(&config.Config{
+			FakePrefix: "TEST-",
+			FakeSuffix: "-X",
+			Configuration: map[string]*config.TableConfig{
+				"users":    {Columns: config.ColumnRuleMap{"name": config.Rule("{{faker.name}}"), "role": config.Rule("admin")}},
+				"partners": {FakePrefix: "PARTNER-", Columns: config.ColumnRuleMap{"name": config.Rule("{{faker.name}}")}},
+			},
+		})
+		user := anon.AnonymiseRow("users", map[string]any{"name": "John", "role": "owner"})
+		partner := anon.AnonymiseRow("partners", map[string]any{"name": "Acme"})
+
+		if name := user["name"].(string); !strings.HasPrefix(name, "TEST-") || !strings.HasSuffix(name, "-X") {
+			t.Errorf("users.name = %q, want TEST-<name>-X", name)
+		}
+		if user["role"] != "admin" {
+			t.Errorf("static value should not be wrapped, got %q", user["role"])
+		}
+		if name := partner["name"].(string); !strings.HasPrefix(name, "PARTNER-") || !strings.HasSuffix(name, "-X") {
+			t.Errorf("partners.name = %q, want PARTNER-<name>-X", name)
+		}
+	})
+
+	t.Run("consistency map holds wrapped value", func(t *testing.T) {
+		anon := New(&config.Config{
+			FakePrefix: "TEST-",
+			Configuration: map[string]*config.TableConfig{
+				"users":  {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+				"orders": {Columns: config.ColumnRuleMap{"customer_email": config.Rule("{{ref:users.email}}")}},
+			},
+		})
+		first := anon.AnonymiseRow("users", map[string]any{"email": "john@example.com"})
+		second := anon.AnonymiseRow("users", map[string]any{"email": "john@example.com"})
+		order := anon.AnonymiseRow("orders", map[string]any{"customer_email": "john@example.com"})
+
+		if !strings.HasPrefix(first["email"].(string), "TEST-") {
+			t.Errorf("email = %q, want TEST- prefix", first["email"])
+		}
+		if second["email"] != first["email"] || order["customer_email"] != first["email"] {
+			t.Errorf("wrapped values differ: %v, %v, %v", first["email"], second["email"], order["customer_email"])
+		}
+		if stored, _ := anon.store.Get(consistencyKey("users", "email", "{{faker.email}}", 0, "john@example.com")); stored != first["email"] {
+			t.Errorf("consistency store = %q, want %q", stored, first["email"])
+		}
+	})
+}
+
+func TestAnonymiseRow_ArrayColumns(t *testing.T) {
+	newAnonymiser := func() *Anonymiser {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"emails": config.Rule("{{faker.email}}"), "tags": config.Rule("redacted")}},
+			},
+		})
+		anon.SetArrayColumns("users", []string{"emails", "tags"})
+		return anon
+	}
+
+	t.Run("fakes each element of a text[] value", func(t *testing.T) {
+		anon := newAnonymiser()
+		result := anon.AnonymiseRow("users", map[string]any{"emails": "{a@example.com,NULL,b@example.com}"})
+
+		elements, ok := parseArrayLiteral(result["emails"].(string))
+		if !ok || len(elements) != 3 {
+			t.Fatalf("emails = %q, want a 3 element array", result["emails"])
+		}
+		if elements[0] == "a@example.com" || elements[2] == "b@example.com" {
+			t.Errorf("elements should be anonymised, got %q", result["emails"])
+		}
+		if elements[1] != nil {
+			t.Errorf("NULL element should be kept, got %v", elements[1])
+		}
+		if !strings.Contains(elements[0].(string), "@") {
+			t.Errorf("element = %q, want an email", elements[0])
+		}
+	})
+
+	t.Run("elements share the consistency map", func(t *testing.T) {
+		anon := newAnonymiser()
+		result := anon.AnonymiseRow("users", map[string]any{"emails": "{a@example.com,a@example.com}"})
+
+		elements, _ := parseArrayLiteral(result["emails"].(string))
+		if len(elements) != 2 || elements[0] != elements[1] {
+			t.Errorf("repeated elements should map to the same value, got %q", result["emails"])
+		}
+	})
+
+	t.Run("non-array values fall back to scalar handling", func(t *testing.T) {
+		anon := newAnonymiser()
+		result := anon.AnonymiseRow("users", map[string]any{"emails": "a@example.com"})
+
+		if email := result["emails"].(string); strings.HasPrefix(email, "{") || !strings.Contains(email, "@") {
+			t.Errorf("emails = %q, want a scalar email", email)
+		}
+	})
+
+	t.Run("static rules replace the whole value", func(t *testing.T) {
+		anon := newAnonymiser()
+		result := anon.AnonymiseRow("users", map[string]any{"tags": "{vip,staff}"})
+
+		if result["tags"] != "redacted" {
+			t.Errorf("tags = %v, want redacted", result["tags"])
+		}
+	})
+
+	t.Run("columns not marked as arrays are scalar", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"emails": config.Rule("{{faker.email}}")}},
+			},
+		})
+		result := anon.AnonymiseRow("users", map[string]any{"emails": "{a@example.com}"})
+
+		if strings.HasPrefix(result["emails"].(string), "{") {
+			t.Errorf("emails = %q, want a scalar value", result["emails"])
+		}
+	})
+}
+
+func TestAnonymiseRow_ShiftDays(t *testing.T) {
+	newAnonymiser := func() *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns: config.ColumnRuleMap{"created_at": config.Rule("{{shift.days(id)}}")},
+				},
+				"events": {
+					Columns: config.ColumnRuleMap{
+						"user_id":     config.Rule("{{faker.number}}"),
+						"occurred_at": config.Rule("{{shift.days(user_id)}}"),
+						"event_date":  config.Rule("{{shift.days(user_id)}}"),
+					},
+				},
+			},
+		})
+	}
+
+	t.Run("preserves intervals per entity", func(t *testing.T) {
+		anon := newAnonymiser()
+		signup := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+		firstLogin := time.Date(2024, 1, 12, 18, 30, 0, 0, time.UTC)
+
+		user := anon.AnonymiseRow("users", map[string]any{"id": int64(7), "created_at": signup})
+		event := anon.AnonymiseRow("events", map[string]any{"user_id": int64(7), "occurred_at": firstLogin})
+
+		shiftedSignup := user["created_at"].(time.Time)
+		shiftedLogin := event["occurred_at"].(time.Time)
+		if shiftedSignup.Equal(signup) {
+			t.Error("created_at should be shifted")
+		}
+		if got, want := shiftedLogin.Sub(shiftedSignup), firstLogin.Sub(signup); got != want {
+			t.Errorf("interval = %v, want %v", got, want)
+		}
+		if days := shiftedSignup.Sub(signup).Hours() / 24; days < -MaxShiftDays || days > MaxShiftDays {
+			t.Errorf("shift of %v days exceeds MaxShiftDays", days)
+		}
+	})
+
+	t.Run("string dates keep their format", func(t *testing.T) {
+		anon := newAnonymiser()
+		values := []any{[]byte("42"), "2024-03-01 12:00:00", "2024-03-05"}
+		anon.AnonymiseValues("events", []string{"user_id", "occurred_at", "event_date"}, values)
+
+		occurred, err := time.Parse("2006-01-02 15:04:05", values[1].(string))
+		if err != nil {
+			t.Fatalf("occurred_at %q lost its format: %v", values[1], err)
+		}
+		eventDate, err := time.Parse("2006-01-02", values[2].(string))
+		if err != nil {
+			t.Fatalf("event_date %q lost its format: %v", values[2], err)
+		}
+		if occurred.Format("2006-01-02") == "2024-03-01" {
+			t.Error("occurred_at should be shifted")
+		}
+		// Both columns use the original user_id, not its anonymised value
+		if got := eventDate.Sub(occurred); got != 4*24*time.Hour-12*time.Hour {
+			t.Errorf("interval = %v, want 84h", got)
+		}
+	})
+
+	t.Run("different entities shift independently", func(t *testing.T) {
+		anon := newAnonymiser()
+		date := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		distinct := make(map[time.Time]bool)
+		for id := int64(1); id <= 20; id++ {
+			row := anon.AnonymiseRow("users", map[string]any{"id": id, "created_at": date})
+			distinct[row["created_at"].(time.Time)] = true
+		}
+		if len(distinct) < 2 {
+			t.Error("expected different offsets for different entities")
+		}
+	})
+
+	t.Run("null and invalid dates", func(t *testing.T) {
+		anon := newAnonymiser()
+		result := anon.AnonymiseRow("users", map[string]any{"id": int64(1), "created_at": nil})
+		if result["created_at"] != nil {
+			t.Errorf("NULL should stay NULL, got %v", result["created_at"])
+		}
+		if anon.unshiftable["users.created_at"] {
+			t.Error("NULL should not be reported as an unrecognisable date")
+		}
+		result = anon.AnonymiseRow("users", map[string]any{"id": int64(1), "created_at": "not a date"})
+		if result["created_at"] != nil {
+			t.Errorf("invalid date should be nulled, got %v", result["created_at"])
+		}
+		if !anon.unshiftable["users.created_at"] {
+			t.Error("invalid date should be warned about")
+		}
+	})
+}
+
+func TestAnonymiseRow_Classification(t *testing.T) {
+	anon := New(&config.Config{
+		Policy: map[string]string{"PII": "{{faker.email}}", "PHI": "null"},
+		Configuration: map[string]*config.TableConfig{
+			"patients": {
+				Classification: map[string]string{"email": "PII", "diagnosis": "PHI", "notes": "PHI"},
+				Columns:        config.ColumnRuleMap{"notes": config.Rule("redacted")},
+			},
+		},
+	})
+
+	result := anon.AnonymiseRow("patients", map[string]any{
+		"email":     "john@example.com",
+		"diagnosis": "flu",
+		"notes":     "private",
+		"id":        int64(1),
+	})
+
+	if email := result["email"].(string); email == "john@example.com" || !strings.Contains(email, "@") {
+		t.Errorf("email = %q, want a fake email from the PII policy", email)
+	}
+	if result["diagnosis"] != nil {
+		t.Errorf("diagnosis = %v, want NULL from the PHI policy", result["diagnosis"])
+	}
+	if result["notes"] != "redacted" {
+		t.Errorf("notes = %v, want explicit rule to take precedence", result["notes"])
+	}
+	if result["id"] != int64(1) {
+		t.Errorf("id = %v, want unchanged", result["id"])
+	}
+	if !anon.HasAnonymisation("patients") || len(anon.GetAnonymisedColumns("patients")) != 3 {
+		t.Errorf("GetAnonymisedColumns() = %v, want classified and explicit columns", anon.GetAnonymisedColumns("patients"))
+	}
+}
+
+func TestValidateRules_Classification(t *testing.T) {
+	anon := New(&config.Config{
+		Policy: map[string]string{"PII": "{{faker.email}}"},
+		Configuration: map[string]*config.TableConfig{
+			"users": {Classification: map[string]string{"email": "PII", "id": "none", "diagnosis": "PHI"}},
+		},
+	})
+
+	warnings := anon.ValidateRules()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'PHI'") || !strings.Contains(warnings[0], "users.diagnosis") {
+		t.Errorf("ValidateRules() = %v, want one warning for the PHI classification", warnings)
+	}
+}
+
+func TestAnonymiseRow_Seeded(t *testing.T) {
+	newAnonymiser := func(salt string) *Anonymiser {
+		return New(&config.Config{
+			FakerSalt: salt,
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{
+					"email": config.Rule("{{faker.email:seeded}}"),
+					"name":  config.Rule("{{faker.firstName:seeded}} {{faker.lastName:seeded}}"),
+					"phone": config.Rule("{{faker.phone:seeded}}"),
+				}},
+			},
+		})
+	}
+	row := map[string]any{"email": "john@example.com", "name": "John Smith", "phone": int64(441234567890)}
+
+	first := newAnonymiser("pepper").AnonymiseRow("users", row)
+	second := newAnonymiser("pepper").AnonymiseRow("users", row)
+
+	t.Run("deterministic across fresh instances", func(t *testing.T) {
+		for _, col := range []string{"email", "name", "phone"} {
+			if first[col] != second[col] {
+				t.Errorf("%s = %q and %q, want the same value", col, first[col], second[col])
+			}
+		}
+		if first["email"] == "john@example.com" || !strings.Contains(first["email"].(string), "@") {
+			t.Errorf("email = %q, want a fake email", first["email"])
+		}
+	})
+
+	t.Run("different originals give different fakes", func(t *testing.T) {
+		other := newAnonymiser("pepper").AnonymiseRow("users", map[string]any{"email": "jane@example.com"})
+		if other["email"] == first["email"] {
+			t.Errorf("email = %q for two originals, want different values", other["email"])
+		}
+	})
+
+	t.Run("salt changes the fakes", func(t *testing.T) {
+		salted := newAnonymiser("other salt").AnonymiseRow("users", row)
+		if salted["email"] == first["email"] {
+			t.Errorf("email = %q with both salts, want different values", salted["email"])
+		}
+	})
+
+	t.Run("validates seeded faker names", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.emial:seeded}}")}},
+			},
+		})
+		if warnings := anon.ValidateRules(); len(warnings) != 1 || !strings.Contains(warnings[0], "'emial'") {
+			t.Errorf("ValidateRules() = %v, want unknown faker function 'emial'", warnings)
+		}
+	})
+}
+
+func TestValidateRules_RetainColumnAnonymised(t *testing.T) {
+	retain := config.RetainConfig{
+		ColumnName: "created_at",
+		AfterDate:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("conflict reported", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"orders": {
+					Retain:  retain,
+					Columns: config.ColumnRuleMap{"created_at": config.Rule("{{faker.date}}")},
+				},
+			},
+		})
+
+		errors := anon.ValidateRules()
+		if len(errors) != 1 || !strings.Contains(errors[0], "retain column 'created_at' for orders is also anonymised") {
+			t.Errorf("ValidateRules() = %v, want retain conflict", errors)
+		}
+	})
+
+	t.Run("other columns anonymised", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"orders": {
+					Retain:  retain,
+					Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")},
+				},
+			},
+		})
+
+		if errors := anon.ValidateRules(); len(errors) != 0 {
+			t.Errorf("ValidateRules() = %v, want none", errors)
+		}
+	})
+}
+
+func TestValidateRules_Truncate(t *testing.T) {
+	tests := []struct {
+		name  string
+		table *config.TableConfig
+		want  []string
+	}{
+		{
+			name:  "column rules",
+			table: &config.TableConfig{Truncate: true, Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+			want:  []string{"truncated table audit_log has column rules, which have no effect"},
+		},
+		{
+			name:  "retain",
+			table: &config.TableConfig{Truncate: true, Retain: config.RetainConfig{Count: 100}},
+			want:  []string{"truncated table audit_log has a retain setting, which has no effect"},
+		},
+		{
+			name: "both",
+			table: &config.TableConfig{
+				Truncate: true,
+				Columns:  config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")},
+				Retain:   config.RetainConfig{Follow: "users"},
+			},
+			want: []string{
+				"truncated table audit_log has column rules, which have no effect",
+				"truncated table audit_log has a retain setting, which has no effect",
+			},
+		},
+		{
+			name:  "truncate alone",
+			table: &config.TableConfig{Truncate: true},
+		},
+		{
+			name:  "not truncated",
+			table: &config.TableConfig{Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}, Retain: config.RetainConfig{Count: 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anon := New(&config.Config{
+				Configuration: map[string]*config.TableConfig{"audit_log": tt.table},
+			})
+
+			if errors := anon.ValidateRules(); !slices.Equal(errors, tt.want) {
+				t.Errorf("ValidateRules() = %v, want %v", errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymiseRow_AnonymiseWhere(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {
+				Columns:        config.ColumnRuleMap{"email": config.Rule("anon@example.com")},
+				AnonymiseWhere: "is_test = 0 AND email != 'admin@example.com'",
+			},
+		},
+	}
+	anon := New(cfg)
+
+	tests := []struct {
+		name string
+		row  map[string]any
+		want any
+	}{
+		{"matching row anonymised", map[string]any{"is_test": int64(0), "email": "john@example.com"}, "anon@example.com"},
+		{"test account unchanged", map[string]any{"is_test": int64(1), "email": "seed@example.com"}, "seed@example.com"},
+		{"excluded email unchanged", map[string]any{"is_test": int64(0), "email": "admin@example.com"}, "admin@example.com"},
+		{"NULL never matches", map[string]any{"is_test": nil, "email": "jane@example.com"}, "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := anon.AnonymiseRow("users", tt.row)
+			if result["email"] != tt.want {
+				t.Errorf("email = %v, want %v", result["email"], tt.want)
+			}
+		})
+
+		t.Run(tt.name+" (values)", func(t *testing.T) {
+			values := []any{tt.row["is_test"], tt.row["email"]}
+			anon.AnonymiseValues("users", []string{"is_test", "email"}, values)
+			if values[1] != tt.want {
+				t.Errorf("email = %v, want %v", values[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymiseRow_ColumnLengths(t *testing.T) {
+	cfg := &config.Config{
+		FakePrefix: "TEST-",
+		Configuration: map[string]*config.TableConfig{
+			"users": {
+				Columns: config.ColumnRuleMap{
+					"code":  config.Rule("{{faker.text}}"),
+					"phone": config.Rule("{{faker.number}}"),
+					"bio":   config.Rule("{{faker.text}}"),
+				},
+			},
+		},
+	}
+	anon := New(cfg)
+	anon.SetColumnLengths("users", map[string]int{"code": 10, "phone": 4})
+
+	for i := 0; i < 50; i++ {
+		row := map[string]any{"code": fmt.Sprintf("code-%d", i), "phone": fmt.Sprintf("0770%d", i), "bio": fmt.Sprintf("bio %d", i)}
+		result := anon.AnonymiseRow("users", row)
+
+		if code := result["code"].(string); utf8.RuneCountInString(code) > 10 {
+			t.Fatalf("code = %q, longer than 10", code)
+		}
+		if phone := result["phone"].(string); utf8.RuneCountInString(phone) > 4 {
+			t.Fatalf("phone = %q, longer than 4", phone)
+		}
+
+		values := []any{fmt.Sprintf("other-%d", i)}
+		anon.AnonymiseValues("users", []string{"code"}, values)
+		if code := values[0].(string); utf8.RuneCountInString(code) > 10 {
+			t.Fatalf("code = %q, longer than 10", code)
+		}
+	}
+
+	// Columns without a declared length are not cut
+	bio := anon.AnonymiseRow("users", map[string]any{"bio": "original"})["bio"].(string)
+	if utf8.RuneCountInString(bio) <= 10 {
+		t.Errorf("bio = %q, want an uncut sentence", bio)
+	}
+}
+
+func TestAnonymiseRow_ColumnLengthsEmail(t *testing.T) {
+	prefix := strings.Repeat("x", 30)
+	cfg := &config.Config{
+		FakePrefix: prefix,
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+		},
+	}
+	anon := New(cfg)
+	anon.SetColumnLengths("users", map[string]int{"email": 40})
+
+	for i := 0; i < 50; i++ {
+		email := anon.AnonymiseRow("users", map[string]any{"email": fmt.Sprintf("user%d@example.com", i)})["email"].(string)
+		local, domain, ok := strings.Cut(email, "@")
+		if utf8.RuneCountInString(email) > 40 || !ok || !strings.HasPrefix(local, "x") || !strings.Contains(domain, ".") {
+			t.Fatalf("email = %q, want an address of at most 40 characters cut in its local part", email)
+		}
+	}
+}
+
+func TestTruncateEmail(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"john.smith@example.com", 0, "john.smith@example.com"},
+		{"john.smith@example.com", 30, "john.smith@example.com"},
+		{"john.smith@example.com", 16, "john@example.com"},
+		{"jöhn.smith@example.com", 14, "jö@example.com"},
+		{"john.smith@example.com", 12, "john.smith@e"},
+		{"not an email", 6, "not an"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateEmail(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateEmail(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo wörld", 7, "héllo w"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymiseRow_CaseInsensitiveConsistency(t *testing.T) {
+	newAnon := func(caseInsensitive []string) *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns:                    config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")},
+					CaseInsensitiveConsistency: caseInsensitive,
+				},
+			},
+		})
+	}
+
+	t.Run("case variants share a fake when enabled", func(t *testing.T) {
+		anon := newAnon([]string{"email"})
+		a := anon.AnonymiseRow("users", map[string]any{"email": "John@Example.com"})
+		b := anon.AnonymiseRow("users", map[string]any{"email": "john@example.com"})
+		if a["email"] != b["email"] {
+			t.Errorf("case variants anonymised to %v and %v, want the same fake", a["email"], b["email"])
+		}
+	})
+
+	t.Run("case variants differ by default", func(t *testing.T) {
+		anon := newAnon(nil)
+		a := anon.AnonymiseRow("users", map[string]any{"email": "John@Example.com"})
+		b := anon.AnonymiseRow("users", map[string]any{"email": "john@example.com"})
+		if a["email"] == b["email"] {
+			t.Errorf("case variants both anonymised to %v, want separate fakes", a["email"])
+		}
+	})
+}
+
+func TestAnonymiseRow_SkipConsistency(t *testing.T) {
+	newAnon := func(skip []string) *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"tickets": {
+					Columns:         config.ColumnRuleMap{"notes": config.Rule("{{faker.text}}"), "email": config.Rule("{{faker.email}}")},
+					SkipConsistency: skip,
+				},
+			},
+		})
+	}
+	row := map[string]any{"notes": "Customer called about an order", "email": "jane@example.com"}
+
+	t.Run("identical originals get fresh fakes", func(t *testing.T) {
+		anon := newAnon([]string{"notes"})
+		fakes := make(map[any]bool)
+		for i := 0; i < 20; i++ {
+			fakes[anon.AnonymiseRow("tickets", row)["notes"]] = true
+		}
+		if len(fakes) < 2 {
+			t.Errorf("20 identical notes anonymised to %d distinct fakes, want fresh fakes", len(fakes))
+		}
+
+		if _, ok := anon.consistencyStore().Get(consistencyKey("tickets", "notes", "{{faker.text}}", 0, row["notes"].(string))); ok {
+			t.Error("skip_consistency column should not be stored")
+		}
+		if _, ok := anon.consistencyStore().Get(consistencyKey("tickets", "email", "{{faker.email}}", 0, "jane@example.com")); !ok {
+			t.Error("other columns should still be stored")
+		}
+	})
+
+	t.Run("identical originals share a fake by default", func(t *testing.T) {
+		anon := newAnon(nil)
+		a := anon.AnonymiseRow("tickets", row)
+		b := anon.AnonymiseRow("tickets", row)
+		if a["notes"] != b["notes"] {
+			t.Errorf("identical notes anonymised to %v and %v, want the same fake", a["notes"], b["notes"])
+		}
+	})
+}
+
+func TestValidateRules_SkipConsistency(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"tickets": {
+				Columns: config.ColumnRuleMap{
+					"notes":  config.Rule("{{faker.text}}"),
+					"status": config.Rule("closed"),
+					"city":   config.Rule("{{faker.city}}"),
+				},
+				SkipConsistency:  []string{"notes", "status", "city"},
+				PreserveDistinct: []string{"city"},
+			},
+			"comments": {Columns: config.ColumnRuleMap{"ticket_notes": config.Rule("{{ref:tickets.notes}}")}},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	want := []string{
+		"skip_consistency column 'status' for tickets has no faker rule",
+		"skip_consistency column 'city' for tickets is also in preserve_distinct",
+		"unresolvable reference 'tickets.notes'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("ValidateRules() = %v, want %d errors", errors, len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errors {
+			if strings.Contains(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ValidateRules() = %v, want an error containing %q", errors, w)
+		}
+	}
+}
+
+func TestAnonymiseRow_PreserveDistinct(t *testing.T) {
+	newAnon := func() *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns:          config.ColumnRuleMap{"city": config.Rule("{{faker.city}}"), "team_id": config.Rule("{{faker.number}}")},
+					PreserveDistinct: []string{"city", "team_id"},
+				},
+			},
+		})
+	}
+
+	// 1000 rows over 50 cities and 20 teams
+	rows := make([]map[string]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"city": fmt.Sprintf("city-%d", i%50), "team_id": int64(i % 20)}
+	}
+
+	t.Run("distinct count preserved", func(t *testing.T) {
+		anon := newAnon()
+		anon.SetDistinctLimit("users", "city", 50)
+		anon.SetDistinctLimit("users", "team_id", 20)
+
+		cities := make(map[any]bool)
+		teams := make(map[any]bool)
+		byCity := make(map[any]any)
+		for _, row := range rows {
+			result := anon.AnonymiseRow("users", row)
+			cities[result["city"]] = true
+			teams[result["team_id"]] = true
+
+			if fake, ok := byCity[row["city"]]; ok && fake != result["city"] {
+				t.Fatalf("%v anonymised to %v and %v", row["city"], fake, result["city"])
+			}
+			byCity[row["city"]] = result["city"]
+		}
+
+		if len(cities) != 50 {
+			t.Errorf("got %d distinct cities, want 50", len(cities))
+		}
+		if len(teams) != 20 {
+			t.Errorf("got %d distinct team ids, want 20", len(teams))
+		}
+	})
+
+	t.Run("fakes recycled once the limit is reached", func(t *testing.T) {
+		anon := newAnon()
+		anon.SetDistinctLimit("users", "city", 5)
+
+		cities := make(map[any]bool)
+		for _, row := range rows {
+			cities[anon.AnonymiseRow("users", row)["city"]] = true
+		}
+		if len(cities) != 5 {
+			t.Errorf("got %d distinct cities, want 5", len(cities))
+		}
+
+		// Recycled fakes are still consistent for each original value
+		first := anon.AnonymiseRow("users", map[string]any{"city": "city-42"})["city"]
+		if again := anon.AnonymiseRow("users", map[string]any{"city": "city-42"})["city"]; again != first {
+			t.Errorf("city-42 anonymised to %v then %v", first, again)
+		}
+	})
+
+	t.Run("missing faker rule reported", func(t *testing.T) {
+		anon := New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {
+					Columns:          config.ColumnRuleMap{"city": config.Rule("London")},
+					PreserveDistinct: []string{"city"},
+				},
+			},
+		})
+
+		errors := anon.ValidateRules()
+		if len(errors) != 1 || !strings.Contains(errors[0], "preserve_distinct column 'city' for users has no faker rule") {
+			t.Errorf("ValidateRules() = %v, want missing faker rule", errors)
+		}
+	})
+}
+
+func TestAnonymiseRow_RulePipeline(t *testing.T) {
+	newAnon := func() *Anonymiser {
+		return New(&config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{
+					"joined": config.Rule("2024-06-15", "{{shift.days(id)}}"),
+					"token":  config.Rule("{{faker.uuid}}", "{{faker.email}}"),
+				}},
+			},
+		})
+	}
+
+	checkJoined := func(t *testing.T, got any) {
+		t.Helper()
+		s, ok := got.(string)
+		if !ok {
+			t.Fatalf("joined = %v (%T), want a shifted date string", got, got)
+		}
+		shifted, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatalf("joined = %q, want a date: %v", s, err)
+		}
+		days := int(shifted.Sub(time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		if days == 0 || days < -MaxShiftDays || days > MaxShiftDays {
+			t.Errorf("joined shifted by %d days, want a non-zero shift within %d", days, MaxShiftDays)
+		}
+	}
+
+	t.Run("each step transforms the previous output", func(t *testing.T) {
+		anon := newAnon()
+		a := anon.AnonymiseRow("users", map[string]any{"id": 1, "joined": "1990-01-01", "token": "abc"})
+		b := anon.AnonymiseRow("users", map[string]any{"id": 1, "joined": "2001-01-01", "token": "abc"})
+
+		checkJoined(t, a["joined"])
+		if a["joined"] != b["joined"] {
+			t.Errorf("joined = %v and %v for the same entity, want the same shifted date", a["joined"], b["joined"])
+		}
+
+		email, ok := a["token"].(string)
+		if !ok || !strings.Contains(email, "@") {
+			t.Errorf("token = %v, want the email of the last step", a["token"])
+		}
+		if a["token"] != b["token"] {
+			t.Errorf("token = %v and %v for the same original, want the same value", a["token"], b["token"])
+		}
+	})
+
+	t.Run("steps keep separate consistency mappings", func(t *testing.T) {
+		anon := newAnon()
+		anon.AnonymiseRow("users", map[string]any{"token": "abc"})
+
+		uuid, ok := anon.store.Get(consistencyKey("users", "token", "{{faker.uuid}}", 0, "abc"))
+		if !ok {
+			t.Fatal("first step was not recorded under the original value")
+		}
+		if _, ok := anon.store.Get(consistencyKey("users", "token", "{{faker.email}}", 1, uuid)); !ok {
+			t.Errorf("second step was not recorded under the first step's output %q", uuid)
+		}
+	})
+
+	t.Run("columnar rows", func(t *testing.T) {
+		anon := newAnon()
+		values := []any{1, "1990-01-01", "abc"}
+		anon.AnonymiseValues("users", []string{"id", "joined", "token"}, values)
+
+		checkJoined(t, values[1])
+		if email, ok := values[2].(string); !ok || !strings.Contains(email, "@") {
+			t.Errorf("token = %v, want the email of the last step", values[2])
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package anonymiser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseArrayLiteral parses a one-dimensional Postgres array literal such as
+// {a,"b c",NULL}. NULL elements are returned as nil. It returns false if s
+// is not an array literal or is multi-dimensional.
+func parseArrayLiteral(s string) ([]any, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, false
+	}
+	body := s[1 : len(s)-1]
+
+	elements := []any{}
+	if strings.TrimSpace(body) == "" {
+		return elements, true
+	}
+
+	for i := 0; ; {
+		// Skip leading whitespace
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+
+		if i < len(body) && body[i] == '"' {
+			// Quoted element, with backslash escapes
+			var elem strings.Builder
+			i++
+			for ; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				elem.WriteByte(body[i])
+			}
+			if i >= len(body) {
+				return nil, false
+			}
+			i++
+			elements = append(elements, elem.String())
+
+			for i < len(body) && body[i] == ' ' {
+				i++
+			}
+		} else {
+			end := strings.IndexByte(body[i:], ',')
+			if end < 0 {
+				end = len(body) - i
+			}
+			token := strings.TrimSpace(body[i : i+end])
+			if token == "" || strings.ContainsAny(token, `{}"`) {
+				return nil, false
+			}
+			if strings.EqualFold(token, "NULL") {
+				elements = append(elements, nil)
+			} else {
+				elements = append(elements, token)
+			}
+			i += end
+		}
+
+		if i >= len(body) {
+			return elements, true
+		}
+		if body[i] != ',' {
+			return nil, false
+		}
+		i++
+	}
+}
+
+// formatArrayLiteral serialises elements as a Postgres array literal,
+// quoting elements where needed. nil elements are written as NULL.
+func formatArrayLiteral(elements []any) string {
+	parts := make([]string, len(elements))
+	for i, elem := range elements {
+		if elem == nil {
+			parts[i] = "NULL"
+			continue
+		}
+		s := fmt.Sprint(elem)
+		if s == "" || strings.EqualFold(s, "NULL") || strings.ContainsAny(s, "{},\"\\ \t\n") {
+			s = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+		parts[i] = s
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
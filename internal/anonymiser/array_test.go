@@ -0,0 +1,61 @@
+package anonymiser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArrayLiteral(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   []any
+		wantOK bool
+	}{
+		{"simple", "{a,b,c}", []any{"a", "b", "c"}, true},
+		{"empty", "{}", []any{}, true},
+		{"quoted", `{"hello world","a,b"}`, []any{"hello world", "a,b"}, true},
+		{"escapes", `{"say \"hi\"","back\\slash"}`, []any{`say "hi"`, `back\slash`}, true},
+		{"null element", "{a,NULL,null}", []any{"a", nil, nil}, true},
+		{"quoted null is a string", `{"NULL"}`, []any{"NULL"}, true},
+		{"not an array", "hello", nil, false},
+		{"json object", `{"a": 1}`, nil, false},
+		{"multi-dimensional", "{{1,2},{3,4}}", nil, false},
+		{"unterminated quote", `{"abc}`, nil, false},
+		{"empty element", "{a,,b}", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseArrayLiteral(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("parseArrayLiteral(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseArrayLiteral(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatArrayLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		elements []any
+		want     string
+	}{
+		{"simple", []any{"a", "b"}, "{a,b}"},
+		{"empty", []any{}, "{}"},
+		{"null", []any{"a", nil}, "{a,NULL}"},
+		{"needs quoting", []any{"hello world", "a,b", "", "NULL"}, `{"hello world","a,b","","NULL"}`},
+		{"escapes", []any{`say "hi"`, `back\slash`}, `{"say \"hi\"","back\\slash"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatArrayLiteral(tt.elements); got != tt.want {
+				t.Errorf("formatArrayLiteral() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
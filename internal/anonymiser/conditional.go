@@ -0,0 +1,32 @@
+package anonymiser
+
+import (
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+// usesConditionalRule reports whether any column rule for tableName is a
+// conditional rule, which needs the original values of the row.
+func (a *Anonymiser) usesConditionalRule(tableName string) bool {
+	for _, rule := range a.rules[tableName] {
+		if rule.IsConditional() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchVariant returns the first variant of a conditional rule whose
+// condition the row's original values match, or the default variant. It
+// reports false if no variant applies, leaving the value unchanged.
+func (a *Anonymiser) matchVariant(variants []config.RuleVariant, row map[string]any) (config.RuleVariant, bool) {
+	for _, v := range variants {
+		if v.When == "" {
+			return v, true
+		}
+		// Invalid conditions are rejected by Config.Validate and never match
+		if cond := a.variantConditions[v.When]; cond != nil && cond.Match(func(c string) any { return row[c] }) {
+			return v, true
+		}
+	}
+	return config.RuleVariant{}, false
+}
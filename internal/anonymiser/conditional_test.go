@@ -0,0 +1,130 @@
+package anonymiser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func TestConditionalRule(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"phone": config.ColumnRule{Variants: []config.RuleVariant{
+					{When: "country = 'US'", Rule: "US-{{faker.number}}"},
+					{When: "country = 'GB' AND is_test = 0", Rule: "GB-{{faker.number}}"},
+					{Rule: "INTL-{{faker.number}}"},
+				}},
+				"email": config.ColumnRule{Variants: []config.RuleVariant{
+					{When: "is_test = 0", Rule: "{{faker.email}}"},
+				}},
+				"label": config.ColumnRule{Variants: []config.RuleVariant{
+					{When: "country IS NULL", Rule: "unknown"},
+					{Rule: `gotemplate:{{.country}}-{{.id}}`},
+				}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		row       map[string]any
+		wantPhone string // Prefix of the phone fake
+		wantEmail any    // Email if kept, or nil if faked
+		wantLabel any
+	}{
+		{
+			name:      "first variant",
+			row:       map[string]any{"id": int64(1), "country": "US", "is_test": int64(0), "phone": "555-0100", "email": "a@real.example", "label": "x"},
+			wantPhone: "US-",
+			wantLabel: "US-1",
+		},
+		{
+			name:      "second variant",
+			row:       map[string]any{"id": int64(2), "country": []byte("GB"), "is_test": int64(0), "phone": "555-0100", "email": "b@real.example", "label": "x"},
+			wantPhone: "GB-",
+			wantLabel: "GB-2",
+		},
+		{
+			name:      "default when no condition matches",
+			row:       map[string]any{"id": int64(3), "country": "GB", "is_test": int64(1), "phone": "555-0100", "email": "test@corp.test", "label": "x"},
+			wantPhone: "INTL-",
+			wantEmail: "test@corp.test",
+			wantLabel: "GB-3",
+		},
+		{
+			name:      "NULL condition column",
+			row:       map[string]any{"id": int64(4), "country": nil, "is_test": int64(1), "phone": "555-0100", "email": "test2@corp.test", "label": "x"},
+			wantPhone: "INTL-",
+			wantEmail: "test2@corp.test",
+			wantLabel: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns := []string{"id", "country", "is_test", "phone", "email", "label"}
+			values := make([]any, len(columns))
+			for i, col := range columns {
+				values[i] = tt.row[col]
+			}
+			New(cfg).AnonymiseValues("users", columns, values)
+			byValues := map[string]any{"phone": values[3], "email": values[4], "label": values[5]}
+			byRow := New(cfg).AnonymiseRow("users", tt.row)
+
+			for name, got := range map[string]map[string]any{"AnonymiseRow()": byRow, "AnonymiseValues()": byValues} {
+				if phone, _ := got["phone"].(string); !strings.HasPrefix(phone, tt.wantPhone) {
+					t.Errorf("%s phone = %v, want a fake starting %s", name, got["phone"], tt.wantPhone)
+				}
+				if tt.wantEmail != nil && got["email"] != tt.wantEmail {
+					t.Errorf("%s email = %v, want it unchanged", name, got["email"])
+				}
+				if tt.wantEmail == nil && (got["email"] == tt.row["email"] || got["email"] == nil) {
+					t.Errorf("%s email = %v, want a fake", name, got["email"])
+				}
+				if got["label"] != tt.wantLabel {
+					t.Errorf("%s label = %v, want %v", name, got["label"], tt.wantLabel)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRules_ConditionalRule(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"phone": config.ColumnRule{Variants: []config.RuleVariant{
+					{When: "country = 'US'", Rule: "{{faker.phone}}"},
+					{Rule: "{{faker.nonexistent}}"},
+				}},
+				"label": config.ColumnRule{Variants: []config.RuleVariant{
+					{When: "country = 'US'", Rule: `gotemplate:{{.country`},
+				}},
+			}, PreserveDistinct: []string{"phone"}},
+			"orders": {Columns: config.ColumnRuleMap{"phone": config.Rule("{{ref:users.phone}}")}},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	want := []string{
+		"unknown faker function 'nonexistent' for users.phone",
+		"invalid gotemplate rule for users.label",
+		"unresolvable reference 'users.phone'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("ValidateRules() = %v, want %d errors", errors, len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errors {
+			if strings.Contains(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ValidateRules() = %v, want an error containing %q", errors, w)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package anonymiser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// entityKeyPrefix starts the consistency store keys of entity identities,
+// e.g. "#entity.email:42". Table names cannot start with #, so they never
+// clash with the keys of columns.
+const entityKeyPrefix = "#entity."
+
+// entityFakeValue expands a faker rule for tableName.col from the fake
+// identity of an entity, so that every faker column of the entity's rows,
+// in any table, describes the same fake person. Identities are derived from
+// the entity id and saved in the consistency store, so a persistent store
+// keeps them stable across exports even if faker_salt changes.
+func (a *Anonymiser) entityFakeValue(tableName, col, rule string, entity any) string {
+	var id string
+	if b, ok := entity.([]byte); ok {
+		id = string(b)
+	} else {
+		id = fmt.Sprint(entity)
+	}
+
+	expanded := fakerPattern.ReplaceAllStringFunc(rule, func(token string) string {
+		return a.entityField(id, fakerPattern.FindStringSubmatch(token)[1])
+	})
+	return a.wrapFake(tableName, col, rule, expanded)
+}
+
+// entityField returns the named faker field of an entity's identity,
+// generating and storing the identity the first time it is needed.
+func (a *Anonymiser) entityField(id, name string) string {
+	store := a.consistencyStore()
+	key := entityKeyPrefix + name + ":" + id
+	if cached, ok := store.Get(key); ok {
+		return cached
+	}
+
+	// The person's fields are stored together, so that they stay coherent
+	// even if some were generated in an earlier export
+	seed := seedFor(a.config.FakerSalt, entityKeyPrefix+id)
+	person := entityPerson(seed)
+	value, ok := person[name]
+	if ok {
+		for field, v := range person {
+			fieldKey := entityKeyPrefix + field + ":" + id
+			if _, ok := store.Get(fieldKey); !ok {
+				store.Set(fieldKey, v)
+			}
+		}
+	} else {
+		value = GenerateSeededFakeValue(name, seedFor(a.config.FakerSalt, key))
+		store.Set(key, value)
+	}
+	return value
+}
+
+// entityPerson generates a fake person from seed, whose name, username and
+// email address match one another.
+func entityPerson(seed int64) map[string]string {
+	f := gofakeit.NewUnlocked(seed)
+	first, last := f.FirstName(), f.LastName()
+	username := strings.ToLower(strings.Map(func(r rune) rune {
+		if r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, first+"."+last))
+
+	return map[string]string{
+		"firstName": first,
+		"lastName":  last,
+		"name":      first + " " + last,
+		"username":  username,
+		"email":     username + "@" + f.DomainName(),
+		"phone":     f.Phone(),
+	}
+}
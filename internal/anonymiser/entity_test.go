@@ -0,0 +1,107 @@
+package anonymiser
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func entityConfig(salt string) *config.Config {
+	return &config.Config{
+		FakerSalt: salt,
+		Configuration: map[string]*config.TableConfig{
+			"users": {
+				EntityColumn: "id",
+				Columns: config.ColumnRuleMap{
+					"name":  config.Rule("{{faker.name}}"),
+					"email": config.Rule("{{faker.email}}"),
+					"phone": config.Rule("{{faker.phone}}"),
+				},
+			},
+			"orders": {
+				EntityColumn: "user_id",
+				Columns: config.ColumnRuleMap{
+					"customer_first_name": config.Rule("{{faker.firstName}}"),
+					"customer_email":      config.Rule("{{faker.email}}"),
+					"delivery_city":       config.Rule("{{faker.city}}"),
+				},
+			},
+		},
+	}
+}
+
+func TestEntityColumn(t *testing.T) {
+	anon := New(entityConfig("salt"))
+
+	user := anon.AnonymiseRow("users", map[string]any{"id": int64(42), "name": "Alice Smith", "email": "alice@example.com", "phone": "0113 496 0000"})
+	name, email := user["name"].(string), user["email"].(string)
+	if name == "Alice Smith" || email == "alice@example.com" || user["phone"] == "0113 496 0000" {
+		t.Fatalf("user = %v, want every column faked", user)
+	}
+
+	// The email address is made from the fake name
+	first, _, _ := strings.Cut(name, " ")
+	if !strings.HasPrefix(email, strings.ToLower(first)+".") {
+		t.Errorf("email = %q, want it made from name %q", email, name)
+	}
+
+	// Another table's rows of the same entity share the identity
+	order := anon.AnonymiseRow("orders", map[string]any{"user_id": []byte("42"), "customer_first_name": "Alice", "customer_email": "alice@example.com", "delivery_city": "Leeds"})
+	if order["customer_first_name"] != first || order["customer_email"] != email {
+		t.Errorf("order = %v, want the first name %q and email %q of user 42", order, first, email)
+	}
+
+	// Columnar rows are given the same identity
+	values := []any{int64(42), "Alice", "someone@example.com", "York"}
+	anon.AnonymiseValues("orders", []string{"user_id", "customer_first_name", "customer_email", "delivery_city"}, values)
+	if values[1] != first || values[2] != email || values[3] != order["delivery_city"] {
+		t.Errorf("values = %v, want the identity of user 42", values)
+	}
+
+	// Another entity is given another identity
+	other := anon.AnonymiseRow("users", map[string]any{"id": int64(43), "name": "Alice Smith", "email": "alice@example.com"})
+	if other["name"] == name && other["email"] == email {
+		t.Errorf("user 43 = %v, want an identity other than user 42's", other)
+	}
+
+	// Rows without an entity are faked by their own values
+	orphan := anon.AnonymiseRow("orders", map[string]any{"user_id": nil, "customer_email": "alice@example.com"})
+	if orphan["customer_email"] == email || orphan["customer_email"] == "alice@example.com" {
+		t.Errorf("orphan = %v, want a fake of its own", orphan)
+	}
+}
+
+func TestEntityColumn_AcrossRuns(t *testing.T) {
+	row := map[string]any{"id": int64(7), "name": "Bob Jones", "email": "bob@example.com", "phone": "0113 496 0001"}
+	first := New(entityConfig("salt")).AnonymiseRow("users", row)
+
+	// The identity is derived from the id, so the same salt gives it again
+	if again := New(entityConfig("salt")).AnonymiseRow("users", row); !maps.Equal(again, first) {
+		t.Errorf("second run = %v, want %v", again, first)
+	}
+
+	// A persistent store keeps identities even if the salt changes
+	path := filepath.Join(t.TempDir(), "consistency.db")
+	var want map[string]any
+	for run, salt := range []string{"salt", "rotated"} {
+		store, err := NewSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("NewSQLiteStore() error = %v", err)
+		}
+		anon := New(entityConfig(salt))
+		anon.SetConsistencyStore(store)
+		got := anon.AnonymiseRow("users", row)
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		if run == 0 {
+			want = got
+		} else if !maps.Equal(got, want) {
+			t.Errorf("run with the store = %v, want %v", got, want)
+		}
+	}
+}
@@ -7,30 +7,60 @@ import (
 // FakerFunc is a function that generates fake data.
 type FakerFunc func() string
 
+// defaultFaker generates unseeded fake data.
+var defaultFaker = gofakeit.New(0)
+
 // fakerFunctions maps faker template names to their implementations.
-var fakerFunctions = map[string]FakerFunc{
-	"name":      func() string { return gofakeit.Name() },
-	"firstName": func() string { return gofakeit.FirstName() },
-	"lastName":  func() string { return gofakeit.LastName() },
-	"email":     func() string { return gofakeit.Email() },
-	"phone":     func() string { return gofakeit.Phone() },
-	"address":   func() string { return gofakeit.Street() },
-	"city":      func() string { return gofakeit.City() },
-	"country":   func() string { return gofakeit.Country() },
-	"company":   func() string { return gofakeit.Company() },
-	"uuid":      func() string { return gofakeit.UUID() },
-	"username":  func() string { return gofakeit.Username() },
-	"password":  func() string { return gofakeit.Password(true, true, true, true, false, 32) },
-	"ipv4":      func() string { return gofakeit.IPv4Address() },
-	"date":      func() string { return gofakeit.Date().Format("2006-01-02") },
-	"text":      func() string { return gofakeit.Sentence(10) },
-	"number":    func() string { return gofakeit.DigitN(8) },
+var fakerFunctions = map[string]func(f *gofakeit.Faker) string{
+	"name":      (*gofakeit.Faker).Name,
+	"firstName": (*gofakeit.Faker).FirstName,
+	"lastName":  (*gofakeit.Faker).LastName,
+	"email":     (*gofakeit.Faker).Email,
+	"phone":     (*gofakeit.Faker).Phone,
+	"address":   (*gofakeit.Faker).Street,
+	"city":      (*gofakeit.Faker).City,
+	"country":   (*gofakeit.Faker).Country,
+	"company":   (*gofakeit.Faker).Company,
+	"uuid":      (*gofakeit.Faker).UUID,
+	"username":  (*gofakeit.Faker).Username,
+	"password":  func(f *gofakeit.Faker) string { return f.Password(true, true, true, true, false, 32) },
+	"ipv4":      (*gofakeit.Faker).IPv4Address,
+	"date":      func(f *gofakeit.Faker) string { return f.Date().Format("2006-01-02") },
+	"text":      func(f *gofakeit.Faker) string { return f.Sentence(10) },
+	"number":    func(f *gofakeit.Faker) string { return f.DigitN(8) },
+
+	"jobTitle":      (*gofakeit.Faker).JobTitle,
+	"jobDescriptor": (*gofakeit.Faker).JobDescriptor,
+	"department":    func(f *gofakeit.Faker) string { return f.RandomString(departments) },
+
+	"url":        (*gofakeit.Faker).URL,
+	"domainName": (*gofakeit.Faker).DomainName,
+
+	// US ZIP codes only, there being no locale setting; postcode is an alias
+	"postcode": (*gofakeit.Faker).Zip,
+	"zip":      (*gofakeit.Faker).Zip,
+
+	"state":       (*gofakeit.Faker).State,
+	"fullAddress": func(f *gofakeit.Faker) string { return f.Address().Address },
+}
+
+// departments are the names the department faker picks from, which gofakeit
+// does not provide.
+var departments = []string{
+	"Accounting", "Customer Service", "Engineering", "Facilities", "Finance",
+	"Human Resources", "Information Technology", "Legal", "Logistics", "Marketing",
+	"Operations", "Procurement", "Product", "Quality Assurance", "Research and Development",
+	"Sales", "Security", "Training",
 }
 
 // GetFakerFunc returns the faker function for a given name.
 // Returns nil if the function doesn't exist.
 func GetFakerFunc(name string) FakerFunc {
-	return fakerFunctions[name]
+	fn, ok := fakerFunctions[name]
+	if !ok {
+		return nil
+	}
+	return func() string { return fn(defaultFaker) }
 }
 
 // ListFakerFunctions returns all available faker function names.
@@ -50,3 +80,13 @@ func GenerateFakeValue(funcName string) string {
 	}
 	return ""
 }
+
+// GenerateSeededFakeValue generates a fake value from a faker seeded with
+// seed, so the same seed always gives the same value.
+// Returns empty string if the function doesn't exist.
+func GenerateSeededFakeValue(funcName string, seed int64) string {
+	if fn, ok := fakerFunctions[funcName]; ok {
+		return fn(gofakeit.NewUnlocked(seed))
+	}
+	return ""
+}
@@ -1,7 +1,10 @@
 package anonymiser
 
 import (
+	"net/url"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -10,6 +13,8 @@ func TestGetFakerFunc(t *testing.T) {
 		"name", "firstName", "lastName", "email", "phone",
 		"address", "city", "country", "company", "uuid",
 		"username", "password", "ipv4", "date", "text", "number",
+		"jobTitle", "jobDescriptor", "department", "url", "domainName",
+		"postcode", "zip", "state", "fullAddress",
 	}
 
 	for _, name := range validFunctions {
@@ -39,7 +44,7 @@ func TestGetFakerFunc(t *testing.T) {
 func TestListFakerFunctions(t *testing.T) {
 	functions := ListFakerFunctions()
 
-	expectedCount := 16
+	expectedCount := 25
 	if len(functions) != expectedCount {
 		t.Errorf("ListFakerFunctions() returned %d functions, want %d", len(functions), expectedCount)
 	}
@@ -157,6 +162,62 @@ func TestGenerateFakeValue(t *testing.T) {
 			},
 			desc: "should return 8-digit number string",
 		},
+		{
+			funcName: "jobTitle",
+			validate: func(s string) bool { return len(s) > 0 },
+			desc:     "should return non-empty string",
+		},
+		{
+			funcName: "jobDescriptor",
+			validate: func(s string) bool { return len(s) > 0 },
+			desc:     "should return non-empty string",
+		},
+		{
+			funcName: "department",
+			validate: func(s string) bool { return slices.Contains(departments, s) },
+			desc:     "should return one of the department names",
+		},
+		{
+			funcName: "url",
+			validate: func(s string) bool {
+				u, err := url.Parse(s)
+				return err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.Contains(u.Host, ".")
+			},
+			desc: "should return an http or https URL with a domain",
+		},
+		{
+			funcName: "domainName",
+			validate: func(s string) bool {
+				return regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`).MatchString(s)
+			},
+			desc: "should return a lowercase domain name with a top-level domain",
+		},
+		{
+			funcName: "postcode",
+			validate: func(s string) bool {
+				return regexp.MustCompile(`^\d{5}$`).MatchString(s)
+			},
+			desc: "should return a 5-digit ZIP code",
+		},
+		{
+			funcName: "zip",
+			validate: func(s string) bool {
+				return regexp.MustCompile(`^\d{5}$`).MatchString(s)
+			},
+			desc: "should return a 5-digit ZIP code",
+		},
+		{
+			funcName: "state",
+			validate: func(s string) bool { return len(s) > 0 },
+			desc:     "should return non-empty string",
+		},
+		{
+			funcName: "fullAddress",
+			validate: func(s string) bool {
+				return regexp.MustCompile(`^[^,]+, [^,]+, [A-Za-z ]+ \d{5}$`).MatchString(s)
+			},
+			desc: "should return street, city, state and ZIP code on one line",
+		},
 	}
 
 	for _, tt := range tests {
@@ -208,10 +269,28 @@ func TestFakerFunctionDirectCalls(t *testing.T) {
 	// Test that each function in fakerFunctions can be called directly
 	for name, fn := range fakerFunctions {
 		t.Run(name, func(t *testing.T) {
-			result := fn()
+			result := fn(defaultFaker)
 			if result == "" {
 				t.Errorf("faker function %q returned empty string", name)
 			}
 		})
 	}
 }
+
+func TestGenerateSeededFakeValue(t *testing.T) {
+	for name := range fakerFunctions {
+		t.Run(name, func(t *testing.T) {
+			first := GenerateSeededFakeValue(name, 42)
+			if first == "" {
+				t.Fatalf("GenerateSeededFakeValue(%q) returned empty string", name)
+			}
+			if second := GenerateSeededFakeValue(name, 42); second != first {
+				t.Errorf("GenerateSeededFakeValue(%q, 42) = %q then %q, want the same value", name, first, second)
+			}
+		})
+	}
+
+	if got := GenerateSeededFakeValue("nonexistent", 42); got != "" {
+		t.Errorf("GenerateSeededFakeValue(nonexistent) = %q, want empty string", got)
+	}
+}
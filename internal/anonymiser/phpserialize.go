@@ -0,0 +1,221 @@
+package anonymiser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// phpSerializePrefix starts a rule that anonymises fields of PHP serialized
+// data, e.g. {{phpserialize.replace:email:{{faker.email}}}}.
+const phpSerializePrefix = "{{phpserialize."
+
+// phpSerializePattern matches {{phpserialize.replace:key:rule}} rules,
+// capturing the key and the rule its string values are anonymised with.
+var phpSerializePattern = regexp.MustCompile(`^\{\{phpserialize\.replace:(\w+):(.+)\}\}$`)
+
+// errPHPSerialize is returned for values that are not PHP serialized data.
+var errPHPSerialize = errors.New("invalid PHP serialized data")
+
+// replacePHPSerialized anonymises the string values of every array key or
+// object property named key in a column of PHP serialized data, at any depth,
+// with rule. Length prefixes are recalculated for the new values. Values that
+// are not PHP serialized data are set to NULL, so the original is never
+// exported, and empty strings are kept.
+func (a *Anonymiser) replacePHPSerialized(tableName, col, key, rule string, step int, val any) any {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil
+	}
+	if s == "" {
+		return s
+	}
+
+	r := &phpReplacer{key: key, replace: func(original string) any {
+		// Keys are mapped apart, so that the same original under two keys
+		// can be given fakes of different kinds
+		return a.anonymiseValue(tableName, col+"."+key, rule, step, original)
+	}}
+	rest, err := r.value(s, false)
+	if err != nil || rest != "" {
+		return nil
+	}
+	return r.out.String()
+}
+
+// phpReplacer copies PHP serialized data to out, replacing the string values
+// of key.
+type phpReplacer struct {
+	key     string
+	replace func(original string) any
+	out     strings.Builder
+}
+
+// value copies the serialized value at the start of s, replacing it if it is
+// a string and matched, and returns the rest of s.
+func (r *phpReplacer) value(s string, matched bool) (string, error) {
+	if len(s) < 2 {
+		return "", errPHPSerialize
+	}
+
+	switch s[0] {
+	case 'N':
+		if s[1] != ';' {
+			return "", errPHPSerialize
+		}
+		r.out.WriteString("N;")
+		return s[2:], nil
+
+	case 'b', 'i', 'd', 'r', 'R':
+		end := strings.IndexByte(s, ';')
+		if s[1] != ':' || end < 0 {
+			return "", errPHPSerialize
+		}
+		r.out.WriteString(s[:end+1])
+		return s[end+1:], nil
+
+	case 's', 'E':
+		str, rest, err := phpString(s)
+		if err != nil {
+			return "", err
+		}
+		if matched && s[0] == 's' {
+			r.out.WriteString(formatPHPString(r.replace(str)))
+		} else {
+			r.out.WriteString(s[:len(s)-len(rest)])
+		}
+		return rest, nil
+
+	case 'a':
+		n, rest, ok := phpLength(s[1:])
+		if !ok || !strings.HasPrefix(rest, "{") {
+			return "", errPHPSerialize
+		}
+		r.out.WriteString(s[:len(s)-len(rest)+1])
+		return r.pairs(rest[1:], n)
+
+	case 'O':
+		// O:8:"stdClass":1:{...}
+		l, rest, ok := phpLength(s[1:])
+		if !ok {
+			return "", errPHPSerialize
+		}
+		if _, rest, ok = phpQuoted(rest, l); !ok {
+			return "", errPHPSerialize
+		}
+		n, rest, ok := phpLength(rest)
+		if !ok || !strings.HasPrefix(rest, "{") {
+			return "", errPHPSerialize
+		}
+		r.out.WriteString(s[:len(s)-len(rest)+1])
+		return r.pairs(rest[1:], n)
+
+	case 'C':
+		// Classes serialize themselves, as C:5:"Class":12:{...12 bytes...}
+		l, rest, ok := phpLength(s[1:])
+		if !ok {
+			return "", errPHPSerialize
+		}
+		if _, rest, ok = phpQuoted(rest, l); !ok {
+			return "", errPHPSerialize
+		}
+		n, rest, ok := phpLength(rest)
+		if !ok || len(rest) < n+2 || rest[0] != '{' || rest[n+1] != '}' {
+			return "", errPHPSerialize
+		}
+		rest = rest[n+2:]
+		r.out.WriteString(s[:len(s)-len(rest)])
+		return rest, nil
+	}
+
+	return "", errPHPSerialize
+}
+
+// pairs copies the n keys and values of an array or object, and its closing
+// brace, from the start of s.
+func (r *phpReplacer) pairs(s string, n int) (string, error) {
+	for i := 0; i < n; i++ {
+		// Object properties are prefixed with \0*\0 if protected and
+		// \0Class\0 if private
+		var name string
+		if strings.HasPrefix(s, "s:") {
+			str, _, err := phpString(s)
+			if err != nil {
+				return "", err
+			}
+			name = str[strings.LastIndexByte(str, 0)+1:]
+		}
+
+		rest, err := r.value(s, false)
+		if err != nil {
+			return "", err
+		}
+		if s, err = r.value(rest, name == r.key); err != nil {
+			return "", err
+		}
+	}
+
+	if !strings.HasPrefix(s, "}") {
+		return "", errPHPSerialize
+	}
+	r.out.WriteString("}")
+	return s[1:], nil
+}
+
+// phpString reads a serialized string, s:5:"value";, from the start of s.
+func phpString(s string) (string, string, error) {
+	n, rest, ok := phpLength(s[1:])
+	if !ok {
+		return "", "", errPHPSerialize
+	}
+	str, rest, ok := phpQuoted(rest, n)
+	if !ok || !strings.HasPrefix(rest, ";") {
+		return "", "", errPHPSerialize
+	}
+	return str, rest[1:], nil
+}
+
+// phpLength reads a length, :5:, from the start of s.
+func phpLength(s string) (int, string, bool) {
+	if !strings.HasPrefix(s, ":") {
+		return 0, s, false
+	}
+	end := strings.IndexByte(s[1:], ':')
+	if end < 1 {
+		return 0, s, false
+	}
+	n, err := strconv.Atoi(s[1 : end+1])
+	if err != nil || n < 0 {
+		return 0, s, false
+	}
+	return n, s[end+2:], true
+}
+
+// phpQuoted reads n bytes in double quotes from the start of s.
+func phpQuoted(s string, n int) (string, string, bool) {
+	if len(s) < n+2 || s[0] != '"' || s[n+1] != '"' {
+		return "", s, false
+	}
+	return s[1 : n+1], s[n+2:], true
+}
+
+// formatPHPString serializes an anonymised value as a string, or NULL.
+func formatPHPString(val any) string {
+	if val == nil {
+		return "N;"
+	}
+	s, ok := val.(string)
+	if !ok {
+		s = fmt.Sprint(val)
+	}
+	return "s:" + strconv.Itoa(len(s)) + `:"` + s + `";`
+}
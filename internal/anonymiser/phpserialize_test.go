@@ -0,0 +1,170 @@
+package anonymiser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func TestPHPSerializeReplace(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		val  any
+		want any
+	}{
+		{
+			name: "array key",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  `a:2:{s:5:"email";s:17:"alice@example.com";s:4:"name";s:5:"Alice";}`,
+			want: `a:2:{s:5:"email";s:8:"REDACTED";s:4:"name";s:5:"Alice";}`,
+		},
+		{
+			name: "length counts bytes",
+			rule: "{{phpserialize.replace:city:Zürich}}",
+			val:  []byte(`a:1:{s:4:"city";s:5:"Leeds";}`),
+			want: `a:1:{s:4:"city";s:7:"Zürich";}`,
+		},
+		{
+			name: "nested arrays",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  `a:2:{s:5:"email";s:5:"a@b.c";s:7:"profile";a:2:{i:0;s:5:"email";s:5:"email";s:11:"x\";s:1:\"y";}}`,
+			want: `a:2:{s:5:"email";s:8:"REDACTED";s:7:"profile";a:2:{i:0;s:5:"email";s:5:"email";s:8:"REDACTED";}}`,
+		},
+		{
+			name: "protected object property",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  "O:4:\"User\":2:{s:8:\"\x00*\x00email\";s:5:\"a@b.c\";s:2:\"id\";i:7;}",
+			want: "O:4:\"User\":2:{s:8:\"\x00*\x00email\";s:8:\"REDACTED\";s:2:\"id\";i:7;}",
+		},
+		{
+			name: "key as a value is not a key",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  `a:2:{s:4:"type";s:5:"email";s:4:"name";s:3:"Bob";}`,
+			want: `a:2:{s:4:"type";s:5:"email";s:4:"name";s:3:"Bob";}`,
+		},
+		{
+			name: "non-string values are kept",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  `a:3:{s:5:"email";N;s:6:"active";b:1;s:5:"score";d:0.5;}`,
+			want: `a:3:{s:5:"email";N;s:6:"active";b:1;s:5:"score";d:0.5;}`,
+		},
+		{
+			name: "null rule",
+			rule: "{{phpserialize.replace:email:null}}",
+			val:  `a:1:{s:5:"email";s:5:"a@b.c";}`,
+			want: `a:1:{s:5:"email";N;}`,
+		},
+		{
+			name: "wrong length prefix",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  `a:1:{s:5:"email";s:9:"a@b.c";}`,
+			want: nil,
+		},
+		{
+			name: "not serialized",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  "alice@example.com",
+			want: nil,
+		},
+		{
+			name: "NULL",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  nil,
+			want: nil,
+		},
+		{
+			name: "empty string",
+			rule: "{{phpserialize.replace:email:REDACTED}}",
+			val:  "",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Configuration: map[string]*config.TableConfig{
+					"sessions": {Columns: config.ColumnRuleMap{"data": config.Rule(tt.rule)}},
+				},
+			}
+
+			got := New(cfg).AnonymiseRow("sessions", map[string]any{"data": tt.val})["data"]
+			if got != tt.want {
+				t.Errorf("data = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPHPSerializeReplace_Faker(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"sessions": {Columns: config.ColumnRuleMap{
+				"data": config.Rule(
+					"{{phpserialize.replace:email:{{faker.email}}}}",
+					"{{phpserialize.replace:name:{{faker.name}}}}",
+				),
+			}},
+		},
+	}
+	anon := New(cfg)
+
+	original := `a:2:{s:5:"email";s:17:"alice@example.com";s:4:"name";s:5:"Alice";}`
+	first := anon.AnonymiseRow("sessions", map[string]any{"data": original})["data"].(string)
+	second := anon.AnonymiseRow("sessions", map[string]any{"data": original})["data"].(string)
+	if first != second {
+		t.Errorf("data = %q and %q, want the same fakes for the same originals", first, second)
+	}
+
+	// Every string's length prefix matches the fake written
+	fields := regexp.MustCompile(`s:(\d+):"([^"]*)";`).FindAllStringSubmatch(first, -1)
+	if len(fields) != 4 {
+		t.Fatalf("data = %q, want 4 strings", first)
+	}
+	for _, s := range fields {
+		if n, _ := strconv.Atoi(s[1]); n != len(s[2]) {
+			t.Errorf("string %q has length prefix %d, want %d", s[2], n, len(s[2]))
+		}
+	}
+	if fields[1][2] == "alice@example.com" || fields[3][2] == "Alice" {
+		t.Errorf("data = %q, want the email and name faked", first)
+	}
+}
+
+func TestValidateRules_PHPSerialize(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"sessions": {Columns: config.ColumnRuleMap{
+				"data":    config.Rule("{{phpserialize.replace:email:{{faker.email}}}}"),
+				"profile": config.Rule("{{phpserialize.email}}"),
+				"extra":   config.Rule("{{phpserialize.replace:email:{{faker.nonexistent}}}}"),
+			}},
+			"orders": {Columns: config.ColumnRuleMap{"session": config.Rule("{{ref:sessions.data}}")}},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	want := []string{
+		"invalid phpserialize rule for sessions.profile",
+		"unknown faker function 'nonexistent' for sessions.extra",
+		"unresolvable reference 'sessions.data'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("ValidateRules() = %v, want %d errors", errors, len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errors {
+			if strings.Contains(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ValidateRules() = %v, want an error containing %q", errors, w)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package anonymiser
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// shuffleRule is the column rule that deals a column's own values out to
+// its rows again in a random order, keeping their exact distribution.
+const shuffleRule = "{{shuffle}}"
+
+// shufflePool holds the shuffled values of a {{shuffle}} column and how many
+// have been dealt out.
+type shufflePool struct {
+	values []any
+	next   int
+}
+
+// ShuffleColumns returns the columns of tableName whose rule is {{shuffle}},
+// in name order. Their values must be given to SetShuffleValues before the
+// table's rows are anonymised.
+func (a *Anonymiser) ShuffleColumns(tableName string) []string {
+	var columns []string
+	for col, rule := range a.rules[tableName] {
+		if rule.Is(shuffleRule) {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// SetShuffleValues shuffles the values of tableName.col, read from the rows
+// about to be exported, to be dealt out to those rows in turn. The shuffle is
+// a single cycle, so when the rows are read in the same order again no row is
+// given back its own value.
+func (a *Anonymiser) SetShuffleValues(tableName, col string, values []any) {
+	for i := len(values) - 1; i > 0; i-- {
+		j := rand.IntN(i)
+		values[i], values[j] = values[j], values[i]
+	}
+
+	a.shuffleMu.Lock()
+	a.shuffled[tableName+"."+col] = &shufflePool{values: values}
+	a.shuffleMu.Unlock()
+}
+
+// nextShuffled returns the next value of tableName.col's shuffled values. Rows
+// beyond those the values were read from, e.g. inserted since, are set to
+// NULL.
+func (a *Anonymiser) nextShuffled(tableName, col string) any {
+	a.shuffleMu.Lock()
+	defer a.shuffleMu.Unlock()
+
+	pool := a.shuffled[tableName+"."+col]
+	if pool == nil || pool.next >= len(pool.values) {
+		return nil
+	}
+	val := pool.values[pool.next]
+	pool.next++
+	return val
+}
+
+// isShuffle reports whether a rule step uses {{shuffle}}.
+func isShuffle(step string) bool {
+	return strings.Contains(step, shuffleRule)
+}
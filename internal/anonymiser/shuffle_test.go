@@ -0,0 +1,91 @@
+package anonymiser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func TestShuffle(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"salary": config.Rule("{{shuffle}}"),
+				"city":   config.Rule("{{shuffle}}"),
+				"email":  config.Rule("{{faker.email}}"),
+			}},
+		},
+	}
+	anon := New(cfg)
+
+	if got := anon.ShuffleColumns("users"); !slices.Equal(got, []string{"city", "salary"}) {
+		t.Fatalf("ShuffleColumns() = %v, want [city salary]", got)
+	}
+
+	original := []any{int64(10), int64(20), int64(20), int64(30), nil}
+	anon.SetShuffleValues("users", "salary", slices.Clone(original))
+
+	var got []any
+	for i, val := range original {
+		row := anon.AnonymiseRow("users", map[string]any{"salary": val})
+		got = append(got, row["salary"])
+		if i != 1 && i != 2 && row["salary"] == val {
+			t.Errorf("row %d kept its own value %v", i, val)
+		}
+	}
+
+	sortValues := func(values []any) []string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = fmt.Sprint(v)
+		}
+		slices.Sort(s)
+		return s
+	}
+	if !slices.Equal(sortValues(got), sortValues(original)) {
+		t.Errorf("values = %v, want a reordering of %v", got, original)
+	}
+
+	// Rows beyond those read are set to NULL
+	if extra := anon.AnonymiseRow("users", map[string]any{"salary": int64(40)})["salary"]; extra != nil {
+		t.Errorf("extra row salary = %v, want NULL", extra)
+	}
+}
+
+func TestValidateRules_Shuffle(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {
+				AnonymiseWhere: "is_test = 0",
+				Columns: config.ColumnRuleMap{
+					"salary": config.Rule("{{shuffle}}"),
+					"city":   config.Rule("{{shuffle}}", "{{faker.city}}"),
+				},
+			},
+			"orders": {Columns: config.ColumnRuleMap{"salary": config.Rule("{{ref:users.salary}}")}},
+			"payslips": {
+				Retain:  config.RetainConfig{Follow: "users"},
+				Columns: config.ColumnRuleMap{"amount": config.Rule("{{shuffle}}")},
+			},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	want := []string{
+		"{{shuffle}} must be the whole rule for users.city",
+		"{{shuffle}} column users.salary also deals out the values of rows anonymise_where leaves unchanged",
+		"{{shuffle}} column payslips.amount also deals out the values of rows retain follow leaves out",
+		"unresolvable reference 'users.salary'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("ValidateRules() = %v, want %d errors", errors, len(want))
+	}
+	for _, w := range want {
+		if !slices.ContainsFunc(errors, func(e string) bool { return strings.Contains(e, w) }) {
+			t.Errorf("ValidateRules() = %v, want an error containing %q", errors, w)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package anonymiser
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ConsistencyStore holds the anonymised value given to each original value,
+// so that the same original is always replaced by the same fake. Keys are
+// of the form "table.column:original". Implementations must be safe for
+// concurrent use.
+type ConsistencyStore interface {
+	// Get returns the value stored for key, and whether there is one.
+	Get(key string) (string, bool)
+
+	// Set stores value for key, replacing any value already stored.
+	Set(key, value string)
+}
+
+// MemoryStore is a ConsistencyStore held in memory for a single export.
+// It is the default store.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]string)}
+}
+
+// Get returns the value stored for key.
+func (s *MemoryStore) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Set stores value for key.
+func (s *MemoryStore) Set(key, value string) {
+	s.mu.Lock()
+	s.values[key] = value
+	s.mu.Unlock()
+}
+
+// sqliteStoreBatch is how many values SQLiteStore writes per transaction.
+const sqliteStoreBatch = 1000
+
+// SQLiteStore is a ConsistencyStore persisted to a SQLite file, so that
+// mappings too large to hold in memory, or shared between exports, keep
+// giving the same fakes. Values are written in batched transactions, which
+// are committed by Close.
+//
+// Errors are sticky: after a failed read or write, Get reports no value,
+// Set does nothing, and Close returns the error.
+type SQLiteStore struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+	err     error
+}
+
+// NewSQLiteStore opens or creates a SQLiteStore in the file at path.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open consistency store: %w", err)
+	}
+	// Reads must see the writes of the open transaction
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS consistency (key TEXT PRIMARY KEY, value TEXT NOT NULL)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create consistency store: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Get returns the value stored for key.
+func (s *SQLiteStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.begin() {
+		return "", false
+	}
+
+	var value string
+	err := s.tx.QueryRow(`SELECT value FROM consistency WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false
+	}
+	if err != nil {
+		s.err = fmt.Errorf("failed to read consistency store: %w", err)
+		return "", false
+	}
+	return value, true
+}
+
+// Set stores value for key.
+func (s *SQLiteStore) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.begin() {
+		return
+	}
+
+	if _, err := s.tx.Exec(`INSERT OR REPLACE INTO consistency (key, value) VALUES (?, ?)`, key, value); err != nil {
+		s.err = fmt.Errorf("failed to write consistency store: %w", err)
+		return
+	}
+
+	s.pending++
+	if s.pending >= sqliteStoreBatch {
+		s.commit()
+	}
+}
+
+// Close commits the values written since the last batch and closes the
+// file. It returns the first error the store met.
+func (s *SQLiteStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commit()
+	if err := s.db.Close(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("failed to close consistency store: %w", err)
+	}
+	return s.err
+}
+
+// begin starts a transaction unless one is open, returning false if the
+// store has failed. s.mu must be held.
+func (s *SQLiteStore) begin() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.tx != nil {
+		return true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.err = fmt.Errorf("failed to write consistency store: %w", err)
+		return false
+	}
+	s.tx = tx
+	return true
+}
+
+// commit commits the open transaction, if any. s.mu must be held.
+func (s *SQLiteStore) commit() {
+	if s.tx == nil {
+		return
+	}
+	if err := s.tx.Commit(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("failed to write consistency store: %w", err)
+	}
+	s.tx = nil
+	s.pending = 0
+}
@@ -0,0 +1,137 @@
+package anonymiser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	if _, ok := store.Get("users.email:a"); ok {
+		t.Error("Get() on an empty store should report no value")
+	}
+
+	store.Set("users.email:a", "fake1")
+	store.Set("users.email:a", "fake2")
+	if got, ok := store.Get("users.email:a"); !ok || got != "fake2" {
+		t.Errorf("Get() = %q, %v, want fake2, true", got, ok)
+	}
+
+	// Concurrent use
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("users.email:%d", i)
+			store.Set(key, "fake")
+			store.Get(key)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consistency.db")
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+
+	// More values than fit in one transaction
+	for i := 0; i < sqliteStoreBatch+5; i++ {
+		store.Set(fmt.Sprintf("users.id:%d", i), fmt.Sprintf("fake%d", i))
+	}
+	store.Set("users.id:0", "replaced")
+	if got, ok := store.Get("users.id:3"); !ok || got != "fake3" {
+		t.Errorf("Get() before Close = %q, %v, want fake3, true", got, ok)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() reopen error = %v", err)
+	}
+	defer reopened.Close()
+
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"users.id:0", "replaced", true},
+		{"users.id:1", "fake1", true},
+		{fmt.Sprintf("users.id:%d", sqliteStoreBatch+4), fmt.Sprintf("fake%d", sqliteStoreBatch+4), true},
+		{"users.id:missing", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := reopened.Get(tt.key); got != tt.want || ok != tt.wantOK {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSetConsistencyStore(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+		},
+	}
+	row := map[string]any{"email": "john@example.com"}
+
+	t.Run("memory store", func(t *testing.T) {
+		store := NewMemoryStore()
+		anon := New(cfg)
+		anon.SetConsistencyStore(store)
+
+		first := anon.AnonymiseRow("users", row)
+		if got, ok := store.Get(consistencyKey("users", "email", "{{faker.email}}", 0, "john@example.com")); !ok || got != first["email"] {
+			t.Errorf("store holds %q, %v, want %q", got, ok, first["email"])
+		}
+		if second := anon.AnonymiseRow("users", row); second["email"] != first["email"] {
+			t.Errorf("second AnonymiseRow() = %v, want %v", second["email"], first["email"])
+		}
+	})
+
+	t.Run("file store persists between exports", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "consistency.db")
+
+		export := func(cfg *config.Config) any {
+			store, err := NewSQLiteStore(path)
+			if err != nil {
+				t.Fatalf("NewSQLiteStore() error = %v", err)
+			}
+			anon := New(cfg)
+			anon.SetConsistencyStore(store)
+			email := anon.AnonymiseRow("users", row)["email"]
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			return email
+		}
+
+		first, second := export(cfg), export(cfg)
+		if first != second {
+			t.Errorf("second export gave %v, want %v from the first", second, first)
+		}
+
+		// Fakes of the old rule are not given back once it changes
+		changed := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Columns: config.ColumnRuleMap{"email": config.Rule("user-{{faker.uuid}}@example.com")}},
+			},
+		}
+		if third := export(changed); third == first || !strings.HasPrefix(third.(string), "user-") {
+			t.Errorf("export with a changed rule gave %v, want a fake of the new rule", third)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package anonymiser
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// goTemplatePrefix starts a rule evaluated as a Go text/template against the
+// row's original values, e.g. gotemplate:{{printf "user%d@corp.test" .id}}.
+const goTemplatePrefix = "gotemplate:"
+
+// templateFuncs are the functions gotemplate: rules may call besides the
+// text/template builtins. None of them can reach the filesystem, the network
+// or other processes.
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"fake":  templateFake,
+}
+
+// templateFake returns an unseeded fake from the named faker function, e.g.
+// {{fake "lastName"}}.
+func templateFake(name string) (string, error) {
+	fn := GetFakerFunc(name)
+	if fn == nil {
+		return "", fmt.Errorf("unknown faker function %q", name)
+	}
+	return fn(), nil
+}
+
+// isGoTemplate reports whether a rule step is a gotemplate: rule.
+func isGoTemplate(rule string) bool {
+	return strings.HasPrefix(rule, goTemplatePrefix)
+}
+
+// parseGoTemplate parses a gotemplate: rule. Fields missing from the row are
+// an error when the template is executed.
+func parseGoTemplate(rule string) (*template.Template, error) {
+	return template.New(goTemplatePrefix).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		Parse(strings.TrimPrefix(rule, goTemplatePrefix))
+}
+
+// usesGoTemplate reports whether any column rule for tableName is, or has a
+// step that is, a gotemplate: rule, which needs every original value of the row.
+func (a *Anonymiser) usesGoTemplate(tableName string) bool {
+	for _, rule := range a.rules[tableName] {
+		if rule.Any(isGoTemplate) {
+			return true
+		}
+	}
+	return false
+}
+
+// executeTemplate evaluates a gotemplate: rule against the original values of
+// a row, with text columns given as strings. Values are set to NULL if the
+// template does not parse or fails, so the original value is never exported.
+func (a *Anonymiser) executeTemplate(rule string, row map[string]any) any {
+	tmpl := a.templates[rule]
+	if tmpl == nil {
+		return nil
+	}
+
+	data := make(map[string]any, len(row))
+	for col, val := range row {
+		switch v := val.(type) {
+		case []byte:
+			data[col] = string(v)
+		case sql.RawBytes:
+			data[col] = string(v)
+		default:
+			data[col] = v
+		}
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil
+	}
+	return buf.String()
+}
@@ -0,0 +1,186 @@
+package anonymiser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func TestGoTemplate(t *testing.T) {
+	row := map[string]any{
+		"id":         int64(42),
+		"first_name": []byte("Jane"),
+		"last_name":  "Doe",
+		"email":      "jane.doe@real.example",
+		"created_at": time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC),
+		"nickname":   nil,
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		want any
+	}{
+		{
+			name: "printf with one column",
+			rule: `gotemplate:{{printf "user%d@corp.test" .id}}`,
+			want: "user42@corp.test",
+		},
+		{
+			name: "several columns",
+			rule: `gotemplate:{{lower .first_name}}.{{lower .last_name}}+{{.id}}@corp.test`,
+			want: "jane.doe+42@corp.test",
+		},
+		{
+			name: "conditional on a NULL column",
+			rule: `gotemplate:{{if .nickname}}{{.nickname}}{{else}}{{upper .last_name}}-{{.id}}{{end}}`,
+			want: "DOE-42",
+		},
+		{
+			name: "method of a column value",
+			rule: `gotemplate:{{.created_at.Format "2006"}}-{{.id}}`,
+			want: "2024-42",
+		},
+		{
+			name: "missing column",
+			rule: `gotemplate:{{.no_such_column}}`,
+			want: nil,
+		},
+		{
+			name: "unknown faker",
+			rule: `gotemplate:{{fake "nonexistent"}}`,
+			want: nil,
+		},
+		{
+			name: "does not parse",
+			rule: `gotemplate:{{.id`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Configuration: map[string]*config.TableConfig{
+					"users": {Columns: config.ColumnRuleMap{"email": config.Rule(tt.rule)}},
+				},
+			}
+
+			columns := []string{"id", "first_name", "last_name", "email", "created_at", "nickname"}
+			values := make([]any, len(columns))
+			for i, col := range columns {
+				values[i] = row[col]
+			}
+
+			byRow := New(cfg).AnonymiseRow("users", row)["email"]
+			New(cfg).AnonymiseValues("users", columns, values)
+			byValues := values[3]
+
+			if byRow != tt.want {
+				t.Errorf("AnonymiseRow() email = %v, want %v", byRow, tt.want)
+			}
+			if byValues != tt.want {
+				t.Errorf("AnonymiseValues() email = %v, want %v", byValues, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoTemplate_OriginalValues(t *testing.T) {
+	// Templates see the original value of columns anonymised before them
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"email":   config.Rule("{{faker.email}}"),
+				"name":    config.Rule("Anonymous"),
+				"contact": config.Rule(`gotemplate:{{.name}} <{{.email}}>`),
+			}},
+		},
+	}
+	anon := New(cfg)
+
+	columns := []string{"email", "name", "contact"}
+	values := []any{"jane@real.example", "Jane", "old"}
+	anon.AnonymiseValues("users", columns, values)
+
+	if values[2] != "Jane <jane@real.example>" {
+		t.Errorf("contact = %v, want the original name and email", values[2])
+	}
+	if values[0] == "jane@real.example" || values[1] != "Anonymous" {
+		t.Errorf("values = %v, want email and name anonymised", values)
+	}
+}
+
+func TestGoTemplate_Pipeline(t *testing.T) {
+	// The template's output is faked, so rows with the same derived value share a fake
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"household": config.Rule(`gotemplate:{{.last_name}}/{{.postcode}}`, "{{faker.lastName}}"),
+			}},
+		},
+	}
+	anon := New(cfg)
+
+	jane := anon.AnonymiseRow("users", map[string]any{"last_name": "Doe", "postcode": "AB1", "household": "x"})
+	john := anon.AnonymiseRow("users", map[string]any{"last_name": "Doe", "postcode": "AB1", "household": "y"})
+	if jane["household"] != john["household"] {
+		t.Errorf("household = %v and %v, want the same fake", jane["household"], john["household"])
+	}
+	if s, _ := jane["household"].(string); s == "" || s == "Doe/AB1" {
+		t.Errorf("household = %v, want a fake last name", jane["household"])
+	}
+}
+
+func TestGoTemplate_Fake(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule(`gotemplate:{{lower (fake "firstName")}}.{{.id}}@corp.test`)}},
+		},
+	}
+
+	got, _ := New(cfg).AnonymiseRow("users", map[string]any{"id": 7, "email": "x"})["email"].(string)
+	if !strings.HasSuffix(got, ".7@corp.test") || len(got) <= len(".7@corp.test") || got != strings.ToLower(got) {
+		t.Errorf("email = %q, want a lowercase fake first name then .7@corp.test", got)
+	}
+}
+
+func TestValidateRules_GoTemplate(t *testing.T) {
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"email":  config.Rule(`gotemplate:{{printf "user%d@corp.test" .id}}`),
+				"name":   config.Rule(`gotemplate:{{.first_name`),
+				"secret": config.Rule(`gotemplate:{{readFile "/etc/passwd"}}`),
+				"cmd":    config.Rule("{{faker.name}}", `gotemplate:{{exec "ls"}}`),
+			}},
+			"orders": {Columns: config.ColumnRuleMap{
+				"customer_email": config.Rule("{{ref:users.email}}"),
+			}},
+		},
+	}
+
+	errors := New(cfg).ValidateRules()
+	want := []string{
+		"invalid gotemplate rule for users.name",
+		"invalid gotemplate rule for users.secret",
+		"invalid gotemplate rule for users.cmd",
+		"unresolvable reference 'users.email'",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("ValidateRules() = %v, want %d errors", errors, len(want))
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errors {
+			if strings.Contains(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ValidateRules() = %v, want an error containing %q", errors, w)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Condition is a parsed anonymise_where: expression, evaluated in Go against
+// the values of each row. It is one or more comparisons joined by AND, each
+// either "column op value", with op one of = != <> < <= > >=, or
+// "column IS [NOT] NULL". Values are quoted strings, numbers, true or false.
+type Condition struct {
+	terms []conditionTerm
+}
+
+// conditionTerm is a single comparison within a Condition.
+type conditionTerm struct {
+	column string
+	op     string // =, !=, <, <=, >, >=, IS NULL or IS NOT NULL
+	text   string // Literal as written, unquoted
+	number float64
+	isNum  bool // Literal is a number (or true/false, as 1/0)
+}
+
+// conditionOps are the supported comparison operators.
+var conditionOps = []string{"<=", ">=", "<>", "!=", "=", "<", ">"}
+
+// ParseCondition parses an anonymise_where: expression.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("condition must not be empty")
+	}
+
+	var cond Condition
+	for len(tokens) > 0 {
+		term, rest, err := parseConditionTerm(tokens)
+		if err != nil {
+			return nil, err
+		}
+		cond.terms = append(cond.terms, term)
+
+		if len(rest) == 0 {
+			break
+		}
+		if !strings.EqualFold(rest[0].text, "AND") || rest[0].quoted {
+			return nil, fmt.Errorf("expected AND, got %q", rest[0].text)
+		}
+		if len(rest) == 1 {
+			return nil, fmt.Errorf("condition ends with AND")
+		}
+		tokens = rest[1:]
+	}
+
+	return &cond, nil
+}
+
+// conditionToken is a word, operator or quoted string in a condition.
+type conditionToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeCondition splits a condition into words, operators and quoted strings.
+// Quotes inside strings are escaped by doubling them, as in SQL.
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			var sb strings.Builder
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						sb.WriteRune(r)
+						i++
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string in condition")
+			}
+			tokens = append(tokens, conditionToken{text: sb.String(), quoted: true})
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && strings.ContainsRune("=>", runes[i+1]) {
+				op += string(runes[i+1])
+			}
+			if !isConditionOp(op) {
+				op = string(r)
+			}
+			if !isConditionOp(op) {
+				return nil, fmt.Errorf("unsupported operator %q in condition", op)
+			}
+			tokens = append(tokens, conditionToken{text: op})
+			i += len(op)
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("=!<>'\"", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, conditionToken{text: string(runes[start:i])})
+		}
+	}
+
+	return tokens, nil
+}
+
+// isConditionOp returns true if s is a supported comparison operator.
+func isConditionOp(s string) bool {
+	for _, op := range conditionOps {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConditionTerm parses one comparison from the start of tokens and
+// returns it with the remaining tokens.
+func parseConditionTerm(tokens []conditionToken) (conditionTerm, []conditionToken, error) {
+	if tokens[0].quoted || isConditionOp(tokens[0].text) {
+		return conditionTerm{}, nil, fmt.Errorf("expected column name, got %q", tokens[0].text)
+	}
+	term := conditionTerm{column: tokens[0].text}
+	if len(tokens) < 3 {
+		return conditionTerm{}, nil, fmt.Errorf("incomplete comparison for column %q", term.column)
+	}
+
+	// column IS [NOT] NULL
+	if strings.EqualFold(tokens[1].text, "IS") && !tokens[1].quoted {
+		if strings.EqualFold(tokens[2].text, "NULL") && !tokens[2].quoted {
+			term.op = "IS NULL"
+			return term, tokens[3:], nil
+		}
+		if len(tokens) >= 4 && strings.EqualFold(tokens[2].text, "NOT") && strings.EqualFold(tokens[3].text, "NULL") && !tokens[3].quoted {
+			term.op = "IS NOT NULL"
+			return term, tokens[4:], nil
+		}
+		return conditionTerm{}, nil, fmt.Errorf("expected IS NULL or IS NOT NULL for column %q", term.column)
+	}
+
+	if tokens[1].quoted || !isConditionOp(tokens[1].text) {
+		return conditionTerm{}, nil, fmt.Errorf("expected operator after column %q, got %q", term.column, tokens[1].text)
+	}
+	term.op = tokens[1].text
+	if term.op == "<>" {
+		term.op = "!="
+	}
+
+	literal := tokens[2]
+	term.text = literal.text
+	if !literal.quoted {
+		switch strings.ToLower(literal.text) {
+		case "null":
+			return conditionTerm{}, nil, fmt.Errorf("use IS NULL or IS NOT NULL to compare column %q with NULL", term.column)
+		case "true":
+			term.number, term.isNum = 1, true
+		case "false":
+			term.number, term.isNum = 0, true
+		default:
+			n, err := strconv.ParseFloat(literal.text, 64)
+			if err != nil {
+				return conditionTerm{}, nil, fmt.Errorf("invalid value %q for column %q: strings must be quoted", literal.text, term.column)
+			}
+			term.number, term.isNum = n, true
+		}
+	}
+
+	return term, tokens[3:], nil
+}
+
+// Match reports whether a row matches every comparison of the condition.
+// value looks up a column's value in the row. As in SQL, comparisons with
+// NULL never match.
+func (c *Condition) Match(value func(col string) any) bool {
+	for _, term := range c.terms {
+		if !term.match(value(term.column)) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether a single value satisfies the comparison.
+func (t conditionTerm) match(val any) bool {
+	switch t.op {
+	case "IS NULL":
+		return val == nil
+	case "IS NOT NULL":
+		return val != nil
+	}
+	if val == nil {
+		return false
+	}
+
+	cmp, ok := t.compare(val)
+	if !ok {
+		return false
+	}
+
+	switch t.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compare returns -1, 0 or 1 as val is less than, equal to or greater than
+// the literal. Numbers are compared numerically, dates chronologically and
+// anything else as text. It returns false if val cannot be compared.
+func (t conditionTerm) compare(val any) (int, bool) {
+	if v, ok := val.(time.Time); ok {
+		lit, err := ParseDate(t.text)
+		if err != nil {
+			return 0, false
+		}
+		return v.Compare(lit), true
+	}
+
+	if t.isNum {
+		n, ok := conditionNumber(val)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case n < t.number:
+			return -1, true
+		case n > t.number:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return strings.Compare(conditionText(val), t.text), true
+}
+
+// conditionNumber converts a row value to a number for comparison.
+func conditionNumber(val any) (float64, bool) {
+	switch v := val.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(conditionText(val)), 64)
+	return n, err == nil
+}
+
+// conditionText converts a row value to text for comparison.
+func conditionText(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCondition(t *testing.T) {
+	valid := []string{
+		"is_test = 0",
+		"is_test=0",
+		"email <> 'admin@example.com'",
+		"role != \"seed\"",
+		"created_at >= '2024-01-01' AND id < 100",
+		"deleted_at IS NULL and customer_id is not null",
+		"active = true",
+		"name = 'O''Brien'",
+	}
+	for _, expr := range valid {
+		if _, err := ParseCondition(expr); err != nil {
+			t.Errorf("ParseCondition(%q) error = %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"is_test",
+		"is_test = ",
+		"email = admin",
+		"email = 'admin",
+		"id = NULL",
+		"id ! 1",
+		"id = 1 OR id = 2",
+		"id = 1 AND",
+		"deleted_at IS EMPTY",
+		"= 1",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("ParseCondition(%q) error = nil, want error", expr)
+		}
+	}
+}
+
+func TestCondition_Match(t *testing.T) {
+	row := map[string]any{
+		"id":         int64(42),
+		"is_test":    []byte("0"),
+		"active":     true,
+		"email":      "john@example.com",
+		"name":       "O'Brien",
+		"created_at": time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		"deleted_at": nil,
+	}
+	value := func(col string) any { return row[col] }
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"id = 42", true},
+		{"id > 42", false},
+		{"id >= 42 AND id <= 42", true},
+		{"id != 42.0", false},
+		{"is_test = 0", true},
+		{"active = true", true},
+		{"active = 0", false},
+		{"email = 'john@example.com'", true},
+		{"email <> 'john@example.com'", false},
+		{"email > 'a'", true},
+		{"name = 'O''Brien'", true},
+		{"created_at > '2024-01-01'", true},
+		{"created_at < '2024-06-01 12:00:00'", false},
+		{"deleted_at IS NULL", true},
+		{"deleted_at IS NOT NULL", false},
+		{"deleted_at = 'x'", false},
+		{"deleted_at != 'x'", false},
+		{"email = 1", false},
+		{"missing IS NULL", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cond, err := ParseCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCondition() error = %v", err)
+			}
+			if got := cond.Match(value); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
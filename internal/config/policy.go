@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+)
+
+// PolicyRule is a row of a policy table: a column of a table and the rule it
+// is anonymised with. A row with no column and no rule lists the table
+// without giving it any rules.
+type PolicyRule struct {
+	Table  string
+	Column string
+	Rule   string
+}
+
+// MergePolicy returns a copy of the config with the rules read from its
+// policy_table merged into its table configuration, leaving c unchanged so
+// that it can be used for further exports. A column given a rule in both is
+// an error, as is a column given more than one rule by the policy.
+func (c *Config) MergePolicy(rules []PolicyRule) (*Config, error) {
+	merged := *c
+	merged.Configuration = make(map[string]*TableConfig, len(c.Configuration))
+	for tableName, tableConfig := range c.Configuration {
+		if tableConfig != nil {
+			copied := *tableConfig
+			copied.Columns = maps.Clone(tableConfig.Columns)
+			tableConfig = &copied
+		}
+		merged.Configuration[tableName] = tableConfig
+	}
+
+	added := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.Table == "" {
+			return nil, fmt.Errorf("%w: policy table %s: row with no table_name", ErrInvalidConfig, c.PolicyTable)
+		}
+		if (r.Column == "") != (r.Rule == "") {
+			return nil, fmt.Errorf("%w: policy table %s: table %s: column_name and rule must be given together", ErrInvalidConfig, c.PolicyTable, r.Table)
+		}
+
+		merged.AddTable(r.Table, &TableConfig{})
+		if r.Column == "" {
+			continue
+		}
+
+		tableConfig := merged.Configuration[r.Table]
+		if tableConfig == nil {
+			tableConfig = &TableConfig{}
+			merged.Configuration[r.Table] = tableConfig
+		}
+		if added[r.Table+"."+r.Column] {
+			return nil, fmt.Errorf("%w: table %s: column %s is given more than one rule by policy table %s", ErrInvalidConfig, r.Table, r.Column, c.PolicyTable)
+		}
+		if _, ok := tableConfig.Columns[r.Column]; ok {
+			return nil, fmt.Errorf("%w: table %s: column %s is in both the config and policy table %s", ErrInvalidConfig, r.Table, r.Column, c.PolicyTable)
+		}
+		if tableConfig.Columns == nil {
+			tableConfig.Columns = make(ColumnRuleMap)
+		}
+		tableConfig.Columns[r.Column] = Rule(r.Rule)
+		added[r.Table+"."+r.Column] = true
+	}
+	return &merged, nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile holds the values one environment, e.g. staging or ci, sets over
+// the base config when loaded with LoadOptions.Profile.
+type Profile struct {
+	Connection    Connection              `yaml:"connection,omitempty" json:"connection,omitempty"`       // Connection values set over the base connection
+	Configuration map[string]*TableConfig `yaml:"configuration,omitempty" json:"configuration,omitempty"` // Table values set over the base tables
+}
+
+// profileKeys is a config file decoded only as far as the keys its profiles
+// set, which tell a value a profile sets to false, 0 or "" from one it leaves
+// out.
+type profileKeys struct {
+	Profiles map[string]struct {
+		Connection    map[string]any            `yaml:"connection" json:"connection"`
+		Configuration map[string]map[string]any `yaml:"configuration" json:"configuration"`
+	} `yaml:"profiles" json:"profiles"`
+}
+
+// decodeProfileKeys decodes the keys the profiles of a config file set.
+func decodeProfileKeys(data []byte, isJSON bool) (profileKeys, error) {
+	var keys profileKeys
+	if isJSON {
+		return keys, json.Unmarshal(data, &keys)
+	}
+	return keys, yaml.Unmarshal(data, &keys)
+}
+
+// applyProfile sets the values of the named profile over the config. Every
+// field the profile sets, as named by keys, replaces the base value, even
+// with false or 0, except that column rules are merged column by column, and
+// tables only the profile names are added. Fields the profile leaves out
+// keep their base values.
+func (c *Config) applyProfile(name string, keys profileKeys) error {
+	profile := c.Profiles[name]
+	if profile == nil {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q, the config has no profiles", name)
+		}
+		return fmt.Errorf("unknown profile %q, must be one of: %s", name, strings.Join(names, ", "))
+	}
+
+	set := keys.Profiles[name]
+	overlay(&c.Connection, &profile.Connection, set.Connection)
+
+	tables := make([]string, 0, len(profile.Configuration))
+	for tableName := range profile.Configuration {
+		tables = append(tables, tableName)
+	}
+	sort.Strings(tables)
+
+	for _, tableName := range tables {
+		override := profile.Configuration[tableName]
+		if override == nil {
+			continue
+		}
+		if override.ColumnsFile != "" {
+			return fmt.Errorf("profile %s: table %s: columns_file cannot be set in a profile", name, tableName)
+		}
+
+		base := c.Configuration[tableName]
+		if base == nil {
+			c.AddTable(tableName, &TableConfig{})
+			base = c.Configuration[tableName]
+		}
+
+		columns := base.Columns
+		overlay(base, override, set.Configuration[tableName])
+		if len(override.Columns) > 0 {
+			merged := make(ColumnRuleMap, len(columns)+len(override.Columns))
+			for col, rule := range columns {
+				merged[col] = rule
+			}
+			for col, rule := range override.Columns {
+				merged[col] = rule
+			}
+			base.Columns = merged
+		}
+	}
+
+	c.profile = name
+	return nil
+}
+
+// overlay sets each exported field of dst to the value of the same field of
+// src, where the field's key is one of keys. dst and src point to structs of
+// the same type.
+func overlay(dst, src any, keys map[string]any) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if _, ok := keys[key]; !ok || !field.IsExported() {
+			continue
+		}
+		d.Field(i).Set(s.Field(i))
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profileConfig = `
+connection:
+  type: mysql
+  host: db.staging.internal
+  port: 3306
+  username: app
+  password: s3cret
+  database_name: app
+configuration:
+  users:
+    retain: 1000
+    columns:
+      email: "{{faker.email}}"
+      name: "{{faker.name}}"
+  orders:
+    retain: 5000
+    where: "status <> 'draft'"
+profiles:
+  ci:
+    connection:
+      host: 127.0.0.1
+      database_name: app_ci
+    configuration:
+      users:
+        retain: 10
+        columns:
+          name: REDACTED
+      audit_logs:
+        truncate: true
+  staging:
+    connection:
+      host: db.staging.internal
+`
+
+func TestLoad_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profileConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("without a profile", func(t *testing.T) {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.Connection.Host != "db.staging.internal" || cfg.Configuration["users"].Retain.Count != 1000 {
+			t.Errorf("config = %+v, want the base values", cfg)
+		}
+		if cfg.HasTable("audit_logs") {
+			t.Error("audit_logs should only be added by the ci profile")
+		}
+	})
+
+	t.Run("profile values take precedence", func(t *testing.T) {
+		cfg, err := LoadWithOptions(path, LoadOptions{Profile: "ci"})
+		if err != nil {
+			t.Fatalf("LoadWithOptions() error = %v", err)
+		}
+
+		conn := cfg.Connection
+		if conn.Host != "127.0.0.1" || conn.DatabaseName != "app_ci" {
+			t.Errorf("Connection = %+v, want the profile's host and database", conn)
+		}
+		if conn.Type != "mysql" || conn.Port != 3306 || conn.Username != "app" || conn.Password != "s3cret" {
+			t.Errorf("Connection = %+v, want the values the profile leaves out kept", conn)
+		}
+
+		users := cfg.Configuration["users"]
+		if users.Retain.Count != 10 {
+			t.Errorf("users retain = %d, want the profile's 10", users.Retain.Count)
+		}
+		if !users.Columns["name"].Is("REDACTED") || !users.Columns["email"].Is("{{faker.email}}") {
+			t.Errorf("users columns = %v, want the profile's name rule and the base email rule", users.Columns)
+		}
+
+		orders := cfg.Configuration["orders"]
+		if orders.Retain.Count != 5000 || orders.Where != "status <> 'draft'" {
+			t.Errorf("orders = %+v, want the base values", orders)
+		}
+		if audit := cfg.Configuration["audit_logs"]; audit == nil || !audit.Truncate {
+			t.Errorf("audit_logs = %+v, want the profile's table added", audit)
+		}
+
+		if err := cfg.Save(filepath.Join(t.TempDir(), "saved.yaml")); err == nil {
+			t.Error("Save() should refuse a config loaded with a profile")
+		}
+	})
+
+	t.Run("profile over a connection file", func(t *testing.T) {
+		dir := t.TempDir()
+		secrets := filepath.Join(dir, "secrets.yaml")
+		if err := os.WriteFile(secrets, []byte("connection:\n  type: mysql\n  host: db.prod.internal\n  password: other\n  database_name: prod\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := LoadWithOptions(path, LoadOptions{Profile: "ci", ConnectionFile: secrets})
+		if err != nil {
+			t.Fatalf("LoadWithOptions() error = %v", err)
+		}
+		if cfg.Connection.Host != "db.prod.internal" || cfg.Connection.Password != "other" || cfg.Connection.DatabaseName != "prod" {
+			t.Errorf("Connection = %+v, want the connection file's values over the profile's", cfg.Connection)
+		}
+	})
+
+	t.Run("profile over the config's connection file", func(t *testing.T) {
+		dir := t.TempDir()
+		secrets := filepath.Join(dir, "secrets.yaml")
+		if err := os.WriteFile(secrets, []byte("connection:\n  type: mysql\n  host: db.prod.internal\n  password: other\n  database_name: prod\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(path, []byte("connection_file: secrets.yaml\n"+profileConfig), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := LoadWithOptions(path, LoadOptions{Profile: "ci"})
+		if err != nil {
+			t.Fatalf("LoadWithOptions() error = %v", err)
+		}
+		if cfg.Connection.Host != "127.0.0.1" || cfg.Connection.Password != "other" {
+			t.Errorf("Connection = %+v, want the profile's host and the connection file's password", cfg.Connection)
+		}
+	})
+
+	t.Run("profile sets false and 0", func(t *testing.T) {
+		for _, ext := range []string{"yaml", "json"} {
+			content := "connection:\n  type: sqlite\n  file: app.db\nconfiguration:\n  logs:\n    truncate: true\n  users:\n    retain: 1000\n" +
+				"profiles:\n  full:\n    configuration:\n      logs:\n        truncate: false\n      users:\n        retain: 0\n"
+			if ext == "json" {
+				content = `{"connection": {"type": "sqlite", "file": "app.db"}, "configuration": {"logs": {"truncate": true}, "users": {"retain": 1000}},
+					"profiles": {"full": {"configuration": {"logs": {"truncate": false}, "users": {"retain": 0}}}}}`
+			}
+			path := filepath.Join(t.TempDir(), "config."+ext)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadWithOptions(path, LoadOptions{Profile: "full"})
+			if err != nil {
+				t.Fatalf("LoadWithOptions(%s) error = %v", ext, err)
+			}
+			if cfg.Configuration["logs"].Truncate || cfg.Configuration["users"].Retain.Count != 0 {
+				t.Errorf("%s: logs truncate = %v, users retain = %d, want the profile's false and 0",
+					ext, cfg.Configuration["logs"].Truncate, cfg.Configuration["users"].Retain.Count)
+			}
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := LoadWithOptions(path, LoadOptions{Profile: "prod"})
+		if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), "ci, staging") {
+			t.Errorf("LoadWithOptions() error = %v, want an invalid config error listing the profiles", err)
+		}
+	})
+}
+
+func TestLoad_ProfileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{name: "unknown key", profile: "connection:\n      hostname: localhost"},
+		{name: "columns_file", profile: "configuration:\n      users:\n        columns_file: ci.yaml"},
+		{name: "invalid value", profile: "configuration:\n      users:\n        anonymise_where: email = admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			content := "connection:\n  type: sqlite\n  file: app.db\nprofiles:\n  ci:\n    " + tt.profile + "\n"
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadWithOptions(path, LoadOptions{Profile: "ci"}); err == nil {
+				t.Error("LoadWithOptions() error = nil, want the profile rejected")
+			}
+		})
+	}
+}
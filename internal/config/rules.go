@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ColumnRuleMap maps column names to their anonymisation rules.
+type ColumnRuleMap map[string]ColumnRule
+
+// ColumnRule is the anonymisation rule of a column. It is written as a
+// single string, a list of strings applied in order, each to the output of
+// the previous one, e.g. token: ["{{faker.uuid}}", "tok_{{pk}}"], or a list
+// of variants, a conditional rule.
+type ColumnRule struct {
+	Steps    []string      // Rules applied in order; a single rule is one step
+	Variants []RuleVariant // Variants of a conditional rule, tried in order
+}
+
+// RuleVariant is one branch of a conditional rule. Rule is applied to rows
+// whose original values match When, a condition written as for
+// anonymise_where. A variant without When is the default, applied to rows
+// no other variant matches.
+type RuleVariant struct {
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	Rule string `yaml:"rule" json:"rule"`
+}
+
+// Rule returns a column rule applying steps in order.
+func Rule(steps ...string) ColumnRule {
+	return ColumnRule{Steps: steps}
+}
+
+// IsConditional reports whether the rule is a list of variants.
+func (r ColumnRule) IsConditional() bool {
+	return len(r.Variants) > 0
+}
+
+// AllSteps returns every step of the rule: its steps, or the rule of each
+// variant of a conditional rule.
+func (r ColumnRule) AllSteps() []string {
+	if !r.IsConditional() {
+		return r.Steps
+	}
+
+	steps := make([]string, len(r.Variants))
+	for i, v := range r.Variants {
+		steps[i] = v.Rule
+	}
+	return steps
+}
+
+// Is reports whether the rule is the single step rule, e.g. "null".
+func (r ColumnRule) Is(rule string) bool {
+	return !r.IsConditional() && len(r.Steps) == 1 && r.Steps[0] == rule
+}
+
+// Any reports whether match is true of any step of the rule, or of the rule
+// of any variant.
+func (r ColumnRule) Any(match func(step string) bool) bool {
+	return slices.ContainsFunc(r.AllSteps(), match)
+}
+
+// String returns the rule as written in a config file, for messages.
+func (r ColumnRule) String() string {
+	if r.IsConditional() {
+		parts := make([]string, len(r.Variants))
+		for i, v := range r.Variants {
+			parts[i] = fmt.Sprintf("{when: %q, rule: %q}", v.When, v.Rule)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	if len(r.Steps) == 1 {
+		return r.Steps[0]
+	}
+	return fmt.Sprintf("%q", r.Steps)
+}
+
+// checkVariants checks the variants of a conditional rule for column col:
+// each has a rule, and only the last may be the default.
+func checkVariants(col string, variants []RuleVariant) error {
+	if len(variants) == 0 {
+		return fmt.Errorf("rule list for column %q must not be empty", col)
+	}
+	for i, v := range variants {
+		if v.Rule == "" {
+			return fmt.Errorf("variant %d of column %q has no rule", i+1, col)
+		}
+		if v.When == "" && i < len(variants)-1 {
+			return fmt.Errorf("variant %d of column %q has no when condition, only the last variant may be the default", i+1, col)
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML implements custom YAML unmarshaling for ColumnRuleMap.
+// It supports both string and list rules.
+func (m *ColumnRuleMap) UnmarshalYAML(value *yaml.Node) error {
+	var raw map[string]yaml.Node
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	rules := make(ColumnRuleMap, len(raw))
+	for col, node := range raw {
+		if node.Kind != yaml.SequenceNode {
+			var rule string
+			if err := node.Decode(&rule); err != nil {
+				return fmt.Errorf("rule for column %q must be a string or a list of strings: %w", col, err)
+			}
+			rules[col] = Rule(rule)
+			continue
+		}
+
+		// A list of variants, e.g. [{when: "country = 'US'", rule: ...}, {rule: ...}]
+		if len(node.Content) > 0 && node.Content[0].Kind == yaml.MappingNode {
+			var variants []RuleVariant
+			if err := node.Decode(&variants); err != nil {
+				return fmt.Errorf("variants for column %q must each have a when and a rule string: %w", col, err)
+			}
+			if err := checkVariants(col, variants); err != nil {
+				return err
+			}
+			rules[col] = ColumnRule{Variants: variants}
+			continue
+		}
+
+		var steps []string
+		if err := node.Decode(&steps); err != nil {
+			return fmt.Errorf("rule for column %q must be a string or a list of strings: %w", col, err)
+		}
+		if len(steps) == 0 {
+			return fmt.Errorf("rule list for column %q must not be empty", col)
+		}
+		rules[col] = Rule(steps...)
+	}
+
+	*m = rules
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for ColumnRuleMap.
+func (m *ColumnRuleMap) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	rules := make(ColumnRuleMap, len(raw))
+	for col, msg := range raw {
+		if !bytes.HasPrefix(bytes.TrimSpace(msg), []byte("[")) {
+			var rule string
+			if err := json.Unmarshal(msg, &rule); err != nil {
+				return fmt.Errorf("rule for column %q must be a string or a list of strings: %w", col, err)
+			}
+			rules[col] = Rule(rule)
+			continue
+		}
+
+		// A list of variants, e.g. [{"when": "country = 'US'", "rule": ...}, {"rule": ...}]
+		if bytes.HasPrefix(bytes.TrimSpace(bytes.TrimSpace(msg)[1:]), []byte("{")) {
+			var variants []RuleVariant
+			if err := json.Unmarshal(msg, &variants); err != nil {
+				return fmt.Errorf("variants for column %q must each have a when and a rule string: %w", col, err)
+			}
+			if err := checkVariants(col, variants); err != nil {
+				return err
+			}
+			rules[col] = ColumnRule{Variants: variants}
+			continue
+		}
+
+		var steps []string
+		if err := json.Unmarshal(msg, &steps); err != nil {
+			return fmt.Errorf("rule for column %q must be a string or a list of strings: %w", col, err)
+		}
+		if len(steps) == 0 {
+			return fmt.Errorf("rule list for column %q must not be empty", col)
+		}
+		rules[col] = Rule(steps...)
+	}
+
+	*m = rules
+	return nil
+}
+
+// MarshalYAML implements custom YAML marshaling for ColumnRuleMap, writing
+// rule pipelines and variants back as lists.
+func (m ColumnRuleMap) MarshalYAML() (interface{}, error) {
+	return m.marshalable(), nil
+}
+
+// MarshalJSON implements custom JSON marshaling for ColumnRuleMap.
+func (m ColumnRuleMap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.marshalable())
+}
+
+// marshalable returns the rules as written in a config file: single rules
+// as strings and pipelines and variants as lists. Both encoders write map
+// keys in sorted order, so columns are saved by name.
+func (m ColumnRuleMap) marshalable() map[string]any {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string]any, len(m))
+	for col, rule := range m {
+		switch {
+		case rule.IsConditional():
+			out[col] = rule.Variants
+		case len(rule.Steps) == 1:
+			out[col] = rule.Steps[0]
+		default:
+			out[col] = rule.Steps
+		}
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SessionVars maps MySQL session variable names to the values they are set
+// to on every connection, e.g. net_read_timeout: 600. String values must be
+// quoted as in SQL, e.g. sql_mode: "'ANSI_QUOTES'".
+type SessionVars map[string]string
+
+var (
+	// sessionVarNamePattern matches a MySQL system variable name.
+	sessionVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// sessionVarValuePattern matches a number, a keyword such as ON, or a
+	// quoted string without quotes or backslashes inside it.
+	sessionVarValuePattern = regexp.MustCompile(`^([A-Za-z0-9_.+-]+|'[^'\\]*')$`)
+)
+
+// mysqlDriverParams are the lowercase DSN parameters the MySQL driver reads
+// as its own options, which would not be sent to the server as variables.
+var mysqlDriverParams = map[string]bool{
+	"charset":   true,
+	"collation": true,
+	"compress":  true,
+	"loc":       true,
+	"strict":    true,
+	"timeout":   true,
+	"tls":       true,
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for SessionVars, taking
+// numbers and booleans as well as strings.
+func (v *SessionVars) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("session_vars must be an object: %w", err)
+	}
+
+	vars := make(SessionVars, len(raw))
+	for name, value := range raw {
+		switch val := value.(type) {
+		case string:
+			vars[name] = val
+		case json.Number:
+			vars[name] = val.String()
+		case bool:
+			if val {
+				vars[name] = "ON"
+			} else {
+				vars[name] = "OFF"
+			}
+		default:
+			return fmt.Errorf("session variable %q must be a string, number or boolean", name)
+		}
+	}
+
+	*v = vars
+	return nil
+}
+
+// Validate checks that every name is a variable the driver will set and
+// every value can be written into a SET statement as it is.
+func (v SessionVars) Validate() error {
+	seen := make(map[string]bool, len(v))
+	for _, name := range v.names() {
+		if !sessionVarNamePattern.MatchString(name) || mysqlDriverParams[strings.ToLower(name)] {
+			return fmt.Errorf("invalid session variable name %q", name)
+		}
+		// Variable names are case-insensitive
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("session variable %s is set more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+		if !sessionVarValuePattern.MatchString(v[name]) {
+			return fmt.Errorf("invalid value %q for session variable %s (quote strings, e.g. 'value')", v[name], name)
+		}
+	}
+	return nil
+}
+
+// dsnParams returns the variables as MySQL DSN parameters, e.g.
+// &net_read_timeout=600, in name order. The driver sets them with SET on
+// each connection it opens.
+func (v SessionVars) dsnParams() string {
+	var b strings.Builder
+	for _, name := range v.names() {
+		b.WriteString("&" + strings.ToLower(name) + "=" + url.QueryEscape(v[name]))
+	}
+	return b.String()
+}
+
+// names returns the variable names sorted case-insensitively.
+func (v SessionVars) names() []string {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.ToLower(names[i]), strings.ToLower(names[j])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
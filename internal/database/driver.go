@@ -1,18 +1,48 @@
 package database
 
 import (
+	"bytes"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 )
 
+// Sentinel errors returned by drivers, for use with errors.Is.
+var (
+	// ErrUnsupportedDriver is returned by NewDriver for an unknown database type.
+	ErrUnsupportedDriver = errors.New("unsupported database type")
+
+	// ErrConnectionFailed is returned by Connect when the database cannot be opened or reached.
+	ErrConnectionFailed = errors.New("failed to connect to database")
+)
+
 // StreamOptions contains options for streaming rows from a table.
 type StreamOptions struct {
 	Limit      int       // Maximum number of rows to fetch (0 = unlimited)
 	ColumnName string    // Column name for date-based filtering
 	AfterDate  time.Time // Only fetch rows where ColumnName > AfterDate
+	Where      string    // Raw SQL predicate ANDed into the WHERE clause
+	KeyColumn  string    // Order rows by this column (typically the primary key)
+	AfterKey   any       // Only fetch rows where KeyColumn > AfterKey (requires KeyColumn)
+	Keyset     bool      // Page through rows by KeyColumn, one query per batch
+	Columns    []string  // Columns to select, in order (empty = look up with GetColumns)
+
+	// KeyColumns order rows by several columns instead of KeyColumn, such as
+	// a composite primary key, and AfterKeys resumes after the row holding
+	// these values. Only the SQLite driver supports them.
+	KeyColumns []string
+	AfterKeys  []any
 }
 
 // ForeignKey represents a foreign key relationship.
@@ -29,11 +59,89 @@ type ColumnInfo struct {
 	DataType   string
 	IsNullable bool
 	Default    sql.NullString
+	Extra      string // Extra column attributes, e.g. MySQL "auto_increment"
+	Comment    string // Column comment, if the database supports them
+	MaxLength  int    // Declared length of character columns, e.g. 10 for VARCHAR(10) (0 = unlimited or not a character column)
+
+	CharacterSet string // Character set of MySQL character columns, e.g. "latin1" (empty otherwise)
+
+	GenerationExpression string // Expression of a generated column (MySQL 5.7+)
+}
+
+// IsAutoIncrement returns true if the column's value is assigned by the database on insert.
+func (c ColumnInfo) IsAutoIncrement() bool {
+	return strings.Contains(strings.ToLower(c.Extra), "auto_increment")
+}
+
+// IsGenerated returns true if the column is a generated column, whose value
+// the database computes and which cannot be inserted.
+func (c ColumnInfo) IsGenerated() bool {
+	return c.GenerationExpression != ""
+}
+
+// IsArray returns true if the column holds a Postgres array, reported as
+// "ARRAY" by information_schema or as e.g. "text[]".
+func (c ColumnInfo) IsArray() bool {
+	return strings.EqualFold(c.DataType, "ARRAY") || strings.HasSuffix(c.DataType, "[]")
+}
+
+// IsDecimal returns true if the column holds exact decimal numbers, such as
+// MySQL DECIMAL or Postgres NUMERIC, which drivers return as text.
+func (c ColumnInfo) IsDecimal() bool {
+	dataType := strings.ToLower(c.DataType)
+	return !c.IsArray() && (strings.HasPrefix(dataType, "decimal") || strings.HasPrefix(dataType, "numeric"))
 }
 
+// ZeroDate is streamed by the MySQL driver, when zero date handling is
+// enabled, in place of a zero or otherwise invalid date such as 0000-00-00
+// that cannot be held in a time.Time. It holds the value as stored.
+type ZeroDate string
+
 // RowCallback is called for each batch of rows during streaming.
 type RowCallback func(rows []map[string]any) error
 
+// ColumnarCallback is called for each batch of rows during columnar streaming.
+// values holds one slice per row, ordered as cols. Both are reused between
+// batches and must not be retained after the callback returns.
+type ColumnarCallback func(cols []string, values [][]any) error
+
+// ColumnarStreamer is implemented by drivers that can stream rows without
+// allocating a map per row.
+type ColumnarStreamer interface {
+	// StreamRowsColumnar streams rows from a table in batches using reusable buffers.
+	StreamRowsColumnar(table string, opts StreamOptions, batchSize int, callback ColumnarCallback) error
+}
+
+// Sequence describes a standalone sequence, one not owned by a table column.
+type Sequence struct {
+	Name      string
+	DataType  string // Integer type of the sequence, e.g. bigint
+	Start     int64
+	Increment int64
+	MinValue  int64
+	MaxValue  int64
+	Cycle     bool
+	LastValue sql.NullInt64 // Last value returned by nextval (NULL if never called)
+}
+
+// SequenceLister is implemented by drivers for databases with standalone sequences.
+type SequenceLister interface {
+	// GetSequences returns the standalone sequences in the database, ordered by name.
+	GetSequences() ([]Sequence, error)
+}
+
+// EnumType describes a user-defined enum type.
+type EnumType struct {
+	Name   string
+	Values []string // Labels in their sort order
+}
+
+// EnumLister is implemented by drivers for databases with user-defined enum types.
+type EnumLister interface {
+	// GetEnumTypes returns the enum types used by a table's columns, ordered by name.
+	GetEnumTypes(table string) ([]EnumType, error)
+}
+
 // Driver defines the interface for database operations.
 type Driver interface {
 	// Connect establishes a connection to the database.
@@ -54,6 +162,13 @@ type Driver interface {
 	// GetForeignKeys returns all foreign key relationships in the database.
 	GetForeignKeys() ([]ForeignKey, error)
 
+	// GetServerVersion returns the database server version string.
+	GetServerVersion() (string, error)
+
+	// GetPrimaryKey returns the primary key column names for a table, in key order.
+	// Returns an empty slice if the table has no primary key.
+	GetPrimaryKey(table string) ([]string, error)
+
 	// StreamRows streams rows from a table in batches.
 	// The opts parameter controls row filtering (by count or date).
 	StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error
@@ -61,6 +176,15 @@ type Driver interface {
 	// GetRowCount returns the number of rows in a table.
 	GetRowCount(table string) (int64, error)
 
+	// GetDistinctCount returns the number of distinct non-NULL values in a
+	// column of the rows a stream with opts would read, e.g. those matching
+	// its Where and retained by its Limit.
+	GetDistinctCount(table, column string, opts StreamOptions) (int64, error)
+
+	// GetOrphanCount returns the number of rows whose foreign key column is
+	// not NULL but matches no row of the referenced table.
+	GetOrphanCount(fk ForeignKey) (int64, error)
+
 	// QuoteIdentifier quotes an identifier (table/column name) for safe use in SQL.
 	QuoteIdentifier(name string) string
 
@@ -68,6 +192,13 @@ type Driver interface {
 	GetDatabaseType() string
 }
 
+// orphanCountQuery returns the query counting the rows that break a foreign key.
+func orphanCountQuery(d Driver, fk ForeignKey) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s c WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s = c.%s)",
+		d.QuoteIdentifier(fk.Table), d.QuoteIdentifier(fk.Column),
+		d.QuoteIdentifier(fk.ReferencedTable), d.QuoteIdentifier(fk.ReferencedColumn), d.QuoteIdentifier(fk.Column))
+}
+
 // NewDriver creates a new database driver based on the connection type.
 func NewDriver(dbType string) (Driver, error) {
 	switch dbType {
@@ -78,6 +209,276 @@ func NewDriver(dbType string) (Driver, error) {
 	case "sqlite":
 		return &SQLiteDriver{}, nil
 	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDriver, dbType)
+	}
+}
+
+// versionPattern extracts the major and minor numbers from a version string.
+var versionPattern = regexp.MustCompile(`^\s*(\d+)(?:\.(\d+))?`)
+
+// versionAtLeast reports whether a server version string such as "8.0.35",
+// "5.7.44-log" or "16.2 (Debian 16.2-1.pgdg120+1)" is at least major.minor.
+// Versions that cannot be parsed are assumed to be recent.
+func versionAtLeast(version string, major, minor int) bool {
+	matches := versionPattern.FindStringSubmatch(version)
+	if matches == nil {
+		return true
+	}
+
+	gotMajor, _ := strconv.Atoi(matches[1])
+	gotMinor, _ := strconv.Atoi(matches[2])
+	if gotMajor != major {
+		return gotMajor > major
+	}
+	return gotMinor >= minor
+}
+
+// selectColumns returns the columns to stream from a table: opts.Columns if
+// given, saving a metadata query, otherwise those reported by GetColumns.
+func selectColumns(d Driver, table string, opts StreamOptions) ([]string, error) {
+	if len(opts.Columns) > 0 {
+		return opts.Columns, nil
+	}
+
+	columns, err := d.GetColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names, nil
+}
+
+// streamColumnar scans rows into buffers that are allocated once and reused
+// for every batch, passing each full batch to callback.
+func streamColumnar(rows *sql.Rows, batchSize int, callback ColumnarCallback) error {
+	colNames, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get column names: %w", err)
+	}
+
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	// Allocate scan buffers once for the whole stream
+	values := make([][]any, batchSize)
+	valuePtrs := make([][]any, batchSize)
+	for i := range values {
+		values[i] = make([]any, len(colNames))
+		valuePtrs[i] = make([]any, len(colNames))
+		for j := range values[i] {
+			valuePtrs[i][j] = &values[i][j]
+		}
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs[n]...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		// Convert []byte to string for readability
+		for j, val := range values[n] {
+			if b, ok := val.([]byte); ok {
+				values[n][j] = string(b)
+			}
+		}
+		n++
+
+		// Process batch when full
+		if n >= batchSize {
+			if err := callback(colNames, values); err != nil {
+				return err
+			}
+			n = 0
+		}
+	}
+
+	// Process remaining rows
+	if n > 0 {
+		if err := callback(colNames, values[:n]); err != nil {
+			return err
+		}
 	}
+
+	return rows.Err()
+}
+
+// streamKeyset pages through a table by opts.KeyColumn, or opts.KeyColumns,
+// running one query per batch via stream, until a page returns fewer rows
+// than requested.
+func streamKeyset(opts StreamOptions, batchSize int, callback RowCallback, stream func(StreamOptions, RowCallback) error) error {
+	remaining := opts.Limit
+
+	for {
+		page := nextKeysetPage(opts, batchSize, remaining)
+
+		var fetched int
+		var lastKey any
+		var lastKeys []any
+		err := stream(page, func(rows []map[string]any) error {
+			fetched += len(rows)
+			lastKey = rows[len(rows)-1][opts.KeyColumn]
+			if len(opts.KeyColumns) > 0 {
+				lastKeys = make([]any, len(opts.KeyColumns))
+				for i, col := range opts.KeyColumns {
+					lastKeys[i] = rows[len(rows)-1][col]
+				}
+			}
+			return callback(rows)
+		})
+		if err != nil {
+			return err
+		}
+
+		if remaining > 0 {
+			remaining -= fetched
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if len(opts.KeyColumns) > 0 {
+			if fetched < page.Limit || lastKeys == nil {
+				return nil
+			}
+			opts.AfterKeys = lastKeys
+			continue
+		}
+		if fetched < page.Limit || lastKey == nil {
+			return nil
+		}
+		opts.AfterKey = lastKey
+	}
+}
+
+// streamKeysetColumnar is the columnar equivalent of streamKeyset.
+func streamKeysetColumnar(opts StreamOptions, batchSize int, callback ColumnarCallback, stream func(StreamOptions, ColumnarCallback) error) error {
+	remaining := opts.Limit
+
+	for {
+		page := nextKeysetPage(opts, batchSize, remaining)
+
+		var fetched int
+		var lastKey any
+		var lastKeys []any
+		err := stream(page, func(cols []string, values [][]any) error {
+			fetched += len(values)
+			for i, col := range cols {
+				if col == opts.KeyColumn {
+					lastKey = values[len(values)-1][i]
+				}
+			}
+			if len(opts.KeyColumns) > 0 {
+				// Buffers are reused, so keep copies of the key values
+				lastKeys = make([]any, len(opts.KeyColumns))
+				for k, key := range opts.KeyColumns {
+					for i, col := range cols {
+						if col == key {
+							lastKeys[k] = copyKey(values[len(values)-1][i])
+						}
+					}
+				}
+			}
+			return callback(cols, values)
+		})
+		if err != nil {
+			return err
+		}
+
+		if remaining > 0 {
+			remaining -= fetched
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if len(opts.KeyColumns) > 0 {
+			if fetched < page.Limit || lastKeys == nil {
+				return nil
+			}
+			opts.AfterKeys = lastKeys
+			continue
+		}
+		if fetched < page.Limit || lastKey == nil {
+			return nil
+		}
+		opts.AfterKey = lastKey
+	}
+}
+
+// copyKey returns a copy of a key value that may be held in a reused buffer.
+func copyKey(val any) any {
+	if b, ok := val.([]byte); ok {
+		return bytes.Clone(b)
+	}
+	return val
+}
+
+// nextKeysetPage returns the options for a single keyset page query.
+func nextKeysetPage(opts StreamOptions, batchSize, remaining int) StreamOptions {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	page := opts
+	page.Keyset = false
+	page.Limit = batchSize
+	if remaining > 0 && remaining < batchSize {
+		page.Limit = remaining
+	}
+	return page
+}
+
+// retryableMessages are error message fragments that indicate a transient
+// failure where re-running the query is likely to succeed.
+var retryableMessages = []string{
+	"lost connection",
+	"server has gone away",
+	"connection reset",
+	"broken pipe",
+	"deadlock",
+	"lock wait timeout",
+}
+
+// IsRetryableError reports whether err is a transient failure, such as a lost
+// connection or deadlock, after which a stream can be resumed.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, 1213: // lock wait timeout, deadlock
+			return true
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", "40P01": // serialization failure, deadlock detected
+			return true
+		}
+		if pqErr.Code.Class() == "08" { // connection exception
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range retryableMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+
+	return false
 }
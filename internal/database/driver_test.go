@@ -1,7 +1,14 @@
 package database
 
 import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
 	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 )
 
 func TestNewDriver(t *testing.T) {
@@ -50,6 +57,10 @@ func TestNewDriver(t *testing.T) {
 				return
 			}
 
+			if tt.wantErr && !errors.Is(err, ErrUnsupportedDriver) {
+				t.Errorf("NewDriver(%q) error = %v, want ErrUnsupportedDriver", tt.dbType, err)
+			}
+
 			if !tt.wantErr && driver.GetDatabaseType() != tt.wantType {
 				t.Errorf("GetDatabaseType() = %q, want %q", driver.GetDatabaseType(), tt.wantType)
 			}
@@ -84,6 +95,8 @@ func TestColumnInfoStruct(t *testing.T) {
 		Name:       "email",
 		DataType:   "VARCHAR(255)",
 		IsNullable: true,
+		Extra:      "auto_increment",
+		Comment:    "contact email",
 	}
 
 	if col.Name != "email" {
@@ -95,4 +108,223 @@ func TestColumnInfoStruct(t *testing.T) {
 	if !col.IsNullable {
 		t.Error("IsNullable = false, want true")
 	}
+	if col.Extra != "auto_increment" {
+		t.Errorf("Extra = %q, want %q", col.Extra, "auto_increment")
+	}
+	if col.Comment != "contact email" {
+		t.Errorf("Comment = %q, want %q", col.Comment, "contact email")
+	}
+}
+
+func TestColumnInfo_IsAutoIncrement(t *testing.T) {
+	tests := []struct {
+		extra string
+		want  bool
+	}{
+		{"auto_increment", true},
+		{"AUTO_INCREMENT", true},
+		{"auto_increment on update CURRENT_TIMESTAMP", true},
+		{"DEFAULT_GENERATED", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		col := ColumnInfo{Name: "id", Extra: tt.extra}
+		if got := col.IsAutoIncrement(); got != tt.want {
+			t.Errorf("IsAutoIncrement() with Extra %q = %v, want %v", tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestColumnInfo_IsArray(t *testing.T) {
+	tests := []struct {
+		dataType string
+		want     bool
+	}{
+		{"ARRAY", true},
+		{"text[]", true},
+		{"integer[]", true},
+		{"text", false},
+		{"json", false},
+	}
+
+	for _, tt := range tests {
+		col := ColumnInfo{Name: "tags", DataType: tt.dataType}
+		if got := col.IsArray(); got != tt.want {
+			t.Errorf("IsArray() with DataType %q = %v, want %v", tt.dataType, got, tt.want)
+		}
+	}
+}
+
+func TestColumnInfo_IsDecimal(t *testing.T) {
+	tests := []struct {
+		dataType string
+		want     bool
+	}{
+		{"decimal", true},
+		{"DECIMAL(10,2)", true},
+		{"numeric", true},
+		{"NUMERIC(12, 4)", true},
+		{"numeric[]", false},
+		{"float", false},
+		{"int", false},
+		{"varchar", false},
+	}
+
+	for _, tt := range tests {
+		col := ColumnInfo{Name: "price", DataType: tt.dataType}
+		if got := col.IsDecimal(); got != tt.want {
+			t.Errorf("IsDecimal() with DataType %q = %v, want %v", tt.dataType, got, tt.want)
+		}
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"wrapped unexpected EOF", fmt.Errorf("scan: %w", io.ErrUnexpectedEOF), true},
+		{"mysql invalid conn", mysql.ErrInvalidConn, true},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, true},
+		{"mysql syntax error", &mysql.MySQLError{Number: 1064, Message: "syntax"}, false},
+		{"postgres deadlock", &pq.Error{Code: "40P01"}, true},
+		{"postgres connection failure", &pq.Error{Code: "08006"}, true},
+		{"postgres undefined table", &pq.Error{Code: "42P01"}, false},
+		{"lost connection message", errors.New("Lost connection to MySQL server during query"), true},
+		{"other error", errors.New("no such table: users"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuoteMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    QuoteMode
+		wantErr bool
+	}{
+		{"", QuoteAlways, false},
+		{"always", QuoteAlways, false},
+		{"minimal", QuoteMinimal, false},
+		{"never", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseQuoteMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuoteMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuoteMode(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifier_Minimal(t *testing.T) {
+	mysql := &MySQLDriver{}
+	mysql.SetQuoteMode(QuoteMinimal)
+	postgres := &PostgresDriver{}
+	postgres.SetQuoteMode(QuoteMinimal)
+	sqlite := &SQLiteDriver{}
+	sqlite.SetQuoteMode(QuoteMinimal)
+
+	tests := []struct {
+		driver Driver
+		name   string
+		want   string
+	}{
+		// MySQL
+		{mysql, "users", "users"},
+		{mysql, "created_at", "created_at"},
+		{mysql, "CamelCase", "CamelCase"},
+		{mysql, "order", "`order`"},
+		{mysql, "KEY", "`KEY`"},
+		{mysql, "first name", "`first name`"},
+		{mysql, "2fa", "`2fa`"},
+		{mysql, "a`b", "`a``b`"},
+
+		// PostgreSQL
+		{postgres, "users", "users"},
+		{postgres, "created_at", "created_at"},
+		{postgres, "CamelCase", `"CamelCase"`},
+		{postgres, "user", `"user"`},
+		{postgres, "order", `"order"`},
+		{postgres, "key", "key"},
+		{postgres, "first-name", `"first-name"`},
+
+		// SQLite
+		{sqlite, "users", "users"},
+		{sqlite, "CamelCase", "CamelCase"},
+		{sqlite, "group", `"group"`},
+		{sqlite, "transaction", `"transaction"`},
+		{sqlite, "with space", `"with space"`},
+		{sqlite, "", `""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver.GetDatabaseType()+"/"+tt.name, func(t *testing.T) {
+			if got := tt.driver.QuoteIdentifier(tt.name); got != tt.want {
+				t.Errorf("QuoteIdentifier(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifier_AlwaysByDefault(t *testing.T) {
+	tests := []struct {
+		driver Driver
+		want   string
+	}{
+		{&MySQLDriver{}, "`users`"},
+		{&PostgresDriver{}, `"users"`},
+		{&SQLiteDriver{}, `"users"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver.GetDatabaseType(), func(t *testing.T) {
+			if got := tt.driver.QuoteIdentifier("users"); got != tt.want {
+				t.Errorf("QuoteIdentifier(%q) = %q, want %q", "users", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		want         bool
+	}{
+		{"8.0.35", 5, 7, true},
+		{"5.7.44-log", 5, 7, true},
+		{"5.6.51", 5, 7, false},
+		{"10.11.6-MariaDB", 5, 7, true},
+		{"16.2 (Debian 16.2-1.pgdg120+1)", 9, 5, true},
+		{"9.4.26", 9, 5, false},
+		{"10", 9, 5, true},
+		{"3.15.2", 3, 16, false},
+		{"3.45.1", 3, 16, true},
+		{"unknown", 99, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := versionAtLeast(tt.version, tt.major, tt.minor); got != tt.want {
+				t.Errorf("versionAtLeast(%q, %d, %d) = %v, want %v", tt.version, tt.major, tt.minor, got, tt.want)
+			}
+		})
+	}
 }
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
@@ -12,32 +14,52 @@ import (
 
 // MySQLDriver implements the Driver interface for MySQL databases.
 type MySQLDriver struct {
-	db       *sql.DB
-	database string
+	db            *sql.DB
+	database      string
+	quoteMode     QuoteMode
+	serverVersion string
+	zeroDates     bool     // Date columns are parsed here, mapping zero dates to ZeroDate
+	tx            activeTx // Transaction rolled back by Close if not committed
 }
 
 // Connect establishes a connection to the MySQL database.
 func (d *MySQLDriver) Connect(cfg *config.Connection) error {
 	db, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
-		return fmt.Errorf("failed to open MySQL connection: %w", err)
+		return fmt.Errorf("%w: failed to open MySQL connection: %w", ErrConnectionFailed, err)
 	}
 
 	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping MySQL: %w", err)
+		return fmt.Errorf("%w: failed to ping MySQL: %w", ErrConnectionFailed, err)
 	}
 
 	d.db = db
 	d.database = cfg.DatabaseName
+	d.zeroDates = cfg.ZeroDates != ""
 	return nil
 }
 
-// Close closes the database connection.
+// Close rolls back any open transaction and closes the database connection.
 func (d *MySQLDriver) Close() error {
-	if d.db != nil {
-		return d.db.Close()
+	if d.db == nil {
+		return nil
 	}
-	return nil
+
+	rollbackErr := d.tx.rollback()
+	if err := d.db.Close(); err != nil {
+		return err
+	}
+	return rollbackErr
+}
+
+// BeginTx starts a transaction that Close rolls back unless CommitTx is called.
+func (d *MySQLDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.tx.begin(ctx, d.db, opts)
+}
+
+// CommitTx commits the transaction started by BeginTx.
+func (d *MySQLDriver) CommitTx() error {
+	return d.tx.commit()
 }
 
 // GetTables returns all table names in the database.
@@ -79,7 +101,15 @@ func (d *MySQLDriver) GetTableSchema(table string) (string, error) {
 
 // GetColumns returns column information for a table.
 func (d *MySQLDriver) GetColumns(table string) ([]ColumnInfo, error) {
-	query := `SELECT column_name, data_type, is_nullable, column_default
+	// Generated columns were added in MySQL 5.7. MariaDB leaves the
+	// expression of ordinary columns NULL
+	generationExpression := "COALESCE(generation_expression, '')"
+	if !d.supports(5, 7) {
+		generationExpression = "''"
+	}
+
+	query := `SELECT column_name, data_type, is_nullable, column_default, extra, column_comment, ` + generationExpression + `,
+                     COALESCE(character_maximum_length, 0), COALESCE(character_set_name, '')
               FROM information_schema.columns
               WHERE table_schema = ? AND table_name = ?
               ORDER BY ordinal_position`
@@ -94,7 +124,7 @@ func (d *MySQLDriver) GetColumns(table string) ([]ColumnInfo, error) {
 	for rows.Next() {
 		var col ColumnInfo
 		var isNullable string
-		if err := rows.Scan(&col.Name, &col.DataType, &isNullable, &col.Default); err != nil {
+		if err := rows.Scan(&col.Name, &col.DataType, &isNullable, &col.Default, &col.Extra, &col.Comment, &col.GenerationExpression, &col.MaxLength, &col.CharacterSet); err != nil {
 			return nil, fmt.Errorf("failed to scan column: %w", err)
 		}
 		col.IsNullable = isNullable == "YES"
@@ -104,6 +134,27 @@ func (d *MySQLDriver) GetColumns(table string) ([]ColumnInfo, error) {
 	return columns, rows.Err()
 }
 
+// GetServerVersion returns the MySQL server version, e.g. "8.0.35".
+func (d *MySQLDriver) GetServerVersion() (string, error) {
+	if d.serverVersion != "" {
+		return d.serverVersion, nil
+	}
+
+	var version string
+	if err := d.db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	d.serverVersion = version
+	return version, nil
+}
+
+// supports reports whether the server is at least version major.minor.
+// If the version cannot be read the server is assumed to be recent.
+func (d *MySQLDriver) supports(major, minor int) bool {
+	version, err := d.GetServerVersion()
+	return err != nil || versionAtLeast(version, major, minor)
+}
+
 // GetForeignKeys returns all foreign key relationships in the database.
 func (d *MySQLDriver) GetForeignKeys() ([]ForeignKey, error) {
 	query := `SELECT
@@ -134,35 +185,43 @@ func (d *MySQLDriver) GetForeignKeys() ([]ForeignKey, error) {
 	return fks, rows.Err()
 }
 
-// StreamRows streams rows from a table in batches.
-func (d *MySQLDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
-	// Get column names first
-	columns, err := d.GetColumns(table)
+// GetPrimaryKey returns the primary key column names for a table.
+func (d *MySQLDriver) GetPrimaryKey(table string) ([]string, error) {
+	query := `SELECT column_name
+              FROM information_schema.key_column_usage
+              WHERE table_schema = ? AND table_name = ? AND constraint_name = 'PRIMARY'
+              ORDER BY ordinal_position`
+
+	rows, err := d.db.Query(query, d.database, table)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to query primary key: %w", err)
 	}
+	defer rows.Close()
 
-	columnNames := make([]string, len(columns))
-	for i, col := range columns {
-		columnNames[i] = d.QuoteIdentifier(col.Name)
+	var pkCols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
+		}
+		pkCols = append(pkCols, col)
 	}
 
-	// Build query
-	query := fmt.Sprintf("SELECT %s FROM %s",
-		strings.Join(columnNames, ", "),
-		d.QuoteIdentifier(table))
-
-	var args []any
+	return pkCols, rows.Err()
+}
 
-	// Add date-based WHERE clause if specified
-	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
-		query += fmt.Sprintf(" WHERE %s > ?", d.QuoteIdentifier(opts.ColumnName))
-		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+// StreamRows streams rows from a table in batches.
+func (d *MySQLDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && opts.KeyColumn != "" {
+		return streamKeyset(opts, batchSize, callback, func(page StreamOptions, cb RowCallback) error {
+			return d.StreamRows(table, page, batchSize, cb)
+		})
 	}
 
-	// Add LIMIT clause if specified
-	if opts.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
 	}
 
 	rows, err := d.db.Query(query, args...)
@@ -177,6 +236,11 @@ func (d *MySQLDriver) StreamRows(table string, opts StreamOptions, batchSize int
 		return fmt.Errorf("failed to get column names: %w", err)
 	}
 
+	dateCols, err := d.dateColumns(rows)
+	if err != nil {
+		return err
+	}
+
 	batch := make([]map[string]any, 0, batchSize)
 
 	for rows.Next() {
@@ -197,7 +261,11 @@ func (d *MySQLDriver) StreamRows(table string, opts StreamOptions, batchSize int
 			val := values[i]
 			// Convert []byte to string for readability
 			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
+				if dateCols[i] {
+					row[col] = parseMySQLDate(string(b))
+				} else {
+					row[col] = string(b)
+				}
 			} else {
 				row[col] = val
 			}
@@ -223,6 +291,140 @@ func (d *MySQLDriver) StreamRows(table string, opts StreamOptions, batchSize int
 	return rows.Err()
 }
 
+// StreamRowsColumnar streams rows from a table in batches, reusing scan
+// buffers between batches instead of allocating a map per row.
+func (d *MySQLDriver) StreamRowsColumnar(table string, opts StreamOptions, batchSize int, callback ColumnarCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && opts.KeyColumn != "" {
+		return streamKeysetColumnar(opts, batchSize, callback, func(page StreamOptions, cb ColumnarCallback) error {
+			return d.StreamRowsColumnar(table, page, batchSize, cb)
+		})
+	}
+
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query rows: %w", err)
+	}
+	defer rows.Close()
+
+	dateCols, err := d.dateColumns(rows)
+	if err != nil {
+		return err
+	}
+	if dateCols != nil {
+		next := callback
+		callback = func(cols []string, values [][]any) error {
+			for _, row := range values {
+				for i, isDate := range dateCols {
+					if s, ok := row[i].(string); ok && isDate {
+						row[i] = parseMySQLDate(s)
+					}
+				}
+			}
+			return next(cols, values)
+		}
+	}
+
+	return streamColumnar(rows, batchSize, callback)
+}
+
+// mysqlDateTypes are the column types that can hold zero dates.
+var mysqlDateTypes = map[string]bool{"DATE": true, "DATETIME": true, "TIMESTAMP": true}
+
+// dateColumns reports, for each result column, whether it holds dates that
+// must be parsed here. It returns nil unless zero date handling is enabled.
+func (d *MySQLDriver) dateColumns(rows *sql.Rows) ([]bool, error) {
+	if !d.zeroDates {
+		return nil, nil
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+
+	dateCols := make([]bool, len(types))
+	for i, t := range types {
+		dateCols[i] = mysqlDateTypes[t.DatabaseTypeName()]
+	}
+	return dateCols, nil
+}
+
+// parseMySQLDate parses a DATE, DATETIME or TIMESTAMP value as read with
+// parseTime=false. Zero and invalid dates are returned as a ZeroDate.
+func parseMySQLDate(s string) any {
+	layout := "2006-01-02 15:04:05"
+	if len(s) == len("2006-01-02") {
+		layout = "2006-01-02"
+	}
+
+	t, err := time.ParseInLocation(layout, s, time.UTC)
+	if err != nil {
+		return ZeroDate(s)
+	}
+	return t
+}
+
+// buildSelectQuery builds the SELECT statement used to stream rows from a table.
+func (d *MySQLDriver) buildSelectQuery(table string, opts StreamOptions) (string, []any, error) {
+	// Get column names first
+	columns, err := selectColumns(d, table, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = d.QuoteIdentifier(col)
+	}
+
+	// Build query
+	query := fmt.Sprintf("SELECT %s FROM %s",
+		strings.Join(columnNames, ", "),
+		d.QuoteIdentifier(table))
+
+	var args []any
+	var conditions []string
+
+	// Add date-based condition if specified
+	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s > ?", d.QuoteIdentifier(opts.ColumnName)))
+		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+	}
+
+	// Add raw predicate if specified
+	if opts.Where != "" {
+		conditions = append(conditions, "("+opts.Where+")")
+	}
+
+	// Resume after the last key seen if specified
+	if opts.KeyColumn != "" && opts.AfterKey != nil {
+		conditions = append(conditions, fmt.Sprintf("%s > ?", d.QuoteIdentifier(opts.KeyColumn)))
+		args = append(args, opts.AfterKey)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Order by key so the stream can be resumed
+	if opts.KeyColumn != "" {
+		query += " ORDER BY " + d.QuoteIdentifier(opts.KeyColumn)
+	}
+
+	// Add LIMIT clause if specified
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	return query, args, nil
+}
+
 // GetRowCount returns the number of rows in a table.
 func (d *MySQLDriver) GetRowCount(table string) (int64, error) {
 	var count int64
@@ -234,11 +436,48 @@ func (d *MySQLDriver) GetRowCount(table string) (int64, error) {
 	return count, nil
 }
 
+// GetDistinctCount returns the number of distinct non-NULL values in a
+// column of the rows a stream with opts would read.
+func (d *MySQLDriver) GetDistinctCount(table, column string, opts StreamOptions) (int64, error) {
+	opts.Columns = []string{column}
+	rows, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(DISTINCT %s) FROM (%s) AS filtered", d.QuoteIdentifier(column), rows)
+	err = d.db.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count distinct values: %w", err)
+	}
+	return count, nil
+}
+
+// GetOrphanCount returns the number of rows whose foreign key column is
+// not NULL but matches no row of the referenced table.
+func (d *MySQLDriver) GetOrphanCount(fk ForeignKey) (int64, error) {
+	var count int64
+	if err := d.db.QueryRow(orphanCountQuery(d, fk)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphaned rows: %w", err)
+	}
+	return count, nil
+}
+
 // QuoteIdentifier quotes an identifier for MySQL.
+// In QuoteMinimal mode only reserved words and non-word identifiers are quoted.
 func (d *MySQLDriver) QuoteIdentifier(name string) string {
+	if d.quoteMode == QuoteMinimal && !needsQuoting(name, bareIdentifier, mysqlReservedWords) {
+		return name
+	}
 	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
 }
 
+// SetQuoteMode sets when QuoteIdentifier quotes identifiers.
+func (d *MySQLDriver) SetQuoteMode(mode QuoteMode) {
+	d.quoteMode = mode
+}
+
 // GetDatabaseType returns "mysql".
 func (d *MySQLDriver) GetDatabaseType() string {
 	return "mysql"
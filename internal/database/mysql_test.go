@@ -0,0 +1,423 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+func newMockMySQLDriver(t *testing.T) (*MySQLDriver, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &MySQLDriver{db: db, database: "testdb"}, mock
+}
+
+func TestMySQLDriver_GetColumns(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.35"))
+
+	rows := sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "extra", "column_comment", "generation_expression", "character_maximum_length", "character_set_name"}).
+		AddRow("id", "int", "NO", nil, "auto_increment", "", "", 0, "").
+		AddRow("email", "varchar", "YES", nil, "", "PII: contact email", "", 255, "utf8mb4").
+		AddRow("updated_at", "timestamp", "NO", "CURRENT_TIMESTAMP", "DEFAULT_GENERATED on update CURRENT_TIMESTAMP", "", "", 0, "").
+		AddRow("full_name", "varchar", "YES", nil, "VIRTUAL GENERATED", "", "concat(`first_name`,' ',`last_name`)", 101, "latin1")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT column_name, data_type, is_nullable, column_default, extra, column_comment, COALESCE(generation_expression, '')")).
+		WithArgs("testdb", "users").
+		WillReturnRows(rows)
+
+	columns, err := driver.GetColumns("users")
+	if err != nil {
+		t.Fatalf("GetColumns() error = %v", err)
+	}
+	if len(columns) != 4 {
+		t.Fatalf("GetColumns() returned %d columns, want 4", len(columns))
+	}
+
+	if columns[0].Extra != "auto_increment" {
+		t.Errorf("id.Extra = %q, want auto_increment", columns[0].Extra)
+	}
+	if !columns[0].IsAutoIncrement() {
+		t.Error("id.IsAutoIncrement() = false, want true")
+	}
+	if columns[0].CharacterSet != "" || columns[3].CharacterSet != "latin1" {
+		t.Errorf("CharacterSet = %q, %q, want none for id and latin1 for full_name", columns[0].CharacterSet, columns[3].CharacterSet)
+	}
+	if columns[1].MaxLength != 255 {
+		t.Errorf("email.MaxLength = %d, want 255", columns[1].MaxLength)
+	}
+	if columns[1].Comment != "PII: contact email" {
+		t.Errorf("email.Comment = %q, want %q", columns[1].Comment, "PII: contact email")
+	}
+	if !columns[1].IsNullable {
+		t.Error("email.IsNullable = false, want true")
+	}
+	if columns[2].Extra != "DEFAULT_GENERATED on update CURRENT_TIMESTAMP" {
+		t.Errorf("updated_at.Extra = %q", columns[2].Extra)
+	}
+	if !columns[2].Default.Valid || columns[2].Default.String != "CURRENT_TIMESTAMP" {
+		t.Errorf("updated_at.Default = %v, want CURRENT_TIMESTAMP", columns[2].Default)
+	}
+	if columns[3].GenerationExpression != "concat(`first_name`,' ',`last_name`)" {
+		t.Errorf("full_name.GenerationExpression = %q", columns[3].GenerationExpression)
+	}
+	if !columns[3].IsGenerated() || columns[2].IsGenerated() {
+		t.Errorf("IsGenerated() = %v, %v for full_name, updated_at, want true, false", columns[3].IsGenerated(), columns[2].IsGenerated())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_GetColumns_MariaDB(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("10.11.6-MariaDB"))
+
+	// MariaDB's generation_expression is NULL for ordinary columns, which
+	// the query reads as an empty string
+	rows := sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "extra", "column_comment", "COALESCE(generation_expression, '')", "character_maximum_length", "character_set_name"}).
+		AddRow("id", "int", "NO", nil, "auto_increment", "", "", 0, "").
+		AddRow("total", "int", "YES", nil, "VIRTUAL GENERATED", "", "`a` + `b`", 0, "")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT column_name, data_type, is_nullable, column_default, extra, column_comment, COALESCE(generation_expression, '')")).
+		WithArgs("testdb", "users").
+		WillReturnRows(rows)
+
+	columns, err := driver.GetColumns("users")
+	if err != nil {
+		t.Fatalf("GetColumns() error = %v", err)
+	}
+	if len(columns) != 2 || columns[0].IsGenerated() || columns[1].GenerationExpression != "`a` + `b`" {
+		t.Errorf("GetColumns() = %+v", columns)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_GetServerVersion(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.44-log"))
+
+	version, err := driver.GetServerVersion()
+	if err != nil {
+		t.Fatalf("GetServerVersion() error = %v", err)
+	}
+	if version != "5.7.44-log" {
+		t.Errorf("GetServerVersion() = %q, want %q", version, "5.7.44-log")
+	}
+
+	// The version is cached after the first query
+	if _, err := driver.GetServerVersion(); err != nil {
+		t.Fatalf("GetServerVersion() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_GetColumns_BeforeGeneratedColumns(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.6.51"))
+
+	rows := sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "extra", "column_comment", "''", "character_maximum_length", "character_set_name"}).
+		AddRow("id", "int", "NO", nil, "auto_increment", "", "", 0, "")
+	mock.ExpectQuery("SELECT column_name, data_type, is_nullable, column_default, extra, column_comment, ''").
+		WithArgs("testdb", "users").
+		WillReturnRows(rows)
+
+	columns, err := driver.GetColumns("users")
+	if err != nil {
+		t.Fatalf("GetColumns() error = %v", err)
+	}
+	if len(columns) != 1 || columns[0].GenerationExpression != "" {
+		t.Errorf("GetColumns() = %+v", columns)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// expectZeroDateStream sets up a table with a zero and a valid date. A real
+// server only stores zero dates when sql_mode excludes NO_ZERO_DATE, e.g.
+// SET sql_mode = 'NO_ENGINE_SUBSTITUTION'; INSERT INTO events VALUES (1, '0000-00-00 00:00:00', '0000-00-00').
+func expectZeroDateStream(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.35"))
+	mock.ExpectQuery("SELECT column_name, data_type").
+		WithArgs("testdb", "events").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "extra", "column_comment", "generation_expression", "character_maximum_length", "character_set_name"}).
+			AddRow("id", "int", "NO", nil, "", "", "", 0, "").
+			AddRow("created_at", "datetime", "YES", nil, "", "", "", 0, "").
+			AddRow("day", "date", "YES", nil, "", "", "", 0, "").
+			AddRow("name", "varchar", "YES", nil, "", "", "", 0, "utf8mb4"))
+
+	rows := sqlmock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("INT", int64(0)),
+		sqlmock.NewColumn("created_at").OfType("DATETIME", []byte{}),
+		sqlmock.NewColumn("day").OfType("DATE", []byte{}),
+		sqlmock.NewColumn("name").OfType("VARCHAR", []byte{}),
+	).
+		AddRow(int64(1), []byte("0000-00-00 00:00:00"), []byte("0000-00-00"), []byte("0000-00-00")).
+		AddRow(int64(2), []byte("2024-03-15 10:30:00"), []byte("2024-03-15"), []byte("valid"))
+	mock.ExpectQuery("SELECT `id`, `created_at`, `day`, `name` FROM `events`").WillReturnRows(rows)
+}
+
+func TestMySQLDriver_StreamRows_ZeroDates(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+	driver.zeroDates = true
+	expectZeroDateStream(mock)
+
+	var got []map[string]any
+	err := driver.StreamRows("events", StreamOptions{}, 10, func(rows []map[string]any) error {
+		got = append(got, rows...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamRows() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("StreamRows() returned %d rows, want 2", len(got))
+	}
+
+	if got[0]["created_at"] != ZeroDate("0000-00-00 00:00:00") {
+		t.Errorf("zero datetime = %#v, want ZeroDate", got[0]["created_at"])
+	}
+	if got[0]["day"] != ZeroDate("0000-00-00") {
+		t.Errorf("zero date = %#v, want ZeroDate", got[0]["day"])
+	}
+	if got[0]["name"] != "0000-00-00" {
+		t.Errorf("non-date column = %#v, want string", got[0]["name"])
+	}
+
+	want := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	if ts, ok := got[1]["created_at"].(time.Time); !ok || !ts.Equal(want) {
+		t.Errorf("valid datetime = %#v, want %v", got[1]["created_at"], want)
+	}
+	if ts, ok := got[1]["day"].(time.Time); !ok || !ts.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("valid date = %#v, want 2024-03-15", got[1]["day"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_StreamRowsColumnar_ZeroDates(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+	driver.zeroDates = true
+	expectZeroDateStream(mock)
+
+	var created []any
+	err := driver.StreamRowsColumnar("events", StreamOptions{}, 10, func(cols []string, values [][]any) error {
+		for _, row := range values {
+			created = append(created, row[1])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamRowsColumnar() error = %v", err)
+	}
+
+	if len(created) != 2 || created[0] != ZeroDate("0000-00-00 00:00:00") {
+		t.Errorf("created_at values = %#v, want ZeroDate first", created)
+	}
+	if _, ok := created[1].(time.Time); !ok {
+		t.Errorf("valid datetime = %#v, want time.Time", created[1])
+	}
+}
+
+func TestMySQLDriver_StreamRows_GivenColumns(t *testing.T) {
+	driver, mock := newMockMySQLDriver(t)
+
+	// Columns are read once, as by the schema analyser
+	mock.ExpectQuery(`SELECT VERSION\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.35"))
+	mock.ExpectQuery("SELECT column_name, data_type").
+		WithArgs("testdb", "users").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "extra", "column_comment", "generation_expression", "character_maximum_length", "character_set_name"}).
+			AddRow("id", "int", "NO", nil, "", "", "", 0, "").
+			AddRow("email", "varchar", "YES", nil, "", "", "", 0, "utf8mb4"))
+
+	// Each keyset page selects the given columns without looking them up again
+	mock.ExpectQuery("SELECT `id`, `email` FROM `users` ORDER BY `id` LIMIT 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(int64(1), "a@example.com").AddRow(int64(2), "b@example.com"))
+	mock.ExpectQuery("SELECT `id`, `email` FROM `users` WHERE `id` > \\? ORDER BY `id` LIMIT 2").
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(int64(3), "c@example.com"))
+
+	columns, err := driver.GetColumns("users")
+	if err != nil {
+		t.Fatalf("GetColumns() error = %v", err)
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+
+	var got int
+	opts := StreamOptions{KeyColumn: "id", Keyset: true, Columns: names}
+	err = driver.StreamRows("users", opts, 2, func(rows []map[string]any) error {
+		got += len(rows)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamRows() error = %v", err)
+	}
+	if got != 3 {
+		t.Errorf("StreamRows() returned %d rows, want 3", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_StreamRows_ReservedWords(t *testing.T) {
+	afterDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Reserved words are quoted in every clause, even when quoting is minimal
+	tests := []struct {
+		name      string
+		mode      QuoteMode
+		opts      StreamOptions
+		wantQuery string
+		wantArgs  []driver.Value
+	}{
+		{
+			name:      "retention by reserved date column",
+			mode:      QuoteAlways,
+			opts:      StreamOptions{ColumnName: "select", AfterDate: afterDate, KeyColumn: "id", Limit: 10},
+			wantQuery: "SELECT `id`, `select` FROM `order` WHERE `select` > ? ORDER BY `id` LIMIT 10",
+			wantArgs:  []driver.Value{"2024-01-01 00:00:00"},
+		},
+		{
+			name:      "retention by reserved date column with minimal quoting",
+			mode:      QuoteMinimal,
+			opts:      StreamOptions{ColumnName: "select", AfterDate: afterDate, KeyColumn: "id", Limit: 10},
+			wantQuery: "SELECT id, `select` FROM `order` WHERE `select` > ? ORDER BY id LIMIT 10",
+			wantArgs:  []driver.Value{"2024-01-01 00:00:00"},
+		},
+		{
+			name:      "resume after reserved key column",
+			mode:      QuoteAlways,
+			opts:      StreamOptions{KeyColumn: "select", AfterKey: "b", Where: "id > 0"},
+			wantQuery: "SELECT `id`, `select` FROM `order` WHERE (id > 0) AND `select` > ? ORDER BY `select`",
+			wantArgs:  []driver.Value{"b"},
+		},
+		{
+			name:      "resume after reserved key column with minimal quoting",
+			mode:      QuoteMinimal,
+			opts:      StreamOptions{KeyColumn: "select", AfterKey: "b", Where: "id > 0"},
+			wantQuery: "SELECT id, `select` FROM `order` WHERE (id > 0) AND `select` > ? ORDER BY `select`",
+			wantArgs:  []driver.Value{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, mock := newMockMySQLDriver(t)
+			d.SetQuoteMode(tt.mode)
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantQuery)).
+				WithArgs(tt.wantArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "select"}).AddRow(int64(1), "c"))
+
+			opts := tt.opts
+			opts.Columns = []string{"id", "select"}
+			err := d.StreamRows("order", opts, 10, func(rows []map[string]any) error { return nil })
+			if err != nil {
+				t.Fatalf("StreamRows() error = %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestMySQLDriver_CloseRollsBackTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	driver := &MySQLDriver{db: db, database: "testdb"}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := driver.BeginTx(ctx, nil); err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMySQLDriver_SessionVarsDSN(t *testing.T) {
+	conn := config.Connection{
+		Type:         "mysql",
+		Host:         "localhost",
+		Username:     "root",
+		DatabaseName: "testdb",
+		Charset:      "latin1",
+		SessionVars: config.SessionVars{
+			"net_read_timeout":     "600",
+			"NET_WRITE_TIMEOUT":    "600",
+			"group_concat_max_len": "1048576",
+			"sql_mode":             "'ANSI_QUOTES,NO_ZERO_DATE'",
+		},
+	}
+
+	// The driver sends every parameter it does not read itself as a SET
+	// on each connection it opens
+	cfg, err := mysql.ParseDSN(conn.DSN())
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+
+	want := map[string]string{
+		"net_read_timeout":     "600",
+		"net_write_timeout":    "600",
+		"group_concat_max_len": "1048576",
+		"sql_mode":             "'ANSI_QUOTES,NO_ZERO_DATE'",
+	}
+	if !reflect.DeepEqual(cfg.Params, want) {
+		t.Errorf("Params = %v, want %v", cfg.Params, want)
+	}
+	if cfg.DBName != "testdb" || !cfg.MultiStatements {
+		t.Errorf("DSN options lost: DBName = %q, MultiStatements = %v", cfg.DBName, cfg.MultiStatements)
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+// policyColumns are the columns of a policy table, in PolicyRule order.
+var policyColumns = []string{"table_name", "column_name", "rule"}
+
+// ReadPolicy reads the rows of a policy table holding column rules. NULL
+// columns are read as empty strings.
+func ReadPolicy(d Driver, table string) ([]config.PolicyRule, error) {
+	var rules []config.PolicyRule
+	err := d.StreamRows(table, StreamOptions{Columns: policyColumns}, 1000, func(rows []map[string]any) error {
+		for _, row := range rows {
+			rules = append(rules, config.PolicyRule{
+				Table:  policyString(row["table_name"]),
+				Column: policyString(row["column_name"]),
+				Rule:   policyString(row["rule"]),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy table %s: %w", table, err)
+	}
+	return rules, nil
+}
+
+// policyString returns a policy table value as a string.
+func policyString(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
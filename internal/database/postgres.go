@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -12,19 +13,22 @@ import (
 
 // PostgresDriver implements the Driver interface for PostgreSQL databases.
 type PostgresDriver struct {
-	db       *sql.DB
-	database string
+	db            *sql.DB
+	database      string
+	quoteMode     QuoteMode
+	serverVersion string
+	tx            activeTx // Transaction rolled back by Close if not committed
 }
 
 // Connect establishes a connection to the PostgreSQL database.
 func (d *PostgresDriver) Connect(cfg *config.Connection) error {
 	db, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		return fmt.Errorf("failed to open PostgreSQL connection: %w", err)
+		return fmt.Errorf("%w: failed to open PostgreSQL connection: %w", ErrConnectionFailed, err)
 	}
 
 	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping PostgreSQL: %w", err)
+		return fmt.Errorf("%w: failed to ping PostgreSQL: %w", ErrConnectionFailed, err)
 	}
 
 	d.db = db
@@ -32,12 +36,27 @@ func (d *PostgresDriver) Connect(cfg *config.Connection) error {
 	return nil
 }
 
-// Close closes the database connection.
+// Close rolls back any open transaction and closes the database connection.
 func (d *PostgresDriver) Close() error {
-	if d.db != nil {
-		return d.db.Close()
+	if d.db == nil {
+		return nil
 	}
-	return nil
+
+	rollbackErr := d.tx.rollback()
+	if err := d.db.Close(); err != nil {
+		return err
+	}
+	return rollbackErr
+}
+
+// BeginTx starts a transaction that Close rolls back unless CommitTx is called.
+func (d *PostgresDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.tx.begin(ctx, d.db, opts)
+}
+
+// CommitTx commits the transaction started by BeginTx.
+func (d *PostgresDriver) CommitTx() error {
+	return d.tx.commit()
 }
 
 // GetTables returns all table names in the database.
@@ -86,24 +105,12 @@ func (d *PostgresDriver) GetTableSchema(table string) (string, error) {
 	}
 
 	// Get primary key
-	pkQuery := `SELECT a.attname
-                FROM pg_index i
-                JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
-                WHERE i.indrelid = $1::regclass AND i.indisprimary`
-
-	pkRows, err := d.db.Query(pkQuery, table)
-	if err == nil {
-		defer pkRows.Close()
-		var pkCols []string
-		for pkRows.Next() {
-			var col string
-			if err := pkRows.Scan(&col); err == nil {
-				pkCols = append(pkCols, d.QuoteIdentifier(col))
-			}
-		}
-		if len(pkCols) > 0 {
-			colDefs = append(colDefs, fmt.Sprintf("    PRIMARY KEY (%s)", strings.Join(pkCols, ", ")))
+	if pkCols, err := d.GetPrimaryKey(table); err == nil && len(pkCols) > 0 {
+		quotedPK := make([]string, len(pkCols))
+		for i, col := range pkCols {
+			quotedPK[i] = d.QuoteIdentifier(col)
 		}
+		colDefs = append(colDefs, fmt.Sprintf("    PRIMARY KEY (%s)", strings.Join(quotedPK, ", ")))
 	}
 
 	schema := fmt.Sprintf("CREATE TABLE %s (\n%s\n);",
@@ -117,6 +124,10 @@ func (d *PostgresDriver) GetTableSchema(table string) (string, error) {
 func (d *PostgresDriver) GetColumns(table string) ([]ColumnInfo, error) {
 	query := `SELECT column_name,
                      CASE
+                       WHEN data_type = 'ARRAY'
+                       THEN substring(udt_name from 2) || '[]'
+                       WHEN data_type = 'USER-DEFINED'
+                       THEN quote_ident(udt_name)
                        WHEN character_maximum_length IS NOT NULL
                        THEN data_type || '(' || character_maximum_length || ')'
                        WHEN numeric_precision IS NOT NULL AND data_type NOT IN ('integer', 'bigint', 'smallint')
@@ -124,7 +135,12 @@ func (d *PostgresDriver) GetColumns(table string) ([]ColumnInfo, error) {
                        ELSE data_type
                      END as data_type,
                      is_nullable,
-                     column_default
+                     column_default,
+                     COALESCE(col_description(
+                       (quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass,
+                       ordinal_position
+                     ), '') as column_comment,
+                     COALESCE(character_maximum_length, 0)
               FROM information_schema.columns
               WHERE table_schema = 'public' AND table_name = $1
               ORDER BY ordinal_position`
@@ -139,7 +155,7 @@ func (d *PostgresDriver) GetColumns(table string) ([]ColumnInfo, error) {
 	for rows.Next() {
 		var col ColumnInfo
 		var isNullable string
-		if err := rows.Scan(&col.Name, &col.DataType, &isNullable, &col.Default); err != nil {
+		if err := rows.Scan(&col.Name, &col.DataType, &isNullable, &col.Default, &col.Comment, &col.MaxLength); err != nil {
 			return nil, fmt.Errorf("failed to scan column: %w", err)
 		}
 		col.IsNullable = isNullable == "YES"
@@ -185,35 +201,152 @@ func (d *PostgresDriver) GetForeignKeys() ([]ForeignKey, error) {
 	return fks, rows.Err()
 }
 
-// StreamRows streams rows from a table in batches.
-func (d *PostgresDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
-	// Get column names first
-	columns, err := d.GetColumns(table)
+// GetServerVersion returns the PostgreSQL server version, e.g. "16.2".
+func (d *PostgresDriver) GetServerVersion() (string, error) {
+	if d.serverVersion != "" {
+		return d.serverVersion, nil
+	}
+
+	var version string
+	if err := d.db.QueryRow("SHOW server_version").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	d.serverVersion = version
+	return version, nil
+}
+
+// supports reports whether the server is at least version major.minor.
+// If the version cannot be read the server is assumed to be recent.
+func (d *PostgresDriver) supports(major, minor int) bool {
+	version, err := d.GetServerVersion()
+	return err != nil || versionAtLeast(version, major, minor)
+}
+
+// GetSequences returns the sequences in the public schema that are not owned
+// by a column, such as those created by serial or identity columns.
+func (d *PostgresDriver) GetSequences() ([]Sequence, error) {
+	// pg_sequences, which holds the last value, was added in PostgreSQL 10
+	lastValue := `(SELECT p.last_value FROM pg_sequences p
+                      WHERE p.schemaname = s.sequence_schema AND p.sequencename = s.sequence_name)`
+	if !d.supports(10, 0) {
+		lastValue = "NULL::bigint"
+	}
+
+	query := `SELECT s.sequence_name, s.data_type, s.start_value, s.increment,
+                     s.minimum_value, s.maximum_value, s.cycle_option, ` + lastValue + `
+              FROM information_schema.sequences s
+              WHERE s.sequence_schema = 'public'
+                AND NOT EXISTS (
+                  SELECT 1 FROM pg_depend dep
+                  WHERE dep.classid = 'pg_class'::regclass
+                    AND dep.objid = (quote_ident(s.sequence_schema) || '.' || quote_ident(s.sequence_name))::regclass
+                    AND dep.deptype IN ('a', 'i')
+                )
+              ORDER BY s.sequence_name`
+
+	rows, err := d.db.Query(query)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to query sequences: %w", err)
 	}
+	defer rows.Close()
 
-	columnNames := make([]string, len(columns))
-	for i, col := range columns {
-		columnNames[i] = d.QuoteIdentifier(col.Name)
+	var sequences []Sequence
+	for rows.Next() {
+		var seq Sequence
+		var cycle string
+		if err := rows.Scan(&seq.Name, &seq.DataType, &seq.Start, &seq.Increment, &seq.MinValue, &seq.MaxValue, &cycle, &seq.LastValue); err != nil {
+			return nil, fmt.Errorf("failed to scan sequence: %w", err)
+		}
+		seq.Cycle = cycle == "YES"
+		sequences = append(sequences, seq)
 	}
 
-	// Build query
-	query := fmt.Sprintf("SELECT %s FROM %s",
-		strings.Join(columnNames, ", "),
-		d.QuoteIdentifier(table))
+	return sequences, rows.Err()
+}
 
-	var args []any
+// GetEnumTypes returns the enum types used by a table's columns, including
+// as array elements, so that they can be created before the table.
+func (d *PostgresDriver) GetEnumTypes(table string) ([]EnumType, error) {
+	query := `SELECT t.typname, e.enumlabel
+              FROM pg_type t
+              JOIN pg_enum e ON e.enumtypid = t.oid
+              WHERE EXISTS (
+                SELECT 1 FROM pg_attribute a
+                WHERE a.attrelid = ('public.' || quote_ident($1))::regclass
+                  AND a.attnum > 0 AND NOT a.attisdropped
+                  AND a.atttypid IN (t.oid, t.typarray)
+              )
+              ORDER BY t.typname, e.enumsortorder`
 
-	// Add date-based WHERE clause if specified
-	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
-		query += fmt.Sprintf(" WHERE %s > $1", d.QuoteIdentifier(opts.ColumnName))
-		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+	rows, err := d.db.Query(query, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enum types: %w", err)
 	}
+	defer rows.Close()
 
-	// Add LIMIT clause if specified
-	if opts.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	var types []EnumType
+	for rows.Next() {
+		var name, label string
+		if err := rows.Scan(&name, &label); err != nil {
+			return nil, fmt.Errorf("failed to scan enum type: %w", err)
+		}
+		if len(types) == 0 || types[len(types)-1].Name != name {
+			types = append(types, EnumType{Name: name})
+		}
+		types[len(types)-1].Values = append(types[len(types)-1].Values, label)
+	}
+
+	return types, rows.Err()
+}
+
+// GetPrimaryKey returns the primary key column names for a table.
+func (d *PostgresDriver) GetPrimaryKey(table string) ([]string, error) {
+	// array_position was added in PostgreSQL 9.5; before that, order by the
+	// column's position in the index using generate_subscripts
+	query := `SELECT a.attname
+              FROM pg_index i
+              JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+              WHERE i.indrelid = $1::regclass AND i.indisprimary
+              ORDER BY array_position(i.indkey::int2[], a.attnum)`
+	if !d.supports(9, 5) {
+		query = `SELECT a.attname
+              FROM pg_index i
+              CROSS JOIN generate_subscripts(i.indkey, 1) AS s(n)
+              JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[s.n]
+              WHERE i.indrelid = $1::regclass AND i.indisprimary
+              ORDER BY s.n`
+	}
+
+	rows, err := d.db.Query(query, d.QuoteIdentifier(table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query primary key: %w", err)
+	}
+	defer rows.Close()
+
+	var pkCols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
+		}
+		pkCols = append(pkCols, col)
+	}
+
+	return pkCols, rows.Err()
+}
+
+// StreamRows streams rows from a table in batches.
+func (d *PostgresDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && opts.KeyColumn != "" {
+		return streamKeyset(opts, batchSize, callback, func(page StreamOptions, cb RowCallback) error {
+			return d.StreamRows(table, page, batchSize, cb)
+		})
+	}
+
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
 	}
 
 	rows, err := d.db.Query(query, args...)
@@ -274,6 +407,85 @@ func (d *PostgresDriver) StreamRows(table string, opts StreamOptions, batchSize
 	return rows.Err()
 }
 
+// StreamRowsColumnar streams rows from a table in batches, reusing scan
+// buffers between batches instead of allocating a map per row.
+func (d *PostgresDriver) StreamRowsColumnar(table string, opts StreamOptions, batchSize int, callback ColumnarCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && opts.KeyColumn != "" {
+		return streamKeysetColumnar(opts, batchSize, callback, func(page StreamOptions, cb ColumnarCallback) error {
+			return d.StreamRowsColumnar(table, page, batchSize, cb)
+		})
+	}
+
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query rows: %w", err)
+	}
+	defer rows.Close()
+
+	return streamColumnar(rows, batchSize, callback)
+}
+
+// buildSelectQuery builds the SELECT statement used to stream rows from a table.
+func (d *PostgresDriver) buildSelectQuery(table string, opts StreamOptions) (string, []any, error) {
+	// Get column names first
+	columns, err := selectColumns(d, table, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = d.QuoteIdentifier(col)
+	}
+
+	// Build query
+	query := fmt.Sprintf("SELECT %s FROM %s",
+		strings.Join(columnNames, ", "),
+		d.QuoteIdentifier(table))
+
+	var args []any
+	var conditions []string
+
+	// Add date-based condition if specified
+	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s > $%d", d.QuoteIdentifier(opts.ColumnName), len(args)+1))
+		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+	}
+
+	// Add raw predicate if specified
+	if opts.Where != "" {
+		conditions = append(conditions, "("+opts.Where+")")
+	}
+
+	// Resume after the last key seen if specified
+	if opts.KeyColumn != "" && opts.AfterKey != nil {
+		conditions = append(conditions, fmt.Sprintf("%s > $%d", d.QuoteIdentifier(opts.KeyColumn), len(args)+1))
+		args = append(args, opts.AfterKey)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Order by key so the stream can be resumed
+	if opts.KeyColumn != "" {
+		query += " ORDER BY " + d.QuoteIdentifier(opts.KeyColumn)
+	}
+
+	// Add LIMIT clause if specified
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	return query, args, nil
+}
+
 // GetRowCount returns the number of rows in a table.
 func (d *PostgresDriver) GetRowCount(table string) (int64, error) {
 	var count int64
@@ -285,11 +497,49 @@ func (d *PostgresDriver) GetRowCount(table string) (int64, error) {
 	return count, nil
 }
 
+// GetDistinctCount returns the number of distinct non-NULL values in a
+// column of the rows a stream with opts would read.
+func (d *PostgresDriver) GetDistinctCount(table, column string, opts StreamOptions) (int64, error) {
+	opts.Columns = []string{column}
+	rows, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(DISTINCT %s) FROM (%s) AS filtered", d.QuoteIdentifier(column), rows)
+	err = d.db.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count distinct values: %w", err)
+	}
+	return count, nil
+}
+
+// GetOrphanCount returns the number of rows whose foreign key column is
+// not NULL but matches no row of the referenced table.
+func (d *PostgresDriver) GetOrphanCount(fk ForeignKey) (int64, error) {
+	var count int64
+	if err := d.db.QueryRow(orphanCountQuery(d, fk)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphaned rows: %w", err)
+	}
+	return count, nil
+}
+
 // QuoteIdentifier quotes an identifier for PostgreSQL.
+// In QuoteMinimal mode only reserved words and identifiers that are not
+// lower-case words (which PostgreSQL would case-fold) are quoted.
 func (d *PostgresDriver) QuoteIdentifier(name string) string {
+	if d.quoteMode == QuoteMinimal && !needsQuoting(name, bareLowerIdentifier, postgresReservedWords) {
+		return name
+	}
 	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
 }
 
+// SetQuoteMode sets when QuoteIdentifier quotes identifiers.
+func (d *PostgresDriver) SetQuoteMode(mode QuoteMode) {
+	d.quoteMode = mode
+}
+
 // GetDatabaseType returns "postgres".
 func (d *PostgresDriver) GetDatabaseType() string {
 	return "postgres"
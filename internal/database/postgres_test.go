@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockPostgresDriver(t *testing.T) (*PostgresDriver, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &PostgresDriver{db: db, database: "testdb"}, mock
+}
+
+func TestPostgresDriver_GetSequences(t *testing.T) {
+	driver, mock := newMockPostgresDriver(t)
+
+	mock.ExpectQuery("SHOW server_version").
+		WillReturnRows(sqlmock.NewRows([]string{"server_version"}).AddRow("16.2"))
+
+	// An independent invoice number sequence, used by no column, and one
+	// that has never been advanced
+	rows := sqlmock.NewRows([]string{"sequence_name", "data_type", "start_value", "increment", "minimum_value", "maximum_value", "cycle_option", "last_value"}).
+		AddRow("invoice_number_seq", "bigint", "1000", "1", "1", "9223372036854775807", "NO", int64(1042)).
+		AddRow("ticket_seq", "integer", "1", "5", "1", "2147483647", "YES", nil)
+	mock.ExpectQuery("FROM information_schema.sequences s").WillReturnRows(rows)
+
+	sequences, err := driver.GetSequences()
+	if err != nil {
+		t.Fatalf("GetSequences() error = %v", err)
+	}
+	if len(sequences) != 2 {
+		t.Fatalf("GetSequences() returned %d sequences, want 2", len(sequences))
+	}
+
+	invoice := sequences[0]
+	if invoice.Name != "invoice_number_seq" || invoice.Start != 1000 || invoice.MaxValue != 9223372036854775807 || invoice.Cycle {
+		t.Errorf("invoice_number_seq = %+v", invoice)
+	}
+	if !invoice.LastValue.Valid || invoice.LastValue.Int64 != 1042 {
+		t.Errorf("invoice_number_seq.LastValue = %v, want 1042", invoice.LastValue)
+	}
+
+	ticket := sequences[1]
+	if ticket.DataType != "integer" || ticket.Increment != 5 || !ticket.Cycle || ticket.LastValue.Valid {
+		t.Errorf("ticket_seq = %+v", ticket)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresDriver_GetSequences_BeforePgSequences(t *testing.T) {
+	driver, mock := newMockPostgresDriver(t)
+
+	mock.ExpectQuery("SHOW server_version").
+		WillReturnRows(sqlmock.NewRows([]string{"server_version"}).AddRow("9.6.24"))
+	mock.ExpectQuery(`s.cycle_option, NULL::bigint`).
+		WillReturnRows(sqlmock.NewRows([]string{"sequence_name", "data_type", "start_value", "increment", "minimum_value", "maximum_value", "cycle_option", "last_value"}))
+
+	if _, err := driver.GetSequences(); err != nil {
+		t.Fatalf("GetSequences() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresDriver_GetEnumTypes(t *testing.T) {
+	driver, mock := newMockPostgresDriver(t)
+
+	rows := sqlmock.NewRows([]string{"typname", "enumlabel"}).
+		AddRow("mood", "sad").
+		AddRow("mood", "happy").
+		AddRow("order_status", "pending").
+		AddRow("order_status", "shipped")
+	mock.ExpectQuery("FROM pg_type t").WithArgs("orders").WillReturnRows(rows)
+
+	types, err := driver.GetEnumTypes("orders")
+	if err != nil {
+		t.Fatalf("GetEnumTypes() error = %v", err)
+	}
+	if len(types) != 2 {
+		t.Fatalf("GetEnumTypes() returned %d types, want 2", len(types))
+	}
+	if types[0].Name != "mood" || strings.Join(types[0].Values, ",") != "sad,happy" {
+		t.Errorf("types[0] = %+v, want mood (sad, happy)", types[0])
+	}
+	if types[1].Name != "order_status" || strings.Join(types[1].Values, ",") != "pending,shipped" {
+		t.Errorf("types[1] = %+v, want order_status (pending, shipped)", types[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresDriver_StreamRows_ReservedWords(t *testing.T) {
+	afterDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Reserved words are quoted in every clause, even when quoting is minimal
+	tests := []struct {
+		name      string
+		mode      QuoteMode
+		opts      StreamOptions
+		wantQuery string
+		wantArgs  []driver.Value
+	}{
+		{
+			name:      "retention by reserved date column",
+			mode:      QuoteAlways,
+			opts:      StreamOptions{ColumnName: "select", AfterDate: afterDate, KeyColumn: "id", Limit: 10},
+			wantQuery: `SELECT "id", "select" FROM "order" WHERE "select" > $1 ORDER BY "id" LIMIT 10`,
+			wantArgs:  []driver.Value{"2024-01-01 00:00:00"},
+		},
+		{
+			name:      "retention by reserved date column with minimal quoting",
+			mode:      QuoteMinimal,
+			opts:      StreamOptions{ColumnName: "select", AfterDate: afterDate, KeyColumn: "id", Limit: 10},
+			wantQuery: `SELECT id, "select" FROM "order" WHERE "select" > $1 ORDER BY id LIMIT 10`,
+			wantArgs:  []driver.Value{"2024-01-01 00:00:00"},
+		},
+		{
+			name:      "resume after reserved key column",
+			mode:      QuoteAlways,
+			opts:      StreamOptions{KeyColumn: "select", AfterKey: "b", Where: "id > 0"},
+			wantQuery: `SELECT "id", "select" FROM "order" WHERE (id > 0) AND "select" > $1 ORDER BY "select"`,
+			wantArgs:  []driver.Value{"b"},
+		},
+		{
+			name:      "resume after reserved key column with minimal quoting",
+			mode:      QuoteMinimal,
+			opts:      StreamOptions{KeyColumn: "select", AfterKey: "b", Where: "id > 0"},
+			wantQuery: `SELECT id, "select" FROM "order" WHERE (id > 0) AND "select" > $1 ORDER BY "select"`,
+			wantArgs:  []driver.Value{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, mock := newMockPostgresDriver(t)
+			d.SetQuoteMode(tt.mode)
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantQuery)).
+				WithArgs(tt.wantArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "select"}).AddRow(int64(1), "c"))
+
+			opts := tt.opts
+			opts.Columns = []string{"id", "select"}
+			err := d.StreamRows("order", opts, 10, func(rows []map[string]any) error { return nil })
+			if err != nil {
+				t.Fatalf("StreamRows() error = %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
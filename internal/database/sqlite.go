@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,30 +18,114 @@ import (
 
 // SQLiteDriver implements the Driver interface for SQLite databases.
 type SQLiteDriver struct {
-	db *sql.DB
+	db            *sql.DB
+	quoteMode     QuoteMode
+	serverVersion string
+	tx            activeTx // Transaction rolled back by Close if not committed
 }
 
 // Connect establishes a connection to the SQLite database.
 func (d *SQLiteDriver) Connect(cfg *config.Connection) error {
+	if err := checkSQLiteFile(cfg.DSN()); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+	}
+
 	db, err := sql.Open("sqlite3", cfg.DSN())
 	if err != nil {
-		return fmt.Errorf("failed to open SQLite connection: %w", err)
+		return fmt.Errorf("%w: failed to open SQLite connection: %w", ErrConnectionFailed, err)
 	}
 
 	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping SQLite: %w", err)
+		return fmt.Errorf("%w: failed to ping SQLite: %w", ErrConnectionFailed, err)
 	}
 
 	d.db = db
 	return nil
 }
 
-// Close closes the database connection.
+// checkSQLiteFile returns an error if the database file of a SQLite DSN
+// does not exist or cannot be read, where SQLite would otherwise create an
+// empty database or fail with a generic error. In-memory databases are not
+// checked.
+func checkSQLiteFile(dsn string) error {
+	path, ok := sqliteFilePath(dsn)
+	if !ok {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("SQLite database file %q does not exist", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot access SQLite database file %q: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("SQLite database file %q is a directory", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("SQLite database file %q is not readable: %w", path, err)
+	}
+	return file.Close()
+}
+
+// sqliteFilePath returns the file a SQLite DSN opens, which is either a path
+// or a file: URI, either followed by driver parameters such as
+// ?_busy_timeout=5000, or false if the database is held in memory.
+func sqliteFilePath(dsn string) (string, bool) {
+	if dsn == ":memory:" {
+		return "", false
+	}
+
+	uri, isURI := strings.CutPrefix(dsn, "file:")
+	if !isURI {
+		path, _, _ := strings.Cut(dsn, "?")
+		return path, true
+	}
+
+	path, query, _ := strings.Cut(uri, "?")
+	if path == ":memory:" {
+		return "", false
+	}
+	if params, err := url.ParseQuery(query); err == nil && params.Get("mode") == "memory" {
+		return "", false
+	}
+
+	// file:///data/app.db and file://localhost/data/app.db name /data/app.db
+	if rest, ok := strings.CutPrefix(path, "//"); ok {
+		if i := strings.Index(rest, "/"); i >= 0 {
+			path = rest[i:]
+		}
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return path, true
+}
+
+// Close rolls back any open transaction and closes the database connection.
 func (d *SQLiteDriver) Close() error {
-	if d.db != nil {
-		return d.db.Close()
+	if d.db == nil {
+		return nil
 	}
-	return nil
+
+	rollbackErr := d.tx.rollback()
+	if err := d.db.Close(); err != nil {
+		return err
+	}
+	return rollbackErr
+}
+
+// BeginTx starts a transaction that Close rolls back unless CommitTx is called.
+func (d *SQLiteDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.tx.begin(ctx, d.db, opts)
+}
+
+// CommitTx commits the transaction started by BeginTx.
+func (d *SQLiteDriver) CommitTx() error {
+	return d.tx.commit()
 }
 
 // GetTables returns all table names in the database.
@@ -102,6 +192,7 @@ func (d *SQLiteDriver) GetColumns(table string) ([]ColumnInfo, error) {
 			DataType:   dataType,
 			IsNullable: notNull == 0,
 			Default:    dfltValue,
+			MaxLength:  declaredLength(dataType),
 		}
 		columns = append(columns, col)
 	}
@@ -109,6 +200,21 @@ func (d *SQLiteDriver) GetColumns(table string) ([]ColumnInfo, error) {
 	return columns, rows.Err()
 }
 
+// charLengthPattern matches the length of a declared character type such as
+// VARCHAR(10) or NCHAR(2).
+var charLengthPattern = regexp.MustCompile(`(?i)char[^(]*\(\s*(\d+)\s*\)`)
+
+// declaredLength returns the length declared by a character column type.
+// SQLite does not enforce it, but a dump may be restored elsewhere.
+func declaredLength(dataType string) int {
+	matches := charLengthPattern.FindStringSubmatch(dataType)
+	if matches == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(matches[1])
+	return n
+}
+
 // GetForeignKeys returns all foreign key relationships in the database.
 func (d *SQLiteDriver) GetForeignKeys() ([]ForeignKey, error) {
 	// Get all tables first
@@ -125,9 +231,14 @@ func (d *SQLiteDriver) GetForeignKeys() ([]ForeignKey, error) {
 			continue // Skip tables with no foreign keys
 		}
 
+		// Keys written as REFERENCES parent, without columns, reference the
+		// parent's primary key and have no "to" column
+		var tableFKs []ForeignKey
+		var implicit []int // Position in the parent's primary key, or -1
 		for rows.Next() {
 			var id, seq int
-			var refTable, from, to, onUpdate, onDelete, match string
+			var refTable, from, onUpdate, onDelete, match string
+			var to sql.NullString
 
 			if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
 				rows.Close()
@@ -138,45 +249,127 @@ func (d *SQLiteDriver) GetForeignKeys() ([]ForeignKey, error) {
 				Table:            table,
 				Column:           from,
 				ReferencedTable:  refTable,
-				ReferencedColumn: to,
+				ReferencedColumn: to.String,
+			}
+			tableFKs = append(tableFKs, fk)
+			if to.Valid {
+				implicit = append(implicit, -1)
+			} else {
+				implicit = append(implicit, seq)
 			}
-			fks = append(fks, fk)
 		}
 		rows.Close()
+
+		for i, fk := range tableFKs {
+			if implicit[i] >= 0 {
+				pk, err := d.GetPrimaryKey(fk.ReferencedTable)
+				if err != nil || implicit[i] >= len(pk) {
+					continue // Parent has no primary key to reference
+				}
+				fk.ReferencedColumn = pk[implicit[i]]
+			}
+			fks = append(fks, fk)
+		}
 	}
 
 	return fks, nil
 }
 
-// StreamRows streams rows from a table in batches.
-func (d *SQLiteDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
-	// Get column names first
-	columns, err := d.GetColumns(table)
+// GetServerVersion returns the SQLite library version, e.g. "3.45.1".
+func (d *SQLiteDriver) GetServerVersion() (string, error) {
+	if d.serverVersion != "" {
+		return d.serverVersion, nil
+	}
+
+	var version string
+	if err := d.db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	d.serverVersion = version
+	return version, nil
+}
+
+// supports reports whether the library is at least version major.minor.
+// If the version cannot be read the library is assumed to be recent.
+func (d *SQLiteDriver) supports(major, minor int) bool {
+	version, err := d.GetServerVersion()
+	return err != nil || versionAtLeast(version, major, minor)
+}
+
+// GetPrimaryKey returns the primary key column names for a table.
+func (d *SQLiteDriver) GetPrimaryKey(table string) ([]string, error) {
+	// Table-valued pragma functions were added in SQLite 3.16
+	if !d.supports(3, 16) {
+		return d.getPrimaryKeyFromPragma(table)
+	}
+
+	query := `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`
+
+	rows, err := d.db.Query(query, table)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to query primary key: %w", err)
 	}
+	defer rows.Close()
 
-	columnNames := make([]string, len(columns))
-	for i, col := range columns {
-		columnNames[i] = d.QuoteIdentifier(col.Name)
+	var pkCols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
+		}
+		pkCols = append(pkCols, col)
 	}
 
-	// Build query
-	query := fmt.Sprintf("SELECT %s FROM %s",
-		strings.Join(columnNames, ", "),
-		d.QuoteIdentifier(table))
+	return pkCols, rows.Err()
+}
 
-	var args []any
+// getPrimaryKeyFromPragma reads the primary key with PRAGMA table_info, for
+// SQLite versions without table-valued pragma functions.
+func (d *SQLiteDriver) getPrimaryKeyFromPragma(table string) ([]string, error) {
+	query := fmt.Sprintf("PRAGMA table_info(%s)", d.QuoteIdentifier(table))
 
-	// Add date-based WHERE clause if specified
-	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
-		query += fmt.Sprintf(" WHERE %s > ?", d.QuoteIdentifier(opts.ColumnName))
-		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query primary key: %w", err)
 	}
+	defer rows.Close()
 
-	// Add LIMIT clause if specified
-	if opts.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	// pk holds the column's 1-based position in the primary key, or 0
+	byPosition := make(map[int]string)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, dataType string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
+		}
+		if pk > 0 {
+			byPosition[pk] = name
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pkCols []string
+	for i := 1; i <= len(byPosition); i++ {
+		pkCols = append(pkCols, byPosition[i])
+	}
+	return pkCols, nil
+}
+
+// StreamRows streams rows from a table in batches.
+func (d *SQLiteDriver) StreamRows(table string, opts StreamOptions, batchSize int, callback RowCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && (opts.KeyColumn != "" || len(opts.KeyColumns) > 0) {
+		return streamKeyset(opts, batchSize, callback, func(page StreamOptions, cb RowCallback) error {
+			return d.StreamRows(table, page, batchSize, cb)
+		})
+	}
+
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
 	}
 
 	rows, err := d.db.Query(query, args...)
@@ -237,6 +430,102 @@ func (d *SQLiteDriver) StreamRows(table string, opts StreamOptions, batchSize in
 	return rows.Err()
 }
 
+// StreamRowsColumnar streams rows from a table in batches, reusing scan
+// buffers between batches instead of allocating a map per row.
+func (d *SQLiteDriver) StreamRowsColumnar(table string, opts StreamOptions, batchSize int, callback ColumnarCallback) error {
+	// Page by key, one query per batch, if requested
+	if opts.Keyset && (opts.KeyColumn != "" || len(opts.KeyColumns) > 0) {
+		return streamKeysetColumnar(opts, batchSize, callback, func(page StreamOptions, cb ColumnarCallback) error {
+			return d.StreamRowsColumnar(table, page, batchSize, cb)
+		})
+	}
+
+	query, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return err
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query rows: %w", err)
+	}
+	defer rows.Close()
+
+	return streamColumnar(rows, batchSize, callback)
+}
+
+// buildSelectQuery builds the SELECT statement used to stream rows from a table.
+func (d *SQLiteDriver) buildSelectQuery(table string, opts StreamOptions) (string, []any, error) {
+	// Get column names first
+	columns, err := selectColumns(d, table, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = d.QuoteIdentifier(col)
+	}
+
+	// Build query
+	query := fmt.Sprintf("SELECT %s FROM %s",
+		strings.Join(columnNames, ", "),
+		d.QuoteIdentifier(table))
+
+	var args []any
+	var conditions []string
+
+	// Add date-based condition if specified
+	if opts.ColumnName != "" && !opts.AfterDate.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s > ?", d.QuoteIdentifier(opts.ColumnName)))
+		args = append(args, opts.AfterDate.Format("2006-01-02 15:04:05"))
+	}
+
+	// Add raw predicate if specified
+	if opts.Where != "" {
+		conditions = append(conditions, "("+opts.Where+")")
+	}
+
+	// Resume after the last key seen if specified
+	if opts.KeyColumn != "" && opts.AfterKey != nil {
+		conditions = append(conditions, fmt.Sprintf("%s > ?", d.QuoteIdentifier(opts.KeyColumn)))
+		args = append(args, opts.AfterKey)
+	}
+	if len(opts.KeyColumns) > 0 && opts.AfterKeys != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s) > (%s)",
+			strings.Join(d.quoteIdentifiers(opts.KeyColumns), ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(opts.KeyColumns)), ", ")))
+		args = append(args, opts.AfterKeys...)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Order by key so the stream can be resumed
+	if len(opts.KeyColumns) > 0 {
+		query += " ORDER BY " + strings.Join(d.quoteIdentifiers(opts.KeyColumns), ", ")
+	} else if opts.KeyColumn != "" {
+		query += " ORDER BY " + d.QuoteIdentifier(opts.KeyColumn)
+	}
+
+	// Add LIMIT clause if specified
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	return query, args, nil
+}
+
+// quoteIdentifiers quotes each of a list of identifiers.
+func (d *SQLiteDriver) quoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = d.QuoteIdentifier(name)
+	}
+	return quoted
+}
+
 // GetRowCount returns the number of rows in a table.
 func (d *SQLiteDriver) GetRowCount(table string) (int64, error) {
 	var count int64
@@ -248,11 +537,48 @@ func (d *SQLiteDriver) GetRowCount(table string) (int64, error) {
 	return count, nil
 }
 
+// GetDistinctCount returns the number of distinct non-NULL values in a
+// column of the rows a stream with opts would read.
+func (d *SQLiteDriver) GetDistinctCount(table, column string, opts StreamOptions) (int64, error) {
+	opts.Columns = []string{column}
+	rows, args, err := d.buildSelectQuery(table, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(DISTINCT %s) FROM (%s) AS filtered", d.QuoteIdentifier(column), rows)
+	err = d.db.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count distinct values: %w", err)
+	}
+	return count, nil
+}
+
+// GetOrphanCount returns the number of rows whose foreign key column is
+// not NULL but matches no row of the referenced table.
+func (d *SQLiteDriver) GetOrphanCount(fk ForeignKey) (int64, error) {
+	var count int64
+	if err := d.db.QueryRow(orphanCountQuery(d, fk)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphaned rows: %w", err)
+	}
+	return count, nil
+}
+
 // QuoteIdentifier quotes an identifier for SQLite.
+// In QuoteMinimal mode only reserved words and non-word identifiers are quoted.
 func (d *SQLiteDriver) QuoteIdentifier(name string) string {
+	if d.quoteMode == QuoteMinimal && !needsQuoting(name, bareIdentifier, sqliteReservedWords) {
+		return name
+	}
 	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
 }
 
+// SetQuoteMode sets when QuoteIdentifier quotes identifiers.
+func (d *SQLiteDriver) SetQuoteMode(mode QuoteMode) {
+	d.quoteMode = mode
+}
+
 // GetDatabaseType returns "sqlite".
 func (d *SQLiteDriver) GetDatabaseType() string {
 	return "sqlite"
@@ -1,8 +1,15 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 )
@@ -79,11 +86,95 @@ func TestSQLiteDriver_Connect(t *testing.T) {
 		}
 
 		err := driver.Connect(cfg)
-		// SQLite will create the file, but we can't write to a nonexistent directory
-		if err == nil {
+		if !errors.Is(err, ErrConnectionFailed) {
+			t.Errorf("Connect() error = %v, want ErrConnectionFailed", err)
+		}
+	})
+
+	t.Run("missing file is not created", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing.db")
+		driver := &SQLiteDriver{}
+
+		err := driver.Connect(&config.Connection{Type: "sqlite", File: path})
+		if !errors.Is(err, ErrConnectionFailed) || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Connect() error = %v, want ErrConnectionFailed saying the file does not exist", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Connect() should not create %s, Stat() error = %v", path, err)
+		}
+	})
+
+	t.Run("readable file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", path, err)
+		}
+		driver := &SQLiteDriver{}
+
+		if err := driver.Connect(&config.Connection{Type: "sqlite", File: path}); err != nil {
+			t.Errorf("Connect() error = %v", err)
+		}
+		driver.Close()
+	})
+
+	t.Run("in-memory URI", func(t *testing.T) {
+		for _, dsn := range []string{"file::memory:", "file::memory:?cache=shared", "file:test_connect?mode=memory&cache=shared"} {
+			driver := &SQLiteDriver{}
+			if err := driver.Connect(&config.Connection{Type: "sqlite", File: dsn}); err != nil {
+				t.Errorf("Connect(%q) error = %v", dsn, err)
+			}
 			driver.Close()
-			// This might succeed on some systems if the path is writable
-			t.Log("Connection succeeded unexpectedly - path may be writable")
+		}
+	})
+}
+
+func TestCheckSQLiteFile(t *testing.T) {
+	dir := t.TempDir()
+	readable := filepath.Join(dir, "app.db")
+	if err := os.WriteFile(readable, nil, 0644); err != nil {
+		t.Fatalf("failed to create %s: %v", readable, err)
+	}
+
+	tests := []struct {
+		name    string
+		dsn     string
+		wantErr string
+	}{
+		{"memory", ":memory:", ""},
+		{"memory URI", "file::memory:?cache=shared", ""},
+		{"memory mode URI", "file:shared?mode=memory&cache=shared", ""},
+		{"readable file", readable, ""},
+		{"readable file with parameters", readable + "?_busy_timeout=5000&_journal_mode=WAL", ""},
+		{"readable file URI", "file:" + readable + "?mode=ro", ""},
+		{"readable file URI with authority", "file://" + readable, ""},
+		{"missing file", filepath.Join(dir, "missing.db"), "does not exist"},
+		{"missing file with parameters", filepath.Join(dir, "missing.db") + "?_busy_timeout=5000", `missing.db" does not exist`},
+		{"missing file URI", "file:" + filepath.Join(dir, "missing.db") + "?mode=ro", "does not exist"},
+		{"directory", dir, "is a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSQLiteFile(tt.dsn)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkSQLiteFile() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkSQLiteFile() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unreadable file", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root can read files without read permission")
+		}
+		path := filepath.Join(dir, "locked.db")
+		if err := os.WriteFile(path, nil, 0000); err != nil {
+			t.Fatalf("failed to create %s: %v", path, err)
+		}
+		if err := checkSQLiteFile(path); err == nil || !strings.Contains(err.Error(), "not readable") {
+			t.Errorf("checkSQLiteFile() error = %v, want error containing \"not readable\"", err)
 		}
 	})
 }
@@ -173,6 +264,92 @@ func TestSQLiteDriver_GetTableSchema(t *testing.T) {
 	})
 }
 
+func TestSQLiteDriver_GetDistinctCount(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	queries := []string{
+		"CREATE TABLE visits (id INTEGER PRIMARY KEY, city TEXT)",
+		"INSERT INTO visits (city) VALUES ('Leeds'), ('York'), ('Leeds'), (NULL), ('Hull')",
+	}
+	for _, q := range queries {
+		if _, err := driver.db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts StreamOptions
+		want int64
+	}{
+		{name: "all rows", want: 3},
+		{name: "filtered by where", opts: StreamOptions{Where: "city <> 'York'"}, want: 2},
+		{name: "limited to the retained rows", opts: StreamOptions{KeyColumn: "id", Limit: 2}, want: 2},
+		{name: "limited with a where", opts: StreamOptions{KeyColumn: "id", Limit: 2, Where: "id > 2"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := driver.GetDistinctCount("visits", "city", tt.opts)
+			if err != nil {
+				t.Fatalf("GetDistinctCount() error = %v", err)
+			}
+			if count != tt.want {
+				t.Errorf("GetDistinctCount() = %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteDriver_GetOrphanCount(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+	setupTestTables(t, driver)
+
+	// Foreign keys are not enforced by default, so orders can reference
+	// users that do not exist
+	queries := []string{
+		"INSERT INTO users (id, name) VALUES (1, 'Jane')",
+		"INSERT INTO orders (user_id, amount) VALUES (1, 10), (98, 20), (99, 30), (99, 40)",
+	}
+	for _, q := range queries {
+		if _, err := driver.db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	fk := ForeignKey{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"}
+	count, err := driver.GetOrphanCount(fk)
+	if err != nil {
+		t.Fatalf("GetOrphanCount() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("GetOrphanCount() = %d, want 3", count)
+	}
+}
+
+func TestDeclaredLength(t *testing.T) {
+	tests := []struct {
+		dataType string
+		want     int
+	}{
+		{"VARCHAR(10)", 10},
+		{"varchar( 255 )", 255},
+		{"NCHAR(2)", 2},
+		{"CHARACTER VARYING(40)", 40},
+		{"TEXT", 0},
+		{"INTEGER", 0},
+		{"DECIMAL(10,2)", 0},
+	}
+
+	for _, tt := range tests {
+		if got := declaredLength(tt.dataType); got != tt.want {
+			t.Errorf("declaredLength(%q) = %d, want %d", tt.dataType, got, tt.want)
+		}
+	}
+}
+
 func TestSQLiteDriver_GetColumns(t *testing.T) {
 	driver := createTestDB(t)
 	defer driver.Close()
@@ -221,6 +398,90 @@ func TestSQLiteDriver_GetColumns(t *testing.T) {
 	}
 }
 
+func TestSQLiteDriver_GetPrimaryKey(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+	setupTestTables(t, driver)
+
+	if _, err := driver.db.Exec(`CREATE TABLE memberships (
+		user_id INTEGER,
+		org_id INTEGER,
+		role TEXT,
+		PRIMARY KEY (org_id, user_id)
+	)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+	if _, err := driver.db.Exec(`CREATE TABLE notes (body TEXT)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	tests := []struct {
+		table string
+		want  []string
+	}{
+		{"users", []string{"id"}},
+		{"memberships", []string{"org_id", "user_id"}},
+		{"notes", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			got, err := driver.GetPrimaryKey(tt.table)
+			if err != nil {
+				t.Fatalf("GetPrimaryKey() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetPrimaryKey(%q) = %v, want %v", tt.table, got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetPrimaryKey(%q)[%d] = %q, want %q", tt.table, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteDriver_GetServerVersion(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	version, err := driver.GetServerVersion()
+	if err != nil {
+		t.Fatalf("GetServerVersion() error = %v", err)
+	}
+	if !strings.HasPrefix(version, "3.") {
+		t.Errorf("GetServerVersion() = %q, want a 3.x version", version)
+	}
+}
+
+func TestSQLiteDriver_GetPrimaryKey_BeforePragmaFunctions(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	if _, err := driver.db.Exec(`CREATE TABLE memberships (
+		user_id INTEGER,
+		org_id INTEGER,
+		PRIMARY KEY (org_id, user_id)
+	)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	// Pretend to be a library without pragma_table_info()
+	driver.serverVersion = "3.15.2"
+	if driver.supports(3, 16) {
+		t.Fatal("supports(3, 16) = true for 3.15.2")
+	}
+
+	got, err := driver.GetPrimaryKey("memberships")
+	if err != nil {
+		t.Fatalf("GetPrimaryKey() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != "org_id" || got[1] != "user_id" {
+		t.Errorf("GetPrimaryKey() = %v, want [org_id user_id]", got)
+	}
+}
+
 func TestSQLiteDriver_GetForeignKeys(t *testing.T) {
 	driver := createTestDB(t)
 	defer driver.Close()
@@ -252,6 +513,49 @@ func TestSQLiteDriver_GetForeignKeys(t *testing.T) {
 	}
 }
 
+func TestSQLiteDriver_GetForeignKeys_NaturalKeys(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE countries (code TEXT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE regions (country TEXT, code TEXT, PRIMARY KEY (country, code))`,
+		`CREATE TABLE cities (
+			id INTEGER PRIMARY KEY,
+			country_code TEXT REFERENCES countries(code),
+			home_country TEXT REFERENCES countries,
+			region_country TEXT,
+			region_code TEXT,
+			FOREIGN KEY (region_country, region_code) REFERENCES regions
+		)`,
+	} {
+		if _, err := driver.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to create test table: %v", err)
+		}
+	}
+
+	fks, err := driver.GetForeignKeys()
+	if err != nil {
+		t.Fatalf("GetForeignKeys() error = %v", err)
+	}
+
+	// Keys without referenced columns reference the parent's primary key
+	want := map[string]string{
+		"country_code":   "countries.code",
+		"home_country":   "countries.code",
+		"region_country": "regions.country",
+		"region_code":    "regions.code",
+	}
+	if len(fks) != len(want) {
+		t.Fatalf("GetForeignKeys() = %+v, want %d FKs", fks, len(want))
+	}
+	for _, fk := range fks {
+		if got := fk.ReferencedTable + "." + fk.ReferencedColumn; fk.Table != "cities" || got != want[fk.Column] {
+			t.Errorf("FK %s.%s references %s, want %s", fk.Table, fk.Column, got, want[fk.Column])
+		}
+	}
+}
+
 func TestSQLiteDriver_GetForeignKeys_NoFKs(t *testing.T) {
 	driver := createTestDB(t)
 	defer driver.Close()
@@ -331,6 +635,48 @@ func TestSQLiteDriver_StreamRows(t *testing.T) {
 		}
 	})
 
+	t.Run("stream with where filter", func(t *testing.T) {
+		var totalRows int
+
+		err := driver.StreamRows("users", StreamOptions{Where: "age > 25"}, 10, func(rows []map[string]any) error {
+			totalRows += len(rows)
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("StreamRows() error = %v", err)
+		}
+
+		if totalRows != 5 {
+			t.Errorf("StreamRows() with where filter processed %d rows, want 5", totalRows)
+		}
+	})
+
+	t.Run("stream ordered after key", func(t *testing.T) {
+		var ids []int64
+
+		err := driver.StreamRows("users", StreamOptions{KeyColumn: "id", AfterKey: int64(7)}, 10, func(rows []map[string]any) error {
+			for _, row := range rows {
+				ids = append(ids, row["id"].(int64))
+			}
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("StreamRows() error = %v", err)
+		}
+
+		want := []int64{8, 9, 10}
+		if len(ids) != len(want) {
+			t.Fatalf("StreamRows() after key 7 returned ids %v, want %v", ids, want)
+		}
+		for i := range want {
+			if ids[i] != want[i] {
+				t.Errorf("ids[%d] = %d, want %d", i, ids[i], want[i])
+			}
+		}
+	})
+
 	t.Run("callback error propagation", func(t *testing.T) {
 		testErr := errors.New("test error")
 
@@ -391,6 +737,311 @@ func TestSQLiteDriver_StreamRows(t *testing.T) {
 	})
 }
 
+func TestSQLiteDriver_StreamRowsColumnar(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+	setupTestTables(t, driver)
+
+	for i := 1; i <= 10; i++ {
+		_, err := driver.db.Exec(
+			"INSERT INTO users (name, email, age) VALUES (?, ?, ?)",
+			"User"+string(rune('0'+i)),
+			"user"+string(rune('0'+i))+"@example.com",
+			20+i,
+		)
+		if err != nil {
+			t.Fatalf("failed to insert test data: %v", err)
+		}
+	}
+
+	t.Run("stream all rows in batches", func(t *testing.T) {
+		var totalRows int
+		var batches int
+
+		err := driver.StreamRowsColumnar("users", StreamOptions{}, 3, func(cols []string, values [][]any) error {
+			totalRows += len(values)
+			batches++
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("StreamRowsColumnar() error = %v", err)
+		}
+		if totalRows != 10 {
+			t.Errorf("StreamRowsColumnar() processed %d rows, want 10", totalRows)
+		}
+		if batches != 4 {
+			t.Errorf("StreamRowsColumnar() called callback %d times, want 4", batches)
+		}
+	})
+
+	t.Run("values match column order", func(t *testing.T) {
+		var gotCols []string
+		var firstRow []any
+
+		err := driver.StreamRowsColumnar("users", StreamOptions{Limit: 1}, 10, func(cols []string, values [][]any) error {
+			gotCols = append([]string(nil), cols...)
+			firstRow = append([]any(nil), values[0]...)
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("StreamRowsColumnar() error = %v", err)
+		}
+
+		wantCols := []string{"id", "name", "email", "age", "active"}
+		if len(gotCols) != len(wantCols) {
+			t.Fatalf("cols = %v, want %v", gotCols, wantCols)
+		}
+		for i := range wantCols {
+			if gotCols[i] != wantCols[i] {
+				t.Errorf("cols[%d] = %q, want %q", i, gotCols[i], wantCols[i])
+			}
+		}
+		if firstRow[1] != "User1" {
+			t.Errorf("name = %v, want User1", firstRow[1])
+		}
+	})
+
+	t.Run("callback error propagation", func(t *testing.T) {
+		testErr := errors.New("test error")
+
+		err := driver.StreamRowsColumnar("users", StreamOptions{}, 10, func(cols []string, values [][]any) error {
+			return testErr
+		})
+
+		if err != testErr {
+			t.Errorf("StreamRowsColumnar() error = %v, want %v", err, testErr)
+		}
+	})
+}
+
+// benchmarkRows is the number of rows streamed per benchmark iteration, so
+// allocs/op divided by benchmarkRows gives allocations per row.
+const benchmarkRows = 5000
+
+func benchmarkStreamDriver(b *testing.B) *SQLiteDriver {
+	b.Helper()
+
+	driver := &SQLiteDriver{}
+	if err := driver.Connect(&config.Connection{Type: "sqlite", File: ":memory:"}); err != nil {
+		b.Fatalf("failed to connect to test database: %v", err)
+	}
+
+	if _, err := driver.db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, price REAL, qty INTEGER)`); err != nil {
+		b.Fatalf("failed to create test table: %v", err)
+	}
+	if _, err := driver.db.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+		INSERT INTO items (name, price, qty) SELECT 'item' || i, i * 1.5, i FROM n`, benchmarkRows); err != nil {
+		b.Fatalf("failed to insert test data: %v", err)
+	}
+
+	return driver
+}
+
+func BenchmarkSQLiteDriver_StreamRows(b *testing.B) {
+	driver := benchmarkStreamDriver(b)
+	defer driver.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := driver.StreamRows("items", StreamOptions{}, 1000, func(rows []map[string]any) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSQLiteDriver_StreamRowsColumnar(b *testing.B) {
+	driver := benchmarkStreamDriver(b)
+	defer driver.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := driver.StreamRowsColumnar("items", StreamOptions{}, 1000, func(cols []string, values [][]any) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSQLiteDriver_StreamRows_Keyset(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+	setupTestTables(t, driver)
+
+	for i := 1; i <= 10; i++ {
+		_, err := driver.db.Exec("INSERT INTO users (name, email, age) VALUES (?, ?, ?)",
+			"User"+string(rune('0'+i)), "user"+string(rune('0'+i))+"@example.com", 20+i)
+		if err != nil {
+			t.Fatalf("failed to insert test data: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      StreamOptions
+		batchSize int
+		wantRows  int
+	}{
+		{"batch divides rows", StreamOptions{}, 5, 10},
+		{"batch leaves remainder", StreamOptions{}, 3, 10},
+		{"batch larger than table", StreamOptions{}, 50, 10},
+		{"with limit", StreamOptions{Limit: 7}, 3, 7},
+		{"with where filter", StreamOptions{Where: "age > 25"}, 2, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.KeyColumn = "id"
+			opts.Keyset = true
+
+			seen := make(map[int64]int)
+			var last int64
+			err := driver.StreamRows("users", opts, tt.batchSize, func(rows []map[string]any) error {
+				for _, row := range rows {
+					id := row["id"].(int64)
+					if id <= last {
+						t.Errorf("id %d visited out of order after %d", id, last)
+					}
+					last = id
+					seen[id]++
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamRows() error = %v", err)
+			}
+
+			if len(seen) != tt.wantRows {
+				t.Errorf("visited %d distinct rows, want %d", len(seen), tt.wantRows)
+			}
+			for id, n := range seen {
+				if n != 1 {
+					t.Errorf("id %d visited %d times, want 1", id, n)
+				}
+			}
+		})
+
+		t.Run(tt.name+" columnar", func(t *testing.T) {
+			opts := tt.opts
+			opts.KeyColumn = "id"
+			opts.Keyset = true
+
+			seen := make(map[int64]int)
+			err := driver.StreamRowsColumnar("users", opts, tt.batchSize, func(cols []string, values [][]any) error {
+				for _, row := range values {
+					seen[row[0].(int64)]++
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamRowsColumnar() error = %v", err)
+			}
+
+			if len(seen) != tt.wantRows {
+				t.Errorf("visited %d distinct rows, want %d", len(seen), tt.wantRows)
+			}
+			for id, n := range seen {
+				if n != 1 {
+					t.Errorf("id %d visited %d times, want 1", id, n)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteDriver_StreamRows_KeysetComposite(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	// Student numbers repeat between regions, so only the pair is unique.
+	// Rows are inserted out of key order, which a rowid table returns them in
+	// unless they are ordered by the key.
+	var keys []string
+	for _, region := range []string{"east", "north", "west"} {
+		for student := 1; student <= 4; student++ {
+			keys = append(keys, fmt.Sprintf("%s/%d", region, student))
+		}
+	}
+	for _, table := range []string{"enrolments", "rowid_enrolments"} {
+		create := "CREATE TABLE " + table + " (region TEXT NOT NULL, student INTEGER NOT NULL, grade TEXT, PRIMARY KEY (region, student))"
+		if table == "enrolments" {
+			create += " WITHOUT ROWID"
+		}
+		if _, err := driver.db.Exec(create); err != nil {
+			t.Fatalf("failed to create table: %v", err)
+		}
+		for _, i := range []int{7, 0, 11, 3, 9, 1, 5, 10, 2, 8, 4, 6} {
+			region, student, _ := strings.Cut(keys[i], "/")
+			if _, err := driver.db.Exec("INSERT INTO "+table+" (region, student, grade) VALUES (?, ?, 'A')", region, student); err != nil {
+				t.Fatalf("failed to insert test data: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      StreamOptions
+		batchSize int
+		want      []string
+	}{
+		{"batch divides rows", StreamOptions{}, 4, keys},
+		{"batch leaves remainder", StreamOptions{}, 5, keys},
+		{"batch of one", StreamOptions{}, 1, keys},
+		{"batch larger than table", StreamOptions{}, 50, keys},
+		{"with limit", StreamOptions{Limit: 7}, 3, keys[:7]},
+		{"after a key", StreamOptions{AfterKeys: []any{"north", 2}}, 3, keys[6:]},
+	}
+
+	for _, table := range []string{"enrolments", "rowid_enrolments"} {
+		for _, tt := range tests {
+			opts := tt.opts
+			opts.KeyColumns = []string{"region", "student"}
+			opts.Keyset = true
+
+			t.Run(table+" "+tt.name, func(t *testing.T) {
+				var got []string
+				err := driver.StreamRows(table, opts, tt.batchSize, func(rows []map[string]any) error {
+					for _, row := range rows {
+						got = append(got, fmt.Sprintf("%s/%d", row["region"], row["student"]))
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("StreamRows() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("StreamRows() visited %v, want %v", got, tt.want)
+				}
+			})
+
+			t.Run(table+" "+tt.name+" columnar", func(t *testing.T) {
+				var got []string
+				err := driver.StreamRowsColumnar(table, opts, tt.batchSize, func(cols []string, values [][]any) error {
+					for _, row := range values {
+						got = append(got, fmt.Sprintf("%s/%d", row[0], row[1]))
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("StreamRowsColumnar() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("StreamRowsColumnar() visited %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
 func TestSQLiteDriver_GetRowCount(t *testing.T) {
 	driver := createTestDB(t)
 	defer driver.Close()
@@ -422,6 +1073,101 @@ func TestSQLiteDriver_GetRowCount(t *testing.T) {
 	})
 }
 
+func TestSQLiteDriver_ReservedWords(t *testing.T) {
+	for _, mode := range []QuoteMode{QuoteAlways, QuoteMinimal} {
+		t.Run(string(mode), func(t *testing.T) {
+			driver := createTestDB(t)
+			defer driver.Close()
+			driver.SetQuoteMode(mode)
+
+			queries := []string{
+				`CREATE TABLE "order" (id INTEGER PRIMARY KEY, "select" TEXT)`,
+				`INSERT INTO "order" (id, "select") VALUES (1, '2023-06-01 00:00:00'), (2, '2024-03-01 00:00:00'), (3, '2024-06-01 00:00:00'), (4, '2024-09-01 00:00:00')`,
+			}
+			for _, q := range queries {
+				if _, err := driver.db.Exec(q); err != nil {
+					t.Fatalf("failed to execute %q: %v", q, err)
+				}
+			}
+
+			columns, err := driver.GetColumns("order")
+			if err != nil {
+				t.Fatalf("GetColumns() error = %v", err)
+			}
+			if len(columns) != 2 || columns[1].Name != "select" {
+				t.Errorf("GetColumns() = %+v, want id and select", columns)
+			}
+
+			pk, err := driver.GetPrimaryKey("order")
+			if err != nil || len(pk) != 1 || pk[0] != "id" {
+				t.Errorf("GetPrimaryKey() = %v, %v, want [id]", pk, err)
+			}
+
+			if count, err := driver.GetRowCount("order"); err != nil || count != 4 {
+				t.Errorf("GetRowCount() = %d, %v, want 4", count, err)
+			}
+
+			if count, err := driver.GetDistinctCount("order", "select", StreamOptions{}); err != nil || count != 4 {
+				t.Errorf("GetDistinctCount() = %d, %v, want 4", count, err)
+			}
+
+			tests := []struct {
+				name    string
+				opts    StreamOptions
+				wantIDs []int64
+			}{
+				{
+					name:    "retention by reserved date column",
+					opts:    StreamOptions{ColumnName: "select", AfterDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), KeyColumn: "id", Limit: 2},
+					wantIDs: []int64{2, 3},
+				},
+				{
+					name:    "resume after reserved key column",
+					opts:    StreamOptions{KeyColumn: "select", AfterKey: "2024-03-01 00:00:00", Where: `"select" < '2024-09-01'`},
+					wantIDs: []int64{3},
+				},
+				{
+					name:    "keyset paging by reserved key column",
+					opts:    StreamOptions{KeyColumn: "select", Keyset: true},
+					wantIDs: []int64{1, 2, 3, 4},
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					var got []int64
+					err := driver.StreamRows("order", tt.opts, 1, func(rows []map[string]any) error {
+						for _, row := range rows {
+							got = append(got, row["id"].(int64))
+						}
+						return nil
+					})
+					if err != nil {
+						t.Fatalf("StreamRows() error = %v", err)
+					}
+					if !reflect.DeepEqual(got, tt.wantIDs) {
+						t.Errorf("StreamRows() ids = %v, want %v", got, tt.wantIDs)
+					}
+
+					got = nil
+					err = driver.StreamRowsColumnar("order", tt.opts, 1, func(cols []string, values [][]any) error {
+						for _, row := range values {
+							got = append(got, row[0].(int64))
+						}
+						return nil
+					})
+					if err != nil {
+						t.Fatalf("StreamRowsColumnar() error = %v", err)
+					}
+					if !reflect.DeepEqual(got, tt.wantIDs) {
+						t.Errorf("StreamRowsColumnar() ids = %v, want %v", got, tt.wantIDs)
+					}
+				})
+			}
+		})
+	}
+}
+
 func TestSQLiteDriver_QuoteIdentifier(t *testing.T) {
 	driver := &SQLiteDriver{}
 
@@ -524,3 +1270,128 @@ func TestSQLiteDriver_DataTypes(t *testing.T) {
 		t.Errorf("text_col type = %T, want string", row["text_col"])
 	}
 }
+
+func TestSQLiteDriver_CloseRollsBackTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("failed to create %s: %v", path, err)
+	}
+	connect := func() *SQLiteDriver {
+		driver := &SQLiteDriver{}
+		if err := driver.Connect(&config.Connection{Type: "sqlite", File: path}); err != nil {
+			t.Fatalf("failed to connect to test database: %v", err)
+		}
+		return driver
+	}
+	countRows := func() int {
+		driver := connect()
+		defer driver.Close()
+		count, err := driver.GetRowCount("items")
+		if err != nil {
+			t.Fatalf("GetRowCount() error = %v", err)
+		}
+		return int(count)
+	}
+
+	driver := connect()
+	if _, err := driver.db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	driver.Close()
+
+	t.Run("uncommitted transaction", func(t *testing.T) {
+		driver := connect()
+		tx, err := driver.BeginTx(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("BeginTx() error = %v", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO items (id) VALUES (1)`); err != nil {
+			t.Fatalf("insert error = %v", err)
+		}
+
+		if err := driver.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if n := countRows(); n != 0 {
+			t.Errorf("found %d rows after Close, want the insert rolled back", n)
+		}
+	})
+
+	t.Run("cancelled export", func(t *testing.T) {
+		driver := connect()
+		ctx, cancel := context.WithCancel(context.Background())
+		tx, err := driver.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() error = %v", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO items (id) VALUES (2)`); err != nil {
+			t.Fatalf("insert error = %v", err)
+		}
+
+		// Cancelling mid-export rolls the transaction back before Close does
+		cancel()
+		if err := driver.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if n := countRows(); n != 0 {
+			t.Errorf("found %d rows after Close, want the insert rolled back", n)
+		}
+	})
+
+	t.Run("committed transaction", func(t *testing.T) {
+		driver := connect()
+		tx, err := driver.BeginTx(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("BeginTx() error = %v", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO items (id) VALUES (3)`); err != nil {
+			t.Fatalf("insert error = %v", err)
+		}
+		if _, err := driver.BeginTx(context.Background(), nil); err == nil {
+			t.Error("BeginTx() with a transaction open should fail")
+		}
+		if err := driver.CommitTx(); err != nil {
+			t.Fatalf("CommitTx() error = %v", err)
+		}
+
+		if err := driver.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if n := countRows(); n != 1 {
+			t.Errorf("found %d rows after Close, want the committed row", n)
+		}
+	})
+}
+
+func TestReadPolicy(t *testing.T) {
+	driver := createTestDB(t)
+	defer driver.Close()
+
+	queries := []string{
+		"CREATE TABLE dbmask_policy (id INTEGER PRIMARY KEY, table_name TEXT, column_name TEXT, rule TEXT, owner TEXT)",
+		"INSERT INTO dbmask_policy (table_name, column_name, rule, owner) VALUES " +
+			"('users', 'email', '{{faker.email}}', 'privacy'), ('users', 'password', 'null', 'security'), ('audit_log', NULL, NULL, 'privacy')",
+	}
+	for _, q := range queries {
+		if _, err := driver.db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	rules, err := ReadPolicy(driver, "dbmask_policy")
+	if err != nil {
+		t.Fatalf("ReadPolicy() error = %v", err)
+	}
+	want := []config.PolicyRule{
+		{Table: "users", Column: "email", Rule: "{{faker.email}}"},
+		{Table: "users", Column: "password", Rule: "null"},
+		{Table: "audit_log"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ReadPolicy() = %+v, want %+v", rules, want)
+	}
+
+	if _, err := ReadPolicy(driver, "no_such_table"); err == nil {
+		t.Error("ReadPolicy() of a missing table should fail")
+	}
+}
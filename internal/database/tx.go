@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Transactor is implemented by drivers that can hold a transaction open,
+// for example to export from a consistent snapshot. A transaction that is
+// begun but not committed is rolled back by Close, so that an export that
+// is cancelled or fails part way does not leave locks behind.
+type Transactor interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	CommitTx() error
+}
+
+// activeTx tracks a driver's open transaction.
+type activeTx struct {
+	mu sync.Mutex
+	tx *sql.Tx
+}
+
+// begin starts a transaction on db, failing if one is already open.
+func (a *activeTx) begin(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tx != nil {
+		return nil, fmt.Errorf("a transaction is already open")
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	a.tx = tx
+	return tx, nil
+}
+
+// commit commits the open transaction.
+func (a *activeTx) commit() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tx == nil {
+		return fmt.Errorf("no transaction is open")
+	}
+
+	err := a.tx.Commit()
+	a.tx = nil
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// rollback rolls back the open transaction, if any. A transaction already
+// rolled back because its context was cancelled is not an error.
+func (a *activeTx) rollback() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.tx == nil {
+		return nil
+	}
+
+	err := a.tx.Rollback()
+	a.tx = nil
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("failed to roll back transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+// DefaultDumpCharset is the character set MySQL dumps declare with SET NAMES
+// unless Options.DumpCharset is set.
+const DefaultDumpCharset = "utf8mb4"
+
+// CharsetMismatch records a MySQL column whose character set differs from
+// the one the dump declares, so its values may be converted on restore.
+type CharsetMismatch struct {
+	Table   string
+	Column  string
+	Charset string
+}
+
+// checkCharsets records the character columns of tables whose character
+// set cannot hold every value the dump's character set can. Truncated tables
+// export no data and are skipped.
+func (e *Exporter) checkCharsets(tables []schema.TableInfo) {
+	for _, table := range tables {
+		if e.anonymiser.ShouldTruncate(table.Name) {
+			continue
+		}
+		for _, col := range table.Columns {
+			if col.CharacterSet == "" || charsetCompatible(col.CharacterSet, e.dumpCharset) {
+				continue
+			}
+			e.stats.CharsetMismatches = append(e.stats.CharsetMismatches, CharsetMismatch{
+				Table:   table.Name,
+				Column:  col.Name,
+				Charset: col.CharacterSet,
+			})
+		}
+	}
+}
+
+// charsetCompatible returns true if a column in the column character set
+// can be restored from a dump in the dump character set without its values
+// being lost. utf8 (utf8mb3) is a subset of utf8mb4, ASCII is a subset of
+// every character set SET NAMES accepts, and binary strings are never converted.
+func charsetCompatible(column, dump string) bool {
+	column, dump = strings.ToLower(column), strings.ToLower(dump)
+	switch column {
+	case dump, "binary", "ascii":
+		return true
+	case "utf8", "utf8mb3":
+		return dump == "utf8" || dump == "utf8mb3" || dump == "utf8mb4"
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultCheckpointInterval is how often the progress of a table being
+// exported is saved to the checkpoint file.
+const DefaultCheckpointInterval = 10 * time.Second
+
+// Checkpoint records how far an export got, so that an interrupted export
+// can be resumed. Tables are saved as they complete, and the table in
+// progress by the key of the last row written when it is read in key order.
+type Checkpoint struct {
+	Completed []string `json:"completed"` // Tables written to the dump, including any that failed and were skipped
+
+	Table     string `json:"table,omitempty"`      // Table in progress
+	KeyColumn string `json:"key_column,omitempty"` // Column Table is read in order of
+	LastKey   any    `json:"last_key,omitempty"`   // KeyColumn value of the last row of Table written
+	Rows      int64  `json:"rows,omitempty"`       // Rows of Table written
+
+	// The length of each output when the checkpoint was saved. Anything
+	// written after it must be cut off before the export is resumed.
+	SQLOffset    int64 `json:"sql_offset"`
+	NDJSONOffset int64 `json:"ndjson_offset,omitempty"`
+	ParamsOffset int64 `json:"params_offset,omitempty"`
+}
+
+// LoadCheckpoint reads a checkpoint file. It returns nil if there is no
+// file, meaning the export starts from the beginning.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+
+	// Keys are compared with the values the driver returns
+	if n, ok := cp.LastKey.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			cp.LastKey = i
+		} else {
+			cp.LastKey = n.String()
+		}
+	}
+
+	return &cp, nil
+}
+
+// save writes the checkpoint to path, replacing the file only once the new
+// one is complete.
+func (c *Checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// completed reports whether a table was written by an earlier run.
+func (c *Checkpoint) completed(tableName string) bool {
+	return slices.Contains(c.Completed, tableName)
+}
+
+// checkpointKey returns a key value as it can be saved in a checkpoint.
+// Drivers may return text keys as bytes in buffers that are reused.
+func checkpointKey(key any) any {
+	if b, ok := key.([]byte); ok {
+		return string(b)
+	}
+	return key
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// tableProgress is how far through a table a batch of rows goes.
+type tableProgress struct {
+	lastKey any
+	rows    int64
+}
+
+// progressQueue holds the progress of batches sent to the pipeline, in send
+// order, until the writer has written them.
+type progressQueue struct {
+	mu      sync.Mutex
+	batches []tableProgress
+}
+
+func (q *progressQueue) push(p tableProgress) {
+	q.mu.Lock()
+	q.batches = append(q.batches, p)
+	q.mu.Unlock()
+}
+
+func (q *progressQueue) pop() tableProgress {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := q.batches[0]
+	q.batches = q.batches[1:]
+	return p
+}
+
+// setupCheckpoint loads the checkpoint to resume from, if there is one.
+// Parent keys are held only in memory, so an export that filters rows by
+// foreign key cannot be resumed.
+func (e *Exporter) setupCheckpoint() error {
+	if e.fkTracker != nil || e.followTracker != nil {
+		return errors.New("checkpoints cannot be used with retain follow, --verify-fk or foreign key manifests")
+	}
+	if e.splitData() {
+		return errors.New("checkpoints cannot be used with a separate data output")
+	}
+
+	resume, err := LoadCheckpoint(e.checkpointPath)
+	if err != nil {
+		return err
+	}
+
+	e.resume = resume
+	e.checkpoint = &Checkpoint{}
+	if resume != nil {
+		e.checkpoint.Completed = slices.Clone(resume.Completed)
+		e.checkpoint.SQLOffset = resume.SQLOffset
+		e.checkpoint.NDJSONOffset = resume.NDJSONOffset
+		e.checkpoint.ParamsOffset = resume.ParamsOffset
+		if e.verbose {
+			e.logf("Resuming from checkpoint: %d tables already exported\n", len(resume.Completed))
+		}
+	}
+	e.sqlOffset = e.checkpoint.SQLOffset
+	e.ndjsonOffset = e.checkpoint.NDJSONOffset
+	e.paramsOffset = e.checkpoint.ParamsOffset
+	return nil
+}
+
+// resumeTable returns the checkpoint to resume tableName from, or nil if
+// the table starts from the beginning.
+func (e *Exporter) resumeTable(tableName string) *Checkpoint {
+	if e.resume == nil || e.resume.Table != tableName || e.resume.LastKey == nil {
+		return nil
+	}
+	return e.resume
+}
+
+// saveCheckpoint flushes the outputs and saves how far the export has got.
+func (e *Exporter) saveCheckpoint() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+
+	e.checkpoint.SQLOffset = e.sqlOffset + e.sqlCounter.n
+	if e.ndjsonCounter != nil {
+		e.checkpoint.NDJSONOffset = e.ndjsonOffset + e.ndjsonCounter.n
+	}
+	if e.paramsCounter != nil {
+		e.checkpoint.ParamsOffset = e.paramsOffset + e.paramsCounter.n
+	}
+	if err := e.checkpoint.save(e.checkpointPath); err != nil {
+		return err
+	}
+	e.lastCheckpoint = time.Now()
+	return nil
+}
+
+// checkpointProgress saves the progress of a table after a batch of it is
+// written, at most once per checkpoint interval.
+func (e *Exporter) checkpointProgress(tableName, keyColumn string, p tableProgress) error {
+	if time.Since(e.lastCheckpoint) < e.checkpointInterval {
+		return nil
+	}
+
+	e.checkpoint.Table = tableName
+	e.checkpoint.KeyColumn = keyColumn
+	e.checkpoint.LastKey = p.lastKey
+	e.checkpoint.Rows = p.rows
+	return e.saveCheckpoint()
+}
+
+// checkpointTable saves a table as completed.
+func (e *Exporter) checkpointTable(tableName string) error {
+	e.checkpoint.Completed = append(e.checkpoint.Completed, tableName)
+	e.checkpoint.Table = ""
+	e.checkpoint.KeyColumn = ""
+	e.checkpoint.LastKey = nil
+	e.checkpoint.Rows = 0
+	return e.saveCheckpoint()
+}
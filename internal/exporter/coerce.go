@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+// numericPattern matches the unquoted literals formatValue writes numbers as.
+var numericPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// integerPattern matches an integer that is safe to write unquoted.
+var integerPattern = regexp.MustCompile(`^-?[0-9]+$`)
+
+// formatAs rewrites literal, the formatted value of tableName.col, as the
+// column's output type: config.OutputTypeString quotes numbers,
+// config.OutputTypeInt unquotes integer strings, and config.OutputTypeBool
+// writes TRUE or FALSE. NULLs, values already of the type and an empty type
+// are left as they are. Values that cannot be written as the type are left
+// as they are too, with a warning the first time for each column. It is safe
+// to call concurrently.
+func (e *Exporter) formatAs(tableName, col string, val any, literal, as string) string {
+	if as == "" || val == nil || literal == "NULL" {
+		return literal
+	}
+
+	switch as {
+	case config.OutputTypeString:
+		if numericPattern.MatchString(literal) {
+			return e.escapeString(literal)
+		}
+		return literal
+	case config.OutputTypeInt:
+		if integerPattern.MatchString(literal) {
+			return literal
+		}
+		if text, ok := textValue(val); ok {
+			if text = strings.TrimSpace(text); integerPattern.MatchString(text) {
+				return text
+			}
+		}
+	case config.OutputTypeBool:
+		if integerPattern.MatchString(literal) {
+			return sqlBool(strings.TrimLeft(literal, "-0") != "")
+		}
+		if text, ok := textValue(val); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(text)); err == nil {
+				return sqlBool(b)
+			}
+		}
+	}
+
+	e.warnOutputType(tableName, col, as)
+	return literal
+}
+
+// textValue returns the text of a string value, as drivers return text.
+func textValue(val any) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case sql.RawBytes:
+		return string(v), true
+	}
+	return "", false
+}
+
+// sqlBool returns the SQL literal of a boolean, which MySQL, PostgreSQL and
+// SQLite all read.
+func sqlBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// warnOutputType warns, once per column, that a value of tableName.col could
+// not be written as its output type.
+func (e *Exporter) warnOutputType(tableName, col, as string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := tableName + "." + col
+	if e.warnedOutputTypes == nil {
+		e.warnedOutputTypes = make(map[string]bool)
+	}
+	if e.warnedOutputTypes[key] {
+		return
+	}
+	e.warnedOutputTypes[key] = true
+	fmt.Fprintf(os.Stderr, "Warning: a value of %s cannot be written as %s, writing it unchanged\n", key, as)
+}
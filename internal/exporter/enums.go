@@ -0,0 +1,49 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+// writeEnumTypes writes the enum types used by a table that have not already
+// been written for an earlier table, for drivers that have them.
+func (e *Exporter) writeEnumTypes(table string) error {
+	lister, ok := e.driver.(database.EnumLister)
+	if !ok {
+		return nil
+	}
+
+	types, err := lister.GetEnumTypes(table)
+	if err != nil {
+		return fmt.Errorf("failed to get enum types: %w", err)
+	}
+
+	if e.createdEnums == nil {
+		e.createdEnums = make(map[string]bool)
+	}
+	for _, enum := range types {
+		if e.createdEnums[enum.Name] {
+			continue
+		}
+		e.createdEnums[enum.Name] = true
+
+		if _, err := e.writer.WriteString(e.buildEnumType(enum)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildEnumType returns the statement that creates an enum type. PostgreSQL
+// has no CREATE TYPE IF NOT EXISTS, so an existing type is left in place.
+func (e *Exporter) buildEnumType(enum database.EnumType) string {
+	labels := make([]string, len(enum.Values))
+	for i, label := range enum.Values {
+		labels[i] = e.escapeString(label)
+	}
+
+	return fmt.Sprintf("DO $$ BEGIN\n    CREATE TYPE %s AS ENUM (%s);\nEXCEPTION\n    WHEN duplicate_object THEN NULL;\nEND $$;\n\n",
+		e.driver.QuoteIdentifier(enum.Name), strings.Join(labels, ", "))
+}
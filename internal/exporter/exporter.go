@@ -2,13 +2,27 @@ package exporter
 
 import (
 	"bufio"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/fktracker"
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
 )
 
@@ -18,30 +32,323 @@ const (
 
 	// BufferSize is the buffer size for writing (64KB).
 	BufferSize = 64 * 1024
+
+	// MaxResumeAttempts is how many times a failed table stream is resumed.
+	MaxResumeAttempts = 3
+
+	// DefaultRetryDelay is the base delay before resuming a failed stream.
+	DefaultRetryDelay = time.Second
 )
 
+// ErrRowsLimit is returned when an export would write more rows than
+// Options.RowsLimitTotal allows.
+var ErrRowsLimit = errors.New("total row limit reached")
+
+// ErrEmptyExport is returned when Options.FailIfEmpty is set and an export
+// wrote no rows.
+var ErrEmptyExport = errors.New("no rows exported")
+
 // Stats contains export statistics.
 type Stats struct {
 	TablesExported  int
 	TablesTruncated int
 	RowsExported    int64
+	RowsFiltered    int64                    // Rows dropped for referencing a missing parent (FKManifest or retain follow only)
+	TableDurations  map[string]time.Duration // Time spent exporting each table
+	Orphans         []fktracker.Orphan       // Dangling foreign key references (VerifyFK only)
+	TableErrors     []TableError             // Tables that failed when errors are tolerated
+
+	CharsetMismatches []CharsetMismatch // MySQL columns in a character set other than the dump's
+
+	RowsOversized int64 // Rows larger than MaxRowSize
+	RowsSkipped   int64 // Oversized rows left out of the dump (OversizedSkip only)
+}
+
+// TableError records a table that failed to export.
+type TableError struct {
+	Table string
+	Err   error
 }
 
 // Exporter handles SQL dump generation.
 type Exporter struct {
 	driver     database.Driver
 	anonymiser *anonymiser.Anonymiser
-	writer     *bufio.Writer
+	writer     *sqlWriter
 	verbose    bool
+	log        io.Writer // Where verbose progress goes, os.Stdout if nil
 	batchSize  int
 	dbType     string
 	stats      Stats
+
+	reuseBuffers      bool
+	skipAutoIncrement bool
+	materialise       bool
+	rowsLimitTotal    int64
+	resumeOnError     bool
+	keyset            bool
+	verifyFK          bool
+	maxErrors         int
+	continueOnError   bool
+	mysqldumpCompat   bool
+	schemaOnly        bool
+	refresh           bool
+	dumpSequences     bool
+	fromDate          time.Time
+	parallelBatches   int
+	readThreads       int
+	writeThreads      int
+	zeroDatesNull     bool
+	quoteDecimals     bool
+	dumpCharset       string
+	ndjson            *bufio.Writer // NDJSON output, if any, written alongside the SQL dump
+	warnedTypes       map[reflect.Type]bool
+	createdEnums      map[string]bool // Enum types already written, shared between tables
+	partialInserts    map[string]bool // Tables whose INSERTs leave out some columns
+	mu                sync.Mutex      // guards the FK trackers, warnedTypes and RowsFiltered for concurrent formatting
+	fkManifest        string
+	writeFKManifest   string
+	fkTracker         *fktracker.Tracker
+	followTracker     *fktracker.Tracker // filters tables whose retain follows a parent
+	retryDelay        time.Duration
+
+	// Columns whose decimal values are written unquoted, by table
+	decimalColumns map[string]map[string]bool
+
+	// Progress saved to, and resumed from, Options.Checkpoint
+	checkpointPath     string
+	checkpointInterval time.Duration
+	checkpoint         *Checkpoint
+	resume             *Checkpoint
+	lastCheckpoint     time.Time
+	sqlCounter         *countingWriter
+	ndjsonCounter      *countingWriter
+	sqlOffset          int64 // Length of the outputs before this run
+	ndjsonOffset       int64
+
+	// Only rows of tables with an updated_column changed after since are exported
+	since time.Time
+
+	// Params output, if any, and the table whose statement it last wrote
+	params        *bufio.Writer
+	paramsTable   string
+	paramsCounter *countingWriter
+	paramsOffset  int64
+
+	compactInserts bool // INSERTs are written on one line
+	keepFKChecks   bool // The header leaves foreign key checks on
+
+	data *sqlWriter // Output of the rows when Options.Data splits them from the schema
+
+	insertRewriter func(table, sql string) string
+
+	// NaN and infinite floats are written in the database's notation if
+	// nonFiniteKeep, otherwise as NULL with a warning the first time
+	nonFiniteKeep   bool
+	warnedNonFinite bool
+
+	// Rows larger than maxRowSize are warned about, and skipped if
+	// skipOversized, naming their primary key
+	maxRowSize    int
+	skipOversized bool
+	primaryKeys   map[string][]string
+
+	failIfEmpty bool
+
+	maxInsertSize int // Most bytes of an INSERT statement
+
+	// Rows written against rowsLimitTotal, and those read but left out for
+	// going past it, guarded by mu
+	rowsWritten   int64
+	rowsOverLimit int64
+
+	// Output types columns are written as, by table, and the columns whose
+	// values could not be written as theirs, warned about once
+	outputTypes       map[string]map[string]string
+	warnedOutputTypes map[string]bool
 }
 
 // Options configures the exporter behavior.
 type Options struct {
 	Verbose   bool
 	BatchSize int
+
+	// Log receives the progress messages of Verbose. Defaults to os.Stdout.
+	Log io.Writer
+
+	// ReuseBuffers streams rows through reusable columnar buffers instead of
+	// a map per row, when the driver supports it.
+	ReuseBuffers bool
+
+	// SkipAutoIncrement omits auto-increment columns from INSERT statements
+	// so that the restoring database assigns fresh values.
+	SkipAutoIncrement bool
+
+	// MaterialiseGenerated inserts the current values of generated columns
+	// and removes their GENERATED clause from CREATE TABLE, so the target
+	// stores them as plain columns. Otherwise generated columns are left
+	// out of INSERT statements and the target computes them.
+	MaterialiseGenerated bool
+
+	// RowsLimitTotal aborts the export with ErrRowsLimit rather than write
+	// more than this many rows across all tables. Rows left out of the dump,
+	// e.g. by retain follow or as oversized, are not counted. Zero means no
+	// limit.
+	RowsLimitTotal int64
+
+	// ResumeOnError orders rows by primary key and, after a lost connection
+	// or deadlock, resumes the stream from the last key seen.
+	ResumeOnError bool
+
+	// Keyset pages through tables by primary key, one query per batch,
+	// instead of a single large SELECT.
+	Keyset bool
+
+	// VerifyFK records the foreign key values written to the dump and
+	// reports any that reference a row missing from the dump.
+	VerifyFK bool
+
+	// MaxErrors is how many tables may fail before the export is aborted.
+	// Failed tables are recorded in Stats.TableErrors and skipped.
+	MaxErrors int
+
+	// ContinueOnError skips every failed table instead of aborting.
+	ContinueOnError bool
+
+	// MysqldumpCompat formats MySQL dumps like mysqldump's default output,
+	// with conditional directives, LOCK TABLES blocks and single-line
+	// extended INSERTs. It has no effect for other databases.
+	MysqldumpCompat bool
+
+	// SchemaOnly exports table structure without any rows.
+	SchemaOnly bool
+
+	// DumpSequences writes a CREATE SEQUENCE statement for each standalone
+	// sequence before the tables, and a setval restoring its current value
+	// unless SchemaOnly is set. It has no effect for databases without
+	// sequences.
+	DumpSequences bool
+
+	// Refresh empties each table before its rows are inserted instead of
+	// dropping and recreating it, for targets that already have the schema.
+	// Tables set to truncate: true are emptied and left empty.
+	Refresh bool
+
+	// KeepForeignKeyChecks leaves foreign key checks on while the dump is
+	// restored, instead of turning them off in its header, so that the
+	// restore enforces integrity. Tables must then be in dependency order.
+	KeepForeignKeyChecks bool
+
+	// FromDate, if set, replaces the after_date of every date-based retain.
+	// Tables without a date-based retain are unaffected.
+	FromDate time.Time
+
+	// ParallelBatches is the number of batches that may be read ahead while
+	// earlier ones are written. Zero reads and writes serially. It has no
+	// effect with ReuseBuffers, whose buffers cannot be handed off.
+	ParallelBatches int
+
+	// FKManifest is a manifest written by an earlier export. Its parent keys
+	// are loaded into the FK tracker, and child rows that reference a parent
+	// in neither that dump nor this one are left out.
+	FKManifest string
+
+	// WriteFKManifest is where to save the parent keys written to the dump,
+	// including any loaded from FKManifest, after the export completes.
+	WriteFKManifest string
+
+	// ReadThreads is the number of batches in flight on the read side of the
+	// pipeline: ReadThreads-1 batches are read ahead of the one being written,
+	// like ParallelBatches. Values are clamped to [1, MaxThreads].
+	ReadThreads int
+
+	// WriteThreads is the number of goroutines formatting batches as INSERT
+	// statements. Statements are still written in order by a single writer.
+	// Values are clamped to [1, MaxThreads].
+	WriteThreads int
+
+	// ZeroDates is how database.ZeroDate values are written: config.ZeroDatesNull
+	// writes NULL, anything else writes the value as stored.
+	ZeroDates string
+
+	// QuoteDecimals writes the values of DECIMAL and NUMERIC columns, which
+	// drivers return as text, as quoted strings. Otherwise they are written
+	// as unquoted numeric literals.
+	QuoteDecimals bool
+
+	// DumpCharset is the character set MySQL dumps declare with SET NAMES,
+	// which must be the one the data was read in. Columns in other character
+	// sets are recorded in Stats.CharsetMismatches. Defaults to
+	// DefaultDumpCharset.
+	DumpCharset string
+
+	// NDJSON, if set, also receives every row written to the dump as a line
+	// of JSON, {"table": ..., "row": {...}}, encoded from the same pass over
+	// the data as the INSERT statements.
+	NDJSON io.Writer
+
+	// Params, if set, also receives every row written to the dump as a JSON
+	// array of values, one per line, after a line holding the parameterised
+	// INSERT statement they bind to, {"table": ..., "statement": ...,
+	// "columns": [...]}. Values are never escaped into SQL text.
+	Params io.Writer
+
+	// Checkpoint is a file the progress of the export is saved to. If it
+	// already exists, the export resumes from it: completed tables are
+	// skipped, and the table in progress continues after the last key
+	// written. The outputs must then hold exactly the Checkpoint's SQLOffset,
+	// NDJSONOffset and ParamsOffset bytes written before. The file is removed once the
+	// export completes.
+	Checkpoint string
+
+	// Since, if set, limits tables with an updated_column to the rows
+	// changed after it, for incremental exports. Tables without one are
+	// exported in full.
+	Since time.Time
+
+	// LineEnding is the line ending of the SQL dump. Defaults to LineEndingLF.
+	LineEnding LineEnding
+
+	// InsertStyle is how the rows of INSERT statements are laid out.
+	// Defaults to InsertMultiline. It has no effect with MysqldumpCompat,
+	// whose INSERTs are always compact.
+	InsertStyle InsertStyle
+
+	// Data, if set, receives the rows of the SQL dump, so that the output
+	// given to New holds only its schema. Each output has the header and
+	// footer needed to restore it, and the INSERT statements go to Data, as
+	// do the TRUNCATE statements of Refresh. It cannot be used with
+	// Checkpoint.
+	Data io.Writer
+
+	// InsertRewriter, if set, is called with each INSERT statement of the SQL
+	// dump, ending in its semicolon, and the table it inserts into. The
+	// statement it returns is written in its place. It may be called from
+	// several goroutines at once when WriteThreads is more than one.
+	InsertRewriter func(table, sql string) string
+
+	// NonFiniteFloats is how NaN and infinite float values are written:
+	// config.NonFiniteFloatsKeep writes them in PostgreSQL's and SQLite's
+	// notation where they have one, anything else writes NULL.
+	NonFiniteFloats string
+
+	// FailIfEmpty returns ErrEmptyExport, once the dump is written, if no
+	// table had rows to export. It has no effect with SchemaOnly.
+	FailIfEmpty bool
+
+	// MaxRowSize, if positive, is the size in bytes of a row's formatted
+	// values above which the row is warned about, with its table and
+	// primary key, or skipped as OversizedRows says.
+	MaxRowSize int
+
+	// OversizedRows is what happens to rows larger than MaxRowSize.
+	// Defaults to OversizedWarn.
+	OversizedRows OversizedRowAction
+
+	// MaxInsertSize is the most bytes of one INSERT statement, like MySQL's
+	// max_allowed_packet: a batch whose rows would make a longer statement
+	// is split into several. Defaults to DefaultMaxInsertSize.
+	MaxInsertSize int
 }
 
 // New creates a new Exporter instance.
@@ -50,45 +357,361 @@ func New(driver database.Driver, anon *anonymiser.Anonymiser, output io.Writer,
 	if batchSize <= 0 {
 		batchSize = DefaultBatchSize
 	}
+	dumpCharset := opts.DumpCharset
+	if dumpCharset == "" {
+		dumpCharset = DefaultDumpCharset
+	}
+	maxInsertSize := opts.MaxInsertSize
+	if maxInsertSize <= 0 {
+		maxInsertSize = DefaultMaxInsertSize
+	}
+
+	// Count what is written so that checkpoints record the outputs' lengths
+	var sqlCounter, ndjsonCounter, paramsCounter *countingWriter
+	if opts.Checkpoint != "" {
+		sqlCounter = &countingWriter{w: output}
+		output = sqlCounter
+		if opts.NDJSON != nil {
+			ndjsonCounter = &countingWriter{w: opts.NDJSON}
+			opts.NDJSON = ndjsonCounter
+		}
+		if opts.Params != nil {
+			paramsCounter = &countingWriter{w: opts.Params}
+			opts.Params = paramsCounter
+		}
+	}
+
+	// Line endings are converted above the checkpoint's counters, so that
+	// its offsets are of the output as it is on disk
+	var data *sqlWriter
+	if opts.Data != nil {
+		data = newSQLWriter(opts.Data, opts.LineEnding)
+	}
+
+	var ndjson, params *bufio.Writer
+	if opts.NDJSON != nil {
+		ndjson = bufio.NewWriterSize(opts.NDJSON, BufferSize)
+	}
+	if opts.Params != nil {
+		params = bufio.NewWriterSize(opts.Params, BufferSize)
+	}
 
 	return &Exporter{
 		driver:     driver,
 		anonymiser: anon,
-		writer:     bufio.NewWriterSize(output, BufferSize),
+		writer:     newSQLWriter(output, opts.LineEnding),
 		verbose:    opts.Verbose,
+		log:        opts.Log,
 		batchSize:  batchSize,
 		dbType:     driver.GetDatabaseType(),
+		stats:      Stats{TableDurations: make(map[string]time.Duration)},
+
+		reuseBuffers:      opts.ReuseBuffers,
+		skipAutoIncrement: opts.SkipAutoIncrement,
+		materialise:       opts.MaterialiseGenerated,
+		rowsLimitTotal:    opts.RowsLimitTotal,
+		resumeOnError:     opts.ResumeOnError,
+		keyset:            opts.Keyset,
+		verifyFK:          opts.VerifyFK,
+		maxErrors:         opts.MaxErrors,
+		continueOnError:   opts.ContinueOnError,
+		mysqldumpCompat:   opts.MysqldumpCompat && driver.GetDatabaseType() == "mysql",
+		schemaOnly:        opts.SchemaOnly,
+		refresh:           opts.Refresh,
+		dumpSequences:     opts.DumpSequences,
+		fromDate:          opts.FromDate,
+		parallelBatches:   opts.ParallelBatches,
+		readThreads:       ClampThreads(opts.ReadThreads),
+		writeThreads:      ClampThreads(opts.WriteThreads),
+		zeroDatesNull:     opts.ZeroDates == config.ZeroDatesNull,
+		dumpCharset:       dumpCharset,
+		quoteDecimals:     opts.QuoteDecimals,
+		ndjson:            ndjson,
+		fkManifest:        opts.FKManifest,
+		writeFKManifest:   opts.WriteFKManifest,
+		retryDelay:        DefaultRetryDelay,
+
+		checkpointPath:     opts.Checkpoint,
+		checkpointInterval: DefaultCheckpointInterval,
+		sqlCounter:         sqlCounter,
+		ndjsonCounter:      ndjsonCounter,
+
+		since: opts.Since,
+
+		params:        params,
+		paramsCounter: paramsCounter,
+
+		compactInserts: opts.InsertStyle == InsertCompact,
+		keepFKChecks:   opts.KeepForeignKeyChecks,
+
+		data: data,
+
+		insertRewriter: opts.InsertRewriter,
+
+		nonFiniteKeep: opts.NonFiniteFloats == config.NonFiniteFloatsKeep,
+
+		maxRowSize:    opts.MaxRowSize,
+		skipOversized: opts.OversizedRows == OversizedSkip,
+		primaryKeys:   make(map[string][]string),
+
+		failIfEmpty: opts.FailIfEmpty,
+
+		maxInsertSize: maxInsertSize,
+
+		outputTypes: make(map[string]map[string]string),
+	}
+}
+
+// checkDependencyOrder returns an error if a table comes before a table it
+// references through fks, other than itself, as an export using feature needs
+// each table exported after the tables it references.
+func checkDependencyOrder(tables []schema.TableInfo, fks []database.ForeignKey, feature string) error {
+	position := make(map[string]int, len(tables))
+	for i, table := range tables {
+		position[table.Name] = i
+	}
+
+	for _, fk := range fks {
+		child, ok := position[fk.Table]
+		if !ok || fk.Table == fk.ReferencedTable {
+			continue
+		}
+		if parent, ok := position[fk.ReferencedTable]; ok && parent > child {
+			return fmt.Errorf("table %s references %s, which must be exported before it with %s", fk.Table, fk.ReferencedTable, feature)
+		}
 	}
+	return nil
 }
 
 // Export performs the full database export.
 func (e *Exporter) Export(tables []schema.TableInfo) error {
-	// Write header
-	if err := e.writeHeader(); err != nil {
-		return err
+	if e.verifyFK || e.fkManifest != "" || e.writeFKManifest != "" {
+		fks, err := e.driver.GetForeignKeys()
+		if err != nil {
+			return fmt.Errorf("failed to get foreign keys: %w", err)
+		}
+		e.fkTracker = fktracker.New(fks)
+
+		// Rows are filtered against the parent keys recorded so far
+		if e.fkManifest != "" {
+			if err := checkDependencyOrder(tables, fks, "an FK manifest"); err != nil {
+				return err
+			}
+		}
+	}
+	if e.fkManifest != "" {
+		if err := e.fkTracker.Load(e.fkManifest); err != nil {
+			return err
+		}
+	}
+
+	if !e.schemaOnly {
+		if err := e.setupFollows(tables); err != nil {
+			return err
+		}
+	}
+
+	// TRUNCATE ... CASCADE empties referencing tables, so they must be refilled
+	// after the tables they reference
+	if e.refresh && e.dbType == "postgres" {
+		fks, err := e.driver.GetForeignKeys()
+		if err != nil {
+			return fmt.Errorf("failed to get foreign keys: %w", err)
+		}
+		if err := checkDependencyOrder(tables, fks, "--refresh"); err != nil {
+			return err
+		}
+	}
+
+	if e.checkpointPath != "" {
+		if err := e.setupCheckpoint(); err != nil {
+			return err
+		}
+	}
+
+	if e.dbType == "mysql" && !e.schemaOnly {
+		e.checkCharsets(tables)
+	}
+
+	// The header and sequences of a resumed export are already written
+	if e.resume == nil {
+		if err := e.writeHeader(e.writer); err != nil {
+			return err
+		}
+		if e.splitData() {
+			if err := e.writeHeader(e.data); err != nil {
+				return err
+			}
+		}
+
+		// Create sequences before the tables whose defaults may use them
+		if e.dumpSequences {
+			if err := e.writeSequences(); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Export each table
 	for _, table := range tables {
+		if e.resume != nil && e.resume.completed(table.Name) {
+			if e.verbose {
+				e.logf("Skipping table: %s (exported before the checkpoint)\n", table.Name)
+			}
+			continue
+		}
 		if e.verbose {
-			fmt.Printf("Exporting table: %s\n", table.Name)
+			e.logf("Exporting table: %s\n", table.Name)
 		}
 
+		tableStart := time.Now()
 		if err := e.exportTable(table); err != nil {
-			return fmt.Errorf("failed to export table %s: %w", table.Name, err)
+			if errors.Is(err, ErrRowsLimit) {
+				e.settleRowsExported()
+				return err
+			}
+			if !e.continueOnError && len(e.stats.TableErrors) >= e.maxErrors {
+				return fmt.Errorf("failed to export table %s: %w", table.Name, err)
+			}
+
+			// Record the failure and move on; the dump may hold a partial table
+			e.stats.TableErrors = append(e.stats.TableErrors, TableError{Table: table.Name, Err: err})
+			fmt.Fprintf(os.Stderr, "Warning: failed to export table %s: %v\n", table.Name, err)
+			if _, err := fmt.Fprintf(e.dataWriter(), "\n-- Export of table %s failed: %v\n", table.Name, err); err != nil {
+				return err
+			}
+			if e.mysqldumpCompat {
+				if _, err := e.dataWriter().WriteString("UNLOCK TABLES;\n"); err != nil {
+					return err
+				}
+			}
+		} else {
+			e.stats.TableDurations[table.Name] = time.Since(tableStart)
+			if err := e.writePostSQL(table.Name); err != nil {
+				return err
+			}
+		}
+
+		// Flush after every table so that a restore reading from a pipe
+		// receives each table as soon as it is complete
+		if e.checkpoint != nil {
+			if err := e.checkpointTable(table.Name); err != nil {
+				return err
+			}
+		} else if err := e.flush(); err != nil {
+			return err
 		}
 	}
 
 	// Write footer
-	if err := e.writeFooter(); err != nil {
+	if err := e.writeFooter(e.writer); err != nil {
+		return err
+	}
+	if e.splitData() {
+		if err := e.writeFooter(e.data); err != nil {
+			return err
+		}
+	}
+
+	e.settleRowsExported()
+
+	if e.verifyFK {
+		e.stats.Orphans = e.fkTracker.Orphans()
+	}
+	if e.writeFKManifest != "" {
+		if err := e.fkTracker.Save(e.writeFKManifest); err != nil {
+			return err
+		}
+	}
+
+	if err := e.flush(); err != nil {
+		return err
+	}
+
+	// A completed export has nothing to resume
+	if e.checkpointPath != "" {
+		if err := os.Remove(e.checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove checkpoint: %w", err)
+		}
+	}
+
+	// A dump without rows usually means a wrong database or filter. Rows
+	// exported before a checkpoint are not counted, so resumed runs pass.
+	if e.failIfEmpty && !e.schemaOnly && e.resume == nil && e.stats.RowsExported == 0 {
+		return fmt.Errorf("%w from %d tables", ErrEmptyExport, len(tables))
+	}
+	return nil
+}
+
+// splitData reports whether rows are written to their own output.
+func (e *Exporter) splitData() bool {
+	return e.data != nil
+}
+
+// dataWriter returns the output the rows of the SQL dump are written to.
+func (e *Exporter) dataWriter() *sqlWriter {
+	if e.data != nil {
+		return e.data
+	}
+	return e.writer
+}
+
+// writePostSQL writes the post_sql statements of a table after its rows,
+// adding the terminating semicolon to any written without one.
+func (e *Exporter) writePostSQL(tableName string) error {
+	statements := e.anonymiser.GetPostSQL(tableName)
+	if len(statements) == 0 {
+		return nil
+	}
+
+	w := e.dataWriter()
+	if _, err := w.WriteString("\n"); err != nil {
 		return err
 	}
+	for _, stmt := range statements {
+		stmt = strings.TrimRight(strings.TrimSpace(stmt), ";")
+		if _, err := w.WriteVerbatim(stmt); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(";\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return e.writer.Flush()
+// flush flushes the SQL dump and the data, NDJSON and params outputs, if any.
+func (e *Exporter) flush() error {
+	if err := e.writer.Flush(); err != nil {
+		return err
+	}
+	if e.splitData() {
+		if err := e.data.Flush(); err != nil {
+			return err
+		}
+	}
+	if e.ndjson != nil {
+		if err := e.ndjson.Flush(); err != nil {
+			return err
+		}
+	}
+	if e.params != nil {
+		return e.params.Flush()
+	}
+	return nil
 }
 
-// writeHeader writes the SQL dump header.
-func (e *Exporter) writeHeader() error {
+// writeHeader writes the SQL dump header to w.
+func (e *Exporter) writeHeader(w *sqlWriter) error {
+	if e.mysqldumpCompat {
+		header := mysqldumpHeader
+		if e.keepFKChecks {
+			header = strings.Replace(header, mysqldumpFKChecksOff, "", 1)
+		}
+		_, err := fmt.Fprintf(w, header, e.dumpCharset)
+		return err
+	}
+
 	header := fmt.Sprintf(`-- Database Dump
 -- Generated by dbmask
 -- Date: %s
@@ -96,21 +719,27 @@ func (e *Exporter) writeHeader() error {
 
 `, time.Now().Format(time.RFC3339), e.dbType)
 
-	if _, err := e.writer.WriteString(header); err != nil {
+	if _, err := w.WriteString(header); err != nil {
 		return err
 	}
 
 	// Database-specific settings
 	switch e.dbType {
 	case "mysql":
-		mysqlHeader := `SET NAMES utf8mb4;
-SET FOREIGN_KEY_CHECKS = 0;
-SET SQL_MODE = 'NO_AUTO_VALUE_ON_ZERO';
+		if _, err := fmt.Fprintf(w, "SET NAMES %s;\n", e.dumpCharset); err != nil {
+			return err
+		}
+		if !e.keepFKChecks {
+			if _, err := w.WriteString("SET FOREIGN_KEY_CHECKS = 0;\n"); err != nil {
+				return err
+			}
+		}
+		mysqlHeader := `SET SQL_MODE = 'NO_AUTO_VALUE_ON_ZERO';
 SET AUTOCOMMIT = 0;
 START TRANSACTION;
 
 `
-		if _, err := e.writer.WriteString(mysqlHeader); err != nil {
+		if _, err := w.WriteString(mysqlHeader); err != nil {
 			return err
 		}
 	case "postgres":
@@ -120,14 +749,17 @@ SET check_function_bodies = false;
 SET client_min_messages = warning;
 
 `
-		if _, err := e.writer.WriteString(pgHeader); err != nil {
+		if _, err := w.WriteString(pgHeader); err != nil {
 			return err
 		}
 	case "sqlite":
+		if e.keepFKChecks {
+			break
+		}
 		sqliteHeader := `PRAGMA foreign_keys = OFF;
 
 `
-		if _, err := e.writer.WriteString(sqliteHeader); err != nil {
+		if _, err := w.WriteString(sqliteHeader); err != nil {
 			return err
 		}
 	}
@@ -135,29 +767,39 @@ SET client_min_messages = warning;
 	return nil
 }
 
-// writeFooter writes the SQL dump footer.
-func (e *Exporter) writeFooter() error {
+// writeFooter writes the SQL dump footer to w.
+func (e *Exporter) writeFooter(w *sqlWriter) error {
+	if e.mysqldumpCompat {
+		return e.writeMysqldumpFooter(w)
+	}
+
 	switch e.dbType {
 	case "mysql":
 		footer := `
 COMMIT;
 SET FOREIGN_KEY_CHECKS = 1;
 `
-		if _, err := e.writer.WriteString(footer); err != nil {
+		if e.keepFKChecks {
+			footer = "\nCOMMIT;\n"
+		}
+		if _, err := w.WriteString(footer); err != nil {
 			return err
 		}
 	case "postgres":
 		footer := `
 -- End of dump
 `
-		if _, err := e.writer.WriteString(footer); err != nil {
+		if _, err := w.WriteString(footer); err != nil {
 			return err
 		}
 	case "sqlite":
+		if e.keepFKChecks {
+			break
+		}
 		footer := `
 PRAGMA foreign_keys = ON;
 `
-		if _, err := e.writer.WriteString(footer); err != nil {
+		if _, err := w.WriteString(footer); err != nil {
 			return err
 		}
 	}
@@ -167,30 +809,21 @@ PRAGMA foreign_keys = ON;
 
 // exportTable exports a single table's schema and data.
 func (e *Exporter) exportTable(table schema.TableInfo) error {
-	// Write table header comment
-	comment := fmt.Sprintf("\n--\n-- Table: %s\n--\n\n", table.Name)
-	if _, err := e.writer.WriteString(comment); err != nil {
-		return err
-	}
-
-	// Write DROP TABLE IF EXISTS
-	dropStmt := e.getDropTableStatement(table.Name)
-	if _, err := e.writer.WriteString(dropStmt + "\n\n"); err != nil {
-		return err
-	}
-
-	// Write CREATE TABLE
-	if _, err := e.writer.WriteString(table.CreateStmt + "\n\n"); err != nil {
-		return err
+	// The schema and first rows of a resumed table are already written
+	resume := e.resumeTable(table.Name)
+	if resume == nil {
+		if err := e.writeTableSchema(table); err != nil {
+			return err
+		}
 	}
 
 	// Track table export
 	e.stats.TablesExported++
 
 	// Check if table should be truncated
-	if e.anonymiser.ShouldTruncate(table.Name) {
+	if e.schemaOnly || e.anonymiser.ShouldTruncate(table.Name) {
 		if e.verbose {
-			fmt.Printf("  Truncating table: %s (no data)\n", table.Name)
+			e.logf("  Truncating table: %s (no data)\n", table.Name)
 		}
 		e.stats.TablesTruncated++
 		return nil
@@ -198,71 +831,569 @@ func (e *Exporter) exportTable(table schema.TableInfo) error {
 
 	// Get retain configuration
 	retainCfg := e.anonymiser.GetRetainConfig(table.Name)
+	if retainCfg.IsDateBased() && !e.fromDate.IsZero() {
+		retainCfg.AfterDate = e.fromDate
+	}
+
+	// Only export rows changed since the previous export, keeping the later
+	// date if the table is also retained by its update timestamp
+	if col := e.anonymiser.GetUpdatedColumn(table.Name); col != "" && !e.since.IsZero() {
+		if retainCfg.IsDateBased() && retainCfg.ColumnName != col {
+			return fmt.Errorf("table %s is retained by %s, so it cannot also be filtered by its updated_column %s", table.Name, retainCfg.ColumnName, col)
+		}
+		if !retainCfg.IsDateBased() || e.since.After(retainCfg.AfterDate) {
+			retainCfg.ColumnName = col
+			retainCfg.AfterDate = e.since
+		}
+	}
 	if e.verbose {
 		if retainCfg.IsDateBased() {
-			fmt.Printf("  Retaining rows from %s where %s > %s\n",
-				table.Name, retainCfg.ColumnName, retainCfg.AfterDate.Format("2006-01-02"))
+			e.logf("  Retaining rows from %s where %s > %s\n",
+				table.Name, retainCfg.ColumnName, retainCfg.AfterDate.Format("2006-01-02 15:04:05"))
 		} else if retainCfg.IsCountBased() {
-			fmt.Printf("  Retaining %d rows from: %s\n", retainCfg.Count, table.Name)
+			e.logf("  Retaining %d rows from: %s\n", retainCfg.Count, table.Name)
+		} else if retainCfg.IsFollow() {
+			e.logf("  Retaining rows from %s that reference rows exported from %s\n", table.Name, retainCfg.Follow)
 		}
 	}
 
-	// Build stream options from retain config
+	// Make the primary key available to {{pk}} rules
+	e.anonymiser.SetPrimaryKey(table.Name, table.PrimaryKey)
+	if len(table.PrimaryKey) == 0 && e.anonymiser.UsesPrimaryKey(table.Name) {
+		fmt.Fprintf(os.Stderr, "Warning: table %s has no primary key, {{pk}} will be empty\n", table.Name)
+	}
+
+	// Fake array columns element by element, fit fakes to character columns,
+	// and write decimal columns as numbers
+	var arrayCols []string
+	lengths := make(map[string]int)
+	decimals := make(map[string]bool)
+	for _, col := range table.Columns {
+		if col.IsArray() {
+			arrayCols = append(arrayCols, col.Name)
+		}
+		if col.MaxLength > 0 {
+			lengths[col.Name] = col.MaxLength
+		}
+		if col.IsDecimal() && !e.quoteDecimals {
+			decimals[col.Name] = true
+		}
+	}
+	e.anonymiser.SetArrayColumns(table.Name, arrayCols)
+	e.anonymiser.SetColumnLengths(table.Name, lengths)
+	if e.decimalColumns == nil {
+		e.decimalColumns = make(map[string]map[string]bool)
+	}
+	e.decimalColumns[table.Name] = decimals
+	e.primaryKeys[table.Name] = table.PrimaryKey
+	e.outputTypes[table.Name] = e.anonymiser.GetOutputTypes(table.Name)
+
+	for _, name := range e.longIdentifiers(table.Name, e.insertColumns(table)) {
+		fmt.Fprintf(os.Stderr, "Warning: name %s of table %s is over the %s name length limit of %d\n", name, table.Name, e.dbType, identifierLimits[e.dbType])
+	}
+
+	where := e.anonymiser.GetWhere(table.Name)
+	if e.verbose && where != "" {
+		e.logf("  Filtering rows from %s where %s\n", table.Name, where)
+	}
+
+	// Build stream options from retain config, selecting the columns already
+	// read by the schema analyser so the driver need not look them up again
 	streamOpts := database.StreamOptions{
 		Limit:      retainCfg.Count,
 		ColumnName: retainCfg.ColumnName,
 		AfterDate:  retainCfg.AfterDate,
+		Where:      where,
+		Columns:    make([]string, len(table.Columns)),
 	}
-
-	// Get column names
-	columnNames := make([]string, len(table.Columns))
 	for i, col := range table.Columns {
-		columnNames[i] = col.Name
+		streamOpts.Columns[i] = col.Name
 	}
 
-	// Stream and export rows
-	var batch []map[string]any
-	var rowCount int64
-	err := e.driver.StreamRows(table.Name, streamOpts, e.batchSize, func(rows []map[string]any) error {
-		for _, row := range rows {
-			// Apply anonymization
-			anonRow := e.anonymiser.AnonymiseRow(table.Name, row)
-			batch = append(batch, anonRow)
-			rowCount++
-
-			// Write batch when full
-			if len(batch) >= e.batchSize {
-				if err := e.writeBatchInsert(table.Name, columnNames, batch); err != nil {
-					return err
-				}
-				batch = nil
-			}
+	// Page by primary key instead of one large query
+	if e.keyset {
+		if key := keysetColumn(table); key != "" {
+			streamOpts.KeyColumn = key
+			streamOpts.Keyset = true
+		} else if keys := keysetColumns(table); keys != nil && e.dbType == "sqlite" {
+			streamOpts.KeyColumns = keys
+			streamOpts.Keyset = true
+		} else if e.verbose {
+			e.logf("  No numeric or string primary key to page %s by, using a single query\n", table.Name)
 		}
-		return nil
-	})
-	e.stats.RowsExported += rowCount
-	if err != nil {
-		return err
 	}
 
-	// Write remaining rows
-	if len(batch) > 0 {
-		if err := e.writeBatchInsert(table.Name, columnNames, batch); err != nil {
-			return err
+	// Order by primary key so that a failed stream can be resumed
+	if e.resumeOnError {
+		if len(table.PrimaryKey) == 1 {
+			streamOpts.KeyColumn = table.PrimaryKey[0]
+		} else if e.verbose {
+			e.logf("  No single-column primary key on %s, resume disabled\n", table.Name)
 		}
 	}
 
-	return nil
-}
+	// Order by primary key so that checkpoints can record the progress
+	// through the table
+	if e.checkpoint != nil && streamOpts.KeyColumn == "" {
+		streamOpts.KeyColumn = keysetColumn(table)
+	}
 
-// getDropTableStatement returns the DROP TABLE statement for the database type.
-func (e *Exporter) getDropTableStatement(tableName string) string {
-	quotedName := e.driver.QuoteIdentifier(tableName)
-	switch e.dbType {
-	case "mysql":
-		return fmt.Sprintf("DROP TABLE IF EXISTS %s;", quotedName)
-	case "postgres":
-		return fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE;", quotedName)
+	// Give preserve_distinct columns as many distinct fakes as the rows to
+	// be exported have values
+	for _, col := range e.anonymiser.PreserveDistinctColumns(table.Name) {
+		count, err := e.driver.GetDistinctCount(table.Name, col, streamOpts)
+		if err != nil {
+			return err
+		}
+		if e.verbose {
+			e.logf("  Limiting %s.%s to %d distinct fakes\n", table.Name, col, count)
+		}
+		e.anonymiser.SetDistinctLimit(table.Name, col, int(count))
+	}
+
+	var resumedRows int64
+	if resume != nil {
+		if resume.KeyColumn != streamOpts.KeyColumn {
+			return fmt.Errorf("checkpoint resumes %s by column %q, but it is read by %q", table.Name, resume.KeyColumn, streamOpts.KeyColumn)
+		}
+		if e.verbose {
+			e.logf("  Resuming %s after %s = %v (%d rows already exported)\n", table.Name, resume.KeyColumn, resume.LastKey, resume.Rows)
+		}
+		streamOpts.AfterKey = resume.LastKey
+		resumedRows = resume.Rows
+		if streamOpts.Limit > 0 {
+			streamOpts.Limit -= int(resume.Rows)
+			if streamOpts.Limit <= 0 {
+				return nil
+			}
+		}
+	}
+
+	// Read the values of {{shuffle}} columns before they are dealt out
+	if err := e.readShuffleValues(table, streamOpts); err != nil {
+		return err
+	}
+
+	if !e.mysqldumpCompat {
+		return e.exportRows(table, streamOpts, resumedRows)
+	}
+
+	if resume == nil {
+		if err := e.writeMysqldumpDataStart(table.Name); err != nil {
+			return err
+		}
+	}
+	if err := e.exportRows(table, streamOpts, resumedRows); err != nil {
+		return err
+	}
+	return e.writeMysqldumpDataEnd(table.Name)
+}
+
+// readShuffleValues reads the values of a table's {{shuffle}} columns from
+// the rows the export is about to read, in a first pass over the table, and
+// gives them to the anonymiser to shuffle.
+func (e *Exporter) readShuffleValues(table schema.TableInfo, opts database.StreamOptions) error {
+	columns := e.anonymiser.ShuffleColumns(table.Name)
+	if len(columns) == 0 {
+		return nil
+	}
+	if e.verbose {
+		e.logf("  Reading %s to shuffle %s\n", table.Name, strings.Join(columns, ", "))
+	}
+	// The first pass cannot tell which rows the export will leave out
+	if e.fkManifest != "" || e.skipOversized || e.rowsLimitTotal > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: shuffled values of %s may come from rows left out of the dump\n", table.Name)
+	}
+
+	values := make([][]any, len(columns))
+	err := e.driver.StreamRows(table.Name, opts, e.batchSize, func(rows []map[string]any) error {
+		for _, row := range rows {
+			for i, col := range columns {
+				// Drivers may reuse the buffers of text values
+				switch v := row[col].(type) {
+				case []byte:
+					values[i] = append(values[i], bytes.Clone(v))
+				case sql.RawBytes:
+					values[i] = append(values[i], []byte(bytes.Clone(v)))
+				default:
+					values[i] = append(values[i], v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s to shuffle: %w", table.Name, err)
+	}
+
+	for i, col := range columns {
+		e.anonymiser.SetShuffleValues(table.Name, col, values[i])
+	}
+	return nil
+}
+
+// writeTableSchema writes the table header comment, DROP and CREATE statements.
+func (e *Exporter) writeTableSchema(table schema.TableInfo) error {
+	if e.mysqldumpCompat && !e.refresh {
+		return e.writeMysqldumpTableSchema(table.Name, e.createStatement(table))
+	}
+
+	// Write table header comment, in the data output too if rows have their own
+	comment := fmt.Sprintf("\n--\n-- Table: %s\n--\n\n", table.Name)
+	if _, err := e.writer.WriteString(comment); err != nil {
+		return err
+	}
+	if e.splitData() {
+		if _, err := e.dataWriter().WriteString(comment); err != nil {
+			return err
+		}
+	}
+
+	// Empty the existing table instead of replacing it
+	if e.refresh {
+		_, err := e.dataWriter().WriteString(e.getTruncateTableStatement(table.Name) + "\n\n")
+		return err
+	}
+
+	// Write DROP TABLE IF EXISTS
+	dropStmt := e.getDropTableStatement(table.Name)
+	if _, err := e.writer.WriteString(dropStmt + "\n\n"); err != nil {
+		return err
+	}
+
+	// Create the enum types used by the table's columns
+	if err := e.writeEnumTypes(table.Name); err != nil {
+		return err
+	}
+
+	// Write CREATE TABLE
+	if _, err := e.writer.WriteVerbatim(e.createStatement(table)); err != nil {
+		return err
+	}
+	_, err := e.writer.WriteString("\n\n")
+	return err
+}
+
+// exportRows streams, anonymises and writes a table's rows. resumedRows is
+// the number of rows written before a checkpoint the table resumes from.
+func (e *Exporter) exportRows(table schema.TableInfo, streamOpts database.StreamOptions, resumedRows int64) error {
+	// Stream without per-row maps when the driver supports it
+	if streamer, ok := e.driver.(database.ColumnarStreamer); ok && e.reuseBuffers {
+		return e.exportRowsColumnar(streamer, table, streamOpts, resumedRows)
+	}
+
+	// Get column names
+	columnNames := e.insertColumns(table)
+
+	var rowCount int64
+	var lastKey any
+
+	// Save the progress through the table as each batch is written
+	checkpointing := e.checkpoint != nil && streamOpts.KeyColumn != ""
+	var progress progressQueue
+	written := func() error {
+		if !checkpointing {
+			return nil
+		}
+		return e.checkpointProgress(table.Name, streamOpts.KeyColumn, progress.pop())
+	}
+
+	write := func(batch []map[string]any) error {
+		if err := e.writeBatchInsert(table.Name, columnNames, batch); err != nil {
+			return err
+		}
+		return written()
+	}
+
+	// Format and write batches on separate goroutines while the next ones are read
+	var pipeline *batchPipeline[encodedBatch]
+	if depth := max(e.parallelBatches, e.readThreads-1); depth > 0 || e.writeThreads > 1 {
+		pipeline = newBatchPipeline(max(depth, e.writeThreads), e.writeThreads,
+			func(batch []map[string]any) encodedBatch {
+				return e.encodeBatch(table.Name, columnNames, batch)
+			},
+			func(batch encodedBatch) error {
+				if err := e.writeEncoded(batch); err != nil {
+					return err
+				}
+				return written()
+			})
+		write = pipeline.send
+	}
+	send := func(batch []map[string]any) error {
+		if checkpointing {
+			progress.push(tableProgress{lastKey: checkpointKey(lastKey), rows: resumedRows + rowCount})
+		}
+		return write(batch)
+	}
+
+	// Stream and export rows
+	var batch []map[string]any
+	err := e.streamWithResume(table.Name, streamOpts, &lastKey, &rowCount, func(opts database.StreamOptions) error {
+		return e.driver.StreamRows(table.Name, opts, e.batchSize, func(rows []map[string]any) error {
+			for _, row := range rows {
+				if err := e.checkRowsLimit(); err != nil {
+					return err
+				}
+				if opts.KeyColumn != "" {
+					lastKey = row[opts.KeyColumn]
+				}
+
+				// Apply anonymization
+				anonRow := e.anonymiser.AnonymiseRow(table.Name, row)
+				batch = append(batch, anonRow)
+				rowCount++
+
+				// Write batch when full
+				if len(batch) >= e.batchSize {
+					if err := send(batch); err != nil {
+						return err
+					}
+					batch = nil
+				}
+			}
+			return nil
+		})
+	})
+	e.stats.RowsExported += rowCount
+
+	// Write remaining rows
+	if err == nil && len(batch) > 0 {
+		err = send(batch)
+	}
+
+	// Wait for queued batches to be written
+	if pipeline != nil {
+		if closeErr := pipeline.close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err == nil {
+		err = e.checkRowsLimit()
+	}
+	return err
+}
+
+// exportRowsColumnar streams and exports rows using reusable columnar buffers.
+func (e *Exporter) exportRowsColumnar(streamer database.ColumnarStreamer, table schema.TableInfo, opts database.StreamOptions, resumedRows int64) error {
+	included := make(map[string]bool)
+	for _, name := range e.insertColumns(table) {
+		included[name] = true
+	}
+
+	var outCols []string
+	var keep []int
+	keyIdx := -1
+	var rowCount int64
+	var lastKey any
+	err := e.streamWithResume(table.Name, opts, &lastKey, &rowCount, func(opts database.StreamOptions) error {
+		return streamer.StreamRowsColumnar(table.Name, opts, e.batchSize, func(cols []string, values [][]any) error {
+			// Work out which value positions to write on the first batch
+			if keep == nil {
+				keep = make([]int, 0, len(cols))
+				for i, col := range cols {
+					if included[col] {
+						outCols = append(outCols, col)
+						keep = append(keep, i)
+					}
+					if col == opts.KeyColumn {
+						keyIdx = i
+					}
+				}
+			}
+
+			if err := e.checkRowsLimit(); err != nil {
+				return err
+			}
+
+			for _, row := range values {
+				// Record the key before anonymisation can replace it
+				if keyIdx >= 0 {
+					lastKey = row[keyIdx]
+				}
+
+				// Apply anonymization in place
+				e.anonymiser.AnonymiseValues(table.Name, cols, row)
+			}
+			rowCount += int64(len(values))
+			if err := e.writeValuesInsert(table.Name, outCols, keep, values); err != nil {
+				return err
+			}
+
+			// Save the progress through the table
+			if e.checkpoint != nil && opts.KeyColumn != "" && len(values) > 0 {
+				return e.checkpointProgress(table.Name, opts.KeyColumn, tableProgress{lastKey: checkpointKey(lastKey), rows: resumedRows + rowCount})
+			}
+			return nil
+		})
+	})
+	e.stats.RowsExported += rowCount
+	if err == nil {
+		err = e.checkRowsLimit()
+	}
+	return err
+}
+
+// settleRowsExported removes from RowsExported the rows that were counted
+// when they were read but left out of the dump: those filtered, skipped or
+// read past RowsLimitTotal.
+func (e *Exporter) settleRowsExported() {
+	e.stats.RowsExported -= e.stats.RowsFiltered + e.stats.RowsSkipped + e.rowsOverLimit
+}
+
+// takeRow counts a row about to be written to the dump against
+// RowsLimitTotal. It reports false, leaving the row out, once the limit is
+// reached. It is safe to call concurrently.
+func (e *Exporter) takeRow() bool {
+	if e.rowsLimitTotal <= 0 {
+		return true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rowsWritten >= e.rowsLimitTotal {
+		e.rowsOverLimit++
+		return false
+	}
+	e.rowsWritten++
+	return true
+}
+
+// checkRowsLimit returns ErrRowsLimit once a row has been left out of the
+// dump for going past RowsLimitTotal.
+func (e *Exporter) checkRowsLimit() error {
+	if e.rowsLimitTotal <= 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rowsOverLimit > 0 {
+		return fmt.Errorf("%w: more than %d rows would be exported", ErrRowsLimit, e.rowsLimitTotal)
+	}
+	return nil
+}
+
+// streamWithResume runs stream and, when resuming is enabled and the stream
+// fails with a retryable error, runs it again starting after lastKey.
+// received is the number of rows consumed so far, used to reduce a count limit.
+func (e *Exporter) streamWithResume(tableName string, opts database.StreamOptions, lastKey *any, received *int64, stream func(database.StreamOptions) error) error {
+	limit := opts.Limit
+	err := stream(opts)
+
+	for attempt := 1; attempt <= MaxResumeAttempts; attempt++ {
+		if err == nil || !e.resumeOnError || opts.KeyColumn == "" || !database.IsRetryableError(err) {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: streaming %s failed after %d rows (%v), resuming (attempt %d/%d)\n",
+			tableName, *received, err, attempt, MaxResumeAttempts)
+		time.Sleep(e.retryDelay * time.Duration(attempt))
+
+		if *lastKey != nil {
+			opts.AfterKey = *lastKey
+		}
+		if limit > 0 {
+			opts.Limit = limit - int(*received)
+			if opts.Limit <= 0 {
+				return nil
+			}
+		}
+
+		err = stream(opts)
+	}
+
+	return err
+}
+
+// keysetTypes are the numeric and string base column types that can be
+// compared with > and ordered for keyset pagination.
+var keysetTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true, "integer": true, "bigint": true,
+	"int2": true, "int4": true, "int8": true, "serial": true, "bigserial": true,
+	"numeric": true, "decimal": true, "char": true, "varchar": true, "character": true,
+	"nchar": true, "nvarchar": true, "text": true, "uuid": true,
+}
+
+// keysetColumn returns the column to page by for keyset pagination, or empty
+// string if the table has no single-column numeric or string primary key.
+func keysetColumn(table schema.TableInfo) string {
+	if len(table.PrimaryKey) != 1 || !isKeysetColumn(table, table.PrimaryKey[0]) {
+		return ""
+	}
+	return table.PrimaryKey[0]
+}
+
+// keysetColumns returns the columns of a composite primary key to page by
+// for keyset pagination, or nil if the table has no composite primary key
+// or one of its columns is not numeric or string.
+func keysetColumns(table schema.TableInfo) []string {
+	if len(table.PrimaryKey) < 2 {
+		return nil
+	}
+	for _, key := range table.PrimaryKey {
+		if !isKeysetColumn(table, key) {
+			return nil
+		}
+	}
+	return table.PrimaryKey
+}
+
+// isKeysetColumn reports whether a column of a table is of a numeric or
+// string type that keyset pagination can compare.
+func isKeysetColumn(table schema.TableInfo, name string) bool {
+	for _, col := range table.Columns {
+		if col.Name != name {
+			continue
+		}
+		return keysetTypes[baseType(col.DataType)]
+	}
+	return false
+}
+
+// baseType returns the type name of a column's data type, without its
+// length, precision or modifiers, e.g. "int" for "int(11) unsigned" and
+// "character" for "character varying(10)".
+func baseType(dataType string) string {
+	dataType, _, _ = strings.Cut(strings.ToLower(dataType), "(")
+	if fields := strings.Fields(dataType); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// insertColumns returns the names of the columns to include in INSERT statements.
+func (e *Exporter) insertColumns(table schema.TableInfo) []string {
+	columnNames := make([]string, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if e.skipAutoIncrement && col.IsAutoIncrement() {
+			continue
+		}
+		if !e.materialise && col.IsGenerated() {
+			continue
+		}
+		columnNames = append(columnNames, col.Name)
+	}
+
+	// Recorded before any batch of the table is formatted
+	if len(columnNames) < len(table.Columns) {
+		if e.partialInserts == nil {
+			e.partialInserts = make(map[string]bool)
+		}
+		e.partialInserts[table.Name] = true
+	}
+	return columnNames
+}
+
+// getDropTableStatement returns the DROP TABLE statement for the database type.
+func (e *Exporter) getDropTableStatement(tableName string) string {
+	quotedName := e.driver.QuoteIdentifier(tableName)
+	switch e.dbType {
+	case "mysql":
+		return fmt.Sprintf("DROP TABLE IF EXISTS %s;", quotedName)
+	case "postgres":
+		return fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE;", quotedName)
 	case "sqlite":
 		return fmt.Sprintf("DROP TABLE IF EXISTS %s;", quotedName)
 	default:
@@ -270,42 +1401,257 @@ func (e *Exporter) getDropTableStatement(tableName string) string {
 	}
 }
 
-// writeBatchInsert writes a batch INSERT statement.
+// getTruncateTableStatement returns the statement that empties a table for
+// the database type. Foreign key checks are disabled by the dump header for
+// MySQL and SQLite; Postgres cascades to referencing tables, which are
+// refilled after the tables they reference when exported in dependency order.
+func (e *Exporter) getTruncateTableStatement(tableName string) string {
+	quotedName := e.driver.QuoteIdentifier(tableName)
+	switch e.dbType {
+	case "postgres":
+		return fmt.Sprintf("TRUNCATE TABLE %s CASCADE;", quotedName)
+	case "sqlite":
+		return fmt.Sprintf("DELETE FROM %s;", quotedName)
+	default:
+		return fmt.Sprintf("TRUNCATE TABLE %s;", quotedName)
+	}
+}
+
+// writeBatchInsert writes a batch INSERT statement, and the batch's rows
+// to the NDJSON output if any.
 func (e *Exporter) writeBatchInsert(tableName string, columns []string, rows []map[string]any) error {
+	return e.writeEncoded(e.encodeBatch(tableName, columns, rows))
+}
+
+// allowedRows returns the rows of a batch to write, leaving out those
+// allowRow drops. They are recorded with the FK trackers once they are
+// written. It is safe to call concurrently.
+func (e *Exporter) allowedRows(tableName string, columns []string, rows []map[string]any) []map[string]any {
+	if e.fkTracker == nil && e.followTracker == nil {
+		return rows
+	}
+
+	allowed := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		rowValues := make([]any, len(columns))
+		for j, col := range columns {
+			rowValues[j] = row[col]
+		}
+		if e.allowRow(tableName, columns, rowValues) {
+			allowed = append(allowed, row)
+		}
+	}
+	return allowed
+}
+
+// buildBatchInsert formats a batch INSERT statement, or returns an empty
+// string when there are no rows to write. It also returns the rows written,
+// which leave out any oversized rows skipped. It is safe to call concurrently.
+func (e *Exporter) buildBatchInsert(tableName string, columns []string, rows []map[string]any) (string, []map[string]any) {
 	if len(rows) == 0 {
+		return "", rows
+	}
+
+	// Build INSERT statements
+	inserts := e.newInsertBuilder(tableName, columns)
+	decimals := e.decimalColumns[tableName]
+	types := e.outputTypes[tableName]
+	var written []map[string]any // Set once a row is skipped
+	skipped := false
+	for i, row := range rows {
+		values := make([]string, len(columns))
+		for j, col := range columns {
+			values[j] = e.formatAs(tableName, col, row[col], e.formatColumnValue(row[col], decimals[col]), types[col])
+		}
+		if e.maxRowSize > 0 && !e.allowRowSize(tableName, e.rowSize(values), func(c string) any { return row[c] }) || !e.takeRow() {
+			if !skipped {
+				written = slices.Clone(rows[:i])
+				skipped = true
+			}
+			continue
+		}
+		if skipped {
+			written = append(written, row)
+		}
+		if e.fkTracker != nil || e.followTracker != nil {
+			rowValues := make([]any, len(columns))
+			for j, col := range columns {
+				rowValues[j] = row[col]
+			}
+			e.recordRow(tableName, columns, rowValues)
+		}
+
+		inserts.add(values)
+	}
+	if !skipped {
+		written = rows
+	}
+	if inserts.written == 0 {
+		return "", written
+	}
+
+	return e.rewriteInserts(tableName, inserts.String()), written
+}
+
+// rewriteInserts passes each INSERT statement of a batch through the
+// InsertRewriter, if there is one. Statements end in ";\n", which cannot
+// appear within them as newlines in values are escaped.
+func (e *Exporter) rewriteInserts(tableName, sql string) string {
+	if e.insertRewriter == nil {
+		return sql
+	}
+
+	statements := strings.SplitAfter(strings.TrimSuffix(sql, "\n"), ";\n")
+	var sb strings.Builder
+	for _, stmt := range statements {
+		sb.WriteString(e.insertRewriter(tableName, strings.TrimSuffix(stmt, "\n")))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writeValuesInsert writes a batch INSERT statement for rows held as value
+// slices, and the rows to the NDJSON output if any. keep lists the positions
+// in each row to write, matching columns.
+func (e *Exporter) writeValuesInsert(tableName string, columns []string, keep []int, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// Build INSERT statements
+	inserts := e.newInsertBuilder(tableName, columns)
+	decimals := e.decimalColumns[tableName]
+	types := e.outputTypes[tableName]
+	var ndjson, params bytes.Buffer
+	for _, row := range rows {
+		var rowValues []any
+		if e.fkTracker != nil || e.followTracker != nil {
+			rowValues = make([]any, len(keep))
+			for j, idx := range keep {
+				rowValues[j] = row[idx]
+			}
+			if !e.allowRow(tableName, columns, rowValues) {
+				continue
+			}
+		}
+
+		values := make([]string, len(keep))
+		for j, idx := range keep {
+			values[j] = e.formatAs(tableName, columns[j], row[idx], e.formatColumnValue(row[idx], decimals[columns[j]]), types[columns[j]])
+		}
+		if e.maxRowSize > 0 && !e.allowRowSize(tableName, e.rowSize(values), func(c string) any {
+			if j := slices.Index(columns, c); j >= 0 {
+				return row[keep[j]]
+			}
+			return nil
+		}) {
+			continue
+		}
+		if !e.takeRow() {
+			continue
+		}
+		if rowValues != nil {
+			e.recordRow(tableName, columns, rowValues)
+		}
+
+		inserts.add(values)
+
+		if e.ndjson != nil {
+			values := make(map[string]any, len(keep))
+			for j, idx := range keep {
+				values[columns[j]] = e.jsonValue(row[idx])
+			}
+			appendNDJSON(&ndjson, tableName, values)
+		}
+		if e.params != nil {
+			values := make([]any, len(keep))
+			for j, idx := range keep {
+				values[j] = e.jsonValue(row[idx])
+			}
+			appendParams(&params, values)
+		}
+	}
+	if inserts.written == 0 {
 		return nil
 	}
 
+	return e.writeEncoded(encodedBatch{sql: e.rewriteInserts(tableName, inserts.String()), ndjson: ndjson.Bytes(), params: params.Bytes(), table: tableName, columns: columns})
+}
+
+// allowRow drops a row when it references a parent row that was not
+// exported from a table its retain follows, or when a loaded FK manifest is
+// filtering rows and it references a parent missing from both dumps. Rows it
+// allows are passed to recordRow once they are known to be written.
+func (e *Exporter) allowRow(tableName string, columns []string, values []any) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.followTracker != nil && !e.followTracker.Allows(tableName, columns, values) {
+		e.stats.RowsFiltered++
+		return false
+	}
+	if e.fkManifest != "" && !e.fkTracker.Allows(tableName, columns, values) {
+		e.stats.RowsFiltered++
+		return false
+	}
+	return true
+}
+
+// recordRow records a row written to the dump with the FK trackers, so that
+// rows referencing it are kept and not reported as orphans.
+func (e *Exporter) recordRow(tableName string, columns []string, values []any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.followTracker != nil {
+		e.followTracker.Record(tableName, columns, values)
+	}
+	if e.fkTracker != nil {
+		e.fkTracker.Record(tableName, columns, values)
+	}
+}
+
+// writeInsertPrefix writes the "INSERT INTO table (columns) VALUES" line.
+func (e *Exporter) writeInsertPrefix(sb *strings.Builder, tableName string, columns []string) {
 	quotedTable := e.driver.QuoteIdentifier(tableName)
 	quotedCols := make([]string, len(columns))
 	for i, col := range columns {
 		quotedCols[i] = e.driver.QuoteIdentifier(col)
 	}
 
-	// Build INSERT statement
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES\n",
-		quotedTable, strings.Join(quotedCols, ", ")))
-
-	for i, row := range rows {
-		if i > 0 {
-			sb.WriteString(",\n")
-		}
-
-		values := make([]string, len(columns))
-		for j, col := range columns {
-			values[j] = e.formatValue(row[col])
+	// mysqldump omits the column list unless some columns are left out
+	if e.mysqldumpCompat {
+		if e.partialInserts[tableName] {
+			sb.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quotedTable, strings.Join(quotedCols, ",")))
+		} else {
+			sb.WriteString(fmt.Sprintf("INSERT INTO %s VALUES ", quotedTable))
 		}
+		return
+	}
 
-		sb.WriteString("(")
-		sb.WriteString(strings.Join(values, ", "))
-		sb.WriteString(")")
+	if e.compactInserts {
+		sb.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quotedTable, strings.Join(quotedCols, ",")))
+		return
 	}
 
-	sb.WriteString(";\n")
+	sb.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES\n",
+		quotedTable, strings.Join(quotedCols, ", ")))
+}
 
-	_, err := e.writer.WriteString(sb.String())
-	return err
+// rowSeparator returns the text written between rows of an INSERT.
+func (e *Exporter) rowSeparator() string {
+	if e.mysqldumpCompat || e.compactInserts {
+		return ","
+	}
+	return ",\n"
+}
+
+// valueSeparator returns the text written between values in a row.
+func (e *Exporter) valueSeparator() string {
+	if e.mysqldumpCompat || e.compactInserts {
+		return ","
+	}
+	return ", "
 }
 
 // formatValue formats a value for SQL insertion.
@@ -322,17 +1668,158 @@ func (e *Exporter) formatValue(val any) string {
 		return "0"
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		return fmt.Sprintf("%d", v)
-	case float32, float64:
-		return fmt.Sprintf("%v", v)
+	case float32:
+		return e.formatFloat(v, float64(v))
+	case float64:
+		return e.formatFloat(v, v)
 	case []byte:
 		return e.escapeString(string(v))
 	case string:
 		return e.escapeString(v)
 	case time.Time:
 		return e.escapeString(v.Format("2006-01-02 15:04:05"))
+	case database.ZeroDate:
+		if e.zeroDatesNull {
+			return "NULL"
+		}
+		return e.escapeString(string(v))
+	case sql.RawBytes:
+		return e.escapeString(string(v))
+	case *big.Int:
+		if v == nil {
+			return "NULL"
+		}
+		return v.String()
+	case *big.Float:
+		if v == nil {
+			return "NULL"
+		}
+		return v.Text('f', -1)
 	default:
-		return e.escapeString(fmt.Sprintf("%v", v))
+		return e.formatOther(v)
+	}
+}
+
+// formatFloat formats f, the value of val, as a numeric literal. NaN and
+// infinity, which are not valid SQL literals, are written as NULL unless
+// Options.NonFiniteFloats keeps them in a notation the database reads back.
+func (e *Exporter) formatFloat(val any, f float64) string {
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return fmt.Sprintf("%v", val)
+	}
+
+	if e.nonFiniteKeep {
+		sign := ""
+		if f < 0 {
+			sign = "-"
+		}
+		switch {
+		case e.dbType == "postgres" && math.IsNaN(f):
+			return "'NaN'"
+		case e.dbType == "postgres":
+			return "'" + sign + "Infinity'"
+		case e.dbType == "sqlite" && !math.IsNaN(f):
+			// SQLite reads literals too large for a double as infinity; it
+			// stores NaN as NULL
+			return sign + "9e999"
+		}
+	}
+
+	e.mu.Lock()
+	if !e.warnedNonFinite {
+		e.warnedNonFinite = true
+		fmt.Fprintf(os.Stderr, "Warning: NaN or infinite float value written as NULL\n")
 	}
+	e.mu.Unlock()
+	return "NULL"
+}
+
+// formatColumnValue formats a value for SQL insertion. Values of decimal
+// columns, which drivers return as text, are written unquoted when they are
+// plain decimal numbers.
+func (e *Exporter) formatColumnValue(val any, decimal bool) string {
+	if decimal {
+		switch v := val.(type) {
+		case []byte:
+			if decimalPattern.Match(v) {
+				return string(v)
+			}
+		case string:
+			if decimalPattern.MatchString(v) {
+				return v
+			}
+		}
+	}
+	return e.formatValue(val)
+}
+
+// decimalPattern matches a plain decimal number that is safe to write unquoted.
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// formatOther formats values of types without an explicit case in formatValue.
+// Decimal-like types (structs whose String method returns a plain number) are
+// written unquoted, driver.Valuer types are formatted by their value, and named
+// basic types by their underlying kind. Anything else is written as a quoted
+// string of its %v form, with a warning printed once per type.
+func (e *Exporter) formatOther(val any) string {
+	rv := reflect.ValueOf(val)
+
+	if s, ok := val.(fmt.Stringer); ok && rv.Kind() == reflect.Struct {
+		if str := s.String(); decimalPattern.MatchString(str) {
+			return str
+		}
+	}
+
+	if valuer, ok := val.(driver.Valuer); ok {
+		inner, err := valuer.Value()
+		if err != nil {
+			e.warnUnsupportedType(rv.Type(), err)
+			return "NULL"
+		}
+		return e.formatValue(inner)
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return e.formatValue(rv.Elem().Interface())
+	case reflect.Bool:
+		return e.formatValue(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits())
+	case reflect.String:
+		return e.escapeString(rv.String())
+	}
+
+	e.warnUnsupportedType(rv.Type(), nil)
+	return e.escapeString(fmt.Sprintf("%v", val))
+}
+
+// warnUnsupportedType prints a warning the first time a value of type t
+// cannot be formatted as a native SQL literal.
+func (e *Exporter) warnUnsupportedType(t reflect.Type, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.warnedTypes == nil {
+		e.warnedTypes = make(map[reflect.Type]bool)
+	}
+	if e.warnedTypes[t] {
+		return
+	}
+	e.warnedTypes[t] = true
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read value of type %s, writing NULL: %v\n", t, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: unsupported value type %s, writing it as a quoted string\n", t)
 }
 
 // escapeString escapes a string for SQL.
@@ -352,3 +1839,12 @@ func (e *Exporter) escapeString(s string) string {
 func (e *Exporter) GetStats() Stats {
 	return e.stats
 }
+
+// logf writes a verbose progress message to the export's log.
+func (e *Exporter) logf(format string, args ...any) {
+	w := e.log
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, format, args...)
+}
@@ -1,10 +1,23 @@
 package exporter
 
 import (
-	"bufio"
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +34,7 @@ type mockDriver struct {
 	columns     map[string][]database.ColumnInfo
 	rows        map[string][]map[string]any
 	streamErr   error
+	foreignKeys []database.ForeignKey
 }
 
 func (m *mockDriver) Connect(cfg *config.Connection) error { return nil }
@@ -36,8 +50,14 @@ func (m *mockDriver) GetColumns(table string) ([]database.ColumnInfo, error) {
 	return nil, nil
 }
 func (m *mockDriver) GetForeignKeys() ([]database.ForeignKey, error) {
+	return m.foreignKeys, nil
+}
+func (m *mockDriver) GetPrimaryKey(table string) ([]string, error) {
 	return nil, nil
 }
+func (m *mockDriver) GetServerVersion() (string, error) {
+	return "3.45.1", nil
+}
 func (m *mockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
 	if m.streamErr != nil {
 		return m.streamErr
@@ -65,6 +85,19 @@ func (m *mockDriver) GetRowCount(table string) (int64, error) {
 	}
 	return 0, nil
 }
+func (m *mockDriver) GetDistinctCount(table, column string, opts database.StreamOptions) (int64, error) {
+	seen := make(map[any]bool)
+	for _, row := range m.rows[table] {
+		if val := row[column]; val != nil {
+			seen[val] = true
+		}
+	}
+	return int64(len(seen)), nil
+}
+
+func (m *mockDriver) GetOrphanCount(fk database.ForeignKey) (int64, error) {
+	return 0, nil
+}
 func (m *mockDriver) QuoteIdentifier(name string) string {
 	return "\"" + name + "\""
 }
@@ -75,6 +108,30 @@ func (m *mockDriver) GetDatabaseType() string {
 	return "sqlite"
 }
 
+// columnarMockDriver adds database.ColumnarStreamer support to mockDriver
+type columnarMockDriver struct {
+	mockDriver
+	columnarCalls int
+}
+
+func (m *columnarMockDriver) StreamRowsColumnar(table string, opts database.StreamOptions, batchSize int, callback database.ColumnarCallback) error {
+	m.columnarCalls++
+	cols := make([]string, len(m.columns[table]))
+	for i, col := range m.columns[table] {
+		cols[i] = col.Name
+	}
+	return m.StreamRows(table, opts, batchSize, func(rows []map[string]any) error {
+		values := make([][]any, len(rows))
+		for i, row := range rows {
+			values[i] = make([]any, len(cols))
+			for j, col := range cols {
+				values[i][j] = row[col]
+			}
+		}
+		return callback(cols, values)
+	})
+}
+
 func TestNew(t *testing.T) {
 	driver := &mockDriver{}
 	cfg := &config.Config{}
@@ -410,6 +467,151 @@ func TestFormatValue(t *testing.T) {
 	}
 }
 
+// testDecimal mimics decimal types such as shopspring/decimal.Decimal.
+type testDecimal struct {
+	digits string
+}
+
+func (d testDecimal) String() string { return d.digits }
+func (d testDecimal) Value() (driver.Value, error) {
+	return d.digits, nil
+}
+
+// testStatus is a named string type.
+type testStatus string
+
+// testPoint is a struct with no SQL representation.
+type testPoint struct {
+	X, Y int
+}
+
+func TestFormatValue_OtherTypes(t *testing.T) {
+	exp := &Exporter{}
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"raw bytes", sql.RawBytes("raw"), "'raw'"},
+		{"big int", bigInt, "123456789012345678901234567890"},
+		{"nil big int", (*big.Int)(nil), "NULL"},
+		{"big float", big.NewFloat(12.5), "12.5"},
+		{"decimal", testDecimal{"1234.5600"}, "1234.5600"},
+		{"negative decimal", testDecimal{"-0.01"}, "-0.01"},
+		{"valuer", sql.NullString{String: "it's", Valid: true}, "'it''s'"},
+		{"null valuer", sql.NullInt64{}, "NULL"},
+		{"valid valuer", sql.NullInt64{Int64: 7, Valid: true}, "7"},
+		{"named string", testStatus("active"), "'active'"},
+		{"duration", 2 * time.Second, "2000000000"},
+		{"pointer", func() *int { i := 5; return &i }(), "5"},
+		{"nil pointer", (*string)(nil), "NULL"},
+		{"unexpected struct", testPoint{X: 1, Y: 2}, "'{1 2}'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exp.formatValue(tt.value); got != tt.want {
+				t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	if !exp.warnedTypes[reflect.TypeOf(testPoint{})] {
+		t.Error("unexpected struct type should be warned about")
+	}
+}
+
+func TestFormatValue_ZeroDate(t *testing.T) {
+	zero := database.ZeroDate("0000-00-00 00:00:00")
+
+	keep := New(&mockDriver{dbType: "mysql"}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{ZeroDates: config.ZeroDatesKeep})
+	if got := keep.formatValue(zero); got != "'0000-00-00 00:00:00'" {
+		t.Errorf("formatValue(zero date) with keep = %q, want the stored value", got)
+	}
+
+	null := New(&mockDriver{dbType: "mysql"}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{ZeroDates: config.ZeroDatesNull})
+	if got := null.formatValue(zero); got != "NULL" {
+		t.Errorf("formatValue(zero date) with null = %q, want NULL", got)
+	}
+}
+
+func TestFormatValue_NonFiniteFloat(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+
+	tests := []struct {
+		dbType string
+		mode   string
+		value  any
+		want   string
+	}{
+		{dbType: "mysql", value: nan, want: "NULL"},
+		{dbType: "mysql", value: inf, want: "NULL"},
+		{dbType: "mysql", value: -inf, want: "NULL"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsNull, value: float32(inf), want: "NULL"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsKeep, value: nan, want: "'NaN'"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsKeep, value: inf, want: "'Infinity'"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsKeep, value: float32(-inf), want: "'-Infinity'"},
+		{dbType: "sqlite", mode: config.NonFiniteFloatsKeep, value: nan, want: "NULL"},
+		{dbType: "sqlite", mode: config.NonFiniteFloatsKeep, value: inf, want: "9e999"},
+		{dbType: "sqlite", mode: config.NonFiniteFloatsKeep, value: -inf, want: "-9e999"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsKeep, value: 1.5, want: "1.5"},
+		{dbType: "postgres", mode: config.NonFiniteFloatsKeep, value: float32(0.1), want: "0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s %v", tt.dbType, tt.mode, tt.value), func(t *testing.T) {
+			exp := New(&mockDriver{dbType: tt.dbType}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{NonFiniteFloats: tt.mode})
+			if got := exp.formatValue(tt.value); got != tt.want {
+				t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+			if exp.warnedNonFinite != (tt.want == "NULL") {
+				t.Errorf("warned = %v, want a warning only for values written as NULL", exp.warnedNonFinite)
+			}
+		})
+	}
+}
+
+func TestFormatAs(t *testing.T) {
+	tests := []struct {
+		as       string
+		value    any
+		want     string
+		wantWarn bool
+	}{
+		{as: "", value: int64(42), want: "42"},
+		{as: config.OutputTypeString, value: int64(42), want: "'42'"},
+		{as: config.OutputTypeString, value: -1.5, want: "'-1.5'"},
+		{as: config.OutputTypeString, value: true, want: "'1'"},
+		{as: config.OutputTypeString, value: "it's", want: "'it''s'"},
+		{as: config.OutputTypeString, value: nil, want: "NULL"},
+		{as: config.OutputTypeInt, value: "42", want: "42"},
+		{as: config.OutputTypeInt, value: []byte(" -7 "), want: "-7"},
+		{as: config.OutputTypeInt, value: int64(42), want: "42"},
+		{as: config.OutputTypeInt, value: "4.2", want: "'4.2'", wantWarn: true},
+		{as: config.OutputTypeInt, value: "abc", want: "'abc'", wantWarn: true},
+		{as: config.OutputTypeBool, value: int64(1), want: "TRUE"},
+		{as: config.OutputTypeBool, value: int64(0), want: "FALSE"},
+		{as: config.OutputTypeBool, value: false, want: "FALSE"},
+		{as: config.OutputTypeBool, value: []byte("true"), want: "TRUE"},
+		{as: config.OutputTypeBool, value: "f", want: "FALSE"},
+		{as: config.OutputTypeBool, value: "maybe", want: "'maybe'", wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.as, tt.value), func(t *testing.T) {
+			exp := New(&mockDriver{dbType: "mysql"}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{})
+			if got := exp.formatAs("users", "id", tt.value, exp.formatValue(tt.value), tt.as); got != tt.want {
+				t.Errorf("formatAs(%v, %q) = %q, want %q", tt.value, tt.as, got, tt.want)
+			}
+			if warned := exp.warnedOutputTypes["users.id"]; warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
 func TestEscapeString(t *testing.T) {
 	exp := &Exporter{}
 
@@ -469,7 +671,7 @@ func TestWriteBatchInsert(t *testing.T) {
 		var buf bytes.Buffer
 		exp := &Exporter{
 			driver: driver,
-			writer: bufio.NewWriter(&buf),
+			writer: newSQLWriter(&buf, LineEndingLF),
 		}
 
 		columns := []string{"id", "name"}
@@ -497,7 +699,7 @@ func TestWriteBatchInsert(t *testing.T) {
 		var buf bytes.Buffer
 		exp := &Exporter{
 			driver: driver,
-			writer: bufio.NewWriter(&buf),
+			writer: newSQLWriter(&buf, LineEndingLF),
 		}
 
 		columns := []string{"id", "name"}
@@ -524,7 +726,7 @@ func TestWriteBatchInsert(t *testing.T) {
 		var buf bytes.Buffer
 		exp := &Exporter{
 			driver: driver,
-			writer: bufio.NewWriter(&buf),
+			writer: newSQLWriter(&buf, LineEndingLF),
 		}
 
 		err := exp.writeBatchInsert("users", []string{"id"}, []map[string]any{})
@@ -600,8 +802,8 @@ func TestExport_WithAnonymisation(t *testing.T) {
 	cfg := &config.Config{
 		Configuration: map[string]*config.TableConfig{
 			"users": {
-				Columns: map[string]string{
-					"email": "redacted@example.com",
+				Columns: config.ColumnRuleMap{
+					"email": config.Rule("redacted@example.com"),
 				},
 			},
 		},
@@ -676,3 +878,3344 @@ func TestConstants(t *testing.T) {
 		t.Errorf("BufferSize = %d, want %d", BufferSize, 64*1024)
 	}
 }
+
+func TestExport_TableDurations(t *testing.T) {
+	driver := &mockDriver{
+		columns: map[string][]database.ColumnInfo{
+			"users":  {{Name: "id"}},
+			"orders": {{Name: "id"}},
+		},
+		rows: map[string][]map[string]any{
+			"users":  {{"id": int64(1)}},
+			"orders": {{"id": int64(1)}},
+		},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"orders": {Truncate: true},
+		},
+	}
+	anon := anonymiser.New(cfg)
+	var buf bytes.Buffer
+
+	exp := New(driver, anon, &buf, Options{BatchSize: 10})
+
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{{Name: "id"}}},
+		{Name: "orders", CreateStmt: "CREATE TABLE orders;", Columns: []database.ColumnInfo{{Name: "id"}}},
+	}
+
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	stats := exp.GetStats()
+	if len(stats.TableDurations) != 2 {
+		t.Fatalf("len(TableDurations) = %d, want 2", len(stats.TableDurations))
+	}
+	for _, name := range []string{"users", "orders"} {
+		if _, ok := stats.TableDurations[name]; !ok {
+			t.Errorf("TableDurations missing entry for %s", name)
+		}
+	}
+}
+
+func TestExport_ReuseBuffers(t *testing.T) {
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{
+					"users": {{Name: "id"}, {Name: "email"}},
+				},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1), "email": "john@example.com"},
+						{"id": int64(2), "email": "jane@example.com"},
+						{"id": int64(3), "email": "jim@example.com"},
+					},
+				},
+			},
+		}
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("redacted@example.com")}},
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "email"}}},
+	}
+
+	t.Run("uses columnar streaming when enabled", func(t *testing.T) {
+		driver := newDriver()
+		var buf bytes.Buffer
+
+		exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 2, ReuseBuffers: true})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if driver.columnarCalls != 1 {
+			t.Errorf("StreamRowsColumnar called %d times, want 1", driver.columnarCalls)
+		}
+
+		output := buf.String()
+		if strings.Contains(output, "john@example.com") {
+			t.Error("Output should not contain original email")
+		}
+		if !strings.Contains(output, "(1, 'redacted@example.com')") {
+			t.Errorf("Output missing anonymised row, got:\n%s", output)
+		}
+		if strings.Count(output, "INSERT INTO") != 2 {
+			t.Errorf("expected 2 INSERT statements for batch size 2, got %d", strings.Count(output, "INSERT INTO"))
+		}
+		if exp.GetStats().RowsExported != 3 {
+			t.Errorf("RowsExported = %d, want 3", exp.GetStats().RowsExported)
+		}
+	})
+
+	t.Run("matches map-based output", func(t *testing.T) {
+		var mapBuf, colBuf bytes.Buffer
+
+		if err := New(newDriver(), anonymiser.New(cfg), &mapBuf, Options{BatchSize: 2}).Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if err := New(newDriver(), anonymiser.New(cfg), &colBuf, Options{BatchSize: 2, ReuseBuffers: true}).Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		stripDate := func(s string) string {
+			lines := strings.Split(s, "\n")
+			kept := lines[:0]
+			for _, l := range lines {
+				if !strings.HasPrefix(l, "-- Date:") {
+					kept = append(kept, l)
+				}
+			}
+			return strings.Join(kept, "\n")
+		}
+		if stripDate(mapBuf.String()) != stripDate(colBuf.String()) {
+			t.Errorf("columnar output differs from map output:\n%s\n---\n%s", mapBuf.String(), colBuf.String())
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		driver := newDriver()
+		var buf bytes.Buffer
+
+		if err := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 2}).Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if driver.columnarCalls != 0 {
+			t.Errorf("StreamRowsColumnar called %d times, want 0", driver.columnarCalls)
+		}
+	})
+}
+
+func TestExport_SkipAutoIncrement(t *testing.T) {
+	columns := []database.ColumnInfo{
+		{Name: "id", Extra: "auto_increment"},
+		{Name: "name"},
+	}
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				dbType:  "mysql",
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1), "name": "John"},
+						{"id": int64(2), "name": "Jane"},
+					},
+				},
+			},
+		}
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: columns},
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{
+				BatchSize:         10,
+				ReuseBuffers:      reuse,
+				SkipAutoIncrement: true,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, `INSERT INTO "users" ("name") VALUES`) {
+				t.Errorf("INSERT should omit auto-increment column, got:\n%s", output)
+			}
+			if !strings.Contains(output, "('John'),\n('Jane');") {
+				t.Errorf("values should omit auto-increment column, got:\n%s", output)
+			}
+		})
+	}
+
+	t.Run("kept by default", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !strings.Contains(buf.String(), `("id", "name")`) {
+			t.Error("INSERT should include auto-increment column by default")
+		}
+	})
+}
+
+func TestExport_MaterialiseGenerated(t *testing.T) {
+	columns := []database.ColumnInfo{
+		{Name: "id"},
+		{Name: "first_name"},
+		{Name: "full_name", Extra: "VIRTUAL GENERATED", GenerationExpression: "concat(`first_name`,' x')"},
+	}
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				dbType:  "mysql",
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows: map[string][]map[string]any{
+					"users": {{"id": int64(1), "first_name": "John", "full_name": "John x"}},
+				},
+			},
+		}
+	}
+	tables := []schema.TableInfo{{
+		Name:       "users",
+		CreateStmt: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `first_name` varchar(50),\n  `full_name` varchar(60) GENERATED ALWAYS AS (concat(`first_name`,_utf8mb4' x')) VIRTUAL,\n  PRIMARY KEY (`id`)\n);",
+		Columns:    columns,
+	}}
+
+	t.Run("generated columns left out by default", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, "GENERATED ALWAYS AS") {
+			t.Errorf("CREATE TABLE should keep the GENERATED clause, got:\n%s", output)
+		}
+		if !strings.Contains(output, `INSERT INTO "users" ("id", "first_name") VALUES`) || !strings.Contains(output, "(1, 'John');") {
+			t.Errorf("INSERT should omit the generated column, got:\n%s", output)
+		}
+	})
+
+	for _, reuse := range []bool{false, true} {
+		name := "materialised, map rows"
+		if reuse {
+			name = "materialised, columnar rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{
+				BatchSize:            10,
+				ReuseBuffers:         reuse,
+				MaterialiseGenerated: true,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			output := buf.String()
+			if strings.Contains(output, "GENERATED") || !strings.Contains(output, "`full_name` varchar(60),\n") {
+				t.Errorf("CREATE TABLE should declare full_name as a plain column, got:\n%s", output)
+			}
+			if !strings.Contains(output, `("id", "first_name", "full_name")`) || !strings.Contains(output, "(1, 'John', 'John x');") {
+				t.Errorf("INSERT should include the generated value, got:\n%s", output)
+			}
+		})
+	}
+
+	t.Run("mysqldump-compat lists columns when one is left out", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, MysqldumpCompat: true})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !strings.Contains(buf.String(), `INSERT INTO "users" ("id","first_name") VALUES`) {
+			t.Errorf("INSERT should list the inserted columns, got:\n%s", buf.String())
+		}
+	})
+}
+
+func TestStripGeneratedClauses(t *testing.T) {
+	tests := []struct {
+		name string
+		stmt string
+		want string
+	}{
+		{
+			name: "virtual",
+			stmt: "`full_name` varchar(60) GENERATED ALWAYS AS (concat(`a`,' ',`b`)) VIRTUAL,",
+			want: "`full_name` varchar(60),",
+		},
+		{
+			name: "stored with not null",
+			stmt: "`total` int GENERATED ALWAYS AS ((`qty` * `price`)) STORED NOT NULL,",
+			want: "`total` int NOT NULL,",
+		},
+		{
+			name: "parentheses and quotes in strings",
+			stmt: "`label` text GENERATED ALWAYS AS (concat(`a`,')','it''s','\\'(')) VIRTUAL",
+			want: "`label` text",
+		},
+		{
+			name: "mariadb persistent",
+			stmt: "`total` int AS (`a` + `b`) PERSISTENT,",
+			want: "`total` int,",
+		},
+		{
+			name: "several columns",
+			stmt: "`a` int GENERATED ALWAYS AS (1) VIRTUAL,\n`b` int GENERATED ALWAYS AS (2) STORED",
+			want: "`a` int,\n`b` int",
+		},
+		{
+			name: "no generated columns",
+			stmt: "`id` int NOT NULL",
+			want: "`id` int NOT NULL",
+		},
+		{
+			name: "as in a comment",
+			stmt: "`data` json COMMENT 'kept AS (raw) text',\n`total` int AS (`a` + `b`) VIRTUAL",
+			want: "`data` json COMMENT 'kept AS (raw) text',\n`total` int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripGeneratedClauses(tt.stmt); got != tt.want {
+				t.Errorf("stripGeneratedClauses() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// flakyMockDriver fails its first stream with a retryable error after
+// delivering one batch, then streams normally.
+type flakyMockDriver struct {
+	mockDriver
+	calls    []database.StreamOptions
+	failWith error
+}
+
+func (m *flakyMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	m.calls = append(m.calls, opts)
+
+	var rows []map[string]any
+	for _, row := range m.rows[table] {
+		if opts.AfterKey != nil && row[opts.KeyColumn].(int64) <= opts.AfterKey.(int64) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if opts.Limit > 0 && opts.Limit < len(rows) {
+		rows = rows[:opts.Limit]
+	}
+
+	for i := 0; i < len(rows); i += batchSize {
+		if len(m.calls) == 1 && i > 0 {
+			return m.failWith
+		}
+		end := i + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := callback(rows[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExport_ResumeOnError(t *testing.T) {
+	newDriver := func(failWith error) *flakyMockDriver {
+		rows := make([]map[string]any, 5)
+		for i := range rows {
+			rows[i] = map[string]any{"id": int64(i + 1), "email": "user@example.com"}
+		}
+		return &flakyMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{"users": {{Name: "id"}, {Name: "email"}}},
+				rows:    map[string][]map[string]any{"users": rows},
+			},
+			failWith: failWith,
+		}
+	}
+	tables := []schema.TableInfo{
+		{
+			Name:       "users",
+			CreateStmt: "CREATE TABLE users;",
+			Columns:    []database.ColumnInfo{{Name: "id"}, {Name: "email"}},
+			PrimaryKey: []string{"id"},
+		},
+	}
+
+	t.Run("resumes after last key", func(t *testing.T) {
+		driver := newDriver(errors.New("invalid connection: lost connection to MySQL server during query"))
+		var buf bytes.Buffer
+
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 2, ResumeOnError: true})
+		exp.retryDelay = 0
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if len(driver.calls) != 2 {
+			t.Fatalf("StreamRows called %d times, want 2", len(driver.calls))
+		}
+		if driver.calls[0].KeyColumn != "id" {
+			t.Errorf("KeyColumn = %q, want id", driver.calls[0].KeyColumn)
+		}
+		if driver.calls[1].AfterKey != int64(2) {
+			t.Errorf("resumed AfterKey = %v, want 2", driver.calls[1].AfterKey)
+		}
+
+		if exp.GetStats().RowsExported != 5 {
+			t.Errorf("RowsExported = %d, want 5", exp.GetStats().RowsExported)
+		}
+		output := buf.String()
+		for i := 1; i <= 5; i++ {
+			if n := strings.Count(output, fmt.Sprintf("(%d, ", i)); n != 1 {
+				t.Errorf("row %d written %d times, want 1", i, n)
+			}
+		}
+	})
+
+	t.Run("non-retryable error is returned", func(t *testing.T) {
+		driver := newDriver(errors.New("syntax error"))
+		var buf bytes.Buffer
+
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 2, ResumeOnError: true})
+		exp.retryDelay = 0
+		if err := exp.Export(tables); err == nil {
+			t.Fatal("Export() expected error")
+		}
+		if len(driver.calls) != 1 {
+			t.Errorf("StreamRows called %d times, want 1", len(driver.calls))
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		driver := newDriver(errors.New("lost connection"))
+		var buf bytes.Buffer
+
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 2})
+		if err := exp.Export(tables); err == nil {
+			t.Fatal("Export() expected error")
+		}
+		if driver.calls[0].KeyColumn != "" {
+			t.Errorf("KeyColumn = %q, want empty", driver.calls[0].KeyColumn)
+		}
+	})
+}
+
+func TestKeysetColumn(t *testing.T) {
+	tests := []struct {
+		name  string
+		table schema.TableInfo
+		want  string
+	}{
+		{
+			name: "integer primary key",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "id", DataType: "bigint"}, {Name: "name", DataType: "text"}},
+				PrimaryKey: []string{"id"},
+			},
+			want: "id",
+		},
+		{
+			name: "string primary key",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "code", DataType: "character varying(10)"}},
+				PrimaryKey: []string{"code"},
+			},
+			want: "code",
+		},
+		{
+			name: "composite primary key falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "a", DataType: "int"}, {Name: "b", DataType: "int"}},
+				PrimaryKey: []string{"a", "b"},
+			},
+			want: "",
+		},
+		{
+			name: "no primary key falls back",
+			table: schema.TableInfo{
+				Columns: []database.ColumnInfo{{Name: "id", DataType: "int"}},
+			},
+			want: "",
+		},
+		{
+			name: "geometric primary key falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "p", DataType: "point"}},
+				PrimaryKey: []string{"p"},
+			},
+			want: "",
+		},
+		{
+			name: "binary primary key falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "hash", DataType: "blob"}},
+				PrimaryKey: []string{"hash"},
+			},
+			want: "",
+		},
+		{
+			name: "unsigned integer primary key",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "id", DataType: "INT(10) UNSIGNED"}},
+				PrimaryKey: []string{"id"},
+			},
+			want: "id",
+		},
+		{
+			name: "interval primary key falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "period", DataType: "interval"}},
+				PrimaryKey: []string{"period"},
+			},
+			want: "",
+		},
+		{
+			name: "range primary key falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "span", DataType: "int4range"}},
+				PrimaryKey: []string{"span"},
+			},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keysetColumn(tt.table); got != tt.want {
+				t.Errorf("keysetColumn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		table schema.TableInfo
+		want  []string
+	}{
+		{
+			name: "composite primary key",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "region", DataType: "TEXT"}, {Name: "student", DataType: "INTEGER"}},
+				PrimaryKey: []string{"region", "student"},
+			},
+			want: []string{"region", "student"},
+		},
+		{
+			name: "single-column primary key",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "id", DataType: "int"}},
+				PrimaryKey: []string{"id"},
+			},
+			want: nil,
+		},
+		{
+			name: "binary key column falls back",
+			table: schema.TableInfo{
+				Columns:    []database.ColumnInfo{{Name: "a", DataType: "int"}, {Name: "hash", DataType: "blob"}},
+				PrimaryKey: []string{"a", "hash"},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keysetColumns(tt.table); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keysetColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExport_VerifyFK(t *testing.T) {
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{{Name: "id"}}},
+		{Name: "orders", CreateStmt: "CREATE TABLE orders;", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "user_id"}}},
+	}
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{
+					"users":  tables[0].Columns,
+					"orders": tables[1].Columns,
+				},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1)},
+						{"id": int64(2)},
+						{"id": int64(3)},
+					},
+					"orders": {
+						{"id": int64(10), "user_id": int64(1)},
+						{"id": int64(11), "user_id": int64(3)},
+						{"id": int64(12), "user_id": nil},
+					},
+				},
+				foreignKeys: []database.ForeignKey{
+					{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+				},
+			},
+		}
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name+" without FK filtering reports orphans", func(t *testing.T) {
+			// Retaining users without filtering orders leaves order 11 dangling
+			cfg := &config.Config{
+				Configuration: map[string]*config.TableConfig{
+					"users": {Retain: config.RetainConfig{Count: 1}},
+				},
+			}
+			exp := New(newDriver(), anonymiser.New(cfg), &bytes.Buffer{}, Options{
+				BatchSize:    10,
+				ReuseBuffers: reuse,
+				VerifyFK:     true,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			orphans := exp.GetStats().Orphans
+			if len(orphans) != 1 {
+				t.Fatalf("expected 1 orphan, got %v", orphans)
+			}
+			if got := orphans[0].String(); got != "orders.user_id = 3 -> users.id" {
+				t.Errorf("orphan = %q", got)
+			}
+		})
+
+		t.Run(name+" full export has no orphans", func(t *testing.T) {
+			exp := New(newDriver(), anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{
+				BatchSize:    10,
+				ReuseBuffers: reuse,
+				VerifyFK:     true,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if orphans := exp.GetStats().Orphans; len(orphans) != 0 {
+				t.Errorf("expected no orphans, got %v", orphans)
+			}
+		})
+	}
+
+	t.Run("not tracked by default", func(t *testing.T) {
+		cfg := &config.Config{
+			Configuration: map[string]*config.TableConfig{
+				"users": {Retain: config.RetainConfig{Count: 1}},
+			},
+		}
+		exp := New(newDriver(), anonymiser.New(cfg), &bytes.Buffer{}, Options{BatchSize: 10})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if orphans := exp.GetStats().Orphans; orphans != nil {
+			t.Errorf("expected no verification, got %v", orphans)
+		}
+	})
+}
+
+func TestExport_FKManifest(t *testing.T) {
+	users := schema.TableInfo{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{{Name: "id"}}}
+	orders := schema.TableInfo{Name: "orders", CreateStmt: "CREATE TABLE orders;", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "user_id"}}}
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{
+					"users":  users.Columns,
+					"orders": orders.Columns,
+				},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1)},
+						{"id": int64(2)},
+						{"id": int64(3)},
+					},
+					"orders": {
+						{"id": int64(10), "user_id": int64(1)},
+						{"id": int64(11), "user_id": int64(3)},
+						{"id": int64(12), "user_id": nil},
+					},
+				},
+				foreignKeys: []database.ForeignKey{
+					{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+				},
+			},
+		}
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			manifest := filepath.Join(t.TempDir(), "manifest.json")
+
+			// The first dump holds users 1 and 2 only
+			cfg := &config.Config{
+				Configuration: map[string]*config.TableConfig{
+					"users": {Retain: config.RetainConfig{Count: 2}},
+				},
+			}
+			first := New(newDriver(), anonymiser.New(cfg), &bytes.Buffer{}, Options{
+				BatchSize:       10,
+				ReuseBuffers:    reuse,
+				WriteFKManifest: manifest,
+			})
+			if err := first.Export([]schema.TableInfo{users}); err != nil {
+				t.Fatalf("first Export() error = %v", err)
+			}
+
+			// The second dump of orders drops the order for user 3
+			var buf bytes.Buffer
+			second := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{
+				BatchSize:    10,
+				ReuseBuffers: reuse,
+				FKManifest:   manifest,
+				VerifyFK:     true,
+			})
+			if err := second.Export([]schema.TableInfo{orders}); err != nil {
+				t.Fatalf("second Export() error = %v", err)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, "(10,") || !strings.Contains(output, "(12,") {
+				t.Errorf("expected orders 10 and 12 in output:\n%s", output)
+			}
+			if strings.Contains(output, "(11,") {
+				t.Errorf("expected order 11 to be filtered from output:\n%s", output)
+			}
+
+			stats := second.GetStats()
+			if stats.RowsFiltered != 1 || stats.RowsExported != 2 {
+				t.Errorf("RowsFiltered = %d, RowsExported = %d, want 1 and 2", stats.RowsFiltered, stats.RowsExported)
+			}
+			if len(stats.Orphans) != 0 {
+				t.Errorf("expected no orphans, got %v", stats.Orphans)
+			}
+		})
+	}
+
+	t.Run("every row filtered writes no INSERT", func(t *testing.T) {
+		manifest := filepath.Join(t.TempDir(), "manifest.json")
+		if err := os.WriteFile(manifest, []byte(`{"parents": {"users.id": ["7"]}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		driver := newDriver()
+		driver.rows["orders"] = driver.rows["orders"][:2]
+		var buf bytes.Buffer
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, FKManifest: manifest})
+		if err := exp.Export([]schema.TableInfo{orders}); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if strings.Contains(buf.String(), "INSERT INTO") {
+			t.Errorf("expected no INSERT, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("child before its parent", func(t *testing.T) {
+		manifest := filepath.Join(t.TempDir(), "manifest.json")
+		if err := os.WriteFile(manifest, []byte(`{"parents": {"users.id": ["1"]}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, FKManifest: manifest})
+		err := exp.Export([]schema.TableInfo{orders, users})
+		if err == nil || !strings.Contains(err.Error(), "orders references users") {
+			t.Errorf("Export() error = %v, want an error about the table order", err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("expected no output, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("missing manifest", func(t *testing.T) {
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{
+			FKManifest: filepath.Join(t.TempDir(), "missing.json"),
+		})
+		if err := exp.Export([]schema.TableInfo{orders}); err == nil {
+			t.Error("Export() expected error, got nil")
+		}
+	})
+}
+
+// failingTablesMockDriver fails to stream the listed tables.
+type failingTablesMockDriver struct {
+	mockDriver
+	failTables map[string]bool
+}
+
+func (m *failingTablesMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	if m.failTables[table] {
+		return fmt.Errorf("table %s is corrupt", table)
+	}
+	return m.mockDriver.StreamRows(table, opts, batchSize, callback)
+}
+
+func TestExport_TableErrors(t *testing.T) {
+	newDriver := func() *failingTablesMockDriver {
+		return &failingTablesMockDriver{
+			mockDriver: mockDriver{
+				rows: map[string][]map[string]any{
+					"users":    {{"id": int64(1)}},
+					"orders":   {{"id": int64(2)}},
+					"products": {{"id": int64(3)}},
+					"reviews":  {{"id": int64(4)}},
+				},
+			},
+			failTables: map[string]bool{"orders": true, "reviews": true},
+		}
+	}
+	var tables []schema.TableInfo
+	for _, name := range []string{"users", "orders", "products", "reviews"} {
+		tables = append(tables, schema.TableInfo{
+			Name:       name,
+			CreateStmt: "CREATE TABLE " + name + ";",
+			Columns:    []database.ColumnInfo{{Name: "id"}},
+		})
+	}
+
+	t.Run("aborts on first error by default", func(t *testing.T) {
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{BatchSize: 10})
+		err := exp.Export(tables)
+		if err == nil || !strings.Contains(err.Error(), "orders") {
+			t.Fatalf("Export() error = %v, want orders failure", err)
+		}
+	})
+
+	t.Run("aborts once max errors exceeded", func(t *testing.T) {
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{BatchSize: 10, MaxErrors: 1})
+		err := exp.Export(tables)
+		if err == nil || !strings.Contains(err.Error(), "reviews") {
+			t.Fatalf("Export() error = %v, want reviews failure", err)
+		}
+		if got := len(exp.GetStats().TableErrors); got != 1 {
+			t.Errorf("TableErrors = %d, want 1", got)
+		}
+	})
+
+	for _, opts := range []Options{
+		{BatchSize: 10, MaxErrors: 2},
+		{BatchSize: 10, ContinueOnError: true},
+	} {
+		name := "within max errors"
+		if opts.ContinueOnError {
+			name = "continue on error"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			stats := exp.GetStats()
+			if len(stats.TableErrors) != 2 {
+				t.Fatalf("TableErrors = %v, want 2", stats.TableErrors)
+			}
+			if stats.TableErrors[0].Table != "orders" || stats.TableErrors[1].Table != "reviews" {
+				t.Errorf("TableErrors = %v, want orders and reviews", stats.TableErrors)
+			}
+
+			output := buf.String()
+			for _, want := range []string{
+				`INSERT INTO "users"`,
+				`INSERT INTO "products"`,
+				"-- Export of table orders failed: table orders is corrupt",
+				"-- Export of table reviews failed: table reviews is corrupt",
+				"PRAGMA foreign_keys = ON;",
+			} {
+				if !strings.Contains(output, want) {
+					t.Errorf("output missing %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestExport_RowsLimitTotal(t *testing.T) {
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{
+					"users":  {{Name: "id"}},
+					"orders": {{Name: "id"}},
+				},
+				rows: map[string][]map[string]any{
+					"users":  {{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}},
+					"orders": {{"id": int64(4)}, {"id": int64(5)}, {"id": int64(6)}},
+				},
+			},
+		}
+	}
+	var tables []schema.TableInfo
+	for _, name := range []string{"users", "orders"} {
+		tables = append(tables, schema.TableInfo{
+			Name:       name,
+			CreateStmt: "CREATE TABLE " + name + ";",
+			Columns:    []database.ColumnInfo{{Name: "id"}},
+		})
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name+" stops at the cap", func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{
+				BatchSize:       1,
+				ReuseBuffers:    reuse,
+				RowsLimitTotal:  4,
+				ContinueOnError: true,
+			})
+			err := exp.Export(tables)
+			if !errors.Is(err, ErrRowsLimit) {
+				t.Fatalf("Export() error = %v, want ErrRowsLimit", err)
+			}
+
+			if got := exp.GetStats().RowsExported; got != 4 {
+				t.Errorf("RowsExported = %d, want 4", got)
+			}
+			if strings.Contains(buf.String(), "(5)") {
+				t.Errorf("output should stop at the cap, got:\n%s", buf.String())
+			}
+		})
+	}
+
+	t.Run("under the cap", func(t *testing.T) {
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{BatchSize: 10, RowsLimitTotal: 6})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+	})
+
+	// Six rows are read, but the two oversized ones are not written
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name+" skipped rows are not counted", func(t *testing.T) {
+			driver := newDriver()
+			driver.rows["users"][1]["id"] = strings.Repeat("x", 100)
+			driver.rows["orders"][1]["id"] = strings.Repeat("x", 100)
+
+			exp := New(driver, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{
+				BatchSize:      1,
+				ReuseBuffers:   reuse,
+				RowsLimitTotal: 4,
+				MaxRowSize:     50,
+				OversizedRows:  OversizedSkip,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+		})
+
+		// Rows 1, 3 and 4 are written, 2 is skipped and 5 goes past the cap
+		t.Run(name+" skipped rows are not counted at the cap", func(t *testing.T) {
+			driver := newDriver()
+			driver.rows["users"][1]["id"] = strings.Repeat("x", 100)
+
+			exp := New(driver, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{
+				BatchSize:      1,
+				ReuseBuffers:   reuse,
+				RowsLimitTotal: 3,
+				MaxRowSize:     50,
+				OversizedRows:  OversizedSkip,
+			})
+			if err := exp.Export(tables); !errors.Is(err, ErrRowsLimit) {
+				t.Fatalf("Export() error = %v, want ErrRowsLimit", err)
+			}
+
+			stats := exp.GetStats()
+			if stats.RowsSkipped != 1 || stats.RowsExported != 3 {
+				t.Errorf("RowsSkipped = %d, RowsExported = %d, want 1 and 3", stats.RowsSkipped, stats.RowsExported)
+			}
+		})
+	}
+}
+
+func TestExport_MysqldumpCompat(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id", Extra: "auto_increment"}, {Name: "name"}}
+	newDriver := func(dbType string) *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				dbType:  dbType,
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1), "name": "John"},
+						{"id": int64(2), "name": "O'Brien"},
+					},
+				},
+			},
+		}
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int, name text);", Columns: columns},
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver("mysql"), anonymiser.New(&config.Config{}), &buf, Options{
+				BatchSize:       10,
+				ReuseBuffers:    reuse,
+				MysqldumpCompat: true,
+			})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			output := buf.String()
+			for _, want := range []string{
+				"-- MySQL dump 10.13",
+				"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;",
+				"/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;",
+				`-- Table structure for table "users"`,
+				"/*!40101 SET @saved_cs_client     = @@character_set_client */;",
+				`-- Dumping data for table "users"`,
+				`LOCK TABLES "users" WRITE;`,
+				`/*!40000 ALTER TABLE "users" DISABLE KEYS */;`,
+				`INSERT INTO "users" VALUES (1,'John'),(2,'O''Brien');`,
+				`/*!40000 ALTER TABLE "users" ENABLE KEYS */;`,
+				"UNLOCK TABLES;",
+				"/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;",
+				"-- Dump completed on ",
+			} {
+				if !strings.Contains(output, want) {
+					t.Errorf("output missing %q, got:\n%s", want, output)
+				}
+			}
+			if strings.Contains(output, "START TRANSACTION") {
+				t.Error("mysqldump output should not use the default header")
+			}
+		})
+	}
+
+	t.Run("column list kept when skipping auto-increment", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver("mysql"), anonymiser.New(&config.Config{}), &buf, Options{
+			BatchSize:         10,
+			MysqldumpCompat:   true,
+			SkipAutoIncrement: true,
+		})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if !strings.Contains(buf.String(), `INSERT INTO "users" ("name") VALUES ('John'),('O''Brien');`) {
+			t.Errorf("unexpected INSERT, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("ignored for other databases", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver("postgres"), anonymiser.New(&config.Config{}), &buf, Options{
+			BatchSize:       10,
+			MysqldumpCompat: true,
+		})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if strings.Contains(buf.String(), "LOCK TABLES") || strings.Contains(buf.String(), "/*!40101") {
+			t.Errorf("postgres output should not contain mysqldump markers, got:\n%s", buf.String())
+		}
+	})
+}
+
+func TestExport_SchemaOnly(t *testing.T) {
+	driver := &mockDriver{
+		rows: map[string][]map[string]any{
+			"users": {{"id": int64(1)}, {"id": int64(2)}},
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int);", Columns: []database.ColumnInfo{{Name: "id"}}},
+	}
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, SchemaOnly: true})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "CREATE TABLE users (id int);") {
+		t.Error("schema-only export should include CREATE TABLE")
+	}
+	if strings.Contains(output, "INSERT") {
+		t.Errorf("schema-only export should not include INSERTs, got:\n%s", output)
+	}
+	if stats := exp.GetStats(); stats.RowsExported != 0 {
+		t.Errorf("RowsExported = %d, want 0", stats.RowsExported)
+	}
+}
+
+// recordingMockDriver records the stream options used for each table.
+type recordingMockDriver struct {
+	mockDriver
+	opts map[string]database.StreamOptions
+}
+
+func (m *recordingMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	m.opts[table] = opts
+	return m.mockDriver.StreamRows(table, opts, batchSize, callback)
+}
+
+func TestExport_Refresh(t *testing.T) {
+	tests := []struct {
+		dbType   string
+		compat   bool
+		truncate string
+	}{
+		{dbType: "mysql", truncate: `TRUNCATE TABLE "users";`},
+		{dbType: "mysql", compat: true, truncate: `TRUNCATE TABLE "users";`},
+		{dbType: "postgres", truncate: `TRUNCATE TABLE "users" CASCADE;`},
+		{dbType: "sqlite", truncate: `DELETE FROM "users";`},
+	}
+
+	for _, tt := range tests {
+		name := tt.dbType
+		if tt.compat {
+			name += " mysqldump-compat"
+		}
+		t.Run(name, func(t *testing.T) {
+			driver := &mockDriver{
+				dbType: tt.dbType,
+				rows: map[string][]map[string]any{
+					"users": {{"id": int64(1)}, {"id": int64(2)}},
+				},
+			}
+			tables := []schema.TableInfo{
+				{Name: "users", CreateStmt: "CREATE TABLE users (id int);", Columns: []database.ColumnInfo{{Name: "id"}}},
+				{Name: "sessions", CreateStmt: "CREATE TABLE sessions (id int);", Columns: []database.ColumnInfo{{Name: "id"}}},
+			}
+			cfg := &config.Config{Configuration: map[string]*config.TableConfig{"sessions": {Truncate: true}}}
+
+			var buf bytes.Buffer
+			exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10, Refresh: true, MysqldumpCompat: tt.compat})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, tt.truncate) {
+				t.Errorf("refresh export should include %s, got:\n%s", tt.truncate, output)
+			}
+			if strings.Contains(output, "CREATE TABLE") || strings.Contains(output, "DROP TABLE") {
+				t.Errorf("refresh export should not drop or create tables, got:\n%s", output)
+			}
+			if strings.Index(output, tt.truncate) > strings.Index(output, "INSERT") {
+				t.Error("table should be emptied before its rows are inserted")
+			}
+			if !strings.Contains(output, strings.Replace(tt.truncate, "users", "sessions", 1)) {
+				t.Error("truncate: true tables should be emptied in refresh mode")
+			}
+		})
+	}
+}
+
+func TestExport_RefreshOrder(t *testing.T) {
+	users := schema.TableInfo{Name: "users", CreateStmt: "CREATE TABLE users (id int);", Columns: []database.ColumnInfo{{Name: "id"}}}
+	orders := schema.TableInfo{Name: "orders", CreateStmt: "CREATE TABLE orders (id int, user_id int);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "user_id"}}}
+	fks := []database.ForeignKey{{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"}}
+
+	tests := []struct {
+		name    string
+		dbType  string
+		tables  []schema.TableInfo
+		wantErr bool
+	}{
+		{name: "postgres in dependency order", dbType: "postgres", tables: []schema.TableInfo{users, orders}},
+		{name: "postgres child first", dbType: "postgres", tables: []schema.TableInfo{orders, users}, wantErr: true},
+		{name: "mysql child first", dbType: "mysql", tables: []schema.TableInfo{orders, users}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &mockDriver{dbType: tt.dbType, foreignKeys: fks}
+			exp := New(driver, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{BatchSize: 10, Refresh: true})
+			if err := exp.Export(tt.tables); (err != nil) != tt.wantErr {
+				t.Errorf("Export() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// sequenceMockDriver adds database.SequenceLister support to mockDriver
+type sequenceMockDriver struct {
+	mockDriver
+	sequences []database.Sequence
+}
+
+func (m *sequenceMockDriver) GetSequences() ([]database.Sequence, error) {
+	return m.sequences, nil
+}
+
+func TestExport_DumpSequences(t *testing.T) {
+	newDriver := func() *sequenceMockDriver {
+		return &sequenceMockDriver{
+			mockDriver: mockDriver{
+				dbType: "postgres",
+				rows:   map[string][]map[string]any{"invoices": {{"number": int64(1042)}}},
+			},
+			sequences: []database.Sequence{{
+				Name:      "invoice_number_seq",
+				DataType:  "integer",
+				Start:     1000,
+				Increment: 1,
+				MinValue:  1,
+				MaxValue:  2147483647,
+				LastValue: sql.NullInt64{Int64: 1042, Valid: true},
+			}},
+		}
+	}
+	tables := []schema.TableInfo{{
+		Name:       "invoices",
+		CreateStmt: "CREATE TABLE invoices (number integer DEFAULT nextval('invoice_number_seq'::regclass));",
+		Columns:    []database.ColumnInfo{{Name: "number"}},
+	}}
+	create := `CREATE SEQUENCE IF NOT EXISTS "invoice_number_seq" AS integer START WITH 1000 INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 NO CYCLE;`
+	setval := `SELECT setval('"invoice_number_seq"', 1042, true);`
+
+	t.Run("created before tables", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, DumpSequences: true})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, create) || !strings.Contains(output, setval) {
+			t.Fatalf("output missing sequence statements:\n%s", output)
+		}
+		if strings.Index(output, create) > strings.Index(output, "CREATE TABLE invoices") {
+			t.Error("sequence should be created before the table that uses it")
+		}
+	})
+
+	t.Run("schema only has no setval", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, DumpSequences: true, SchemaOnly: true})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, create) {
+			t.Errorf("schema-only output missing CREATE SEQUENCE:\n%s", output)
+		}
+		if strings.Contains(output, "setval") {
+			t.Errorf("schema-only output should not set sequence values:\n%s", output)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(newDriver(), anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if strings.Contains(buf.String(), "CREATE SEQUENCE") {
+			t.Error("sequences should not be exported unless DumpSequences is set")
+		}
+	})
+}
+
+// enumMockDriver adds database.EnumLister support to mockDriver
+type enumMockDriver struct {
+	mockDriver
+	enums map[string][]database.EnumType
+}
+
+func (m *enumMockDriver) GetEnumTypes(table string) ([]database.EnumType, error) {
+	return m.enums[table], nil
+}
+
+func TestExport_EnumTypes(t *testing.T) {
+	status := database.EnumType{Name: "order_status", Values: []string{"pending", "shipped", "customer's choice"}}
+	driver := &enumMockDriver{
+		mockDriver: mockDriver{dbType: "postgres", rows: map[string][]map[string]any{}},
+		enums: map[string][]database.EnumType{
+			"orders":  {status},
+			"returns": {status},
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id integer);"},
+		{Name: "orders", CreateStmt: "CREATE TABLE orders (status order_status);"},
+		{Name: "returns", CreateStmt: "CREATE TABLE returns (status order_status);"},
+	}
+
+	t.Run("created before the table", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		output := buf.String()
+		create := `CREATE TYPE "order_status" AS ENUM ('pending', 'shipped', 'customer''s choice');`
+		if strings.Count(output, create) != 1 {
+			t.Fatalf("output should create order_status once:\n%s", output)
+		}
+		if strings.Index(output, create) > strings.Index(output, "CREATE TABLE orders") {
+			t.Error("enum type should be created before the table that uses it")
+		}
+		if strings.Index(output, create) < strings.Index(output, "CREATE TABLE users") {
+			t.Error("enum type should not be created before unrelated tables")
+		}
+		if !strings.Contains(output, "WHEN duplicate_object THEN NULL;") {
+			t.Error("enum type creation should tolerate an existing type")
+		}
+	})
+
+	t.Run("refresh keeps existing types", func(t *testing.T) {
+		var buf bytes.Buffer
+		exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, Refresh: true})
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if strings.Contains(buf.String(), "CREATE TYPE") {
+			t.Error("refresh should not create enum types")
+		}
+	})
+}
+
+func TestExport_FromDate(t *testing.T) {
+	driver := &recordingMockDriver{
+		mockDriver: mockDriver{rows: map[string][]map[string]any{}},
+		opts:       map[string]database.StreamOptions{},
+	}
+	tables := []schema.TableInfo{
+		{Name: "orders", CreateStmt: "CREATE TABLE orders (id int);"},
+		{Name: "logs", CreateStmt: "CREATE TABLE logs (id int);"},
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int);"},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"orders": {Retain: config.RetainConfig{ColumnName: "created_at", AfterDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			"logs":   {Retain: config.RetainConfig{Count: 100}},
+		},
+	}
+	fromDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10, FromDate: fromDate})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	if got := driver.opts["orders"]; got.ColumnName != "created_at" || !got.AfterDate.Equal(fromDate) {
+		t.Errorf("orders options = %+v, want created_at > %v", got, fromDate)
+	}
+	if got := driver.opts["logs"]; !got.AfterDate.IsZero() || got.Limit != 100 {
+		t.Errorf("logs options = %+v, want limit 100 without date", got)
+	}
+	if got := driver.opts["users"]; !got.AfterDate.IsZero() || got.ColumnName != "" {
+		t.Errorf("users options = %+v, want no date filter", got)
+	}
+	if cfg.Configuration["orders"].Retain.AfterDate.Year() != 2020 {
+		t.Error("FromDate should not modify the config")
+	}
+}
+
+func TestExport_Since(t *testing.T) {
+	lastRun := time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC)
+	tables := []schema.TableInfo{
+		{Name: "orders", CreateStmt: "CREATE TABLE orders (id int);"},
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int);"},
+		{Name: "countries", CreateStmt: "CREATE TABLE countries (id int);"},
+	}
+
+	tests := []struct {
+		name       string
+		orders     *config.TableConfig
+		since      time.Time
+		wantColumn string
+		wantAfter  time.Time
+		wantErr    bool
+	}{
+		{
+			name:       "rows changed since the last run",
+			orders:     &config.TableConfig{UpdatedColumn: "updated_at"},
+			since:      lastRun,
+			wantColumn: "updated_at",
+			wantAfter:  lastRun,
+		},
+		{
+			name:   "first run exports every row",
+			orders: &config.TableConfig{UpdatedColumn: "updated_at"},
+		},
+		{
+			name:       "count retain still applies",
+			orders:     &config.TableConfig{UpdatedColumn: "updated_at", Retain: config.RetainConfig{Count: 50}},
+			since:      lastRun,
+			wantColumn: "updated_at",
+			wantAfter:  lastRun,
+		},
+		{
+			name:       "later retain date on the same column is kept",
+			orders:     &config.TableConfig{UpdatedColumn: "updated_at", Retain: config.RetainConfig{ColumnName: "updated_at", AfterDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			since:      lastRun,
+			wantColumn: "updated_at",
+			wantAfter:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "earlier retain date on the same column is replaced",
+			orders:     &config.TableConfig{UpdatedColumn: "updated_at", Retain: config.RetainConfig{ColumnName: "updated_at", AfterDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			since:      lastRun,
+			wantColumn: "updated_at",
+			wantAfter:  lastRun,
+		},
+		{
+			name:    "retain date on another column",
+			orders:  &config.TableConfig{UpdatedColumn: "updated_at", Retain: config.RetainConfig{ColumnName: "created_at", AfterDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			since:   lastRun,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &recordingMockDriver{
+				mockDriver: mockDriver{rows: map[string][]map[string]any{}},
+				opts:       map[string]database.StreamOptions{},
+			}
+			cfg := &config.Config{
+				Configuration: map[string]*config.TableConfig{
+					"orders": tt.orders,
+					"users":  {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+				},
+			}
+
+			exp := New(driver, anonymiser.New(cfg), &bytes.Buffer{}, Options{BatchSize: 10, Since: tt.since})
+			err := exp.Export(tables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Export() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := driver.opts["orders"]; got.ColumnName != tt.wantColumn || !got.AfterDate.Equal(tt.wantAfter) {
+				t.Errorf("orders options = %+v, want %s > %v", got, tt.wantColumn, tt.wantAfter)
+			}
+			if got := driver.opts["orders"]; got.Limit != tt.orders.Retain.Count {
+				t.Errorf("orders limit = %d, want %d", got.Limit, tt.orders.Retain.Count)
+			}
+			for _, name := range []string{"users", "countries"} {
+				if got := driver.opts[name]; got.ColumnName != "" || !got.AfterDate.IsZero() {
+					t.Errorf("%s options = %+v, want every row of a table without an updated_column", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExport_ArrayColumns(t *testing.T) {
+	driver := &mockDriver{
+		dbType: "postgres",
+		rows: map[string][]map[string]any{
+			"users": {{"id": int64(1), "emails": "{a@example.com,b@example.com}"}},
+		},
+	}
+	tables := []schema.TableInfo{
+		{
+			Name:       "users",
+			CreateStmt: "CREATE TABLE users (id int, emails text[]);",
+			Columns:    []database.ColumnInfo{{Name: "id", DataType: "integer"}, {Name: "emails", DataType: "text[]"}},
+		},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"emails": config.Rule("{{faker.email}}")}},
+		},
+	}
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "a@example.com") || strings.Contains(output, "b@example.com") {
+		t.Errorf("array elements should be anonymised, got:\n%s", output)
+	}
+	if !strings.Contains(output, "'{") {
+		t.Errorf("array value should be exported as an array literal, got:\n%s", output)
+	}
+}
+
+func TestExport_ParallelBatches(t *testing.T) {
+	rows := make([]map[string]any, 250)
+	for i := range rows {
+		rows[i] = map[string]any{"id": int64(i + 1), "email": fmt.Sprintf("user%d@example.com", i+1)}
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int, email text);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "email"}}},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("redacted@example.com")}},
+		},
+	}
+
+	export := func(opts Options) string {
+		driver := &mockDriver{rows: map[string][]map[string]any{"users": rows}}
+		var buf bytes.Buffer
+		opts.BatchSize = 7
+		exp := New(driver, anonymiser.New(cfg), &buf, opts)
+		if err := exp.Export(tables); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if stats := exp.GetStats(); stats.RowsExported != 250 {
+			t.Errorf("RowsExported = %d, want 250", stats.RowsExported)
+		}
+		// The header's date may differ between runs
+		return regexp.MustCompile(`(?m)^-- Date: .*$`).ReplaceAllString(buf.String(), "")
+	}
+
+	serial := export(Options{})
+	for _, opts := range []Options{
+		{ParallelBatches: 1},
+		{ParallelBatches: 4},
+		{ReadThreads: 3},
+		{WriteThreads: 4},
+		{ReadThreads: 2, WriteThreads: 8},
+	} {
+		if parallel := export(opts); parallel != serial {
+			t.Errorf("output with %+v differs from serial output", opts)
+		}
+	}
+}
+
+func TestBatchPipeline(t *testing.T) {
+	format := func(batch []map[string]any) string {
+		return fmt.Sprint(batch[0]["id"])
+	}
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("preserves order with %d workers", workers), func(t *testing.T) {
+			var written []string
+			p := newBatchPipeline(2, workers, func(batch []map[string]any) string {
+				// Later batches format faster, so workers finish out of order
+				time.Sleep(time.Duration(20-batch[0]["id"].(int)) * 50 * time.Microsecond)
+				return format(batch)
+			}, func(stmt string) error {
+				written = append(written, stmt)
+				return nil
+			})
+			for i := 0; i < 20; i++ {
+				if err := p.send([]map[string]any{{"id": i}}); err != nil {
+					t.Fatalf("send() error = %v", err)
+				}
+			}
+			if err := p.close(); err != nil {
+				t.Fatalf("close() error = %v", err)
+			}
+
+			if len(written) != 20 {
+				t.Fatalf("wrote %d batches, want 20", len(written))
+			}
+			for i, stmt := range written {
+				if stmt != fmt.Sprint(i) {
+					t.Fatalf("batch %d is %q, want %d", i, stmt, i)
+				}
+			}
+		})
+	}
+
+	t.Run("returns write error", func(t *testing.T) {
+		writeErr := errors.New("disk full")
+		p := newBatchPipeline(1, 2, format, func(stmt string) error {
+			return writeErr
+		})
+
+		// Sends stop succeeding once the writer has failed
+		var sendErr error
+		for i := 0; i < 100 && sendErr == nil; i++ {
+			sendErr = p.send([]map[string]any{{"id": i}})
+		}
+		if !errors.Is(sendErr, writeErr) {
+			t.Errorf("send() error = %v, want %v", sendErr, writeErr)
+		}
+		if err := p.close(); !errors.Is(err, writeErr) {
+			t.Errorf("close() error = %v, want %v", err, writeErr)
+		}
+	})
+}
+
+func TestClampThreads(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want int
+	}{
+		{name: "unset defaults to serial", n: 0, want: 1},
+		{name: "negative", n: -3, want: 1},
+		{name: "one", n: 1, want: 1},
+		{name: "within bounds", n: 8, want: 8},
+		{name: "maximum", n: MaxThreads, want: MaxThreads},
+		{name: "above maximum", n: MaxThreads + 1, want: MaxThreads},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClampThreads(tt.n); got != tt.want {
+				t.Errorf("ClampThreads(%d) = %d, want %d", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+// slowMockDriver simulates database latency for each batch it streams.
+type slowMockDriver struct {
+	mockDriver
+	delay time.Duration
+}
+
+func (m *slowMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	rows := m.rows[table]
+	for i := 0; i < len(rows); i += batchSize {
+		time.Sleep(m.delay)
+		end := min(i+batchSize, len(rows))
+		if err := callback(rows[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slowWriter simulates output latency for each KiB written.
+type slowWriter struct {
+	delayPerKiB time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delayPerKiB * time.Duration(len(p)/1024))
+	return len(p), nil
+}
+
+func benchmarkExport(b *testing.B, parallelBatches int) {
+	rows := make([]map[string]any, 2000)
+	for i := range rows {
+		rows[i] = map[string]any{"id": int64(i + 1), "name": strings.Repeat("x", 1000)}
+	}
+	driver := &slowMockDriver{mockDriver: mockDriver{rows: map[string][]map[string]any{"items": rows}}, delay: time.Millisecond}
+	tables := []schema.TableInfo{
+		{Name: "items", CreateStmt: "CREATE TABLE items (id int, name text);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "name"}}},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		exp := New(driver, anonymiser.New(&config.Config{}), slowWriter{delayPerKiB: 10 * time.Microsecond}, Options{BatchSize: 100, ParallelBatches: parallelBatches})
+		if err := exp.Export(tables); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExport_Serial(b *testing.B) {
+	benchmarkExport(b, 0)
+}
+
+func BenchmarkExport_ParallelBatches(b *testing.B) {
+	benchmarkExport(b, 4)
+}
+
+// benchRows is the number of rows in each table of the synthetic dataset
+// exported by BenchmarkExport_SQLite, e.g.
+// go test -bench SQLite -benchrows 100000 ./internal/exporter
+var benchRows = flag.Int("benchrows", 10000, "rows in each table of the synthetic benchmark dataset")
+
+// benchmarkSQLiteTables creates an in-memory SQLite database of users and
+// their orders, benchRows of each, and returns a driver connected to it and
+// its tables in dependency order. The database lasts until the benchmark ends.
+func benchmarkSQLiteTables(b *testing.B) (database.Driver, []schema.TableInfo) {
+	b.Helper()
+
+	// A shared cache lets the driver's connections see the data written here
+	dsn := "file:dbmask_benchmark?mode=memory&cache=shared"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		b.Fatalf("failed to open benchmark database: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT, phone TEXT, created_at TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id), total REAL, note TEXT)`,
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+			INSERT INTO users (name, email, phone, created_at)
+			SELECT 'User ' || i, 'user' || i || '@example.com', '0113 496 ' || (i % 10000), datetime('2024-01-01', '+' || i || ' minutes') FROM n`,
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+			INSERT INTO orders (user_id, total, note) SELECT (i * 7) % ? + 1, i * 1.25, 'Deliver to the back door of ' || i FROM n`,
+	} {
+		args := []any{*benchRows, *benchRows}[:strings.Count(stmt, "?")]
+		if _, err := db.Exec(stmt, args...); err != nil {
+			b.Fatalf("failed to create benchmark dataset: %v", err)
+		}
+	}
+
+	driver, err := database.NewDriver("sqlite")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := driver.Connect(&config.Connection{Type: "sqlite", File: dsn}); err != nil {
+		b.Fatalf("failed to connect to benchmark database: %v", err)
+	}
+	b.Cleanup(func() { driver.Close() })
+
+	analyser := schema.NewAnalyser(driver)
+	tables, err := analyser.GetAllTables()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if tables, err = analyser.SortTablesByDependency(tables); err != nil {
+		b.Fatal(err)
+	}
+	return driver, tables
+}
+
+// BenchmarkExport_SQLite runs full anonymising exports of a synthetic
+// dataset, reporting rows exported per second and allocations, as a baseline
+// for the concurrency options.
+func BenchmarkExport_SQLite(b *testing.B) {
+	driver, tables := benchmarkSQLiteTables(b)
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{
+				"name":  config.Rule("{{faker.name}}"),
+				"email": config.Rule("{{faker.email}}"),
+				"phone": config.Rule("{{faker.phone}}"),
+			}},
+			"orders": {Columns: config.ColumnRuleMap{"note": config.Rule("null")}},
+		},
+	}
+
+	for _, bm := range []struct {
+		name string
+		opts Options
+	}{
+		{name: "serial", opts: Options{}},
+		{name: "parallel-batches", opts: Options{ParallelBatches: 4}},
+		{name: "write-threads", opts: Options{WriteThreads: 4}},
+		{name: "read-threads", opts: Options{ReadThreads: 2, WriteThreads: 4}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			var rows int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				opts := bm.opts
+				opts.BatchSize = 1000
+				exp := New(driver, anonymiser.New(cfg), io.Discard, opts)
+				if err := exp.Export(tables); err != nil {
+					b.Fatal(err)
+				}
+				rows += exp.GetStats().RowsExported
+			}
+			b.ReportMetric(float64(rows)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
+
+// waitingMockDriver calls wait before streaming each batch of a table's rows.
+type waitingMockDriver struct {
+	mockDriver
+	wait func(table string, batch int) error
+}
+
+func (m *waitingMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	rows := m.rows[table]
+	for i := 0; i < len(rows); i += batchSize {
+		if err := m.wait(table, i/batchSize); err != nil {
+			return err
+		}
+		if err := callback(rows[i:min(i+batchSize, len(rows))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExport_Pipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	var mu sync.Mutex
+	var output strings.Builder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := pr.Read(buf)
+			mu.Lock()
+			output.Write(buf[:n])
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// waitFor waits until the output read from the pipe contains want
+	waitFor := func(want string) error {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			found := strings.Contains(output.String(), want)
+			mu.Unlock()
+			if found {
+				return nil
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return fmt.Errorf("timed out waiting for %q to be written to the pipe", want)
+	}
+
+	// A table several times larger than the write buffer
+	bigRows := make([]map[string]any, 3*BufferSize/100)
+	for i := range bigRows {
+		bigRows[i] = map[string]any{"id": int64(i), "name": strings.Repeat("x", 100)}
+	}
+
+	driver := &waitingMockDriver{
+		mockDriver: mockDriver{rows: map[string][]map[string]any{
+			"small": {{"id": int64(1), "name": "a"}},
+			"big":   bigRows,
+		}},
+		wait: func(table string, batch int) error {
+			switch {
+			case table == "big" && batch == 0:
+				// The previous table reaches the pipe before the next is read
+				return waitFor(`INSERT INTO "small"`)
+			case table == "big" && batch == len(bigRows)/200:
+				// Half way through, the start of the table has already been written
+				return waitFor(`INSERT INTO "big"`)
+			}
+			return nil
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "small", CreateStmt: "CREATE TABLE small (id int, name text);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "name"}}},
+		{Name: "big", CreateStmt: "CREATE TABLE big (id int, name text);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "name"}}},
+	}
+
+	exp := New(driver, anonymiser.New(&config.Config{}), pw, Options{BatchSize: 100})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	pw.Close()
+	<-done
+
+	if got := strings.Count(output.String(), strings.Repeat("x", 100)); got != len(bigRows) {
+		t.Errorf("read %d rows of big from the pipe, want %d", got, len(bigRows))
+	}
+}
+
+func TestExport_CharsetMismatches(t *testing.T) {
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{
+			{Name: "id", DataType: "int"},
+			{Name: "email", DataType: "varchar", CharacterSet: "utf8mb4"},
+			{Name: "name", DataType: "varchar", CharacterSet: "latin1"},
+			{Name: "code", DataType: "char", CharacterSet: "ascii"},
+		}},
+		{Name: "legacy_notes", CreateStmt: "CREATE TABLE legacy_notes;", Columns: []database.ColumnInfo{
+			{Name: "body", DataType: "text", CharacterSet: "utf8mb3"},
+			{Name: "blob", DataType: "varbinary", CharacterSet: "binary"},
+		}},
+		{Name: "sessions", CreateStmt: "CREATE TABLE sessions;", Columns: []database.ColumnInfo{
+			{Name: "payload", DataType: "text", CharacterSet: "latin1"},
+		}},
+	}
+	anon := anonymiser.New(&config.Config{
+		Configuration: map[string]*config.TableConfig{"sessions": {Truncate: true}},
+	})
+
+	tests := []struct {
+		name    string
+		charset string
+		want    []CharsetMismatch
+	}{
+		{"default utf8mb4", "", []CharsetMismatch{{Table: "users", Column: "name", Charset: "latin1"}}},
+		{"latin1", "latin1", []CharsetMismatch{
+			{Table: "users", Column: "email", Charset: "utf8mb4"},
+			{Table: "legacy_notes", Column: "body", Charset: "utf8mb3"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(&mockDriver{dbType: "mysql"}, anon, &buf, Options{DumpCharset: tt.charset})
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			if got := exp.GetStats().CharsetMismatches; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CharsetMismatches = %+v, want %+v", got, tt.want)
+			}
+
+			charset := tt.charset
+			if charset == "" {
+				charset = DefaultDumpCharset
+			}
+			if want := "SET NAMES " + charset + ";"; !strings.Contains(buf.String(), want) {
+				t.Errorf("output should contain %q, got:\n%s", want, buf.String())
+			}
+		})
+	}
+}
+
+func TestExport_NDJSON(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	rows := make([]map[string]any, 25)
+	for i := range rows {
+		rows[i] = map[string]any{"id": int64(i + 1), "email": []byte(fmt.Sprintf("user%d@real.example", i+1)), "created_at": created, "note": nil}
+	}
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "email"}, {Name: "created_at"}, {Name: "note"}}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: columns},
+		{Name: "sessions", CreateStmt: "CREATE TABLE sessions;", Columns: []database.ColumnInfo{{Name: "id"}}},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users":    {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+			"sessions": {Truncate: true},
+		},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"serial", Options{}},
+		{"write threads", Options{WriteThreads: 4}},
+		{"reuse buffers", Options{ReuseBuffers: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &columnarMockDriver{mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows:    map[string][]map[string]any{"users": rows, "sessions": {{"id": int64(1)}}},
+			}}
+
+			var sqlOut, ndjsonOut bytes.Buffer
+			opts := tt.opts
+			opts.BatchSize = 10
+			opts.NDJSON = &ndjsonOut
+			exp := New(driver, anonymiser.New(cfg), &sqlOut, opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			// Both outputs hold the same anonymised rows, in the same order
+			lines := strings.Split(strings.TrimSuffix(ndjsonOut.String(), "\n"), "\n")
+			if len(lines) != len(rows) {
+				t.Fatalf("NDJSON has %d lines, want %d:\n%s", len(lines), len(rows), ndjsonOut.String())
+			}
+			dump := sqlOut.String()
+			last := 0
+			for i, line := range lines {
+				var got struct {
+					Table string         `json:"table"`
+					Row   map[string]any `json:"row"`
+				}
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatalf("line %d is not JSON: %v\n%s", i+1, err, line)
+				}
+				if got.Table != "users" || got.Row["id"] != float64(i+1) {
+					t.Errorf("line %d = %s, want users row %d", i+1, line, i+1)
+				}
+				if got.Row["created_at"] != "2024-05-01 12:30:00" || got.Row["note"] != nil {
+					t.Errorf("line %d = %s, want created_at as in the dump and a null note", i+1, line)
+				}
+
+				email, _ := got.Row["email"].(string)
+				if strings.Contains(email, "real.example") {
+					t.Errorf("line %d has the original email: %s", i+1, line)
+				}
+				want := fmt.Sprintf("(%d, '%s', '2024-05-01 12:30:00', NULL)", i+1, email)
+				idx := strings.Index(dump, want)
+				if idx < last {
+					t.Errorf("SQL dump should contain %s after the previous row:\n%s", want, dump)
+				}
+				last = idx
+			}
+
+			if stats := exp.GetStats(); stats.RowsExported != int64(len(lines)) {
+				t.Errorf("RowsExported = %d, want %d", stats.RowsExported, len(lines))
+			}
+		})
+	}
+}
+
+func TestExport_Params(t *testing.T) {
+	rows := make([]map[string]any, 25)
+	for i := range rows {
+		rows[i] = map[string]any{"id": int64(i + 1), "email": []byte(fmt.Sprintf("user%d@real.example", i+1)), "note": "it's a \\ test\n"}
+	}
+	rows[3]["note"] = nil
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "email"}, {Name: "note"}}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: columns},
+		{Name: "sessions", CreateStmt: "CREATE TABLE sessions;", Columns: []database.ColumnInfo{{Name: "id"}}},
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users":    {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+			"sessions": {Truncate: true},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		dbType        string
+		opts          Options
+		wantStatement string
+	}{
+		{"serial", "sqlite", Options{}, `INSERT INTO "users" ("id", "email", "note") VALUES (?, ?, ?)`},
+		{"write threads", "sqlite", Options{WriteThreads: 4}, `INSERT INTO "users" ("id", "email", "note") VALUES (?, ?, ?)`},
+		{"reuse buffers", "sqlite", Options{ReuseBuffers: true}, `INSERT INTO "users" ("id", "email", "note") VALUES (?, ?, ?)`},
+		{"postgres placeholders", "postgres", Options{}, `INSERT INTO "users" ("id", "email", "note") VALUES ($1, $2, $3)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &columnarMockDriver{mockDriver: mockDriver{
+				dbType:  tt.dbType,
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows:    map[string][]map[string]any{"users": rows, "sessions": {{"id": int64(1)}}},
+			}}
+
+			var sqlOut, paramsOut bytes.Buffer
+			opts := tt.opts
+			opts.BatchSize = 10
+			opts.Params = &paramsOut
+			if err := New(driver, anonymiser.New(cfg), &sqlOut, opts).Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			// One statement line, then a line of values for each row
+			lines := strings.Split(strings.TrimSuffix(paramsOut.String(), "\n"), "\n")
+			if len(lines) != len(rows)+1 {
+				t.Fatalf("params output has %d lines, want %d:\n%s", len(lines), len(rows)+1, paramsOut.String())
+			}
+
+			var statement struct {
+				Table     string   `json:"table"`
+				Statement string   `json:"statement"`
+				Columns   []string `json:"columns"`
+			}
+			if err := json.Unmarshal([]byte(lines[0]), &statement); err != nil {
+				t.Fatalf("statement line is not JSON: %v\n%s", err, lines[0])
+			}
+			if statement.Table != "users" || statement.Statement != tt.wantStatement || !reflect.DeepEqual(statement.Columns, []string{"id", "email", "note"}) {
+				t.Errorf("statement line = %s, want users with %s", lines[0], tt.wantStatement)
+			}
+
+			// The same anonymised rows as the dump, in the same order
+			dump := sqlOut.String()
+			last := 0
+			for i, line := range lines[1:] {
+				var values []any
+				if err := json.Unmarshal([]byte(line), &values); err != nil {
+					t.Fatalf("row line %d is not a JSON array: %v\n%s", i+1, err, line)
+				}
+				if len(values) != 3 || values[0] != float64(i+1) || values[2] != rows[i]["note"] {
+					t.Errorf("row line %d = %s, want the values of row %d", i+1, line, i+1)
+				}
+
+				email, _ := values[1].(string)
+				if email == "" || strings.Contains(email, "real.example") {
+					t.Errorf("row line %d should have an anonymised email: %s", i+1, line)
+				}
+				idx := strings.Index(dump, fmt.Sprintf("(%d, '%s', ", i+1, email))
+				if idx < last {
+					t.Errorf("SQL dump should contain row %d with %s after the previous row:\n%s", i+1, email, dump)
+				}
+				last = idx
+			}
+		})
+	}
+}
+
+func TestExport_WideTable(t *testing.T) {
+	// Rows of 1000 columns are about 7 KB, so a 100 KB limit splits 200 rows
+	// into many statements
+	const maxInsertSize = 100_000
+	columns := make([]database.ColumnInfo, 1000)
+	for i := range columns {
+		columns[i] = database.ColumnInfo{Name: fmt.Sprintf("c%d", i), DataType: "int"}
+	}
+	rows := make([]map[string]any, 200)
+	for i := range rows {
+		rows[i] = make(map[string]any, len(columns))
+		for j, col := range columns {
+			rows[i][col.Name] = int64(i*len(columns) + j)
+		}
+	}
+	tables := []schema.TableInfo{{Name: "wide", CreateStmt: "CREATE TABLE wide;", Columns: columns}}
+
+	tests := []struct {
+		name   string
+		dbType string
+		opts   Options
+	}{
+		{"serial", "sqlite", Options{}},
+		{"write threads", "sqlite", Options{WriteThreads: 4}},
+		{"reuse buffers", "sqlite", Options{ReuseBuffers: true}},
+		{"mysqldump compat", "mysql", Options{MysqldumpCompat: true}},
+		{"compact", "sqlite", Options{InsertStyle: InsertCompact}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &columnarMockDriver{mockDriver: mockDriver{
+				dbType:  tt.dbType,
+				columns: map[string][]database.ColumnInfo{"wide": columns},
+				rows:    map[string][]map[string]any{"wide": rows},
+			}}
+
+			var buf bytes.Buffer
+			opts := tt.opts
+			opts.BatchSize = 1000
+			opts.MaxInsertSize = maxInsertSize
+			exp := New(driver, anonymiser.New(&config.Config{}), &buf, opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			var statements []string
+			for _, stmt := range strings.Split(buf.String(), `INSERT INTO "wide"`)[1:] {
+				statements = append(statements, `INSERT INTO "wide"`+stmt[:strings.Index(stmt, ";\n")+1])
+			}
+			if len(statements) < 10 {
+				t.Fatalf("got %d INSERT statements, want the rows split into at least 10", len(statements))
+			}
+
+			exported := 0
+			for i, stmt := range statements {
+				if len(stmt) > maxInsertSize {
+					t.Errorf("statement %d is %d bytes, want at most %d", i+1, len(stmt), maxInsertSize)
+				}
+				if !tt.opts.MysqldumpCompat && strings.Count(stmt, `"c`) != len(columns) {
+					t.Errorf("statement %d should list all %d columns", i+1, len(columns))
+				}
+				n := strings.Count(stmt, "(")
+				if !tt.opts.MysqldumpCompat {
+					n-- // the column list
+				}
+				exported += n
+			}
+			if exported != len(rows) {
+				t.Errorf("statements hold %d rows, want %d", exported, len(rows))
+			}
+
+			// Every row is written once, with its last column
+			output := buf.String()
+			for i := range rows {
+				last := fmt.Sprintf("%d)", i*len(columns)+len(columns)-1)
+				if strings.Count(output, " "+last)+strings.Count(output, ","+last) != 1 {
+					t.Errorf("row %d should be written once", i+1)
+				}
+			}
+			if stats := exp.GetStats(); stats.RowsExported != int64(len(rows)) {
+				t.Errorf("RowsExported = %d, want %d", stats.RowsExported, len(rows))
+			}
+		})
+	}
+}
+
+func TestInsertBuilder(t *testing.T) {
+	row := []string{"1", "'" + strings.Repeat("x", 40) + "'"} // a 48-byte row
+
+	tests := []struct {
+		name          string
+		maxInsertSize int
+		rows          int
+		want          int
+	}{
+		{name: "all rows fit", maxInsertSize: 1000, rows: 5, want: 1},
+		{name: "split", maxInsertSize: 150, rows: 5, want: 3},
+		{name: "row larger than the limit", maxInsertSize: 10, rows: 3, want: 3},
+		{name: "no rows", maxInsertSize: 150, rows: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := New(&mockDriver{}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{MaxInsertSize: tt.maxInsertSize})
+			inserts := exp.newInsertBuilder("t", []string{"id", "name"})
+			for i := 0; i < tt.rows; i++ {
+				inserts.add(row)
+			}
+
+			got := inserts.String()
+			if n := strings.Count(got, "INSERT INTO"); n != tt.want {
+				t.Errorf("String() = %q, want %d statements", got, tt.want)
+			}
+			if strings.Count(got, "(1, ") != tt.rows {
+				t.Errorf("String() = %q, want %d rows", got, tt.rows)
+			}
+			// Only a statement of a single row may be over the limit
+			for _, stmt := range strings.SplitAfter(got, ";\n") {
+				size := len(strings.TrimSuffix(stmt, "\n"))
+				if strings.Count(stmt, "(1, ") > 1 && size > tt.maxInsertSize {
+					t.Errorf("statement %q is %d bytes, want at most %d", stmt, size, tt.maxInsertSize)
+				}
+			}
+		})
+	}
+}
+
+func TestLongIdentifiers(t *testing.T) {
+	long63, long64 := strings.Repeat("a", 63), strings.Repeat("é", 64)
+
+	tests := []struct {
+		dbType string
+		want   []string
+	}{
+		{dbType: "mysql", want: nil},
+		{dbType: "postgres", want: []string{long64}},
+		{dbType: "sqlite", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			exp := New(&mockDriver{dbType: tt.dbType}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{})
+			if got := exp.longIdentifiers("users", []string{"id", long63, long64}); !slices.Equal(got, tt.want) {
+				t.Errorf("longIdentifiers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// MySQL counts characters
+	exp := New(&mockDriver{dbType: "mysql"}, anonymiser.New(&config.Config{}), &bytes.Buffer{}, Options{})
+	if got := exp.longIdentifiers(long64+"x", nil); len(got) != 1 {
+		t.Errorf("longIdentifiers() = %v, want the 65-character table name", got)
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Format
+		wantErr bool
+	}{
+		{"", []Format{FormatSQL}, false},
+		{"sql", []Format{FormatSQL}, false},
+		{"ndjson", []Format{FormatNDJSON}, false},
+		{"sql,ndjson", []Format{FormatSQL, FormatNDJSON}, false},
+		{"ndjson, sql", []Format{FormatNDJSON, FormatSQL}, false},
+		{"sql,params", []Format{FormatSQL, FormatParams}, false},
+		{"csv", nil, true},
+		{"sql,sql", nil, true},
+		{"sql,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFormats(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormats(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFormats(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	exp := &Exporter{zeroDatesNull: true}
+
+	tests := []struct {
+		name string
+		val  any
+		want string
+	}{
+		{"nil", nil, `null`},
+		{"bytes", []byte("hello"), `"hello"`},
+		{"float", 1.5, `1.5`},
+		{"NaN", math.NaN(), `"NaN"`},
+		{"big int", big.NewInt(12345678901234), `12345678901234`},
+		{"decimal", testDecimal{digits: "123.45"}, `123.45`},
+		{"zero date", database.ZeroDate("0000-00-00"), `null`},
+		{"named string", testStatus("active"), `"active"`},
+		{"null valuer", sql.NullInt64{}, `null`},
+		{"duration", 2 * time.Second, `2000000000`},
+		{"nil pointer", (*string)(nil), `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(exp.jsonValue(tt.val))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("jsonValue(%v) encodes as %s, want %s", tt.val, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExport_RetainFollow(t *testing.T) {
+	users := schema.TableInfo{Name: "users", CreateStmt: "CREATE TABLE users;", Columns: []database.ColumnInfo{{Name: "id"}}}
+	orders := schema.TableInfo{Name: "orders", CreateStmt: "CREATE TABLE orders;", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "user_id"}, {Name: "product_id"}}}
+	products := schema.TableInfo{Name: "products", CreateStmt: "CREATE TABLE products;", Columns: []database.ColumnInfo{{Name: "id"}}}
+	newDriver := func() *columnarMockDriver {
+		return &columnarMockDriver{
+			mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{
+					"users":    users.Columns,
+					"orders":   orders.Columns,
+					"products": products.Columns,
+				},
+				rows: map[string][]map[string]any{
+					"users":    {{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}},
+					"products": {{"id": int64(7)}},
+					"orders": {
+						{"id": int64(10), "user_id": int64(1), "product_id": int64(7)},
+						{"id": int64(11), "user_id": int64(3), "product_id": int64(7)},
+						{"id": int64(12), "user_id": int64(2), "product_id": int64(99)},
+					},
+				},
+				foreignKeys: []database.ForeignKey{
+					{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+					{Table: "orders", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+				},
+			},
+		}
+	}
+	cfg := &config.Config{
+		Configuration: map[string]*config.TableConfig{
+			"users":  {Retain: config.RetainConfig{Count: 2}},
+			"orders": {Retain: config.RetainConfig{Follow: "users"}},
+		},
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "map rows"
+		if reuse {
+			name = "columnar rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exp := New(newDriver(), anonymiser.New(cfg), &buf, Options{BatchSize: 10, ReuseBuffers: reuse})
+			if err := exp.Export([]schema.TableInfo{products, users, orders}); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			// Only the followed relationship filters rows: order 12 keeps its missing product
+			output := buf.String()
+			if !strings.Contains(output, "(10,") || !strings.Contains(output, "(12,") {
+				t.Errorf("expected orders 10 and 12 in output:\n%s", output)
+			}
+			if strings.Contains(output, "(11,") {
+				t.Errorf("expected order 11 to be filtered from output:\n%s", output)
+			}
+
+			if stats := exp.GetStats(); stats.RowsFiltered != 1 || stats.RowsExported != 5 {
+				t.Errorf("RowsFiltered = %d, RowsExported = %d, want 1 and 5", stats.RowsFiltered, stats.RowsExported)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name    string
+		tables  []schema.TableInfo
+		child   string
+		parent  string
+		wantErr string
+	}{
+		{"parent exported after child", []schema.TableInfo{orders, users}, "orders", "users", "must be exported before it"},
+		{"parent not exported", []schema.TableInfo{orders}, "orders", "users", "must be exported before it"},
+		{"no foreign key to parent", []schema.TableInfo{users, products}, "products", "users", "has no foreign key referencing it"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			anon := anonymiser.New(&config.Config{
+				Configuration: map[string]*config.TableConfig{
+					tt.child: {Retain: config.RetainConfig{Follow: tt.parent}},
+				},
+			})
+
+			err := New(newDriver(), anon, &bytes.Buffer{}, Options{}).Export(tt.tables)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Export() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExport_DecimalColumns(t *testing.T) {
+	columns := []database.ColumnInfo{
+		{Name: "id", DataType: "int"},
+		{Name: "price", DataType: "decimal(10,2)"},
+		{Name: "rate", DataType: "numeric"},
+		{Name: "code", DataType: "varchar"},
+	}
+	tables := []schema.TableInfo{{Name: "products", CreateStmt: "CREATE TABLE products;", Columns: columns}}
+	rows := []map[string]any{
+		{"id": int64(1), "price": []byte("3.14"), "rate": "-0.0050", "code": "42"},
+		{"id": int64(2), "price": nil, "rate": []byte("NaN"), "code": []byte("7")},
+	}
+
+	tests := []struct {
+		name  string
+		opts  Options
+		wants []string
+	}{
+		{"unquoted", Options{}, []string{"(1, 3.14, -0.0050, '42')", "(2, NULL, 'NaN', '7')"}},
+		{"unquoted columnar", Options{ReuseBuffers: true}, []string{"(1, 3.14, -0.0050, '42')", "(2, NULL, 'NaN', '7')"}},
+		{"quoted", Options{QuoteDecimals: true}, []string{"(1, '3.14', '-0.0050', '42')", "(2, NULL, 'NaN', '7')"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &columnarMockDriver{mockDriver: mockDriver{
+				columns: map[string][]database.ColumnInfo{"products": columns},
+				rows:    map[string][]map[string]any{"products": rows},
+			}}
+
+			var buf bytes.Buffer
+			exp := New(driver, anonymiser.New(&config.Config{}), &buf, tt.opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			for _, want := range tt.wants {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output should contain %s, got:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+// interruptedMockDriver streams rows in key order after opts.AfterKey, and
+// fails the stream of failTable after failAfter batches while failAfter is set.
+type interruptedMockDriver struct {
+	mockDriver
+	failTable string
+	failAfter int
+	calls     map[string][]database.StreamOptions
+}
+
+func (m *interruptedMockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
+	if m.calls == nil {
+		m.calls = make(map[string][]database.StreamOptions)
+	}
+	m.calls[table] = append(m.calls[table], opts)
+
+	var rows []map[string]any
+	for _, row := range m.rows[table] {
+		if opts.AfterKey != nil && row[opts.KeyColumn].(int64) <= opts.AfterKey.(int64) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if opts.Limit > 0 && opts.Limit < len(rows) {
+		rows = rows[:opts.Limit]
+	}
+
+	for i, batches := 0, 0; i < len(rows); i, batches = i+batchSize, batches+1 {
+		if table == m.failTable && m.failAfter > 0 && batches == m.failAfter {
+			return errors.New("lost connection to server")
+		}
+		if err := callback(rows[i:min(i+batchSize, len(rows))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *interruptedMockDriver) StreamRowsColumnar(table string, opts database.StreamOptions, batchSize int, callback database.ColumnarCallback) error {
+	cols := make([]string, len(m.columns[table]))
+	for i, col := range m.columns[table] {
+		cols[i] = col.Name
+	}
+	return m.StreamRows(table, opts, batchSize, func(rows []map[string]any) error {
+		values := make([][]any, len(rows))
+		for i, row := range rows {
+			values[i] = make([]any, len(cols))
+			for j, col := range cols {
+				values[i][j] = row[col]
+			}
+		}
+		return callback(cols, values)
+	})
+}
+
+func TestExport_Checkpoint(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id", DataType: "int"}, {Name: "email", DataType: "varchar(255)"}}
+	newRows := func(n int) []map[string]any {
+		rows := make([]map[string]any, n)
+		for i := range rows {
+			rows[i] = map[string]any{"id": int64(i + 1), "email": fmt.Sprintf("user%d@example.com", i+1)}
+		}
+		return rows
+	}
+	newDriver := func() *interruptedMockDriver {
+		return &interruptedMockDriver{mockDriver: mockDriver{
+			columns: map[string][]database.ColumnInfo{"users": columns, "orders": columns, "logs": columns},
+			rows:    map[string][]map[string]any{"users": newRows(3), "orders": newRows(7), "logs": newRows(5)},
+		}}
+	}
+	table := func(name string, pk ...string) schema.TableInfo {
+		return schema.TableInfo{Name: name, CreateStmt: "CREATE TABLE " + name + ";", Columns: columns, PrimaryKey: pk}
+	}
+	tables := []schema.TableInfo{table("users", "id"), table("orders", "id"), table("logs")}
+
+	// export runs an export to out, saving a checkpoint after every batch
+	export := func(driver database.Driver, cfg *config.Config, out io.Writer, opts Options) error {
+		exp := New(driver, anonymiser.New(cfg), out, opts)
+		exp.checkpointInterval = 0
+		return exp.Export(tables)
+	}
+	withoutDate := func(s string) string {
+		return regexp.MustCompile(`(?m)^-- Date: .*$`).ReplaceAllString(s, "")
+	}
+
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{"serial", Options{BatchSize: 2}},
+		{"pipeline", Options{BatchSize: 2, ParallelBatches: 2, WriteThreads: 2}},
+		{"columnar", Options{BatchSize: 2, ReuseBuffers: true}},
+		{"keyset", Options{BatchSize: 2, Keyset: true}},
+		{"mysqldump compat", Options{BatchSize: 2, MysqldumpCompat: true}},
+	}
+
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			newModeDriver := func() *interruptedMockDriver {
+				driver := newDriver()
+				if mode.opts.MysqldumpCompat {
+					driver.dbType = "mysql"
+				}
+				return driver
+			}
+
+			var want bytes.Buffer
+			if err := export(newModeDriver(), &config.Config{}, &want, mode.opts); err != nil {
+				t.Fatalf("uninterrupted Export() error = %v", err)
+			}
+
+			path := filepath.Join(t.TempDir(), "checkpoint.json")
+			opts := mode.opts
+			opts.Checkpoint = path
+
+			driver := newModeDriver()
+			driver.failTable, driver.failAfter = "orders", 2
+			var out bytes.Buffer
+			if err := export(driver, &config.Config{}, &out, opts); err == nil {
+				t.Fatal("interrupted Export() expected error")
+			}
+
+			cp, err := LoadCheckpoint(path)
+			if err != nil || cp == nil {
+				t.Fatalf("LoadCheckpoint() = %v, %v, want a checkpoint", cp, err)
+			}
+			if !reflect.DeepEqual(cp.Completed, []string{"users"}) || cp.Table != "orders" || cp.KeyColumn != "id" || cp.LastKey != int64(4) || cp.Rows != 4 {
+				t.Errorf("checkpoint = %+v, want users completed and orders at id 4 after 4 rows", cp)
+			}
+
+			// A crash can leave output written after the checkpoint, which is cut off
+			out.WriteString("INSERT INTO \"orders\" VALUES (5, 'partial')")
+			resumed := bytes.NewBuffer(bytes.Clone(out.Bytes()[:cp.SQLOffset]))
+
+			driver.failAfter = 0
+			if err := export(driver, &config.Config{}, resumed, opts); err != nil {
+				t.Fatalf("resumed Export() error = %v", err)
+			}
+
+			if got := withoutDate(resumed.String()); got != withoutDate(want.String()) {
+				t.Errorf("resumed output differs from an uninterrupted export:\n%s\nwant:\n%s", got, withoutDate(want.String()))
+			}
+			if n := len(driver.calls["users"]); n != 1 {
+				t.Errorf("users streamed %d times, want once", n)
+			}
+			if calls := driver.calls["orders"]; calls[len(calls)-1].AfterKey != int64(4) {
+				t.Errorf("orders resumed after %v, want 4", calls[len(calls)-1].AfterKey)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("checkpoint should be removed once the export completes, Stat() error = %v", err)
+			}
+		})
+	}
+
+	t.Run("table without a key restarts", func(t *testing.T) {
+		var want bytes.Buffer
+		if err := export(newDriver(), &config.Config{}, &want, Options{BatchSize: 2}); err != nil {
+			t.Fatalf("uninterrupted Export() error = %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		driver := newDriver()
+		driver.failTable, driver.failAfter = "logs", 2
+		var out bytes.Buffer
+		if err := export(driver, &config.Config{}, &out, Options{BatchSize: 2, Checkpoint: path}); err == nil {
+			t.Fatal("interrupted Export() expected error")
+		}
+
+		cp, err := LoadCheckpoint(path)
+		if err != nil || cp == nil {
+			t.Fatalf("LoadCheckpoint() = %v, %v, want a checkpoint", cp, err)
+		}
+		if !reflect.DeepEqual(cp.Completed, []string{"users", "orders"}) || cp.Table != "" {
+			t.Errorf("checkpoint = %+v, want users and orders completed and no table in progress", cp)
+		}
+
+		resumed := bytes.NewBuffer(bytes.Clone(out.Bytes()[:cp.SQLOffset]))
+		driver.failAfter = 0
+		if err := export(driver, &config.Config{}, resumed, Options{BatchSize: 2, Checkpoint: path}); err != nil {
+			t.Fatalf("resumed Export() error = %v", err)
+		}
+		if got := withoutDate(resumed.String()); got != withoutDate(want.String()) {
+			t.Errorf("resumed output differs from an uninterrupted export:\n%s", got)
+		}
+		if calls := driver.calls["logs"]; calls[len(calls)-1].AfterKey != nil {
+			t.Errorf("logs resumed after %v, want from the start", calls[len(calls)-1].AfterKey)
+		}
+	})
+
+	t.Run("count retain continues with the rows left", func(t *testing.T) {
+		cfg := &config.Config{Configuration: map[string]*config.TableConfig{
+			"orders": {Retain: config.RetainConfig{Count: 5}},
+		}}
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		driver := newDriver()
+		driver.failTable, driver.failAfter = "orders", 2
+		var out bytes.Buffer
+		if err := export(driver, cfg, &out, Options{BatchSize: 2, Checkpoint: path}); err == nil {
+			t.Fatal("interrupted Export() expected error")
+		}
+
+		driver.failAfter = 0
+		if err := export(driver, cfg, &out, Options{BatchSize: 2, Checkpoint: path}); err != nil {
+			t.Fatalf("resumed Export() error = %v", err)
+		}
+		if calls := driver.calls["orders"]; calls[len(calls)-1].Limit != 1 {
+			t.Errorf("resumed Limit = %d, want 1", calls[len(calls)-1].Limit)
+		}
+	})
+
+	t.Run("key column changed since the checkpoint", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		cp := &Checkpoint{Completed: []string{"users"}, Table: "orders", KeyColumn: "email", LastKey: "a"}
+		if err := cp.save(path); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+		err := export(newDriver(), &config.Config{}, &bytes.Buffer{}, Options{Checkpoint: path})
+		if err == nil || !strings.Contains(err.Error(), `by column "email"`) {
+			t.Errorf("Export() error = %v, want key column mismatch", err)
+		}
+	})
+
+	t.Run("refused with foreign key tracking", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		var out bytes.Buffer
+		if err := export(newDriver(), &config.Config{}, &out, Options{Checkpoint: path, VerifyFK: true}); err == nil {
+			t.Error("Export() expected error")
+		}
+		if out.Len() != 0 {
+			t.Errorf("refused export wrote %d bytes", out.Len())
+		}
+	})
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	if cp, err := LoadCheckpoint(filepath.Join(dir, "missing.json")); cp != nil || err != nil {
+		t.Errorf("LoadCheckpoint() of a missing file = %v, %v, want nil, nil", cp, err)
+	}
+
+	path := filepath.Join(dir, "invalid.json")
+	os.WriteFile(path, []byte("{"), 0644)
+	if _, err := LoadCheckpoint(path); err == nil {
+		t.Error("LoadCheckpoint() of an invalid file expected error")
+	}
+
+	// Keys keep their type through the file
+	for _, key := range []any{int64(9007199254740993), "b7e1-4f", "12345678901234567890"} {
+		path := filepath.Join(dir, "checkpoint.json")
+		if err := (&Checkpoint{Table: "t", KeyColumn: "id", LastKey: key}).save(path); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+		cp, err := LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("LoadCheckpoint() error = %v", err)
+		}
+		if cp.LastKey != key {
+			t.Errorf("LastKey = %#v, want %#v", cp.LastKey, key)
+		}
+	}
+}
+
+func TestExport_OutputStyle(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "name"}}
+	// The CREATE statement is written as read, so the newline in its
+	// default is kept with either line ending
+	create := "CREATE TABLE users (\n  id int,\n  name text DEFAULT 'Line 1\nLine 2'\n);"
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: create, Columns: columns},
+	}
+	header := "-- Database Dump\n-- Generated by dbmask\n-- Date: DATE\n-- Database Type: sqlite\n\n" +
+		"PRAGMA foreign_keys = OFF;\n\n\n--\n-- Table: users\n--\n\n" +
+		"DROP TABLE IF EXISTS \"users\";\n\n"
+	footer := "\n\nPRAGMA foreign_keys = ON;\n"
+	crlf := func(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+	multiline := "\n\nINSERT INTO \"users\" (\"id\", \"name\") VALUES\n(1, 'John'),\n(2, 'Line 1\\nLine 2');" + footer
+	compact := "\n\nINSERT INTO \"users\" (\"id\",\"name\") VALUES (1,'John'),(2,'Line 1\\nLine 2');" + footer
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "multiline with lf",
+			opts: Options{},
+			want: header + create + multiline,
+		},
+		{
+			name: "compact with lf",
+			opts: Options{InsertStyle: InsertCompact},
+			want: header + create + compact,
+		},
+		{
+			name: "multiline with crlf",
+			opts: Options{LineEnding: LineEndingCRLF},
+			want: crlf(header) + create + crlf(multiline),
+		},
+		{
+			name: "compact with crlf",
+			opts: Options{InsertStyle: InsertCompact, LineEnding: LineEndingCRLF},
+			want: crlf(header) + create + crlf(compact),
+		},
+	}
+
+	date := regexp.MustCompile(`-- Date: [^\r\n]*`)
+	for _, tt := range tests {
+		for _, reuse := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s reuse=%v", tt.name, reuse), func(t *testing.T) {
+				driver := &columnarMockDriver{mockDriver: mockDriver{
+					dbType:  "sqlite",
+					columns: map[string][]database.ColumnInfo{"users": columns},
+					rows: map[string][]map[string]any{
+						"users": {
+							{"id": int64(1), "name": "John"},
+							{"id": int64(2), "name": "Line 1\nLine 2"},
+						},
+					},
+				}}
+
+				var buf bytes.Buffer
+				opts := tt.opts
+				opts.BatchSize = 10
+				opts.ReuseBuffers = reuse
+				exp := New(driver, anonymiser.New(&config.Config{}), &buf, opts)
+				if err := exp.Export(tables); err != nil {
+					t.Fatalf("Export() error = %v", err)
+				}
+
+				if got := date.ReplaceAllString(buf.String(), "-- Date: DATE"); got != tt.want {
+					t.Errorf("output = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestParseLineEnding(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LineEnding
+		wantErr bool
+	}{
+		{"", LineEndingLF, false},
+		{"lf", LineEndingLF, false},
+		{"crlf", LineEndingCRLF, false},
+		{"CRLF", "", true},
+		{"cr", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLineEnding(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLineEnding(%q) = %q, %v, want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseInsertStyle(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    InsertStyle
+		wantErr bool
+	}{
+		{"", InsertMultiline, false},
+		{"multiline", InsertMultiline, false},
+		{"compact", InsertCompact, false},
+		{"single", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseInsertStyle(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseInsertStyle(%q) = %q, %v, want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestExport_KeepForeignKeyChecks(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}}
+	tables := []schema.TableInfo{{Name: "users", CreateStmt: "CREATE TABLE users (id int);", Columns: columns}}
+
+	tests := []struct {
+		name    string
+		dbType  string
+		opts    Options
+		toggles []string
+	}{
+		{
+			name:    "mysql",
+			dbType:  "mysql",
+			toggles: []string{"SET FOREIGN_KEY_CHECKS = 0;", "SET FOREIGN_KEY_CHECKS = 1;"},
+		},
+		{
+			name:    "mysqldump compat",
+			dbType:  "mysql",
+			opts:    Options{MysqldumpCompat: true},
+			toggles: []string{mysqldumpFKChecksOff, mysqldumpFKChecksRestore},
+		},
+		{
+			name:    "postgres",
+			dbType:  "postgres",
+			toggles: nil,
+		},
+		{
+			name:    "sqlite",
+			dbType:  "sqlite",
+			toggles: []string{"PRAGMA foreign_keys = OFF;", "PRAGMA foreign_keys = ON;"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, keep := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s keep=%v", tt.name, keep), func(t *testing.T) {
+				driver := &mockDriver{
+					dbType:  tt.dbType,
+					columns: map[string][]database.ColumnInfo{"users": columns},
+					rows:    map[string][]map[string]any{"users": {{"id": int64(1)}}},
+				}
+
+				var buf bytes.Buffer
+				opts := tt.opts
+				opts.BatchSize = 10
+				opts.KeepForeignKeyChecks = keep
+				exp := New(driver, anonymiser.New(&config.Config{}), &buf, opts)
+				if err := exp.Export(tables); err != nil {
+					t.Fatalf("Export() error = %v", err)
+				}
+
+				output := buf.String()
+				for _, toggle := range tt.toggles {
+					if got := strings.Contains(output, toggle); got == keep {
+						t.Errorf("output contains %q = %v, want %v, got:\n%s", toggle, got, !keep, output)
+					}
+				}
+				for _, marker := range []string{"FOREIGN_KEY_CHECKS", "foreign_keys", "session_replication_role"} {
+					if keep && strings.Contains(output, marker) {
+						t.Errorf("output should not touch foreign key checks, got:\n%s", output)
+					}
+				}
+				if !strings.Contains(output, "INSERT INTO") {
+					t.Errorf("output missing rows, got:\n%s", output)
+				}
+			})
+		}
+	}
+}
+
+func TestExport_SplitData(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "name"}}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int, name text);", Columns: columns},
+		{Name: "audit", CreateStmt: "CREATE TABLE audit (id int, name text);", Columns: columns},
+	}
+	newDriver := func(dbType string) *columnarMockDriver {
+		return &columnarMockDriver{mockDriver: mockDriver{
+			dbType:  dbType,
+			columns: map[string][]database.ColumnInfo{"users": columns, "audit": columns},
+			rows: map[string][]map[string]any{
+				"users": {{"id": int64(1), "name": "John"}, {"id": int64(2), "name": "Jane"}},
+				"audit": {{"id": int64(1), "name": "login"}},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		dbType     string
+		opts       Options
+		schemaWant []string
+		dataWant   []string
+	}{
+		{
+			name:       "serial",
+			dbType:     "sqlite",
+			schemaWant: []string{"PRAGMA foreign_keys = OFF;", `DROP TABLE IF EXISTS "users";`, "CREATE TABLE users", "CREATE TABLE audit", "PRAGMA foreign_keys = ON;"},
+			dataWant:   []string{"PRAGMA foreign_keys = OFF;", "-- Table: users", `INSERT INTO "users" ("id", "name") VALUES`, "(2, 'Jane');", `INSERT INTO "audit"`, "PRAGMA foreign_keys = ON;"},
+		},
+		{
+			name:       "pipeline",
+			dbType:     "sqlite",
+			opts:       Options{ReuseBuffers: true, ParallelBatches: 2, WriteThreads: 2},
+			schemaWant: []string{"CREATE TABLE users", "CREATE TABLE audit"},
+			dataWant:   []string{`INSERT INTO "users"`, `INSERT INTO "audit"`},
+		},
+		{
+			name:       "mysqldump compat",
+			dbType:     "mysql",
+			opts:       Options{MysqldumpCompat: true},
+			schemaWant: []string{"-- MySQL dump", "-- Table structure for table \"users\"", "CREATE TABLE users", "-- Dump completed on"},
+			dataWant:   []string{"-- MySQL dump", `LOCK TABLES "users" WRITE;`, `INSERT INTO "users" VALUES (1,'John'),(2,'Jane');`, "UNLOCK TABLES;", "-- Dump completed on"},
+		},
+		{
+			name:       "refresh",
+			dbType:     "mysql",
+			opts:       Options{Refresh: true},
+			schemaWant: []string{"SET FOREIGN_KEY_CHECKS = 0;", "-- Table: users", "COMMIT;"},
+			dataWant:   []string{"SET FOREIGN_KEY_CHECKS = 0;", `TRUNCATE TABLE "users";`, `INSERT INTO "users"`, "COMMIT;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schemaBuf, dataBuf bytes.Buffer
+			opts := tt.opts
+			opts.BatchSize = 10
+			opts.Data = &dataBuf
+			exp := New(newDriver(tt.dbType), anonymiser.New(&config.Config{}), &schemaBuf, opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			schemaOut, dataOut := schemaBuf.String(), dataBuf.String()
+			if strings.Contains(schemaOut, "INSERT INTO") || strings.Contains(schemaOut, "TRUNCATE") {
+				t.Errorf("schema output should not contain rows, got:\n%s", schemaOut)
+			}
+			if strings.Contains(dataOut, "CREATE TABLE") || strings.Contains(dataOut, "DROP TABLE") {
+				t.Errorf("data output should not contain schema, got:\n%s", dataOut)
+			}
+			for _, want := range tt.schemaWant {
+				if !strings.Contains(schemaOut, want) {
+					t.Errorf("schema output missing %q, got:\n%s", want, schemaOut)
+				}
+			}
+			for _, want := range tt.dataWant {
+				if !strings.Contains(dataOut, want) {
+					t.Errorf("data output missing %q, got:\n%s", want, dataOut)
+				}
+			}
+		})
+	}
+
+	t.Run("checkpoint refused", func(t *testing.T) {
+		var schemaBuf, dataBuf bytes.Buffer
+		exp := New(newDriver("sqlite"), anonymiser.New(&config.Config{}), &schemaBuf, Options{
+			Data:       &dataBuf,
+			Checkpoint: filepath.Join(t.TempDir(), "checkpoint.json"),
+		})
+		if err := exp.Export(tables); err == nil || !strings.Contains(err.Error(), "separate data output") {
+			t.Errorf("Export() error = %v, want checkpoints refused", err)
+		}
+	})
+}
+
+func TestExport_InsertRewriter(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "name"}}
+	tables := []schema.TableInfo{{Name: "users", CreateStmt: "CREATE TABLE users (id int, name text);", Columns: columns}}
+	staging := func(table, sql string) string {
+		return strings.Replace(sql, "INSERT INTO \""+table+"\"", "INSERT INTO \"staging\".\""+table+"\"", 1)
+	}
+
+	for _, reuse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reuse=%v", reuse), func(t *testing.T) {
+			driver := &columnarMockDriver{mockDriver: mockDriver{
+				dbType:  "sqlite",
+				columns: map[string][]database.ColumnInfo{"users": columns},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1), "name": "John"},
+						{"id": int64(2), "name": "Jane"},
+						{"id": int64(3), "name": "Jim"},
+					},
+				},
+			}}
+
+			var buf bytes.Buffer
+			opts := Options{BatchSize: 2, ReuseBuffers: reuse, InsertRewriter: staging}
+			exp := New(driver, anonymiser.New(&config.Config{}), &buf, opts)
+			if err := exp.Export(tables); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			want := "INSERT INTO \"staging\".\"users\" (\"id\", \"name\") VALUES\n(1, 'John'),\n(2, 'Jane');\n" +
+				"INSERT INTO \"staging\".\"users\" (\"id\", \"name\") VALUES\n(3, 'Jim');\n"
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("output = %q, want it to contain %q", buf.String(), want)
+			}
+			if strings.Contains(buf.String(), "INSERT INTO \"users\"") {
+				t.Errorf("output = %q, want every INSERT rewritten", buf.String())
+			}
+		})
+	}
+
+	t.Run("each statement of a batch", func(t *testing.T) {
+		exp := &Exporter{insertRewriter: func(table, sql string) string {
+			return "/* " + table + " */ " + sql
+		}}
+		got := exp.rewriteInserts("users", "INSERT INTO a VALUES\n(1);\nINSERT INTO a VALUES\n(2);\n")
+		want := "/* users */ INSERT INTO a VALUES\n(1);\n/* users */ INSERT INTO a VALUES\n(2);\n"
+		if got != want {
+			t.Errorf("rewriteInserts() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestExport_PostSQL(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}}
+	driver := &mockDriver{
+		dbType: "sqlite",
+		columns: map[string][]database.ColumnInfo{
+			"orders": columns,
+			"users":  columns,
+		},
+		rows: map[string][]map[string]any{
+			"orders": {{"id": int64(1)}},
+			"users":  {{"id": int64(2)}},
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id int);", Columns: columns},
+		{Name: "orders", CreateStmt: "CREATE TABLE orders (id int);", Columns: columns},
+	}
+	cfg := &config.Config{Configuration: map[string]*config.TableConfig{
+		"users": {PostSQL: []string{"ANALYZE users", "UPDATE users SET id = id;"}},
+	}}
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	output := buf.String()
+	want := "INSERT INTO \"users\" (\"id\") VALUES\n(2);\n\nANALYZE users;\nUPDATE users SET id = id;\n"
+	at := strings.Index(output, want)
+	if at < 0 {
+		t.Fatalf("output = %q, want it to contain %q", output, want)
+	}
+	if next := strings.Index(output, "CREATE TABLE orders"); next < at {
+		t.Errorf("output = %q, want the post_sql of users before the orders table", output)
+	}
+	if strings.Count(output, "ANALYZE") != 1 {
+		t.Errorf("output = %q, want post_sql written once", output)
+	}
+}
+
+func TestExport_As(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "code"}}
+	driver := &mockDriver{
+		dbType:  "sqlite",
+		columns: map[string][]database.ColumnInfo{"users": columns},
+		rows: map[string][]map[string]any{
+			"users": {
+				{"id": int64(1), "code": []byte("0042")},
+				{"id": int64(2), "code": nil},
+			},
+		},
+	}
+	tables := []schema.TableInfo{
+		{Name: "users", CreateStmt: "CREATE TABLE users (id text, code int);", Columns: columns},
+	}
+	cfg := &config.Config{Configuration: map[string]*config.TableConfig{
+		"users": {As: map[string]string{"id": config.OutputTypeString, "code": config.OutputTypeInt}},
+	}}
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	want := "INSERT INTO \"users\" (\"id\", \"code\") VALUES\n('1', 0042),\n('2', NULL);\n"
+	if output := buf.String(); !strings.Contains(output, want) {
+		t.Errorf("output = %q, want it to contain %q", output, want)
+	}
+}
+
+func TestExport_Shuffle(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "city"}}
+	cities := []string{"Leeds", "York", "Hull", "Bath", "Ely", "Wells"}
+	rows := make([]map[string]any, len(cities))
+	for i, city := range cities {
+		rows[i] = map[string]any{"id": int64(i + 1), "city": []byte(city)}
+	}
+	driver := &mockDriver{
+		dbType:  "sqlite",
+		columns: map[string][]database.ColumnInfo{"users": columns},
+		rows:    map[string][]map[string]any{"users": rows},
+	}
+	tables := []schema.TableInfo{{Name: "users", CreateStmt: "CREATE TABLE users (id int, city text);", Columns: columns}}
+	cfg := &config.Config{Configuration: map[string]*config.TableConfig{
+		"users": {Columns: config.ColumnRuleMap{"city": config.Rule("{{shuffle}}")}},
+	}}
+
+	var buf bytes.Buffer
+	exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 4})
+	if err := exp.Export(tables); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	matches := regexp.MustCompile(`\((\d+), '(\w+)'\)`).FindAllStringSubmatch(buf.String(), -1)
+	if len(matches) != len(cities) {
+		t.Fatalf("output = %q, want %d rows", buf.String(), len(cities))
+	}
+	var got []string
+	for i, m := range matches {
+		if m[2] == cities[i] {
+			t.Errorf("row %s kept its city %s", m[1], m[2])
+		}
+		got = append(got, m[2])
+	}
+
+	slices.Sort(got)
+	want := slices.Sorted(slices.Values(cities))
+	if !slices.Equal(got, want) {
+		t.Errorf("cities = %v, want the same cities as the source %v", got, want)
+	}
+
+	// Rows past the cap are read for shuffling but not written
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+
+	exp = New(driver, anonymiser.New(cfg), &bytes.Buffer{}, Options{BatchSize: 4, RowsLimitTotal: int64(len(cities))})
+	exportErr := exp.Export(tables)
+
+	os.Stderr = stderr
+	w.Close()
+	warnings, _ := io.ReadAll(r)
+	if exportErr != nil {
+		t.Fatalf("Export() error = %v", exportErr)
+	}
+	if !strings.Contains(string(warnings), "Warning: shuffled values of users may come from rows left out of the dump") {
+		t.Errorf("stderr = %q, want a warning about shuffled values", warnings)
+	}
+}
+
+func TestParseOversizedRowAction(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    OversizedRowAction
+		wantErr bool
+	}{
+		{"", OversizedWarn, false},
+		{"warn", OversizedWarn, false},
+		{"skip", OversizedSkip, false},
+		{"truncate", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseOversizedRowAction(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseOversizedRowAction(%q) = %q, %v, want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestExport_MaxRowSize(t *testing.T) {
+	columns := []database.ColumnInfo{{Name: "id"}, {Name: "payload"}}
+	tables := []schema.TableInfo{{Name: "events", CreateStmt: "CREATE TABLE events (id int, payload text);", Columns: columns, PrimaryKey: []string{"id"}}}
+	huge := strings.Repeat("x", 100)
+	rows := []map[string]any{
+		{"id": int64(1), "payload": "small"},
+		{"id": int64(2), "payload": huge},
+		{"id": int64(3), "payload": "small"},
+	}
+
+	tests := []struct {
+		name        string
+		action      OversizedRowAction
+		columnar    bool
+		wantHuge    bool
+		wantWarning string
+	}{
+		{name: "warn", action: OversizedWarn, wantHuge: true, wantWarning: "Warning: row of events with primary key id = 2 is 107 bytes, over the maximum row size of 50"},
+		{name: "skip", action: OversizedSkip, wantWarning: "Warning: skipping row of events with primary key id = 2, whose 107 bytes exceed the maximum row size of 50"},
+		{name: "skip columnar", action: OversizedSkip, columnar: true, wantWarning: "Warning: skipping row of events with primary key id = 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var driver database.Driver = &mockDriver{
+				dbType:  "sqlite",
+				columns: map[string][]database.ColumnInfo{"events": columns},
+				rows:    map[string][]map[string]any{"events": rows},
+			}
+			if tt.columnar {
+				driver = &columnarMockDriver{mockDriver: *driver.(*mockDriver)}
+			}
+
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stderr := os.Stderr
+			os.Stderr = w
+
+			var buf bytes.Buffer
+			exp := New(driver, anonymiser.New(&config.Config{}), &buf, Options{BatchSize: 10, MaxRowSize: 50, OversizedRows: tt.action})
+			exportErr := exp.Export(tables)
+
+			os.Stderr = stderr
+			w.Close()
+			warnings, _ := io.ReadAll(r)
+
+			if exportErr != nil {
+				t.Fatalf("Export() error = %v", exportErr)
+			}
+			if !strings.Contains(string(warnings), tt.wantWarning) {
+				t.Errorf("stderr = %q, want it to contain %q", warnings, tt.wantWarning)
+			}
+			if got := strings.Contains(buf.String(), huge); got != tt.wantHuge {
+				t.Errorf("oversized row written = %v, want %v", got, tt.wantHuge)
+			}
+
+			want := "(1, 'small'),\n(2, '" + huge + "'),\n(3, 'small');\n"
+			if !tt.wantHuge {
+				want = "(1, 'small'),\n(3, 'small');\n"
+			}
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("output = %q, want it to contain %q", buf.String(), want)
+			}
+
+			stats := exp.GetStats()
+			wantRows := int64(3)
+			if !tt.wantHuge {
+				wantRows = 2
+			}
+			if stats.RowsOversized != 1 || stats.RowsExported != wantRows {
+				t.Errorf("RowsOversized = %d, RowsExported = %d, want 1 and %d", stats.RowsOversized, stats.RowsExported, wantRows)
+			}
+		})
+	}
+}
+
+func TestExport_MaxRowSizeSkipFollow(t *testing.T) {
+	users := schema.TableInfo{Name: "users", CreateStmt: "CREATE TABLE users (id int, bio text);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "bio"}}, PrimaryKey: []string{"id"}}
+	orders := schema.TableInfo{Name: "orders", CreateStmt: "CREATE TABLE orders (id int, user_id int);", Columns: []database.ColumnInfo{{Name: "id"}, {Name: "user_id"}}, PrimaryKey: []string{"id"}}
+	cfg := &config.Config{Configuration: map[string]*config.TableConfig{
+		"orders": {Retain: config.RetainConfig{Follow: "users"}},
+	}}
+
+	for _, columnar := range []bool{false, true} {
+		t.Run(fmt.Sprintf("columnar %v", columnar), func(t *testing.T) {
+			var driver database.Driver = &mockDriver{
+				dbType: "sqlite",
+				columns: map[string][]database.ColumnInfo{
+					"users":  users.Columns,
+					"orders": orders.Columns,
+				},
+				rows: map[string][]map[string]any{
+					"users": {
+						{"id": int64(1), "bio": "short"},
+						{"id": int64(2), "bio": strings.Repeat("x", 100)},
+					},
+					"orders": {
+						{"id": int64(10), "user_id": int64(1)},
+						{"id": int64(11), "user_id": int64(2)},
+					},
+				},
+				foreignKeys: []database.ForeignKey{
+					{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+				},
+			}
+			if columnar {
+				driver = &columnarMockDriver{mockDriver: *driver.(*mockDriver)}
+			}
+
+			stderr := os.Stderr
+			os.Stderr, _ = os.Open(os.DevNull)
+			var buf bytes.Buffer
+			exp := New(driver, anonymiser.New(cfg), &buf, Options{BatchSize: 10, MaxRowSize: 50, OversizedRows: OversizedSkip, VerifyFK: true})
+			err := exp.Export([]schema.TableInfo{users, orders})
+			os.Stderr = stderr
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			// The order of the skipped user goes with it
+			output := buf.String()
+			if !strings.Contains(output, "(10, 1)") || strings.Contains(output, "(11, 2)") {
+				t.Errorf("output = %q, want order 10 only", output)
+			}
+			stats := exp.GetStats()
+			if stats.RowsSkipped != 1 || stats.RowsFiltered != 1 || len(stats.Orphans) != 0 {
+				t.Errorf("RowsSkipped = %d, RowsFiltered = %d, Orphans = %v, want 1, 1 and none", stats.RowsSkipped, stats.RowsFiltered, stats.Orphans)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/fktracker"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+// setupFollows creates the tracker that filters the rows of tables whose
+// retain follows a parent table. It tracks only the foreign keys from each
+// such table to its parent, so that other relationships are left alone.
+func (e *Exporter) setupFollows(tables []schema.TableInfo) error {
+	position := make(map[string]int, len(tables))
+	for i, table := range tables {
+		position[table.Name] = i
+	}
+
+	// Parents must be exported first for their keys to be recorded
+	follows := make(map[string]string)
+	for i, table := range tables {
+		retainCfg := e.anonymiser.GetRetainConfig(table.Name)
+		if !retainCfg.IsFollow() {
+			continue
+		}
+		if pos, ok := position[retainCfg.Follow]; !ok || pos > i {
+			return fmt.Errorf("table %s follows %s, which must be exported before it", table.Name, retainCfg.Follow)
+		}
+		follows[table.Name] = retainCfg.Follow
+	}
+	if len(follows) == 0 {
+		return nil
+	}
+
+	fks, err := e.driver.GetForeignKeys()
+	if err != nil {
+		return fmt.Errorf("failed to get foreign keys: %w", err)
+	}
+
+	var followed []database.ForeignKey
+	for _, fk := range fks {
+		if follows[fk.Table] == fk.ReferencedTable {
+			followed = append(followed, fk)
+		}
+	}
+	for child, parent := range follows {
+		if !hasForeignKey(followed, child, parent) {
+			return fmt.Errorf("table %s follows %s but has no foreign key referencing it", child, parent)
+		}
+	}
+
+	e.followTracker = fktracker.New(followed)
+	return nil
+}
+
+// hasForeignKey returns true if fks includes a foreign key from child to parent.
+func hasForeignKey(fks []database.ForeignKey, child, parent string) bool {
+	for _, fk := range fks {
+		if fk.Table == child && fk.ReferencedTable == parent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package exporter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+// generatedClause matches the start of a generated column's clause up to the
+// opening parenthesis of its expression: GENERATED ALWAYS AS ( in MySQL and
+// SQLite, or just AS ( in MariaDB, whose first group is then empty.
+var generatedClause = regexp.MustCompile(`(?i)\s+(GENERATED\s+ALWAYS\s+)?AS\s*\(`)
+
+// generatedStorage matches the storage keyword that may follow the expression.
+var generatedStorage = regexp.MustCompile(`(?i)^\s+(?:VIRTUAL|STORED|PERSISTENT)\b`)
+
+// createStatement returns the table's CREATE statement, without the GENERATED
+// clauses of its generated columns when materialising their values.
+func (e *Exporter) createStatement(table schema.TableInfo) string {
+	if !e.materialise {
+		return table.CreateStmt
+	}
+	for _, col := range table.Columns {
+		if col.IsGenerated() {
+			return stripGeneratedClauses(table.CreateStmt)
+		}
+	}
+	return table.CreateStmt
+}
+
+// stripGeneratedClauses removes every "GENERATED ALWAYS AS (expr) VIRTUAL"
+// style clause from a CREATE TABLE statement, leaving plain columns. A bare
+// "AS (expr)" is only taken for MariaDB's clause when a storage keyword
+// follows it, so that an AS ( elsewhere, e.g. in a comment, is kept.
+func stripGeneratedClauses(stmt string) string {
+	var sb strings.Builder
+	for {
+		loc := generatedClause.FindStringSubmatchIndex(stmt)
+		if loc == nil {
+			break
+		}
+		end := closingParen(stmt, loc[1])
+		if end < 0 {
+			break
+		}
+		rest := stmt[end+1:]
+		storage := generatedStorage.FindStringIndex(rest)
+		if storage == nil && loc[2] < 0 {
+			sb.WriteString(stmt[:loc[1]])
+			stmt = stmt[loc[1]:]
+			continue
+		}
+		if storage != nil {
+			rest = rest[storage[1]:]
+		}
+
+		sb.WriteString(stmt[:loc[0]])
+		stmt = rest
+	}
+	sb.WriteString(stmt)
+	return sb.String()
+}
+
+// closingParen returns the index of the parenthesis closing the one opened
+// just before start, skipping quoted strings and identifiers, or -1.
+func closingParen(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '"', '`':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxInsertSize is the most bytes of an INSERT statement unless
+// Options.MaxInsertSize is set: mysqldump's default net_buffer_length, well
+// below the max_allowed_packet of MySQL and the statement sizes other
+// databases accept.
+const DefaultMaxInsertSize = 1 << 20
+
+// identifierLimits is the longest table or column name each database
+// accepts, in characters for MySQL and bytes for Postgres, which truncates
+// longer names rather than refusing them.
+var identifierLimits = map[string]int{
+	"mysql":    64,
+	"postgres": 63,
+}
+
+// insertBuilder writes the rows of a batch as INSERT statements, starting
+// another statement before one would grow past the maximum INSERT size. A
+// row larger than that on its own is written in a statement of its own.
+type insertBuilder struct {
+	e       *Exporter
+	table   string
+	columns []string
+	limit   int // Most bytes of a statement
+	sb      strings.Builder
+	start   int // Offset of the current statement in sb
+	rows    int // Rows in the current statement
+	written int // Rows in every statement
+}
+
+// newInsertBuilder returns an insertBuilder for rows of columns of tableName.
+func (e *Exporter) newInsertBuilder(tableName string, columns []string) *insertBuilder {
+	limit := e.maxInsertSize
+	if limit <= 0 {
+		limit = DefaultMaxInsertSize
+	}
+	return &insertBuilder{e: e, table: tableName, columns: columns, limit: limit}
+}
+
+// add writes a row of formatted values.
+func (b *insertBuilder) add(values []string) {
+	separator := b.e.rowSeparator()
+
+	// The statement would end with the row and its ";"
+	if b.rows > 0 && b.sb.Len()-b.start+len(separator)+b.e.rowSize(values)+1 > b.limit {
+		b.sb.WriteString(";\n")
+		b.rows = 0
+	}
+	if b.rows == 0 {
+		b.start = b.sb.Len()
+		b.e.writeInsertPrefix(&b.sb, b.table, b.columns)
+	} else {
+		b.sb.WriteString(separator)
+	}
+
+	b.sb.WriteString("(")
+	b.sb.WriteString(strings.Join(values, b.e.valueSeparator()))
+	b.sb.WriteString(")")
+	b.rows++
+	b.written++
+}
+
+// String returns the statements written, or an empty string if no rows were
+// added.
+func (b *insertBuilder) String() string {
+	if b.written == 0 {
+		return ""
+	}
+	return b.sb.String() + ";\n"
+}
+
+// longIdentifiers returns the table and column names longer than the
+// database accepts, which a restore refuses or truncates.
+func (e *Exporter) longIdentifiers(tableName string, columns []string) []string {
+	limit := identifierLimits[e.dbType]
+	if limit == 0 {
+		return nil
+	}
+
+	var long []string
+	for _, name := range append([]string{tableName}, columns...) {
+		length := len(name)
+		if e.dbType == "mysql" {
+			length = utf8.RuneCountInString(name)
+		}
+		if length > limit {
+			long = append(long, name)
+		}
+	}
+	return long
+}
@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The lines of mysqldumpHeader and mysqldumpFooter that turn foreign key
+// checks off and back on, left out when they are kept on.
+const (
+	mysqldumpFKChecksOff     = "/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;\n"
+	mysqldumpFKChecksRestore = "/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;\n"
+)
+
+// mysqldumpHeader opens a dump in mysqldump's default style, saving the
+// session settings that mysqldumpFooter restores. It is formatted with the
+// dump's character set.
+const mysqldumpHeader = `-- MySQL dump 10.13  Generated by dbmask
+--
+-- ------------------------------------------------------
+
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;
+/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;
+/*!50503 SET NAMES %s */;
+/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
+/*!40103 SET TIME_ZONE='+00:00' */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+` + mysqldumpFKChecksOff + `/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
+/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
+`
+
+// mysqldumpFooter restores the session settings saved by mysqldumpHeader.
+const mysqldumpFooter = `
+/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+` + mysqldumpFKChecksRestore + `/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
+/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+
+-- Dump completed on %s
+`
+
+// writeMysqldumpTableSchema writes a table's DROP and CREATE statements in
+// mysqldump's "Table structure" block.
+func (e *Exporter) writeMysqldumpTableSchema(tableName, createStmt string) error {
+	quoted := e.driver.QuoteIdentifier(tableName)
+	block := fmt.Sprintf(`
+--
+-- Table structure for table %s
+--
+
+%s
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+`, quoted, e.getDropTableStatement(tableName))
+
+	if _, err := e.writer.WriteString(block); err != nil {
+		return err
+	}
+	if _, err := e.writer.WriteVerbatim(createStmt); err != nil {
+		return err
+	}
+	_, err := e.writer.WriteString("\n/*!40101 SET character_set_client = @saved_cs_client */;\n")
+	return err
+}
+
+// writeMysqldumpDataStart opens mysqldump's "Dumping data" block, locking the
+// table and disabling its keys while rows are inserted.
+func (e *Exporter) writeMysqldumpDataStart(tableName string) error {
+	quoted := e.driver.QuoteIdentifier(tableName)
+	block := fmt.Sprintf(`
+--
+-- Dumping data for table %s
+--
+
+LOCK TABLES %s WRITE;
+/*!40000 ALTER TABLE %s DISABLE KEYS */;
+`, quoted, quoted, quoted)
+
+	_, err := e.dataWriter().WriteString(block)
+	return err
+}
+
+// writeMysqldumpDataEnd closes the block opened by writeMysqldumpDataStart.
+func (e *Exporter) writeMysqldumpDataEnd(tableName string) error {
+	quoted := e.driver.QuoteIdentifier(tableName)
+	block := fmt.Sprintf("/*!40000 ALTER TABLE %s ENABLE KEYS */;\nUNLOCK TABLES;\n", quoted)
+
+	_, err := e.dataWriter().WriteString(block)
+	return err
+}
+
+// writeMysqldumpFooter writes the closing settings and completion comment.
+func (e *Exporter) writeMysqldumpFooter(w *sqlWriter) error {
+	footer := mysqldumpFooter
+	if e.keepFKChecks {
+		footer = strings.Replace(footer, mysqldumpFKChecksRestore, "", 1)
+	}
+	_, err := fmt.Fprintf(w, footer, time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
@@ -0,0 +1,220 @@
+package exporter
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+// Format is an output format an export can be written in.
+type Format string
+
+const (
+	// FormatSQL is a SQL dump that restores the tables (the default).
+	FormatSQL Format = "sql"
+
+	// FormatNDJSON is newline-delimited JSON, one object per row.
+	FormatNDJSON Format = "ndjson"
+
+	// FormatParams is a parameterised INSERT statement for each table, each
+	// followed by its rows as JSON arrays of the values to bind, one per line.
+	FormatParams Format = "params"
+)
+
+// ParseFormats parses a --format value: a comma-separated list of formats,
+// each at most once. An empty string means FormatSQL.
+func ParseFormats(s string) ([]Format, error) {
+	if s == "" {
+		return []Format{FormatSQL}, nil
+	}
+
+	var formats []Format
+	seen := make(map[Format]bool)
+	for _, part := range strings.Split(s, ",") {
+		format := Format(strings.TrimSpace(part))
+		switch format {
+		case FormatSQL, FormatNDJSON, FormatParams:
+		default:
+			return nil, fmt.Errorf("invalid format %q (must be %s, %s or %s)", format, FormatSQL, FormatNDJSON, FormatParams)
+		}
+		if seen[format] {
+			return nil, fmt.Errorf("format %q given more than once", format)
+		}
+		seen[format] = true
+		formats = append(formats, format)
+	}
+
+	return formats, nil
+}
+
+// ndjsonRow is one line of NDJSON output.
+type ndjsonRow struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// encodedBatch is a batch of rows encoded for each output.
+type encodedBatch struct {
+	sql    string
+	ndjson []byte
+	params []byte
+
+	// The table and columns of the rows, for the params statement
+	table   string
+	columns []string
+}
+
+// encodeBatch formats a batch as an INSERT statement and, when there are
+// NDJSON or params outputs, as lines of each holding the same rows. It is
+// safe to call concurrently.
+func (e *Exporter) encodeBatch(tableName string, columns []string, rows []map[string]any) encodedBatch {
+	rows = e.allowedRows(tableName, columns, rows)
+
+	stmt, rows := e.buildBatchInsert(tableName, columns, rows)
+	batch := encodedBatch{sql: stmt}
+	if e.ndjson != nil {
+		var buf bytes.Buffer
+		for _, row := range rows {
+			values := make(map[string]any, len(columns))
+			for _, col := range columns {
+				values[col] = e.jsonValue(row[col])
+			}
+			appendNDJSON(&buf, tableName, values)
+		}
+		batch.ndjson = buf.Bytes()
+	}
+	if e.params != nil && len(rows) > 0 {
+		var buf bytes.Buffer
+		for _, row := range rows {
+			values := make([]any, len(columns))
+			for j, col := range columns {
+				values[j] = e.jsonValue(row[col])
+			}
+			appendParams(&buf, values)
+		}
+		batch.params = buf.Bytes()
+		batch.table, batch.columns = tableName, columns
+	}
+
+	return batch
+}
+
+// writeEncoded writes an encoded batch to each output.
+func (e *Exporter) writeEncoded(batch encodedBatch) error {
+	if _, err := e.dataWriter().WriteString(batch.sql); err != nil {
+		return err
+	}
+	if e.ndjson != nil {
+		if _, err := e.ndjson.Write(batch.ndjson); err != nil {
+			return err
+		}
+	}
+	if e.params != nil && len(batch.params) > 0 {
+		if err := e.writeParamsStatement(batch.table, batch.columns); err != nil {
+			return err
+		}
+		if _, err := e.params.Write(batch.params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendNDJSON appends a row as a line of NDJSON. Values must have been
+// converted by jsonValue, so encoding cannot fail.
+func appendNDJSON(buf *bytes.Buffer, tableName string, values map[string]any) {
+	line, _ := json.Marshal(ndjsonRow{Table: tableName, Row: values})
+	buf.Write(line)
+	buf.WriteByte('\n')
+}
+
+// jsonValue converts a value to one encoding/json writes as the value the
+// SQL dump holds: text and dates as strings, numbers that JSON cannot hold
+// as strings, and decimals as numbers.
+func (e *Exporter) jsonValue(val any) any {
+	switch v := val.(type) {
+	case nil, bool, string, int, int32, int64:
+		return v
+	case []byte:
+		return string(v)
+	case sql.RawBytes:
+		return string(v)
+	case float32:
+		return jsonFloat(float64(v))
+	case float64:
+		return jsonFloat(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case database.ZeroDate:
+		if e.zeroDatesNull {
+			return nil
+		}
+		return string(v)
+	case *big.Int:
+		if v == nil {
+			return nil
+		}
+		return json.Number(v.String())
+	case *big.Float:
+		if v == nil {
+			return nil
+		}
+		return json.Number(v.Text('f', -1))
+	}
+
+	rv := reflect.ValueOf(val)
+
+	if s, ok := val.(fmt.Stringer); ok && rv.Kind() == reflect.Struct {
+		if str := s.String(); decimalPattern.MatchString(str) {
+			return json.Number(str)
+		}
+	}
+
+	if valuer, ok := val.(driver.Valuer); ok {
+		inner, err := valuer.Value()
+		if err != nil {
+			e.warnUnsupportedType(rv.Type(), err)
+			return nil
+		}
+		return e.jsonValue(inner)
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+		return e.jsonValue(rv.Elem().Interface())
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return jsonFloat(rv.Float())
+	case reflect.String:
+		return rv.String()
+	}
+
+	e.warnUnsupportedType(rv.Type(), nil)
+	return fmt.Sprintf("%v", val)
+}
+
+// jsonFloat returns f, or its text for NaN and infinities, which JSON
+// numbers cannot hold.
+func jsonFloat(f float64) any {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// paramsStatement is the line of params output that starts the rows of a
+// table: a parameterised INSERT statement and the columns its parameters
+// are bound to, in order.
+type paramsStatement struct {
+	Table     string   `json:"table"`
+	Statement string   `json:"statement"`
+	Columns   []string `json:"columns"`
+}
+
+// buildParamsStatement returns the parameterised INSERT statement for a row
+// of columns, with placeholders in the style of the database's driver.
+func (e *Exporter) buildParamsStatement(tableName string, columns []string) string {
+	quotedCols := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		quotedCols[i] = e.driver.QuoteIdentifier(col)
+		if e.dbType == "postgres" {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		e.driver.QuoteIdentifier(tableName), strings.Join(quotedCols, ", "), strings.Join(placeholders, ", "))
+}
+
+// appendParams appends a row as a line of params output, a JSON array of its
+// values. Values must have been converted by jsonValue, so encoding cannot fail.
+func appendParams(buf *bytes.Buffer, values []any) {
+	line, _ := json.Marshal(values)
+	buf.Write(line)
+	buf.WriteByte('\n')
+}
+
+// writeParamsStatement writes the statement line for a table's rows, unless
+// it is the table the last rows were written for.
+func (e *Exporter) writeParamsStatement(tableName string, columns []string) error {
+	if e.paramsTable == tableName {
+		return nil
+	}
+
+	line, err := json.Marshal(paramsStatement{
+		Table:     tableName,
+		Statement: e.buildParamsStatement(tableName, columns),
+		Columns:   columns,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := e.params.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	e.paramsTable = tableName
+	return nil
+}
@@ -0,0 +1,103 @@
+package exporter
+
+import "sync"
+
+// MaxThreads is the most read or write threads an export may use.
+const MaxThreads = 64
+
+// ClampThreads limits a read or write thread count to [1, MaxThreads].
+// One thread on each side reproduces the serial export.
+func ClampThreads(n int) int {
+	return min(max(n, 1), MaxThreads)
+}
+
+// batchPipeline hands batches of rows from the reader to worker goroutines
+// that format them, e.g. as INSERT statements, and on to a single writer
+// goroutine, through bounded channels. The next batch can be read while
+// earlier ones are formatted and written. Results are written in the order
+// their batches were sent, however many workers format them.
+type batchPipeline[T any] struct {
+	jobs    chan pipelineJob[T]
+	pending chan chan T   // per-batch results, in send order
+	failed  chan struct{} // closed when write returns an error
+	done    chan struct{} // closed when the writer goroutine exits
+	workers sync.WaitGroup
+	err     error
+}
+
+// pipelineJob is a batch waiting to be formatted.
+type pipelineJob[T any] struct {
+	batch  []map[string]any
+	result chan T
+}
+
+// newBatchPipeline starts workers goroutines calling format for each batch
+// and a writer goroutine calling write with the results. depth is the number
+// of batches that may wait to be formatted and written.
+func newBatchPipeline[T any](depth, workers int, format func([]map[string]any) T, write func(T) error) *batchPipeline[T] {
+	p := &batchPipeline[T]{
+		jobs:    make(chan pipelineJob[T], depth),
+		pending: make(chan chan T, depth),
+		failed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < max(workers, 1); i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				job.result <- format(job.batch)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+		for result := range p.pending {
+			formatted := <-result
+			// Drain remaining batches after a failure so senders never block
+			if p.err != nil {
+				continue
+			}
+			if err := write(formatted); err != nil {
+				p.err = err
+				close(p.failed)
+			}
+		}
+	}()
+
+	return p
+}
+
+// send queues a batch for formatting and writing, blocking while the
+// pipeline is full. It returns the writer's error if a previous write failed.
+func (p *batchPipeline[T]) send(batch []map[string]any) error {
+	select {
+	case <-p.failed:
+		return p.err
+	default:
+	}
+
+	result := make(chan T, 1)
+	select {
+	case p.pending <- result:
+	case <-p.failed:
+		return p.err
+	}
+
+	// The writer is waiting on result, so the job must be queued even if
+	// a write has since failed
+	p.jobs <- pipelineJob[T]{batch: batch, result: result}
+	return nil
+}
+
+// close waits for every queued batch to be written and returns the first
+// write error, if any.
+func (p *batchPipeline[T]) close() error {
+	close(p.jobs)
+	close(p.pending)
+	<-p.done
+	p.workers.Wait()
+	return p.err
+}
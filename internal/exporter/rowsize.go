@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OversizedRowAction is what happens to a row whose formatted values are
+// larger than Options.MaxRowSize.
+type OversizedRowAction string
+
+const (
+	// OversizedWarn writes the row, with a warning (the default).
+	OversizedWarn OversizedRowAction = "warn"
+
+	// OversizedSkip leaves the row out of the dump, with a warning.
+	OversizedSkip OversizedRowAction = "skip"
+)
+
+// ParseOversizedRowAction parses an --oversized-rows value. An empty string
+// means OversizedWarn.
+func ParseOversizedRowAction(s string) (OversizedRowAction, error) {
+	switch OversizedRowAction(s) {
+	case "", OversizedWarn:
+		return OversizedWarn, nil
+	case OversizedSkip:
+		return OversizedSkip, nil
+	default:
+		return "", fmt.Errorf("invalid oversized row action %q: expected %q or %q", s, OversizedWarn, OversizedSkip)
+	}
+}
+
+// rowSize returns the length of a row's formatted values as written in an
+// INSERT, with their separators and parentheses.
+func (e *Exporter) rowSize(values []string) int {
+	size := 2 + len(e.valueSeparator())*max(len(values)-1, 0)
+	for _, v := range values {
+		size += len(v)
+	}
+	return size
+}
+
+// allowRowSize reports whether a row whose formatted values are size bytes
+// is written. Rows over MaxRowSize are warned about, naming the table and the
+// row's primary key, and left out if oversized rows are skipped. value looks
+// up a column's value in the row. It is safe to call concurrently.
+func (e *Exporter) allowRowSize(tableName string, size int, value func(col string) any) bool {
+	if e.maxRowSize <= 0 || size <= e.maxRowSize {
+		return true
+	}
+
+	key := "no primary key"
+	if pk := e.primaryKeys[tableName]; len(pk) > 0 {
+		parts := make([]string, len(pk))
+		for i, col := range pk {
+			parts[i] = col + " = " + e.formatValue(value(col))
+		}
+		key = "primary key " + strings.Join(parts, ", ")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats.RowsOversized++
+	if e.skipOversized {
+		e.stats.RowsSkipped++
+		fmt.Fprintf(os.Stderr, "Warning: skipping row of %s with %s, whose %d bytes exceed the maximum row size of %d\n", tableName, key, size, e.maxRowSize)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Warning: row of %s with %s is %d bytes, over the maximum row size of %d\n", tableName, key, size, e.maxRowSize)
+	return true
+}
@@ -0,0 +1,57 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+// writeSequences writes the standalone sequences of drivers that have them.
+func (e *Exporter) writeSequences() error {
+	lister, ok := e.driver.(database.SequenceLister)
+	if !ok {
+		return nil
+	}
+
+	sequences, err := lister.GetSequences()
+	if err != nil {
+		return fmt.Errorf("failed to get sequences: %w", err)
+	}
+	if e.verbose && len(sequences) > 0 {
+		e.logf("Exporting %d sequence(s)\n", len(sequences))
+	}
+
+	for _, seq := range sequences {
+		if _, err := e.writer.WriteString(e.buildSequence(seq)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildSequence returns the statements that create a sequence and, unless
+// exporting the schema only, restore its current value.
+func (e *Exporter) buildSequence(seq database.Sequence) string {
+	quoted := e.driver.QuoteIdentifier(seq.Name)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n--\n-- Sequence: %s\n--\n\n", seq.Name)
+	sb.WriteString("CREATE SEQUENCE IF NOT EXISTS " + quoted)
+	// AS was added in PostgreSQL 10; bigint is the default
+	if seq.DataType != "" && seq.DataType != "bigint" {
+		sb.WriteString(" AS " + seq.DataType)
+	}
+	fmt.Fprintf(&sb, " START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d", seq.Start, seq.Increment, seq.MinValue, seq.MaxValue)
+	if seq.Cycle {
+		sb.WriteString(" CYCLE;\n")
+	} else {
+		sb.WriteString(" NO CYCLE;\n")
+	}
+
+	if !e.schemaOnly && seq.LastValue.Valid {
+		fmt.Fprintf(&sb, "SELECT setval(%s, %d, true);\n", e.escapeString(quoted), seq.LastValue.Int64)
+	}
+
+	return sb.String()
+}
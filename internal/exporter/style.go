@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LineEnding is the line ending written to SQL dumps.
+type LineEnding string
+
+const (
+	// LineEndingLF ends lines with \n (the default).
+	LineEndingLF LineEnding = "lf"
+
+	// LineEndingCRLF ends lines with \r\n.
+	LineEndingCRLF LineEnding = "crlf"
+)
+
+// ParseLineEnding parses a --line-endings value. An empty string means
+// LineEndingLF.
+func ParseLineEnding(s string) (LineEnding, error) {
+	switch LineEnding(s) {
+	case "", LineEndingLF:
+		return LineEndingLF, nil
+	case LineEndingCRLF:
+		return LineEndingCRLF, nil
+	default:
+		return "", fmt.Errorf("invalid line ending %q: expected %q or %q", s, LineEndingLF, LineEndingCRLF)
+	}
+}
+
+// InsertStyle is how the rows of INSERT statements are laid out.
+type InsertStyle string
+
+const (
+	// InsertMultiline writes each row of an INSERT on its own line (the default).
+	InsertMultiline InsertStyle = "multiline"
+
+	// InsertCompact writes each INSERT on one line, without spaces between values.
+	InsertCompact InsertStyle = "compact"
+)
+
+// ParseInsertStyle parses an --insert-style value. An empty string means
+// InsertMultiline.
+func ParseInsertStyle(s string) (InsertStyle, error) {
+	switch InsertStyle(s) {
+	case "", InsertMultiline:
+		return InsertMultiline, nil
+	case InsertCompact:
+		return InsertCompact, nil
+	default:
+		return "", fmt.Errorf("invalid insert style %q: expected %q or %q", s, InsertMultiline, InsertCompact)
+	}
+}
+
+// sqlWriter buffers a SQL dump. With crlf set, each \n the exporter writes
+// is written as \r\n. Text read from the database or the config, such as a
+// CREATE statement, is written by WriteVerbatim, so that newlines within its
+// string literals are kept as they are. Values in INSERT statements never
+// hold a bare newline, which escapeString writes as \n.
+type sqlWriter struct {
+	*bufio.Writer
+	crlf bool
+}
+
+func newSQLWriter(w io.Writer, ending LineEnding) *sqlWriter {
+	return &sqlWriter{Writer: bufio.NewWriterSize(w, BufferSize), crlf: ending == LineEndingCRLF}
+}
+
+func (w *sqlWriter) Write(p []byte) (int, error) {
+	if !w.crlf {
+		return w.Writer.Write(p)
+	}
+	if _, err := w.Writer.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *sqlWriter) WriteString(s string) (int, error) {
+	if !w.crlf {
+		return w.Writer.WriteString(s)
+	}
+	if _, err := w.Writer.WriteString(strings.ReplaceAll(s, "\n", "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+// WriteVerbatim writes s without converting its line endings.
+func (w *sqlWriter) WriteVerbatim(s string) (int, error) {
+	return w.Writer.WriteString(s)
+}
@@ -0,0 +1,197 @@
+// Package fktracker records the foreign key values emitted in a dump so that
+// references to rows missing from the dump can be reported.
+package fktracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+// Orphan is a foreign key value with no matching row in the referenced table.
+type Orphan struct {
+	ForeignKey database.ForeignKey
+	Value      string
+}
+
+// String formats the orphan as "table.column = value -> parent.column".
+func (o Orphan) String() string {
+	return fmt.Sprintf("%s.%s = %s -> %s.%s",
+		o.ForeignKey.Table, o.ForeignKey.Column, o.Value,
+		o.ForeignKey.ReferencedTable, o.ForeignKey.ReferencedColumn)
+}
+
+// Tracker records emitted parent key values and child foreign key values.
+type Tracker struct {
+	foreignKeys []database.ForeignKey
+	childFKs    map[string][]int           // table -> indexes into foreignKeys
+	parentCols  map[string]map[string]bool // table -> referenced columns
+	parents     map[string]map[string]bool // "table.column" -> emitted values
+	children    []map[string]bool          // per foreign key -> emitted values
+}
+
+// New creates a Tracker for the given foreign keys.
+func New(fks []database.ForeignKey) *Tracker {
+	t := &Tracker{
+		foreignKeys: fks,
+		childFKs:    make(map[string][]int),
+		parentCols:  make(map[string]map[string]bool),
+		parents:     make(map[string]map[string]bool),
+		children:    make([]map[string]bool, len(fks)),
+	}
+
+	for i, fk := range fks {
+		t.childFKs[fk.Table] = append(t.childFKs[fk.Table], i)
+		if t.parentCols[fk.ReferencedTable] == nil {
+			t.parentCols[fk.ReferencedTable] = make(map[string]bool)
+		}
+		t.parentCols[fk.ReferencedTable][fk.ReferencedColumn] = true
+		t.parents[parentKey(fk.ReferencedTable, fk.ReferencedColumn)] = make(map[string]bool)
+		t.children[i] = make(map[string]bool)
+	}
+
+	return t
+}
+
+// Record records the values of one emitted row of table.
+// columns and values must be the same length.
+func (t *Tracker) Record(table string, columns []string, values []any) {
+	fkIndexes := t.childFKs[table]
+	parentCols := t.parentCols[table]
+	if len(fkIndexes) == 0 && len(parentCols) == 0 {
+		return
+	}
+
+	for i, col := range columns {
+		if values[i] == nil {
+			continue
+		}
+
+		if parentCols[col] {
+			t.parents[parentKey(table, col)][formatKey(values[i])] = true
+		}
+
+		for _, idx := range fkIndexes {
+			if t.foreignKeys[idx].Column == col {
+				t.children[idx][formatKey(values[i])] = true
+			}
+		}
+	}
+}
+
+// Orphans returns every recorded child value with no matching parent value,
+// sorted by table, column and value.
+func (t *Tracker) Orphans() []Orphan {
+	var orphans []Orphan
+	for i, fk := range t.foreignKeys {
+		parents := t.parents[parentKey(fk.ReferencedTable, fk.ReferencedColumn)]
+		for value := range t.children[i] {
+			if !parents[value] {
+				orphans = append(orphans, Orphan{ForeignKey: fk, Value: value})
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		a, b := orphans[i], orphans[j]
+		if a.ForeignKey.Table != b.ForeignKey.Table {
+			return a.ForeignKey.Table < b.ForeignKey.Table
+		}
+		if a.ForeignKey.Column != b.ForeignKey.Column {
+			return a.ForeignKey.Column < b.ForeignKey.Column
+		}
+		return a.Value < b.Value
+	})
+
+	return orphans
+}
+
+// Allows reports whether every foreign key value in a row of table references
+// a recorded parent value. Self-references are not checked, as the parent
+// row may come later in the same table.
+func (t *Tracker) Allows(table string, columns []string, values []any) bool {
+	for _, idx := range t.childFKs[table] {
+		fk := t.foreignKeys[idx]
+		if fk.ReferencedTable == table {
+			continue
+		}
+		for i, col := range columns {
+			if col != fk.Column || values[i] == nil {
+				continue
+			}
+			if !t.parents[parentKey(fk.ReferencedTable, fk.ReferencedColumn)][formatKey(values[i])] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// manifest is the JSON form of a Tracker's recorded parent values.
+type manifest struct {
+	Parents map[string][]string `json:"parents"` // "table.column" -> values
+}
+
+// Save writes the recorded parent values to a JSON manifest, so that a
+// later export can Load them in place of re-reading the parent tables.
+func (t *Tracker) Save(path string) error {
+	m := manifest{Parents: make(map[string][]string, len(t.parents))}
+	for key, set := range t.parents {
+		values := make([]string, 0, len(set))
+		for value := range set {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		m.Parents[key] = values
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal FK manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write FK manifest: %w", err)
+	}
+	return nil
+}
+
+// Load adds the parent values of a JSON manifest written by Save to the
+// values recorded so far.
+func (t *Tracker) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read FK manifest: %w", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to parse FK manifest: %w", err)
+	}
+
+	for key, values := range m.Parents {
+		if t.parents[key] == nil {
+			t.parents[key] = make(map[string]bool, len(values))
+		}
+		for _, value := range values {
+			t.parents[key][value] = true
+		}
+	}
+	return nil
+}
+
+// parentKey returns the lookup key for a referenced column.
+func parentKey(table, column string) string {
+	return table + "." + column
+}
+
+// formatKey normalises a value so that equal keys compare equal regardless
+// of how the driver scanned them (e.g. []byte vs string).
+func formatKey(val any) string {
+	if b, ok := val.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,142 @@
+package fktracker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+)
+
+func TestTracker_Orphans(t *testing.T) {
+	fks := []database.ForeignKey{
+		{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+		{Table: "orders", Column: "product_code", ReferencedTable: "products", ReferencedColumn: "code"},
+	}
+
+	tracker := New(fks)
+	tracker.Record("users", []string{"id", "name"}, []any{int64(1), "John"})
+	tracker.Record("users", []string{"id", "name"}, []any{int64(2), "Jane"})
+	tracker.Record("products", []string{"code"}, []any{[]byte("ABC")})
+	tracker.Record("orders", []string{"id", "user_id", "product_code"}, []any{int64(1), int64(1), "ABC"})
+	tracker.Record("orders", []string{"id", "user_id", "product_code"}, []any{int64(2), int64(5), "XYZ"})
+	tracker.Record("orders", []string{"id", "user_id", "product_code"}, []any{int64(3), int64(5), nil})
+	tracker.Record("unrelated", []string{"id"}, []any{int64(9)})
+
+	orphans := tracker.Orphans()
+	want := []string{
+		"orders.product_code = XYZ -> products.code",
+		"orders.user_id = 5 -> users.id",
+	}
+	if len(orphans) != len(want) {
+		t.Fatalf("Orphans() = %v, want %v", orphans, want)
+	}
+	for i, orphan := range orphans {
+		if orphan.String() != want[i] {
+			t.Errorf("Orphans()[%d] = %q, want %q", i, orphan.String(), want[i])
+		}
+	}
+}
+
+func TestTracker_NoOrphans(t *testing.T) {
+	tracker := New([]database.ForeignKey{
+		{Table: "comments", Column: "parent_id", ReferencedTable: "comments", ReferencedColumn: "id"},
+	})
+	tracker.Record("comments", []string{"id", "parent_id"}, []any{int64(1), nil})
+	tracker.Record("comments", []string{"id", "parent_id"}, []any{int64(2), int64(1)})
+
+	if orphans := tracker.Orphans(); len(orphans) != 0 {
+		t.Errorf("Orphans() = %v, want none", orphans)
+	}
+}
+
+func TestTracker_SaveLoad(t *testing.T) {
+	fks := []database.ForeignKey{
+		{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+	}
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	first := New(fks)
+	first.Record("users", []string{"id"}, []any{int64(2)})
+	first.Record("users", []string{"id"}, []any{[]byte("1")})
+	if err := first.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	second := New(fks)
+	if err := second.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	second.Record("orders", []string{"id", "user_id"}, []any{int64(1), int64(1)})
+	second.Record("orders", []string{"id", "user_id"}, []any{int64(2), int64(2)})
+	if orphans := second.Orphans(); len(orphans) != 0 {
+		t.Errorf("Orphans() after Load = %v, want none", orphans)
+	}
+
+	roundTrip := filepath.Join(t.TempDir(), "round-trip.json")
+	if err := second.Save(roundTrip); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	want, _ := os.ReadFile(path)
+	got, _ := os.ReadFile(roundTrip)
+	if string(got) != string(want) {
+		t.Errorf("round-trip manifest = %s, want %s", got, want)
+	}
+}
+
+func TestTracker_LoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "missing file", path: filepath.Join(dir, "missing.json")},
+		{name: "invalid JSON", path: invalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := New(nil).Load(tt.path); err == nil {
+				t.Error("Load() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTracker_Allows(t *testing.T) {
+	tracker := New([]database.ForeignKey{
+		{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+		{Table: "comments", Column: "parent_id", ReferencedTable: "comments", ReferencedColumn: "id"},
+	})
+	tracker.Record("users", []string{"id"}, []any{int64(1)})
+
+	tests := []struct {
+		name   string
+		table  string
+		values []any
+		want   bool
+	}{
+		{name: "known parent", table: "orders", values: []any{int64(1), int64(1)}, want: true},
+		{name: "unknown parent", table: "orders", values: []any{int64(2), int64(7)}, want: false},
+		{name: "null reference", table: "orders", values: []any{int64(3), nil}, want: true},
+		{name: "self reference", table: "comments", values: []any{int64(1), int64(9)}, want: true},
+		{name: "no foreign keys", table: "users", values: []any{int64(5), int64(5)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns := []string{"id", "user_id"}
+			if tt.table == "comments" {
+				columns = []string{"id", "parent_id"}
+			}
+			if got := tracker.Allows(tt.table, columns, tt.values); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
 )
@@ -11,12 +12,14 @@ type TableInfo struct {
 	Name       string
 	CreateStmt string
 	Columns    []database.ColumnInfo
+	PrimaryKey []string
 	RowCount   int64
 }
 
 // Analyser handles schema extraction and analysis.
 type Analyser struct {
 	driver database.Driver
+	groups map[string]string // Table -> group label, used to keep related tables together
 }
 
 // NewAnalyser creates a new schema analyser.
@@ -24,6 +27,12 @@ func NewAnalyser(driver database.Driver) *Analyser {
 	return &Analyser{driver: driver}
 }
 
+// SetGroups sets the group label of each table. When sorting by dependency,
+// tables sharing a group are kept as close together as the dependencies allow.
+func (a *Analyser) SetGroups(groups map[string]string) {
+	a.groups = groups
+}
+
 // GetAllTables returns information about all tables in the database.
 func (a *Analyser) GetAllTables() ([]TableInfo, error) {
 	tables, err := a.driver.GetTables()
@@ -43,6 +52,11 @@ func (a *Analyser) GetAllTables() ([]TableInfo, error) {
 			return nil, fmt.Errorf("failed to get columns for %s: %w", table, err)
 		}
 
+		primaryKey, err := a.driver.GetPrimaryKey(table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get primary key for %s: %w", table, err)
+		}
+
 		rowCount, err := a.driver.GetRowCount(table)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get row count for %s: %w", table, err)
@@ -52,6 +66,7 @@ func (a *Analyser) GetAllTables() ([]TableInfo, error) {
 			Name:       table,
 			CreateStmt: schema,
 			Columns:    columns,
+			PrimaryKey: primaryKey,
 			RowCount:   rowCount,
 		})
 	}
@@ -59,6 +74,47 @@ func (a *Analyser) GetAllTables() ([]TableInfo, error) {
 	return tableInfos, nil
 }
 
+// SortOrder selects the order in which tables are exported.
+type SortOrder string
+
+const (
+	// SortDependency orders tables so that referenced tables come first.
+	SortDependency SortOrder = "dependency"
+	// SortAlpha orders tables by name.
+	SortAlpha SortOrder = "alpha"
+	// SortNone keeps the order in which the driver listed the tables.
+	SortNone SortOrder = "none"
+)
+
+// ParseSortOrder parses a --sort-tables value. An empty string means SortDependency.
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(s) {
+	case "", SortDependency:
+		return SortDependency, nil
+	case SortAlpha, SortNone:
+		return SortOrder(s), nil
+	default:
+		return "", fmt.Errorf("invalid sort order %q: expected %q, %q or %q", s, SortDependency, SortAlpha, SortNone)
+	}
+}
+
+// SortTables returns tables in the given order.
+func (a *Analyser) SortTables(tables []TableInfo, order SortOrder) ([]TableInfo, error) {
+	switch order {
+	case SortAlpha:
+		sorted := make([]TableInfo, len(tables))
+		copy(sorted, tables)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Name < sorted[j].Name
+		})
+		return sorted, nil
+	case SortNone:
+		return tables, nil
+	default:
+		return a.SortTablesByDependency(tables)
+	}
+}
+
 // SortTablesByDependency returns tables sorted by foreign key dependencies.
 // Tables with no dependencies come first, then tables that depend on them, etc.
 func (a *Analyser) SortTablesByDependency(tables []TableInfo) ([]TableInfo, error) {
@@ -89,7 +145,7 @@ func (a *Analyser) SortTablesByDependency(tables []TableInfo) ([]TableInfo, erro
 	}
 
 	// Topological sort using Kahn's algorithm
-	sorted, err := topologicalSort(tables, dependencies)
+	sorted, err := topologicalSort(tables, dependencies, a.groups)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +154,9 @@ func (a *Analyser) SortTablesByDependency(tables []TableInfo) ([]TableInfo, erro
 }
 
 // topologicalSort performs a topological sort on tables based on dependencies.
-func topologicalSort(tables []TableInfo, dependencies map[string][]string) ([]TableInfo, error) {
+// Among the tables that are ready to be emitted, one in the same group as the
+// previous table is preferred, so that grouped tables stay adjacent.
+func topologicalSort(tables []TableInfo, dependencies map[string][]string, groups map[string]string) ([]TableInfo, error) {
 	// Build in-degree map
 	inDegree := make(map[string]int)
 	for _, t := range tables {
@@ -131,9 +189,20 @@ func topologicalSort(tables []TableInfo, dependencies map[string][]string) ([]Ta
 	// Process queue
 	var sorted []TableInfo
 	for len(queue) > 0 {
-		// Pop from queue
-		current := queue[0]
-		queue = queue[1:]
+		// Pop from queue, preferring the group of the previous table
+		next := 0
+		if len(sorted) > 0 {
+			if group := groups[sorted[len(sorted)-1].Name]; group != "" {
+				for i, name := range queue {
+					if groups[name] == group {
+						next = i
+						break
+					}
+				}
+			}
+		}
+		current := queue[next]
+		queue = append(queue[:next], queue[next+1:]...)
 
 		sorted = append(sorted, tableMap[current])
 
@@ -179,3 +248,40 @@ func (a *Analyser) GetForeignKeyMap() (map[string][]database.ForeignKey, error)
 
 	return fkMap, nil
 }
+
+// OrphanedForeignKey is a foreign key that some rows break by referencing a
+// row missing from the referenced table.
+type OrphanedForeignKey struct {
+	database.ForeignKey
+	Rows int64 // Number of rows referencing a missing row
+}
+
+// FindOrphanedForeignKeys counts the rows breaking each foreign key and
+// returns the foreign keys broken by at least one row, ordered by table.
+func (a *Analyser) FindOrphanedForeignKeys() ([]OrphanedForeignKey, error) {
+	fkMap, err := a.GetForeignKeyMap()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get foreign keys: %w", err)
+	}
+
+	tables := make([]string, 0, len(fkMap))
+	for table := range fkMap {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var orphaned []OrphanedForeignKey
+	for _, table := range tables {
+		for _, fk := range fkMap[table] {
+			rows, err := a.driver.GetOrphanCount(fk)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check %s.%s: %w", fk.Table, fk.Column, err)
+			}
+			if rows > 0 {
+				orphaned = append(orphaned, OrphanedForeignKey{ForeignKey: fk, Rows: rows})
+			}
+		}
+	}
+
+	return orphaned, nil
+}
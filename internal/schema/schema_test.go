@@ -2,6 +2,7 @@ package schema
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
@@ -15,6 +16,8 @@ type mockDriver struct {
 	columns    map[string][]database.ColumnInfo
 	rowCounts  map[string]int64
 	foreignKeys []database.ForeignKey
+	primaryKeys map[string][]string
+	orphans     map[string]int64 // "table.column" -> rows breaking the foreign key
 
 	// Error injection
 	getTablesErr     error
@@ -61,6 +64,13 @@ func (m *mockDriver) GetForeignKeys() ([]database.ForeignKey, error) {
 	return m.foreignKeys, nil
 }
 
+func (m *mockDriver) GetPrimaryKey(table string) ([]string, error) {
+	return m.primaryKeys[table], nil
+}
+func (m *mockDriver) GetServerVersion() (string, error) {
+	return "3.45.1", nil
+}
+
 func (m *mockDriver) StreamRows(table string, opts database.StreamOptions, batchSize int, callback database.RowCallback) error {
 	return nil
 }
@@ -75,6 +85,14 @@ func (m *mockDriver) GetRowCount(table string) (int64, error) {
 	return 0, nil
 }
 
+func (m *mockDriver) GetDistinctCount(table, column string, opts database.StreamOptions) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockDriver) GetOrphanCount(fk database.ForeignKey) (int64, error) {
+	return m.orphans[fk.Table+"."+fk.Column], nil
+}
+
 func (m *mockDriver) QuoteIdentifier(name string) string {
 	return "\"" + name + "\""
 }
@@ -509,7 +527,7 @@ func TestTopologicalSort_EdgeCases(t *testing.T) {
 		tables := []TableInfo{}
 		deps := map[string][]string{}
 
-		sorted, err := topologicalSort(tables, deps)
+		sorted, err := topologicalSort(tables, deps, nil)
 		if err != nil {
 			t.Fatalf("topologicalSort() error = %v", err)
 		}
@@ -523,7 +541,7 @@ func TestTopologicalSort_EdgeCases(t *testing.T) {
 		tables := []TableInfo{{Name: "users"}}
 		deps := map[string][]string{"users": {}}
 
-		sorted, err := topologicalSort(tables, deps)
+		sorted, err := topologicalSort(tables, deps, nil)
 		if err != nil {
 			t.Fatalf("topologicalSort() error = %v", err)
 		}
@@ -552,7 +570,7 @@ func TestTopologicalSort_EdgeCases(t *testing.T) {
 			"D": {"B", "C"},
 		}
 
-		sorted, err := topologicalSort(tables, deps)
+		sorted, err := topologicalSort(tables, deps, nil)
 		if err != nil {
 			t.Fatalf("topologicalSort() error = %v", err)
 		}
@@ -572,3 +590,187 @@ func TestTopologicalSort_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestTopologicalSort_Groups(t *testing.T) {
+	// orders and order_items both depend on users; audit_logs and audit_events
+	// have no dependencies but are listed apart from each other.
+	tables := []TableInfo{
+		{Name: "audit_logs"},
+		{Name: "users"},
+		{Name: "orders"},
+		{Name: "audit_events"},
+		{Name: "order_items"},
+	}
+	deps := map[string][]string{
+		"orders":      {"users"},
+		"order_items": {"orders"},
+	}
+
+	t.Run("without groups keeps queue order", func(t *testing.T) {
+		sorted, err := topologicalSort(tables, deps, nil)
+		if err != nil {
+			t.Fatalf("topologicalSort() error = %v", err)
+		}
+
+		want := []string{"audit_logs", "users", "audit_events", "orders", "order_items"}
+		for i, name := range want {
+			if sorted[i].Name != name {
+				t.Fatalf("topologicalSort() = %v, want %v", tableNames(sorted), want)
+			}
+		}
+	})
+
+	t.Run("groups break ties", func(t *testing.T) {
+		groups := map[string]string{
+			"audit_logs":   "audit",
+			"audit_events": "audit",
+			"users":        "sales",
+			"orders":       "sales",
+			"order_items":  "sales",
+		}
+
+		sorted, err := topologicalSort(tables, deps, groups)
+		if err != nil {
+			t.Fatalf("topologicalSort() error = %v", err)
+		}
+
+		want := []string{"audit_logs", "audit_events", "users", "orders", "order_items"}
+		for i, name := range want {
+			if sorted[i].Name != name {
+				t.Fatalf("topologicalSort() = %v, want %v", tableNames(sorted), want)
+			}
+		}
+	})
+
+	t.Run("groups never override dependencies", func(t *testing.T) {
+		groups := map[string]string{"order_items": "audit", "audit_logs": "audit"}
+
+		sorted, err := topologicalSort(tables, deps, groups)
+		if err != nil {
+			t.Fatalf("topologicalSort() error = %v", err)
+		}
+
+		pos := make(map[string]int)
+		for i, t := range sorted {
+			pos[t.Name] = i
+		}
+		if pos["users"] > pos["orders"] || pos["orders"] > pos["order_items"] {
+			t.Errorf("topologicalSort() = %v, dependencies out of order", tableNames(sorted))
+		}
+	})
+}
+
+func tableNames(tables []TableInfo) []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.Name
+	}
+	return names
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SortOrder
+		wantErr bool
+	}{
+		{"", SortDependency, false},
+		{"dependency", SortDependency, false},
+		{"alpha", SortAlpha, false},
+		{"none", SortNone, false},
+		{"random", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSortOrder(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSortOrder(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSortOrder(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortTables(t *testing.T) {
+	driver := &mockDriver{
+		foreignKeys: []database.ForeignKey{
+			{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+			{Table: "users", Column: "team_id", ReferencedTable: "teams", ReferencedColumn: "id"},
+		},
+	}
+	tables := []TableInfo{{Name: "orders"}, {Name: "users"}, {Name: "audit"}, {Name: "teams"}}
+
+	names := func(tables []TableInfo) []string {
+		result := make([]string, len(tables))
+		for i, table := range tables {
+			result[i] = table.Name
+		}
+		return result
+	}
+
+	t.Run("dependency", func(t *testing.T) {
+		sorted, err := NewAnalyser(driver).SortTables(tables, SortDependency)
+		if err != nil {
+			t.Fatalf("SortTables() error = %v", err)
+		}
+		position := make(map[string]int)
+		for i, name := range names(sorted) {
+			position[name] = i
+		}
+		if len(sorted) != 4 || position["teams"] > position["users"] || position["users"] > position["orders"] {
+			t.Errorf("SortTables(dependency) = %v, want teams before users before orders", names(sorted))
+		}
+	})
+
+	t.Run("alpha", func(t *testing.T) {
+		sorted, err := NewAnalyser(driver).SortTables(tables, SortAlpha)
+		if err != nil {
+			t.Fatalf("SortTables() error = %v", err)
+		}
+		want := []string{"audit", "orders", "teams", "users"}
+		if got := names(sorted); !reflect.DeepEqual(got, want) {
+			t.Errorf("SortTables(alpha) = %v, want %v", got, want)
+		}
+		if tables[0].Name != "orders" {
+			t.Error("SortTables(alpha) should not reorder its input")
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		sorted, err := NewAnalyser(driver).SortTables(tables, SortNone)
+		if err != nil {
+			t.Fatalf("SortTables() error = %v", err)
+		}
+		want := []string{"orders", "users", "audit", "teams"}
+		if got := names(sorted); !reflect.DeepEqual(got, want) {
+			t.Errorf("SortTables(none) = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestFindOrphanedForeignKeys(t *testing.T) {
+	driver := &mockDriver{
+		foreignKeys: []database.ForeignKey{
+			{Table: "orders", Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id"},
+			{Table: "order_items", Column: "order_id", ReferencedTable: "orders", ReferencedColumn: "id"},
+			{Table: "order_items", Column: "product_id", ReferencedTable: "products", ReferencedColumn: "id"},
+		},
+		orphans: map[string]int64{"orders.user_id": 3, "order_items.product_id": 1},
+	}
+
+	orphaned, err := NewAnalyser(driver).FindOrphanedForeignKeys()
+	if err != nil {
+		t.Fatalf("FindOrphanedForeignKeys() error = %v", err)
+	}
+
+	want := []OrphanedForeignKey{
+		{ForeignKey: driver.foreignKeys[2], Rows: 1},
+		{ForeignKey: driver.foreignKeys[0], Rows: 3},
+	}
+	if !reflect.DeepEqual(orphaned, want) {
+		t.Errorf("FindOrphanedForeignKeys() = %+v, want %+v", orphaned, want)
+	}
+}
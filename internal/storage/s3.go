@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultS3Endpoint is used when S3_ENDPOINT is not set.
+	DefaultS3Endpoint = "s3.amazonaws.com"
+
+	// S3PartSize is the multipart upload part size (64MB), which bounds the
+	// memory used while streaming an upload of unknown length.
+	S3PartSize = 64 * 1024 * 1024
+)
+
+// S3Location identifies an object in an S3-compatible store.
+type S3Location struct {
+	Bucket string
+	Key    string
+}
+
+// ParseS3URL parses an s3://bucket/key URL.
+// Returns false if the path is not an s3:// URL.
+func ParseS3URL(path string) (S3Location, bool, error) {
+	if !strings.HasPrefix(path, "s3://") {
+		return S3Location{}, false, nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return S3Location{}, true, fmt.Errorf("invalid S3 URL %q: %w", path, err)
+	}
+
+	loc := S3Location{
+		Bucket: u.Host,
+		Key:    strings.TrimPrefix(u.Path, "/"),
+	}
+	if loc.Bucket == "" || loc.Key == "" {
+		return S3Location{}, true, fmt.Errorf("invalid S3 URL %q: expected s3://bucket/key", path)
+	}
+
+	return loc, true, nil
+}
+
+// Uploader uploads a stream of unknown length to an object store.
+type Uploader interface {
+	Upload(ctx context.Context, bucket, key string, body io.Reader) error
+}
+
+// S3Writer is an io.WriteCloser that streams everything written to it into an
+// object store upload. Close must be called to complete the upload.
+type S3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewS3Writer starts an upload to loc and returns a writer feeding it.
+func NewS3Writer(ctx context.Context, uploader Uploader, loc S3Location) *S3Writer {
+	pr, pw := io.Pipe()
+	w := &S3Writer{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		err := uploader.Upload(ctx, loc.Bucket, loc.Key, pr)
+		// Unblock any pending Write if the upload stopped early
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w
+}
+
+// Write sends p to the upload.
+func (w *S3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close finishes the upload and returns any upload error.
+func (w *S3Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort cancels the upload so that no partial object is stored.
+func (w *S3Writer) Abort(cause error) error {
+	w.pw.CloseWithError(cause)
+	return <-w.done
+}
+
+// MinioUploader uploads to an S3-compatible store using the MinIO client.
+type MinioUploader struct {
+	client *minio.Client
+}
+
+// NewMinioUploaderFromEnv creates an uploader using credentials from the
+// environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN or
+// MINIO_ACCESS_KEY, MINIO_SECRET_KEY). S3_ENDPOINT and AWS_REGION select the
+// store, and S3_INSECURE=true disables TLS.
+func NewMinioUploaderFromEnv() (*MinioUploader, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = DefaultS3Endpoint
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		}),
+		Region: os.Getenv("AWS_REGION"),
+		Secure: os.Getenv("S3_INSECURE") != "true",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &MinioUploader{client: client}, nil
+}
+
+// Upload streams body to bucket/key using a multipart upload.
+func (u *MinioUploader) Upload(ctx context.Context, bucket, key string, body io.Reader) error {
+	_, err := u.client.PutObject(ctx, bucket, key, body, -1, minio.PutObjectOptions{
+		ContentType: "application/sql",
+		PartSize:    S3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
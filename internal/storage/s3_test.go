@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// mockUploader captures the bytes streamed to it
+type mockUploader struct {
+	bucket string
+	key    string
+	body   bytes.Buffer
+	err    error
+}
+
+func (m *mockUploader) Upload(ctx context.Context, bucket, key string, body io.Reader) error {
+	m.bucket = bucket
+	m.key = key
+	if _, err := io.Copy(&m.body, body); err != nil {
+		return err
+	}
+	return m.err
+}
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    S3Location
+		wantS3  bool
+		wantErr bool
+	}{
+		{name: "bucket and key", path: "s3://dumps/prod/2024/dump.sql", want: S3Location{Bucket: "dumps", Key: "prod/2024/dump.sql"}, wantS3: true},
+		{name: "local file", path: "dump.sql", wantS3: false},
+		{name: "empty", path: "", wantS3: false},
+		{name: "missing key", path: "s3://dumps", wantS3: true, wantErr: true},
+		{name: "missing bucket", path: "s3:///dump.sql", wantS3: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, isS3, err := ParseS3URL(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseS3URL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if isS3 != tt.wantS3 {
+				t.Errorf("ParseS3URL() isS3 = %v, want %v", isS3, tt.wantS3)
+			}
+			if got != tt.want {
+				t.Errorf("ParseS3URL() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Writer(t *testing.T) {
+	t.Run("streams all bytes to uploader", func(t *testing.T) {
+		uploader := &mockUploader{}
+		w := NewS3Writer(context.Background(), uploader, S3Location{Bucket: "dumps", Key: "dump.sql"})
+
+		chunks := []string{"-- Database Dump\n", "CREATE TABLE users;\n", strings.Repeat("x", 100000)}
+		for _, chunk := range chunks {
+			if _, err := w.Write([]byte(chunk)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		if uploader.bucket != "dumps" || uploader.key != "dump.sql" {
+			t.Errorf("uploaded to %s/%s, want dumps/dump.sql", uploader.bucket, uploader.key)
+		}
+		if got, want := uploader.body.String(), strings.Join(chunks, ""); got != want {
+			t.Errorf("uploaded %d bytes, want %d", len(got), len(want))
+		}
+	})
+
+	t.Run("upload error returned from Close", func(t *testing.T) {
+		uploadErr := errors.New("access denied")
+		uploader := &mockUploader{err: uploadErr}
+		w := NewS3Writer(context.Background(), uploader, S3Location{Bucket: "dumps", Key: "dump.sql"})
+
+		w.Write([]byte("data"))
+		if err := w.Close(); !errors.Is(err, uploadErr) {
+			t.Errorf("Close() error = %v, want %v", err, uploadErr)
+		}
+	})
+
+	t.Run("abort fails the upload", func(t *testing.T) {
+		uploader := &mockUploader{}
+		w := NewS3Writer(context.Background(), uploader, S3Location{Bucket: "dumps", Key: "dump.sql"})
+
+		w.Write([]byte("partial"))
+		exportErr := errors.New("export failed")
+		if err := w.Abort(exportErr); !errors.Is(err, exportErr) {
+			t.Errorf("Abort() error = %v, want %v", err, exportErr)
+		}
+	})
+}
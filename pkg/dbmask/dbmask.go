@@ -0,0 +1,329 @@
+// Package dbmask exports anonymised, minimised database dumps from Go
+// programs. It wires together the same steps as the dbmask command:
+// connect, analyse the schema, sort the tables and export them.
+package dbmask
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/anonymiser"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/database"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/exporter"
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/schema"
+)
+
+// Config is a dbmask configuration, as read from a config file by LoadConfig.
+type Config = config.Config
+
+// ExportOptions configures how tables are written to the dump.
+type ExportOptions = exporter.Options
+
+// TableInfo describes a table found by schema analysis.
+type TableInfo = schema.TableInfo
+
+// SortOrder is the order tables are exported in.
+type SortOrder = schema.SortOrder
+
+// QuoteMode controls when identifiers are quoted.
+type QuoteMode = database.QuoteMode
+
+// ConsistencyStore holds the fake given to each original value, so that the
+// same original is always replaced by the same fake.
+type ConsistencyStore = anonymiser.ConsistencyStore
+
+// Sort orders for Options.SortOrder.
+const (
+	SortDependency = schema.SortDependency
+	SortAlpha      = schema.SortAlpha
+	SortNone       = schema.SortNone
+)
+
+// Identifier quoting modes for Options.QuoteMode.
+const (
+	QuoteAlways  = database.QuoteAlways
+	QuoteMinimal = database.QuoteMinimal
+)
+
+// ErrEmptyExport is returned by Export when ExportOptions.FailIfEmpty is set
+// and no rows were exported.
+var ErrEmptyExport = exporter.ErrEmptyExport
+
+// LoadConfig reads and validates a YAML or JSON config file.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// FileStore is a ConsistencyStore kept in a file. Close it after the export
+// to write the last of its values.
+type FileStore interface {
+	ConsistencyStore
+	Close() error
+}
+
+// NewSQLiteStore opens or creates a FileStore in a SQLite file.
+func NewSQLiteStore(path string) (FileStore, error) {
+	store, err := anonymiser.NewSQLiteStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Options configures Export.
+type Options struct {
+	// Export configures the dump. ZeroDates and DumpCharset are taken from
+	// the config's connection, and NonFiniteFloats from the config. The
+	// progress messages of Export.Verbose and the warnings about policy table
+	// rules are written to Export.Log, which defaults to os.Stderr so that
+	// they stay out of a dump written to os.Stdout.
+	Export ExportOptions
+
+	// SortOrder is the order tables are exported in. Defaults to
+	// SortDependency, which restores without foreign key errors.
+	SortOrder SortOrder
+
+	// QuoteMode controls when identifiers are quoted. Defaults to QuoteAlways.
+	QuoteMode QuoteMode
+
+	// DryRun analyses and sorts the tables without exporting them. Nothing
+	// is written, and Stats.Tables lists the tables that would be exported.
+	DryRun bool
+
+	// ConsistencyStore holds the fakes given to original values. Defaults to
+	// a store in memory for this export; a persistent store, such as one
+	// from NewSQLiteStore, keeps fakes consistent between exports.
+	ConsistencyStore ConsistencyStore
+
+	// OnlyAnonymised exports only the tables with anonymisation rules, and
+	// the tables they reference, directly or through other tables, so that
+	// the dump restores without foreign key errors. Every other table is
+	// left out of the dump, for sanitised samples.
+	OnlyAnonymised bool
+
+	// Strict refuses to export when the rules read from the config's policy
+	// table have warnings, such as an unknown faker. The warnings are written
+	// to Export.Log either way.
+	Strict bool
+}
+
+// Stats reports the outcome of an export.
+type Stats struct {
+	exporter.Stats
+
+	// Config is the config the tables were exported with: the config given
+	// to Export, with the rules of its policy table merged in, if it has one.
+	Config *Config
+
+	Tables           []TableInfo   // Tables in the order they were exported
+	AnalysisDuration time.Duration // Time spent analysing the schema
+	SortDuration     time.Duration // Time spent sorting the tables
+}
+
+// Export connects to the database in cfg, analyses and sorts its tables, and
+// writes an anonymised dump of them to w. Cancelling ctx aborts the export
+// at its next write. In safe mode, hosts refused by cfg are not connected to.
+// The rules of cfg's policy table, if it has one, are merged into a copy of
+// cfg for the export, leaving cfg unchanged.
+func Export(ctx context.Context, cfg *Config, w io.Writer, opts Options) (Stats, error) {
+	var stats Stats
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	sortOrder := opts.SortOrder
+	if sortOrder == "" {
+		sortOrder = SortDependency
+	}
+
+	if err := cfg.CheckHost(); err != nil {
+		return stats, err
+	}
+
+	log := opts.Export.Log
+	if log == nil {
+		log = os.Stderr
+	}
+
+	if opts.Export.Verbose {
+		fmt.Fprintf(log, "Connecting to %s...\n", cfg.Connection.SafeString())
+	}
+
+	driver, err := database.NewDriver(cfg.Connection.Type)
+	if err != nil {
+		return stats, err
+	}
+	if setter, ok := driver.(database.QuoteModeSetter); ok && opts.QuoteMode != "" {
+		setter.SetQuoteMode(opts.QuoteMode)
+	}
+
+	if err := driver.Connect(&cfg.Connection); err != nil {
+		return stats, err
+	}
+	defer driver.Close()
+
+	// Merge the rules kept in the database itself
+	if cfg.PolicyTable != "" {
+		rules, err := database.ReadPolicy(driver, cfg.PolicyTable)
+		if err != nil {
+			return stats, err
+		}
+		merged, err := cfg.MergePolicy(rules)
+		if err != nil {
+			return stats, err
+		}
+		if err := checkPolicyRules(log, cfg, merged, opts.Strict); err != nil {
+			return stats, err
+		}
+		cfg = merged
+	}
+	stats.Config = cfg
+
+	if opts.Export.Verbose {
+		if version, err := driver.GetServerVersion(); err == nil {
+			fmt.Fprintf(log, "Server version: %s\n", version)
+		}
+		fmt.Fprintln(log, "Analyzing database schema...")
+	}
+
+	analysisStart := time.Now()
+	analyzer := schema.NewAnalyser(driver)
+	analyzer.SetGroups(cfg.TableGroups())
+	tables, err := analyzer.GetAllTables()
+	if err != nil {
+		return stats, fmt.Errorf("failed to analyze schema: %w", err)
+	}
+	stats.AnalysisDuration = time.Since(analysisStart)
+
+	if opts.Export.Verbose && sortOrder == SortDependency {
+		fmt.Fprintln(log, "Sorting tables by foreign key dependencies...")
+	}
+
+	sortStart := time.Now()
+	stats.Tables, err = analyzer.SortTables(tables, sortOrder)
+	if err != nil {
+		return stats, fmt.Errorf("failed to sort tables: %w", err)
+	}
+	stats.SortDuration = time.Since(sortStart)
+
+	anon := anonymiser.New(cfg)
+	if opts.OnlyAnonymised {
+		fks, err := driver.GetForeignKeys()
+		if err != nil {
+			return stats, fmt.Errorf("failed to get foreign keys: %w", err)
+		}
+		stats.Tables = anonymisedTables(stats.Tables, anon, fks)
+	}
+
+	if opts.DryRun {
+		return stats, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	if opts.Export.Verbose {
+		fmt.Fprintf(log, "Exporting %d tables...\n", len(stats.Tables))
+	}
+
+	exportOpts := opts.Export
+	exportOpts.Log = log
+	exportOpts.ZeroDates = cfg.Connection.ZeroDates
+	exportOpts.DumpCharset = cfg.Connection.Charset
+	exportOpts.NonFiniteFloats = cfg.NonFiniteFloats
+	if exportOpts.NDJSON != nil {
+		exportOpts.NDJSON = &contextWriter{ctx: ctx, w: exportOpts.NDJSON}
+	}
+
+	if opts.ConsistencyStore != nil {
+		anon.SetConsistencyStore(opts.ConsistencyStore)
+	}
+
+	exp := exporter.New(driver, anon, &contextWriter{ctx: ctx, w: w}, exportOpts)
+	err = exp.Export(stats.Tables)
+	stats.Stats = exp.GetStats()
+	if err != nil {
+		return stats, fmt.Errorf("export failed: %w", err)
+	}
+
+	return stats, nil
+}
+
+// checkPolicyRules validates the rules merged from the policy table of cfg,
+// which the config's own validation never saw. Their warnings are written to
+// log, and returned as an error if strict.
+func checkPolicyRules(log io.Writer, cfg, merged *Config, strict bool) error {
+	known := make(map[string]bool)
+	for _, warning := range anonymiser.New(cfg).ValidateRules() {
+		known[warning] = true
+	}
+
+	var warnings []string
+	for _, warning := range anonymiser.New(merged).ValidateRules() {
+		if !known[warning] {
+			warnings = append(warnings, warning)
+		}
+	}
+	sort.Strings(warnings)
+
+	for _, warning := range warnings {
+		fmt.Fprintf(log, "Warning: policy table %s: %s\n", cfg.PolicyTable, warning)
+	}
+	if strict && len(warnings) > 0 {
+		return fmt.Errorf("%d anonymisation rule warnings in policy table %s (strict)", len(warnings), cfg.PolicyTable)
+	}
+	return nil
+}
+
+// anonymisedTables returns the tables that have anonymisation rules and the
+// tables they reference through fks, transitively, in order.
+func anonymisedTables(tables []TableInfo, anon *anonymiser.Anonymiser, fks []database.ForeignKey) []TableInfo {
+	parents := make(map[string][]string)
+	for _, fk := range fks {
+		parents[fk.Table] = append(parents[fk.Table], fk.ReferencedTable)
+	}
+
+	keep := make(map[string]bool)
+	var add func(table string)
+	add = func(table string) {
+		if keep[table] {
+			return
+		}
+		keep[table] = true
+		for _, parent := range parents[table] {
+			add(parent)
+		}
+	}
+	for _, table := range tables {
+		if anon.HasAnonymisation(table.Name) {
+			add(table.Name)
+		}
+	}
+
+	var anonymised []TableInfo
+	for _, table := range tables {
+		if keep[table.Name] {
+			anonymised = append(anonymised, table)
+		}
+	}
+	return anonymised
+}
+
+// contextWriter fails writes once its context is done, so that cancelling
+// the context stops an export at its next flush.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
@@ -0,0 +1,530 @@
+package dbmask
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elliotjreed/database-anonymiser-minimiser/internal/config"
+)
+
+// newTestDB creates an in-memory SQLite database from queries, kept alive
+// until the test ends, and returns the DSN that Export can connect to it with.
+func newTestDB(t *testing.T, queries ...string) string {
+	t.Helper()
+
+	// A shared cache lets Export's own connection see the same database
+	dsn := "file:" + strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()) + "?mode=memory&cache=shared"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("failed to execute %q: %v", q, err)
+		}
+	}
+
+	return dsn
+}
+
+// newTestConfig creates a database of users and their orders, and a config
+// that connects to it and anonymises users' emails.
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	dsn := newTestDB(t,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id), amount REAL)`,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)`,
+		`INSERT INTO users (id, email) VALUES (1, 'alice@real.example'), (2, 'bob@real.example')`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (1, 1, 9.99), (2, 2, 5.00), (3, 1, 1.50)`,
+	)
+
+	return &Config{
+		Connection: config.Connection{Type: "sqlite", File: dsn},
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Run("exports anonymised tables in dependency order", func(t *testing.T) {
+		var buf bytes.Buffer
+		stats, err := Export(context.Background(), newTestConfig(t), &buf, Options{})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if stats.TablesExported != 2 || stats.RowsExported != 5 {
+			t.Errorf("stats = %d tables, %d rows, want 2 tables, 5 rows", stats.TablesExported, stats.RowsExported)
+		}
+		if len(stats.Tables) != 2 || stats.Tables[0].Name != "users" {
+			t.Errorf("Tables = %+v, want users before orders", stats.Tables)
+		}
+
+		output := buf.String()
+		if strings.Contains(output, "real.example") {
+			t.Errorf("output contains original emails:\n%s", output)
+		}
+		if strings.Index(output, `INSERT INTO "users"`) > strings.Index(output, `INSERT INTO "orders"`) {
+			t.Errorf("users should be inserted before orders:\n%s", output)
+		}
+	})
+
+	t.Run("dry run writes nothing", func(t *testing.T) {
+		var buf bytes.Buffer
+		stats, err := Export(context.Background(), newTestConfig(t), &buf, Options{DryRun: true, SortOrder: SortAlpha})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if buf.Len() != 0 {
+			t.Errorf("dry run wrote %d bytes", buf.Len())
+		}
+		if len(stats.Tables) != 2 || stats.Tables[0].Name != "orders" {
+			t.Errorf("Tables = %+v, want orders and users in alphabetical order", stats.Tables)
+		}
+	})
+
+	t.Run("only anonymised tables", func(t *testing.T) {
+		var buf bytes.Buffer
+		stats, err := Export(context.Background(), newTestConfig(t), &buf, Options{OnlyAnonymised: true})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if stats.TablesExported != 1 || stats.RowsExported != 2 {
+			t.Errorf("stats = %d tables, %d rows, want 1 table, 2 rows", stats.TablesExported, stats.RowsExported)
+		}
+		if len(stats.Tables) != 1 || stats.Tables[0].Name != "users" {
+			t.Errorf("Tables = %+v, want only users", stats.Tables)
+		}
+		if output := buf.String(); strings.Contains(output, `"orders"`) || !strings.Contains(output, `INSERT INTO "users"`) {
+			t.Errorf("output should hold users and not orders:\n%s", output)
+		}
+	})
+
+	t.Run("only anonymised tables keeps the tables they reference", func(t *testing.T) {
+		cfg := newTestConfig(t)
+		cfg.Configuration = map[string]*config.TableConfig{
+			"orders": {Columns: config.ColumnRuleMap{"amount": config.Rule("0")}},
+		}
+
+		var buf bytes.Buffer
+		stats, err := Export(context.Background(), cfg, &buf, Options{OnlyAnonymised: true})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		if len(stats.Tables) != 2 || stats.Tables[0].Name != "users" || stats.Tables[1].Name != "orders" {
+			t.Errorf("Tables = %+v, want users, which orders references, then orders", stats.Tables)
+		}
+		if output := buf.String(); !strings.Contains(output, `INSERT INTO "users"`) {
+			t.Errorf("output should hold the users orders reference:\n%s", output)
+		}
+	})
+
+	t.Run("consistency store keeps fakes between exports", func(t *testing.T) {
+		cfg := newTestConfig(t)
+		path := filepath.Join(t.TempDir(), "consistency.db")
+
+		export := func() string {
+			store, err := NewSQLiteStore(path)
+			if err != nil {
+				t.Fatalf("NewSQLiteStore() error = %v", err)
+			}
+			var buf bytes.Buffer
+			if _, err := Export(context.Background(), cfg, &buf, Options{ConsistencyStore: store}); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			return buf.String()
+		}
+
+		first, second := export(), export()
+		if first != second {
+			t.Errorf("second export differs from the first:\n%s\n---\n%s", first, second)
+		}
+	})
+
+	t.Run("verbose progress goes to the log", func(t *testing.T) {
+		var buf, log bytes.Buffer
+		opts := Options{Export: ExportOptions{Verbose: true, Log: &log}}
+		if _, err := Export(context.Background(), newTestConfig(t), &buf, opts); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+
+		for _, want := range []string{"Connecting to", "Exporting 2 tables", "Exporting table: users"} {
+			if !strings.Contains(log.String(), want) {
+				t.Errorf("log = %q, want it to contain %q", log.String(), want)
+			}
+		}
+		if strings.Contains(buf.String(), "Connecting to") {
+			t.Error("progress should not be written to the dump")
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := Export(ctx, newTestConfig(t), &bytes.Buffer{}, Options{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Export() error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("unsupported database", func(t *testing.T) {
+		cfg := &Config{Connection: config.Connection{Type: "oracle"}}
+
+		if _, err := Export(context.Background(), cfg, &bytes.Buffer{}, Options{}); err == nil {
+			t.Error("Export() expected error for unsupported database")
+		}
+	})
+}
+
+func TestExport_PolicyTable(t *testing.T) {
+	dsn := newTestDB(t,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, password TEXT)`,
+		`CREATE TABLE dbmask_policy (table_name TEXT, column_name TEXT, rule TEXT)`,
+		`INSERT INTO users (id, email, password) VALUES (1, 'alice@real.example', 'hunter2')`,
+		`INSERT INTO dbmask_policy (table_name, column_name, rule) VALUES ('users', 'password', 'null')`,
+	)
+
+	// The config file anonymises emails, and the policy table passwords
+	cfg := &Config{
+		Connection:  config.Connection{Type: "sqlite", File: dsn},
+		PolicyTable: "dbmask_policy",
+		Configuration: map[string]*config.TableConfig{
+			"users": {Columns: config.ColumnRuleMap{"email": config.Rule("{{faker.email}}")}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), cfg, &buf, Options{}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "real.example") || strings.Contains(output, "hunter2") {
+		t.Errorf("output contains original values:\n%s", output)
+	}
+	if !strings.Contains(output, ", NULL)") {
+		t.Errorf("output should contain the NULL password:\n%s", output)
+	}
+	if _, ok := cfg.ColumnRules("users")["password"]; ok {
+		t.Errorf("rules = %v, want the config left without the policy table's rules", cfg.ColumnRules("users"))
+	}
+
+	// The config can be exported again
+	if _, err := Export(context.Background(), cfg, &bytes.Buffer{}, Options{}); err != nil {
+		t.Errorf("second Export() error = %v", err)
+	}
+
+	// Warnings about the policy table's rules are errors with Strict
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO dbmask_policy (table_name, column_name, rule) VALUES ('users', 'id', '{{faker.nosuchfaker}}')`); err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	if _, err := Export(context.Background(), cfg, &bytes.Buffer{}, Options{Strict: true, Export: ExportOptions{Log: &log}}); err == nil || !strings.Contains(err.Error(), "warnings in policy table dbmask_policy") {
+		t.Errorf("Export() error = %v, want the policy table's rule warnings", err)
+	}
+	if !strings.Contains(log.String(), "Warning: policy table dbmask_policy") {
+		t.Errorf("log = %q, want the policy table's rule warnings", log.String())
+	}
+	if _, err := db.Exec(`DELETE FROM dbmask_policy WHERE column_name = 'id'`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rule in both the config and the policy table is refused
+	cfg.Configuration["users"].Columns = config.ColumnRuleMap{"password": config.Rule("{{faker.password}}")}
+	if _, err := Export(context.Background(), cfg, &bytes.Buffer{}, Options{}); err == nil {
+		t.Error("Export() expected error for a column in both the config and the policy table")
+	}
+}
+
+func TestExport_FailIfEmpty(t *testing.T) {
+	dsn := newTestDB(t,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id))`,
+	)
+	cfg := &Config{Connection: config.Connection{Type: "sqlite", File: dsn}}
+
+	tests := []struct {
+		name    string
+		opts    ExportOptions
+		wantErr bool
+	}{
+		{name: "empty database", opts: ExportOptions{FailIfEmpty: true}, wantErr: true},
+		{name: "without the guard", opts: ExportOptions{}},
+		{name: "schema only", opts: ExportOptions{FailIfEmpty: true, SchemaOnly: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			stats, err := Export(context.Background(), cfg, &buf, Options{Export: tt.opts})
+			if got := errors.Is(err, ErrEmptyExport); got != tt.wantErr {
+				t.Fatalf("Export() error = %v, want ErrEmptyExport %v", err, tt.wantErr)
+			}
+			if stats.TablesExported != 2 || stats.RowsExported != 0 {
+				t.Errorf("stats = %d tables, %d rows, want 2 tables and no rows", stats.TablesExported, stats.RowsExported)
+			}
+		})
+	}
+
+	// Any row at all satisfies the guard
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO users (id, email) VALUES (1, 'alice@real.example')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Export(context.Background(), cfg, &bytes.Buffer{}, Options{Export: ExportOptions{FailIfEmpty: true}}); err != nil {
+		t.Errorf("Export() error = %v, want none with a row exported", err)
+	}
+}
+
+func TestExport_RetainFollow(t *testing.T) {
+	dsn := newTestDB(t,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id), amount REAL)`,
+		`CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO users (id, email) VALUES (1, 'a@example.com'), (2, 'b@example.com'), (3, 'c@example.com')`,
+		`INSERT INTO orders (id, user_id, amount) VALUES (10, 1, 9.99), (11, 3, 5.00), (12, 2, 1.50), (13, 3, 2.00), (14, NULL, 3.00)`,
+		`INSERT INTO products (id, name) VALUES (1, 'Widget'), (2, 'Gadget')`,
+	)
+
+	// Users are limited to the first two; orders follow them
+	cfg := &Config{
+		Connection: config.Connection{Type: "sqlite", File: dsn},
+		Configuration: map[string]*config.TableConfig{
+			"users":  {Retain: config.RetainConfig{Count: 2}},
+			"orders": {Retain: config.RetainConfig{Follow: "users"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	stats, err := Export(context.Background(), cfg, &buf, Options{})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"(10, 1, 9.99)", "(12, 2, 1.5)", "(14, NULL, 3)", "'Gadget'"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %s:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"(3, 'c@example.com')", "(11, 3,", "(13, 3,"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %s:\n%s", unwanted, output)
+		}
+	}
+
+	// 2 users, 3 orders and 2 products
+	if stats.RowsExported != 7 || stats.RowsFiltered != 2 {
+		t.Errorf("RowsExported = %d, RowsFiltered = %d, want 7 and 2", stats.RowsExported, stats.RowsFiltered)
+	}
+}
+
+func TestExport_RetainFollow_NaturalKey(t *testing.T) {
+	// Cities reference countries by code, one column naming it and one not
+	dsn := newTestDB(t,
+		`CREATE TABLE countries (code TEXT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE cities (id INTEGER PRIMARY KEY, country_code TEXT REFERENCES countries(code), name TEXT)`,
+		`CREATE TABLE airports (id INTEGER PRIMARY KEY, country TEXT REFERENCES countries, iata TEXT)`,
+		`INSERT INTO countries (code, name) VALUES ('FR', 'France'), ('GB', 'United Kingdom'), ('US', 'United States')`,
+		`INSERT INTO cities (id, country_code, name) VALUES (1, 'FR', 'Paris'), (2, 'US', 'Boston'), (3, 'GB', 'Leeds')`,
+		`INSERT INTO airports (id, country, iata) VALUES (1, 'US', 'BOS'), (2, 'GB', 'LBA'), (3, 'FR', 'CDG')`,
+	)
+
+	cfg := &Config{
+		Connection: config.Connection{Type: "sqlite", File: dsn},
+		Configuration: map[string]*config.TableConfig{
+			"countries": {Retain: config.RetainConfig{Count: 2}},
+			"cities":    {Retain: config.RetainConfig{Follow: "countries"}},
+			"airports":  {Retain: config.RetainConfig{Follow: "countries"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	stats, err := Export(context.Background(), cfg, &buf, Options{Export: ExportOptions{VerifyFK: true}})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	// Count retains keep the first two countries by key
+	output := buf.String()
+	for _, want := range []string{"'France'", "'United Kingdom'", "'Paris'", "'Leeds'", "'LBA'", "'CDG'"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %s:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"'United States'", "'Boston'", "'BOS'"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %s:\n%s", unwanted, output)
+		}
+	}
+	if stats.RowsFiltered != 2 || len(stats.Orphans) != 0 {
+		t.Errorf("RowsFiltered = %d, Orphans = %v, want 2 and none", stats.RowsFiltered, stats.Orphans)
+	}
+}
+
+func TestExport_ParamsRoundTrip(t *testing.T) {
+	dsn := newTestDB(t, `CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, amount REAL, big INTEGER)`)
+	source := [][]any{
+		{int64(1), "plain text", 1.5, int64(1)},
+		{int64(2), "it's 'quoted'", 0.1, int64(-42)},
+		{int64(3), `back\slash and \n as text`, nil, int64(9007199254740993)},
+		{int64(4), "line\nbreak\r\n", 1e-7, nil},
+		{int64(5), "nul\x00byte and \x1a", -3.25, int64(0)},
+		{int64(6), "emoji 😀 and ünïcode", 100.0, int64(7)},
+		{int64(7), nil, nil, nil},
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	defer db.Close()
+	for _, row := range source {
+		if _, err := db.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?)`, row...); err != nil {
+			t.Fatalf("failed to insert %v: %v", row, err)
+		}
+	}
+
+	cfg := &Config{Connection: config.Connection{Type: "sqlite", File: dsn}}
+	var dump, params bytes.Buffer
+	if _, err := Export(context.Background(), cfg, &dump, Options{Export: ExportOptions{Params: &params}}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	// restore loads an export into an empty database and returns its rows
+	restore := func(load func(db *sql.DB) error) [][]any {
+		t.Helper()
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		if err := load(db); err != nil {
+			t.Fatalf("failed to load export: %v", err)
+		}
+		return readNotes(t, db)
+	}
+
+	inline := restore(func(db *sql.DB) error {
+		_, err := db.Exec(dump.String())
+		return err
+	})
+	bound := restore(func(db *sql.DB) error {
+		if _, err := db.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, amount REAL, big INTEGER)`); err != nil {
+			return err
+		}
+		return replayParams(db, params.String())
+	})
+
+	// Bound parameters keep every value; inline literals are only compared
+	// for values without characters the dump escapes
+	want := readNotes(t, db)
+	for i := range want {
+		if !reflect.DeepEqual(bound[i], want[i]) {
+			t.Errorf("params row %d = %q, want %q", i+1, bound[i], want[i])
+		}
+	}
+	for _, i := range []int{0, 1, 5, 6} {
+		if !reflect.DeepEqual(inline[i], want[i]) {
+			t.Errorf("inline row %d = %q, want %q", i+1, inline[i], want[i])
+		}
+	}
+	if len(bound) != len(source) || len(inline) != len(source) {
+		t.Errorf("restored %d rows from params and %d inline, want %d", len(bound), len(inline), len(source))
+	}
+}
+
+// readNotes returns the rows of the notes table in id order.
+func readNotes(t *testing.T, db *sql.DB) [][]any {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT id, body, amount, big FROM notes ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to read notes: %v", err)
+	}
+	defer rows.Close()
+
+	var notes [][]any
+	for rows.Next() {
+		values := make([]any, 4)
+		ptrs := make([]any, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatalf("failed to scan notes: %v", err)
+		}
+		notes = append(notes, values)
+	}
+	return notes
+}
+
+// replayParams executes params output against db, binding each line of
+// values to the statement before it.
+func replayParams(db *sql.DB, params string) error {
+	var stmt *sql.Stmt
+	for _, line := range strings.Split(strings.TrimSuffix(params, "\n"), "\n") {
+		if strings.HasPrefix(line, "{") {
+			var statement struct {
+				Statement string `json:"statement"`
+			}
+			if err := json.Unmarshal([]byte(line), &statement); err != nil {
+				return err
+			}
+			var err error
+			if stmt, err = db.Prepare(statement.Statement); err != nil {
+				return err
+			}
+			defer stmt.Close()
+			continue
+		}
+
+		var values []any
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return err
+		}
+		for i, val := range values {
+			if n, ok := val.(json.Number); ok {
+				if integer, err := n.Int64(); err == nil {
+					values[i] = integer
+				} else {
+					values[i], _ = n.Float64()
+				}
+			}
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}